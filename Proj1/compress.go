@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Whether cached responses are gzipped before they are saved to the database (COMPRESS_CACHE=true)
+// Compressed and uncompressed rows can always be read, so this can be turned on or off at any time
+var compressCache = strings.Trim(os.Getenv("COMPRESS_CACHE"), "'\"") == "true"
+
+// Every gzip stream starts with these bytes, which JSON never does
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Turns the response into the value stored in the data column (gzipped JSON if COMPRESS_CACHE=true)
+func encodeStored(resp NewsAPIResponse) (any, error) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	if !compressCache {
+		return string(data), nil
+	}
+	return gzipBytes(data)
+}
+
+// Reads a value from the data column into the response, gunzipping it first if it was compressed
+func decodeStored(data string, resp *NewsAPIResponse) error {
+	raw := []byte(data)
+	if bytes.HasPrefix(raw, gzipMagic) {
+		reader, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return err
+		}
+		raw, err = io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(raw, resp)
+}
+
+// Compresses the data with gzip
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Compresses every row that was saved before COMPRESS_CACHE was turned on, then prints how much space the cache saves
+func migrateCompression() {
+	if !compressCache {
+		return
+	}
+
+	// Read every row first, since the single SQLite connection can't update while rows are open
+	stored, err := store.Rows()
+	check(err)
+
+	migrated := 0
+	var storedBytes, originalBytes int
+	for _, r := range stored {
+		var original []byte
+		if bytes.HasPrefix([]byte(r.Data), gzipMagic) {
+			// Already compressed, so only its original size is needed for the report
+			reader, err := gzip.NewReader(strings.NewReader(r.Data))
+			if err == nil {
+				original, err = io.ReadAll(reader)
+			}
+			if err != nil {
+				recordFailure(&CacheError{Op: "read", Query: r.Query, Err: err})
+				continue
+			}
+			storedBytes += len(r.Data)
+			originalBytes += len(original)
+			continue
+		}
+
+		compressed, err := gzipBytes([]byte(r.Data))
+		if err == nil {
+			err = store.UpdateData(r, compressed)
+		}
+		if err != nil {
+			recordFailure(&CacheError{Op: "write", Query: r.Query, Err: err})
+			continue
+		}
+		migrated++
+		storedBytes += len(compressed)
+		originalBytes += len(r.Data)
+	}
+
+	fmt.Printf("Cache compression: compressed %d existing rows. %d rows take %s instead of %s",
+		migrated, len(stored), formatBytes(storedBytes), formatBytes(originalBytes))
+	if originalBytes > 0 {
+		fmt.Printf(" (%.0f%% smaller)", 100-float64(storedBytes)/float64(originalBytes)*100)
+	}
+	fmt.Println(".")
+}
+
+// Formats a number of bytes for the size report (Ex: 1.5 MB)
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Parses an explicit date range (Ex: "from=2025-01-01,to=2025-01-31"), returning its first and last date
+// The "to" date is optional, and an empty "to" means up to today
+// A range that ends today or later is returned without a "to", so it shares the cache with "days ago" requests
+func parseDateRange(value string) (string, string, error) {
+	var from, to string
+
+	for _, part := range strings.Split(value, ",") {
+		key, date, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return "", "", fmt.Errorf("'%s' is not 'from=YYYY-MM-DD' or 'to=YYYY-MM-DD'", part)
+		}
+		date = strings.TrimSpace(date)
+
+		// Dates must be real dates in the YYYY-MM-DD format
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return "", "", fmt.Errorf("'%s' is not a date in the YYYY-MM-DD format", date)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "from":
+			from = date
+		case "to":
+			to = date
+		default:
+			return "", "", fmt.Errorf("'%s' is not 'from' or 'to'", key)
+		}
+	}
+
+	if from == "" {
+		return "", "", fmt.Errorf("a date range needs a 'from' date")
+	}
+	if to != "" && to < from {
+		return "", "", fmt.Errorf("the 'to' date (%s) is before the 'from' date (%s)", to, from)
+	}
+
+	// Today is the user's today (in TIMEZONE), not the server's
+	if to >= userToday().Format("2006-01-02") {
+		to = ""
+	}
+
+	return from, to, nil
+}
+
+// Returns whether the cached request's date range has every day of the request's range
+// An empty "to" means up to today, so it covers any range that ends before today too
+func coversRange(cached, request SearchRequest) bool {
+	if cached.Days > request.Days {
+		return false
+	}
+	return cached.To == "" || (request.To != "" && cached.To >= request.To)
+}
+
+// Returns whether a's date range ends later than b's (an empty "to" is today, so it ends latest)
+func endsLater(a, b SearchRequest) bool {
+	if a.To == "" || b.To == "" {
+		return a.To == "" && b.To != ""
+	}
+	return a.To > b.To
+}
+
+// Returns the date range as it is shown with the results (Ex: "2025-01-01" or "2025-01-01 to 2025-01-31")
+func dateRangeText(from, to string) string {
+	if to == "" {
+		return from
+	}
+	return from + " to " + to
+}
+
+// Rebuilds the articles table of a database made before date ranges existed, adding the to_date column to its key
+// Every row that was already cached covers up to the day it was fetched, so it gets an empty to_date
+// Only SQLite databases need this, since PostgreSQL databases were always made with the to_date column
+func migrateDateRanges(db *sql.DB) error {
+	var hasColumn int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('articles') WHERE name = 'to_date'`).Scan(&hasColumn)
+	if err != nil || hasColumn > 0 {
+		return err
+	}
+
+	// The primary key can't be changed in place, so the rows are copied into a new table
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range []string{
+		`CREATE TABLE articles_ranges (
+			query TEXT NOT NULL,
+			days TEXT NOT NULL,
+			to_date TEXT NOT NULL DEFAULT '',
+			data TEXT NOT NULL,
+			PRIMARY KEY (query, days, to_date)
+		)`,
+		`INSERT INTO articles_ranges (query, days, data) SELECT query, days, data FROM articles`,
+		`DROP TABLE articles`,
+		`ALTER TABLE articles_ranges RENAME TO articles`,
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	fmt.Println("Added date ranges to the articles table in news_cache.db.")
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prints what changed when a request's cached results are fetched again (REFRESH_DIFF=true)
+var refreshDiffEnabled = strings.Trim(os.Getenv("REFRESH_DIFF"), "'\"") == "true"
+
+// Returns the articles the request showed from its stored results, or nil if it has none
+// Only the articles the request shows are compared (its sentiment, date range, and limit), so the diff matches what was printed before
+func storedArticles(request SearchRequest) []Article {
+	stored, found := loadFromDatabase(request)
+	if !found {
+		return nil
+	}
+	return buildResult(request, *stored, "").Articles
+}
+
+// Prints the articles that were added, removed, or moved when the query's stored results are replaced by a new fetch
+// The new articles are the ones of the result that is printed, so its link checks aren't done twice
+// Nothing is printed if nothing changed
+func printRefreshDiff(query string, before, after []Article) {
+
+	// Rank of each article before the fetch (by URL, starting at 1)
+	oldRanks := make(map[string]int, len(before))
+	for i, article := range before {
+		oldRanks[article.URL] = i + 1
+	}
+
+	var lines []string
+	added, removed, moved := 0, 0, 0
+	newRanks := make(map[string]bool, len(after))
+	for i, article := range after {
+		rank := i + 1
+		newRanks[article.URL] = true
+
+		oldRank, existed := oldRanks[article.URL]
+		switch {
+		case !existed:
+			added++
+			lines = append(lines, fmt.Sprintf("  + #%d %s (%s)", rank, article.Title, article.URL))
+		case oldRank > rank:
+			moved++
+			lines = append(lines, fmt.Sprintf("  ↑ #%d %s (was #%d)", rank, article.Title, oldRank))
+		case oldRank < rank:
+			moved++
+			lines = append(lines, fmt.Sprintf("  ↓ #%d %s (was #%d)", rank, article.Title, oldRank))
+		}
+	}
+	for i, article := range before {
+		if !newRanks[article.URL] {
+			removed++
+			lines = append(lines, fmt.Sprintf("  - %s (was #%d)", article.Title, i+1))
+		}
+	}
+
+	if len(lines) == 0 {
+		fmt.Printf("\nNo changes for '%s' since the last fetch.\n", query)
+		return
+	}
+	fmt.Printf("\n--- CHANGES FOR '%s' SINCE THE LAST FETCH: %d added, %d removed, %d moved ---\n%s\n",
+		query, added, removed, moved, strings.Join(lines, "\n"))
+}
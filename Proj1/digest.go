@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Addresses the digest of new articles is emailed to (comma-separated), no digest is sent if empty
+	digestTo = splitAddresses(strings.Trim(os.Getenv("DIGEST_TO"), "'\""))
+
+	// SMTP server the digest is sent through, and the login for it (the login is optional)
+	smtpHost     = strings.Trim(os.Getenv("SMTP_HOST"), "'\"")
+	smtpPort     = strings.Trim(os.Getenv("SMTP_PORT"), "'\"")
+	smtpUser     = strings.Trim(os.Getenv("SMTP_USER"), "'\"")
+	smtpPassword = strings.Trim(os.Getenv("SMTP_PASSWORD"), "'\"")
+
+	// Address the digest is sent from (defaults to SMTP_USER)
+	digestFrom = strings.Trim(os.Getenv("DIGEST_FROM"), "'\"")
+
+	// How long to collect new articles before sending them (DIGEST_INTERVAL, Ex: '6h')
+	digestInterval = 24 * time.Hour
+
+	// New articles of each query that haven't been emailed yet
+	digestArticles = map[string][]Article{}
+	digestMu       sync.Mutex
+
+	// When the last digest was sent (or when the program started)
+	lastDigest = time.Now()
+)
+
+// Splits a comma-separated list of email addresses, ignoring empty entries
+func splitAddresses(list string) []string {
+	addresses := []string{}
+	for address := range strings.SplitSeq(list, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// Checks the digest settings (only if DIGEST_TO is set)
+func loadDigest() error {
+	if len(digestTo) == 0 {
+		return nil
+	}
+	if smtpHost == "" {
+		return fmt.Errorf("DIGEST_TO is set but SMTP_HOST is not")
+	}
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+	if digestFrom == "" {
+		digestFrom = smtpUser
+	}
+	if digestFrom == "" {
+		return fmt.Errorf("DIGEST_FROM (or SMTP_USER) is needed to send the digest")
+	}
+
+	if interval := strings.Trim(os.Getenv("DIGEST_INTERVAL"), "'\""); interval != "" {
+		every, err := time.ParseDuration(interval)
+		if err != nil || every <= 0 {
+			return fmt.Errorf("DIGEST_INTERVAL '%s' must be a positive duration (Ex: '6h')", interval)
+		}
+		digestInterval = every
+	}
+
+	fmt.Printf("Emailing a digest of new articles to %s every %s.\n", strings.Join(digestTo, ", "), digestInterval)
+	return nil
+}
+
+// Adds the new articles of a query to the next digest (articles already waiting to be sent are skipped)
+func addToDigest(query string, articles []Article) {
+	if len(digestTo) == 0 {
+		return
+	}
+
+	digestMu.Lock()
+	defer digestMu.Unlock()
+
+	seen := map[string]bool{}
+	for _, article := range digestArticles[query] {
+		seen[article.URL] = true
+	}
+	for _, article := range articles {
+		if !seen[article.URL] {
+			seen[article.URL] = true
+			digestArticles[query] = append(digestArticles[query], article)
+		}
+	}
+}
+
+// Sends the digest if DIGEST_INTERVAL has passed since the last one (or always, if force is true)
+// If sending fails, the articles are kept for the next digest
+func sendDigest(force bool) {
+	if len(digestTo) == 0 || (!force && time.Since(lastDigest) < digestInterval) {
+		return
+	}
+
+	digestMu.Lock()
+	pending := digestArticles
+	digestArticles = map[string][]Article{}
+	digestMu.Unlock()
+
+	since := lastDigest
+	lastDigest = time.Now()
+	if len(pending) == 0 {
+		return
+	}
+
+	subject, body := formatDigest(pending, since)
+	err := sendEmail(subject, body)
+	if err != nil {
+		fmt.Println("ERROR: sending the digest email failed:", err)
+
+		// Put the articles back, so they are sent with the next digest
+		for query, articles := range pending {
+			addToDigest(query, articles)
+		}
+		return
+	}
+	fmt.Printf("Emailed the digest of new articles to %s.\n", strings.Join(digestTo, ", "))
+}
+
+// Builds the subject and plain text body of the digest of articles found since the last one, with the queries in alphabetical order
+func formatDigest(pending map[string][]Article, since time.Time) (string, string) {
+	queries := make([]string, 0, len(pending))
+	total := 0
+	for query, articles := range pending {
+		queries = append(queries, query)
+		total += len(articles)
+	}
+	sort.Strings(queries)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%d new articles for %d queries since %s.\n", total, len(queries), since.In(userLocation).Format(time.RFC1123))
+	for _, query := range queries {
+		articles := pending[query]
+		heading := fmt.Sprintf("%s (%d new)", query, len(articles))
+		fmt.Fprintf(&body, "\n%s\n%s\n", heading, strings.Repeat("-", len(heading)))
+
+		for _, article := range articles {
+			fmt.Fprintf(&body, "- %s\n", article.Title)
+
+			// Source and publish time on one line (whichever of them are known)
+			details := []string{}
+			if article.Source.Name != "" {
+				details = append(details, article.Source.Name)
+			}
+			if published, err := time.Parse(time.RFC3339, article.PublishedAt); err == nil {
+				details = append(details, published.In(userLocation).Format("Jan 2, 2006 3:04 PM"))
+			}
+			if len(details) > 0 {
+				fmt.Fprintf(&body, "  %s\n", strings.Join(details, " | "))
+			}
+			fmt.Fprintf(&body, "  %s\n", article.URL)
+		}
+	}
+
+	subject := fmt.Sprintf("News digest: %d new articles for %d queries", total, len(queries))
+	return subject, body.String()
+}
+
+// Emails the message to every DIGEST_TO address through SMTP_HOST
+// Logs in with SMTP_USER and SMTP_PASSWORD if they are set (the server has to support STARTTLS for the password to be sent)
+func sendEmail(subject, body string) error {
+	headers := []string{
+		"From: " + digestFrom,
+		"To: " + strings.Join(digestTo, ", "),
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+
+	// SMTP lines end with CRLF
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+
+	var auth smtp.Auth
+	if smtpUser != "" {
+		auth = smtp.PlainAuth("", smtpUser, smtpPassword, smtpHost)
+	}
+	return smtp.SendMail(net.JoinHostPort(smtpHost, smtpPort), auth, digestFrom, digestTo, []byte(message))
+}
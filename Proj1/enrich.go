@@ -0,0 +1,176 @@
+package main
+
+import (
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Fetches each article's page to read its Open Graph tags (ENRICH=true)
+	enrichEnabled = strings.Trim(os.Getenv("ENRICH"), "'\"") == "true"
+
+	// Client used for article pages (separate from the API client, so slow news sites don't trip its circuit breaker)
+	enrichClient = &http.Client{Timeout: 10 * time.Second}
+
+	// Finds the meta and link tags in a page, and the attributes inside each tag
+	metaTagPattern   = regexp.MustCompile(`(?is)<(meta|link)\s[^>]*>`)
+	attributePattern = regexp.MustCompile(`(?s)([\w:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// How many article pages are fetched at the same time for one response
+const enrichWorkers = 8
+
+// Only the head of the page is needed, so at most this many bytes are read
+const maxHeadBytes = 256 * 1024
+
+// Details about an article read from its page's Open Graph tags
+type ArticleMetadata struct {
+	Image         string `json:"og_image,omitempty"`
+	SiteName      string `json:"og_site_name,omitempty"`
+	PublishedTime string `json:"published_time,omitempty"`
+	CanonicalURL  string `json:"canonical_url,omitempty"`
+}
+
+// Adds the Open Graph metadata to the articles of a new response that the request shows, before the response is stored
+// Articles that only later requests show are enriched when their results are written, so pages are never fetched for articles that are not shown
+func enrichResponse(req SearchRequest, resp *NewsAPIResponse) {
+	if !enrichEnabled {
+		return
+	}
+
+	reqLimit, _ := strconv.Atoi(req.Limit)
+	shown := []*Article{}
+	for i := range resp.Articles {
+		if len(shown) == reqLimit {
+			break
+		}
+		if articleMatches(req, resp.Articles[i]) {
+			shown = append(shown, &resp.Articles[i])
+		}
+	}
+	enrich(shown)
+}
+
+// Adds the Open Graph metadata to every shown article that does not have it yet (only if ENRICH=true)
+// Stored articles already have it from when they were saved, so this only fetches pages for articles no earlier request showed
+func enrichArticles(articles []Article) {
+	if !enrichEnabled {
+		return
+	}
+
+	shown := make([]*Article, len(articles))
+	for i := range articles {
+		shown[i] = &articles[i]
+	}
+	enrich(shown)
+}
+
+// Fetches the pages of the articles that do not have their metadata yet
+// Pages that can't be fetched are skipped, so the article is still shown without them
+func enrich(articles []*Article) {
+
+	// Only a few pages are fetched at once
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, enrichWorkers)
+
+	for _, article := range articles {
+		if article.Metadata != nil || article.URL == "" {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			if metadata, ok := fetchMetadata(article.URL); ok {
+				article.Metadata = metadata
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// Reads the head of the article's page, returning false if it could not be fetched or has none of the tags
+func fetchMetadata(articleURL string) (*ArticleMetadata, bool) {
+	resp, err := enrichClient.Get(articleURL)
+	if err != nil {
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHeadBytes))
+	if err != nil {
+		return nil, false
+	}
+
+	// Tags after the head belong to the page's content, not the article itself
+	page := string(body)
+	if end := strings.Index(strings.ToLower(page), "</head>"); end != -1 {
+		page = page[:end]
+	}
+
+	metadata := parseMetadata(page)
+	if *metadata == (ArticleMetadata{}) {
+		return nil, false
+	}
+	return metadata, true
+}
+
+// Pulls the Open Graph tags and canonical link out of the head of a page
+func parseMetadata(head string) *ArticleMetadata {
+	metadata := &ArticleMetadata{}
+
+	// og:url is only used if the page has no canonical link
+	ogURL := ""
+
+	for _, tag := range metaTagPattern.FindAllStringSubmatch(head, -1) {
+		attributes := make(map[string]string)
+		for _, attr := range attributePattern.FindAllStringSubmatch(tag[0], -1) {
+			attributes[strings.ToLower(attr[1])] = html.UnescapeString(attr[2] + attr[3])
+		}
+
+		// Link tags only matter for the canonical URL
+		if strings.EqualFold(tag[1], "link") {
+			if strings.EqualFold(attributes["rel"], "canonical") && metadata.CanonicalURL == "" {
+				metadata.CanonicalURL = strings.TrimSpace(attributes["href"])
+			}
+			continue
+		}
+
+		// Sites use either property or name for Open Graph tags
+		key := attributes["property"]
+		if key == "" {
+			key = attributes["name"]
+		}
+		content := strings.TrimSpace(attributes["content"])
+
+		switch strings.ToLower(key) {
+		case "og:image", "og:image:url", "og:image:secure_url":
+			if metadata.Image == "" {
+				metadata.Image = content
+			}
+		case "og:site_name":
+			metadata.SiteName = content
+		case "article:published_time", "og:published_time":
+			metadata.PublishedTime = content
+		case "og:url":
+			ogURL = content
+		}
+	}
+
+	if metadata.CanonicalURL == "" {
+		metadata.CanonicalURL = ogURL
+	}
+	return metadata
+}
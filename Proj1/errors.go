@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Exit codes of the program
+const (
+	// Every request succeeded
+	exitOK = 0
+
+	// The program could not run at all (Ex: missing API key, database could not be opened)
+	exitFatal = 1
+
+	// Some requests failed, but the rest were still processed
+	exitPartial = 2
+)
+
+// A line of an input file that could not be turned into a request (Line is 0 if the file itself could not be read)
+// Field is the field of the line that is invalid (empty if the whole line is)
+type ParseError struct {
+	File   string
+	Line   int
+	Field  string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Reason)
+	}
+	if e.Field != "" {
+		return fmt.Sprintf("%s:%d: field '%s': %s", e.File, e.Line, e.Field, e.Reason)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Reason)
+}
+
+// A request that could not be answered by the News API
+type APIError struct {
+	Request    SearchRequest
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("status %d: %s", e.StatusCode, msg)
+	}
+	return fmt.Sprintf("%s:%d: API request for '%s' failed: %s", e.Request.File, e.Request.Line, e.Request.Query, msg)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// A read or write of the article cache (news_cache.db) that failed
+type CacheError struct {
+	Op    string
+	Query string
+	Err   error
+}
+
+func (e *CacheError) Error() string {
+	return fmt.Sprintf("cache %s for '%s' failed: %s", e.Op, e.Query, e.Err)
+}
+
+func (e *CacheError) Unwrap() error {
+	return e.Err
+}
+
+// Results that could not be sent to an output sink (Ex: the webhook returned an error)
+type SinkError struct {
+	Sink  string
+	Query string
+	Err   error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("output to %s for '%s' failed: %s", e.Sink, e.Query, e.Err)
+}
+
+func (e *SinkError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// Every failure during this run (the program keeps going after each one)
+	failuresMu sync.Mutex
+	failures   []error
+)
+
+// Prints the failure and saves it for the summary at the end of the run
+func recordFailure(err error) {
+	failuresMu.Lock()
+	defer failuresMu.Unlock()
+
+	fmt.Println("ERROR:", err)
+	failures = append(failures, err)
+}
+
+// Prints how many of each kind of failure happened, followed by every failure
+// Returns the exit code of the run
+func printFailureSummary() int {
+	failuresMu.Lock()
+	defer failuresMu.Unlock()
+
+	if len(failures) == 0 {
+		fmt.Println("\nAll requests succeeded.")
+		return exitOK
+	}
+
+	var parseErrors, apiErrors, cacheErrors, sinkErrors int
+	for _, err := range failures {
+		var parseErr *ParseError
+		var apiErr *APIError
+		var cacheErr *CacheError
+		var sinkErr *SinkError
+
+		switch {
+		case errors.As(err, &parseErr):
+			parseErrors++
+		case errors.As(err, &apiErr):
+			apiErrors++
+		case errors.As(err, &cacheErr):
+			cacheErrors++
+		case errors.As(err, &sinkErr):
+			sinkErrors++
+		}
+	}
+
+	fmt.Printf("\n--- %d FAILURES (%d parse, %d API, %d cache, %d output) ---\n", len(failures), parseErrors, apiErrors, cacheErrors, sinkErrors)
+	for _, err := range failures {
+		fmt.Println(err)
+	}
+
+	return exitPartial
+}
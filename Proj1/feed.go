@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit used for feeds of cached queries that were not requested in an input file
+const defaultFeedLimit = 20
+
+// RSS 2.0 document
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	LastBuild   string    `xml:"lastBuildDate"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Author      string `xml:"author,omitempty"`
+	Category    string `xml:"category,omitempty"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+}
+
+// Atom document
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title    string        `xml:"title"`
+	ID       string        `xml:"id"`
+	Link     atomLink      `xml:"link"`
+	Updated  string        `xml:"updated"`
+	Summary  string        `xml:"summary"`
+	Author   *atomAuthor   `xml:"author,omitempty"`
+	Category *atomCategory `xml:"category,omitempty"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Runs the FEED mode, which turns cached results into one RSS or Atom feed per query
+// The queries come from the input files (with their days and limit), or from every cached query if FILE is not set
+// Feeds are written to FEED_DIR (default ./feeds), or served over HTTP if FEED_ADDR is set (Ex: FEED_ADDR=':8080')
+func runFeedMode(filePath string) {
+	format := strings.ToLower(strings.Trim(os.Getenv("FEED_FORMAT"), "'\""))
+	if format == "" {
+		format = "rss"
+	}
+	if format != "rss" && format != "atom" {
+		check(fmt.Errorf("FEED_FORMAT must be rss or atom, it is currently '%s'", format))
+	}
+
+	requests := feedRequests(filePath)
+
+	if addr := strings.Trim(os.Getenv("FEED_ADDR"), "'\""); addr != "" {
+		serveFeeds(addr, requests, format)
+		return
+	}
+
+	dir := strings.Trim(os.Getenv("FEED_DIR"), "'\"")
+	if dir == "" {
+		dir = "./feeds"
+	}
+	writeFeeds(dir, requests, format)
+}
+
+// Returns one request per feed, keyed by the file name of the feed
+func feedRequests(filePath string) map[string]SearchRequest {
+	requests := make(map[string]SearchRequest)
+
+	// Without input files, every cached query gets a feed (using the oldest date that was cached up to today)
+	if filePath == "" {
+		cached, err := store.OpenQueries()
+		check(err)
+
+		for _, req := range cached {
+			req.Limit = strconv.Itoa(defaultFeedLimit)
+			requests[feedName(req.Query)] = req
+		}
+		return requests
+	}
+
+	// Otherwise, use every request in the input files (the first request for a query wins)
+	var mu sync.Mutex
+	for _, inputFile := range expandInputFiles(filePath) {
+		readInputFile(inputFile, func(req SearchRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, exists := requests[feedName(req.Query)]; !exists {
+				requests[feedName(req.Query)] = req
+			}
+		})
+	}
+	return requests
+}
+
+// Writes a feed file for every request into the directory
+func writeFeeds(dir string, requests map[string]SearchRequest, format string) {
+	err := os.MkdirAll(dir, 0755)
+	check(err)
+
+	written := 0
+	for name, req := range requests {
+		data, found := buildFeed(req, format)
+		if !found {
+			fmt.Printf("No cached results for '%s', skipping its feed.\n", req.Query)
+			continue
+		}
+
+		err := os.WriteFile(filepath.Join(dir, name), data, 0644)
+		check(err)
+		written++
+	}
+
+	fmt.Printf("%d %s feeds written to %s\n", written, strings.ToUpper(format), dir)
+}
+
+// Serves the feeds over HTTP, building each one from the cache when it is requested (so it is always up to date)
+//
+//	GET /feeds          lists every feed
+//	GET /feeds/{name}   returns the feed (Ex: /feeds/climate-change.xml)
+func serveFeeds(addr string, requests map[string]SearchRequest, format string) {
+	http.HandleFunc("GET /feeds", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for name, req := range requests {
+			fmt.Fprintf(w, "/feeds/%s\t%s\n", name, req.Query)
+		}
+	})
+
+	http.HandleFunc("GET /feeds/{name}", func(w http.ResponseWriter, r *http.Request) {
+		req, exists := requests[r.PathValue("name")]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+
+		data, found := buildFeed(req, format)
+		if !found {
+			http.Error(w, fmt.Sprintf("no cached results for '%s'", req.Query), http.StatusNotFound)
+			return
+		}
+
+		if format == "atom" {
+			w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		}
+		w.Write(data)
+	})
+
+	fmt.Printf("Serving %d %s feeds at http://localhost%s/feeds\n", len(requests), strings.ToUpper(format), addr)
+	check(http.ListenAndServe(addr, nil))
+}
+
+// Builds the feed of the request from the cached articles, returning false if the query is not cached
+// Only articles in the request's date range (and sentiment) are included, up to its limit
+func buildFeed(req SearchRequest, format string) ([]byte, bool) {
+	resp, inDB := loadFromDatabase(req)
+	if !inDB {
+		return nil, false
+	}
+
+	limit, _ := strconv.Atoi(req.Limit)
+	articles := []Article{}
+	for _, article := range resp.Articles {
+		if len(articles) == limit {
+			break
+		}
+		if articleMatches(req, article) {
+			articles = append(articles, article)
+		}
+	}
+
+	title := fmt.Sprintf("News: %s", req.Query)
+	link := "https://newsapi.org/"
+	now := time.Now().UTC()
+
+	var doc any
+	if format == "atom" {
+		feed := atomFeed{Title: title, ID: "urn:proj1:" + feedName(req.Query), Updated: now.Format(time.RFC3339)}
+		for _, article := range articles {
+			entry := atomEntry{
+				Title:   article.Title,
+				ID:      article.URL,
+				Link:    atomLink{Href: article.URL},
+				Updated: article.PublishedAt,
+				Summary: article.Description,
+			}
+			if article.Author != "" {
+				entry.Author = &atomAuthor{Name: article.Author}
+			}
+			if article.Sentiment != "" {
+				entry.Category = &atomCategory{Term: article.Sentiment}
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		doc = feed
+	} else {
+		feed := rssFeed{Version: "2.0", Channel: rssChannel{
+			Title:       title,
+			Link:        link,
+			Description: fmt.Sprintf("Cached News API results for '%s' since %s", req.Query, req.Days),
+			LastBuild:   now.Format(time.RFC1123Z),
+		}}
+		for _, article := range articles {
+			item := rssItem{
+				Title:       article.Title,
+				Link:        article.URL,
+				Description: article.Description,
+				Author:      article.Author,
+				Category:    article.Sentiment,
+				GUID:        article.URL,
+				PubDate:     article.PublishedAt,
+			}
+
+			// RSS dates use RFC 1123 instead of the RFC 3339 dates the API returns
+			if published, err := time.Parse(time.RFC3339, article.PublishedAt); err == nil {
+				item.PubDate = published.Format(time.RFC1123Z)
+			}
+			feed.Channel.Items = append(feed.Channel.Items, item)
+		}
+		doc = feed
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	check(err)
+	return append([]byte(xml.Header), data...), true
+}
+
+// Characters that can't be in a feed's file name
+var unsafeFeedChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Returns the file name of the query's feed (Ex: "Climate Change" -> "climate-change.xml")
+func feedName(query string) string {
+	return strings.Trim(unsafeFeedChars.ReplaceAllString(strings.ToLower(query), "-"), "-") + ".xml"
+}
@@ -0,0 +1,55 @@
+package main
+
+import "sync"
+
+// A News API call for one query and date range, shared by every worker that needs it during the run
+// done is closed once resp and err are set
+type fetch struct {
+	done chan struct{}
+	resp NewsAPIResponse
+	err  error
+}
+
+var (
+	// Every API call made during this run, by query and date range (kept until the run ends, so each one is only made once)
+	// The results are already in the write channel when done is closed, so they can be used before the database write lands
+	fetchesMu sync.Mutex
+	fetches   = make(map[string]*fetch)
+)
+
+// Returns the key of an API call for the query, from the date, up to the "to" date (empty is today)
+func fetchKey(query, days, to string) string {
+	return query + "|" + days + "|" + to
+}
+
+// Makes the API call for the key once per run
+// A worker asking for a call that is already being made waits for it, and every worker after that gets the same results (or error)
+func fetchOnce(key string, call func() (NewsAPIResponse, error)) (NewsAPIResponse, error) {
+	fetchesMu.Lock()
+	if f, exists := fetches[key]; exists {
+		fetchesMu.Unlock()
+		<-f.done
+		return f.resp, f.err
+	}
+	f := &fetch{done: make(chan struct{})}
+	fetches[key] = f
+	fetchesMu.Unlock()
+
+	f.resp, f.err = call()
+	close(f.done)
+	return f.resp, f.err
+}
+
+// Returns the results of an API call already made (or being made) for the request during this run
+// Used before reading the database, since the results of a call may not have been written to it yet
+func waitForFetch(req SearchRequest) (NewsAPIResponse, bool) {
+	fetchesMu.Lock()
+	f, exists := fetches[fetchKey(req.Query, req.Days, req.To)]
+	fetchesMu.Unlock()
+	if !exists {
+		return NewsAPIResponse{}, false
+	}
+
+	<-f.done
+	return f.resp, f.err == nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// How query terms are marked in titles and descriptions (HIGHLIGHT='ansi', 'bold', or 'off')
+	// Defaults to ANSI colors when stdout is a terminal, and **bold** markers when it isn't (Ex: a log file)
+	highlightStyle = strings.ToLower(strings.Trim(os.Getenv("HIGHLIGHT"), "'\""))
+
+	// Whether each article also shows the words around the first query term in its content (SNIPPET='true')
+	snippetEnabled = strings.Trim(os.Getenv("SNIPPET"), "'\"") == "true"
+
+	// Words shown on each side of the first query term in a snippet (SNIPPET_WORDS)
+	snippetWords = 10
+
+	// Cut-off marker the News API adds to the end of the content (Ex: "... [+2841 chars]")
+	truncatedPattern = regexp.MustCompile(`\s*\[\+\d+ chars\]$`)
+)
+
+// ANSI codes that highlight a term (bold yellow), and reset the text after it
+const (
+	ansiHighlight = "\033[1;33m"
+	ansiReset     = "\033[0m"
+)
+
+// Marks the query's terms in the text of a result
+type highlighter struct {
+	// Matches any of the query's terms (nil if the query has none, or highlighting is off)
+	pattern *regexp.Regexp
+
+	// Text written before and after each term
+	before, after string
+}
+
+// Checks HIGHLIGHT and SNIPPET_WORDS
+func loadHighlight() error {
+	switch highlightStyle {
+	case "":
+		stat, err := os.Stdout.Stat()
+		if err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+			highlightStyle = "ansi"
+		} else {
+			highlightStyle = "bold"
+		}
+	case "ansi", "bold", "off":
+	default:
+		return fmt.Errorf("HIGHLIGHT '%s' must be ansi, bold, or off", highlightStyle)
+	}
+
+	if words := strings.Trim(os.Getenv("SNIPPET_WORDS"), "'\""); words != "" {
+		n, err := strconv.Atoi(words)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("SNIPPET_WORDS '%s' must be a positive number", words)
+		}
+		snippetWords = n
+	}
+	return nil
+}
+
+// Returns the highlighter of the query's terms (common words like "and" are not highlighted)
+func newHighlighter(query string) *highlighter {
+	h := &highlighter{}
+	switch highlightStyle {
+	case "ansi":
+		h.before, h.after = ansiHighlight, ansiReset
+	case "bold":
+		h.before, h.after = "**", "**"
+	}
+
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return h
+	}
+
+	// Longer terms go first, so a term that starts another one doesn't cut it off (Ex: "go" and "golang")
+	slices.SortFunc(terms, func(a, b string) int { return len(b) - len(a) })
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+	h.pattern = regexp.MustCompile(`(?i)\b(?:` + strings.Join(terms, "|") + `)\w*`)
+	return h
+}
+
+// Returns the text with every query term marked (words that start with a term are marked whole, Ex: "elections" for "election")
+func (h *highlighter) mark(text string) string {
+	if h.pattern == nil || h.before == "" {
+		return text
+	}
+	return h.pattern.ReplaceAllString(text, h.before+"$0"+h.after)
+}
+
+// Returns the words around the first query term in the content, with the terms marked (false if no term is in it)
+func (h *highlighter) snippet(content string) (string, bool) {
+	if h.pattern == nil {
+		return "", false
+	}
+
+	words := strings.Fields(truncatedPattern.ReplaceAllString(content, ""))
+	first := slices.IndexFunc(words, h.pattern.MatchString)
+	if first == -1 {
+		return "", false
+	}
+
+	start, end := max(first-snippetWords, 0), min(first+snippetWords+1, len(words))
+	snippet := h.mark(strings.Join(words[start:end], " "))
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(words) {
+		snippet += "..."
+	}
+	return snippet, true
+}
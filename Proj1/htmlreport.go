@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Whether every run's results are also written to a single HTML page (REPORT_HTML='true')
+	htmlReportEnabled = strings.Trim(os.Getenv("REPORT_HTML"), "'\"") == "true"
+
+	// Where the HTML report is written (REPORT_HTML_FILE), in the mounted volume by default so it can be opened in a browser
+	htmlReportPath = "./report.html"
+
+	// Every result written this run (reset at the start of each run)
+	reportResultsMu sync.Mutex
+	reportResults   []SearchResult
+)
+
+// Results of one query in the HTML report (every request with the query is shown together)
+type reportQuery struct {
+	Query    string
+	Articles int
+	Results  []reportResult
+}
+
+// Results of one request in the HTML report
+type reportResult struct {
+	Header   string
+	Articles []reportArticle
+}
+
+// Article as it is shown in the HTML report
+type reportArticle struct {
+	Title       string
+	URL         string
+	Source      string
+	Favicon     string
+	Author      string
+	Published   string
+	Description string
+	Sentiment   string
+}
+
+// Checks REPORT_HTML_FILE
+func loadHTMLReport() {
+	if path := strings.Trim(os.Getenv("REPORT_HTML_FILE"), "'\""); path != "" {
+		htmlReportPath = path
+	}
+}
+
+// Adds the result to this run's HTML report (if REPORT_HTML is on)
+func recordReportResult(result SearchResult) {
+	if !htmlReportEnabled {
+		return
+	}
+	reportResultsMu.Lock()
+	defer reportResultsMu.Unlock()
+	reportResults = append(reportResults, result)
+}
+
+// HTML page of every query's results, with a collapsible section per query (no external stylesheets or scripts needed)
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>News Report ({{.Generated}})</title>
+<style>
+	body { font-family: sans-serif; margin: 2em auto; max-width: 960px; background: #fafafa; color: #222; }
+	details { background: #fff; border: 1px solid #ddd; border-radius: 6px; margin-bottom: 1em; padding: 0.5em 1em; }
+	summary { cursor: pointer; font-size: 1.2em; font-weight: bold; }
+	summary .count { color: #777; font-weight: normal; font-size: 0.8em; }
+	h4 { color: #555; margin: 1em 0 0.5em; font-weight: normal; }
+	ol { padding-left: 1.5em; }
+	li { margin-bottom: 0.8em; }
+	li a { color: #1d4e89; font-weight: bold; text-decoration: none; }
+	li a:hover { text-decoration: underline; }
+	.meta { color: #777; font-size: 0.85em; }
+	.meta img { width: 16px; height: 16px; vertical-align: middle; margin-right: 4px; }
+	.positive { color: #2a9d8f; }
+	.negative { color: #e76f51; }
+	.empty { color: #999; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>News Report</h1>
+<p class="meta">{{len .Queries}} queries, {{.Articles}} articles, generated {{.Generated}} ({{.Timezone}})</p>
+{{range .Queries}}<details>
+<summary>{{.Query}} <span class="count">({{.Articles}} articles)</span></summary>
+{{range .Results}}<h4>{{.Header}}</h4>
+{{if .Articles}}<ol>
+{{range .Articles}}<li>
+<a href="{{.URL}}" target="_blank" rel="noopener">{{.Title}}</a>
+<div class="meta">{{if .Favicon}}<img src="{{.Favicon}}" alt="">{{end}}{{.Source}}{{if .Author}} &middot; {{.Author}}{{end}}{{if .Published}} &middot; {{.Published}}{{end}}{{if .Sentiment}} &middot; <span class="{{.Sentiment}}">{{.Sentiment}}</span>{{end}}</div>
+<div>{{.Description}}</div>
+</li>
+{{end}}</ol>
+{{else}}<p class="empty">No articles matched the request.</p>
+{{end}}{{end}}</details>
+{{end}}</body>
+</html>
+`))
+
+// Writes this run's results to the HTML report, replacing the report of the last run
+func writeHTMLReport() {
+	if !htmlReportEnabled {
+		return
+	}
+
+	reportResultsMu.Lock()
+	results := reportResults
+	reportResultsMu.Unlock()
+
+	// Group the results by query (sorted), keeping each query's requests in the order of the input files
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].File != results[j].File {
+			return results[i].File < results[j].File
+		}
+		return results[i].Line < results[j].Line
+	})
+	byQuery := make(map[string]*reportQuery)
+	total := 0
+	for _, result := range results {
+		query, found := byQuery[result.Query]
+		if !found {
+			query = &reportQuery{Query: result.Query}
+			byQuery[result.Query] = query
+		}
+
+		section := reportResult{Header: reportHeader(result)}
+		for _, article := range result.Articles {
+			section.Articles = append(section.Articles, newReportArticle(article))
+		}
+		query.Results = append(query.Results, section)
+		query.Articles += len(result.Articles)
+		total += len(result.Articles)
+	}
+
+	queries := make([]*reportQuery, 0, len(byQuery))
+	for _, query := range byQuery {
+		queries = append(queries, query)
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Query < queries[j].Query })
+
+	file, err := os.Create(htmlReportPath)
+	if err != nil {
+		fmt.Println("Could not write the HTML report:", err)
+		return
+	}
+	defer file.Close()
+
+	err = htmlReportTemplate.Execute(file, map[string]any{
+		"Queries":   queries,
+		"Articles":  total,
+		"Generated": userNow().Format("Jan 2, 2006 3:04 PM"),
+		"Timezone":  timezoneName(),
+	})
+	if err != nil {
+		fmt.Println("Could not write the HTML report:", err)
+		return
+	}
+
+	fmt.Printf("\nHTML report of %d queries written to %s\n", len(queries), htmlReportPath)
+}
+
+// Returns the line describing the request, like the header printed to stdout
+func reportHeader(result SearchResult) string {
+	header := fmt.Sprintf("Days=%s, Limit=%d, from %s (%s:%d)", dateRangeText(result.Days, result.To), result.Limit, result.Location, result.File, result.Line)
+	if result.Sentiment != "" {
+		header += ", only " + result.Sentiment
+	}
+	if result.Source != "" {
+		header += ", only from " + result.Source
+	}
+	if orig := result.RelaxedFrom; orig != nil {
+		header += fmt.Sprintf(", relaxed from '%s'", orig.Query)
+	}
+	return header
+}
+
+// Returns the article as it is shown in the report, with its publish date in the user's time zone
+// The favicon is looked up by the domain of the article's link
+func newReportArticle(article Article) reportArticle {
+	shown := reportArticle{
+		Title:       article.Title,
+		URL:         article.URL,
+		Source:      article.Source.Name,
+		Author:      article.Author,
+		Description: article.Description,
+		Sentiment:   article.Sentiment,
+	}
+	if published, err := time.Parse(time.RFC3339, article.PublishedAt); err == nil {
+		shown.Published = published.In(userLocation).Format("Jan 2, 2006 3:04 PM")
+	}
+	if link, err := url.Parse(article.URL); err == nil && link.Host != "" {
+		shown.Favicon = "https://www.google.com/s2/favicons?sz=32&domain=" + url.QueryEscape(link.Hostname())
+	}
+	return shown
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Checks that each article's link still works before it is shown, skipping dead links (LINK_CHECK=true)
+	linkCheckEnabled = strings.Trim(os.Getenv("LINK_CHECK"), "'\"") == "true"
+
+	// How long the result of a link check is trusted before the link is checked again (LINK_CHECK_MAX_AGE, Ex: '12h')
+	linkCheckMaxAge = 24 * time.Hour
+
+	// Client used for the checks (separate from the API client, so slow news sites don't trip its circuit breaker)
+	linkCheckClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// How many links are checked at the same time
+const linkCheckWorkers = 8
+
+// The result of checking an article's link (saved in the link_checks table, so the next run can skip it)
+type LinkCheck struct {
+	URL       string
+	Status    int
+	CheckedAt time.Time
+}
+
+// Returns whether the link is gone for good (404 Not Found or 410 Gone)
+// Other errors (Ex: a site that rejects HEAD requests, or is down for a moment) don't make a link dead
+func (c LinkCheck) Dead() bool {
+	return c.Status == http.StatusNotFound || c.Status == http.StatusGone
+}
+
+// Checks LINK_CHECK_MAX_AGE
+func loadLinkCheck() error {
+	maxAge := strings.Trim(os.Getenv("LINK_CHECK_MAX_AGE"), "'\"")
+	if maxAge == "" {
+		return nil
+	}
+
+	age, err := time.ParseDuration(maxAge)
+	if err != nil || age < 0 {
+		return fmt.Errorf("LINK_CHECK_MAX_AGE '%s' must be a duration (Ex: '12h')", maxAge)
+	}
+	linkCheckMaxAge = age
+	return nil
+}
+
+// Returns up to limit of the articles (in order), leaving out the ones with dead links
+// Only as many links are checked as are needed to fill the limit, so a big cached response doesn't check every link
+func liveArticles(query string, articles []Article, limit int) []Article {
+	live := []Article{}
+	skipped := 0
+
+	for start := 0; start < len(articles) && len(live) < limit; {
+		end := min(start+limit-len(live), len(articles))
+		batch := articles[start:end]
+		start = end
+
+		dead := deadLinks(query, batch)
+		for _, article := range batch {
+			if dead[article.URL] {
+				skipped++
+				continue
+			}
+			live = append(live, article)
+		}
+	}
+
+	if skipped > 0 {
+		fmt.Printf("Skipped %d articles with dead links for '%s'.\n", skipped, query)
+	}
+	return live
+}
+
+// Returns which of the articles' links are dead
+// Links checked within LINK_CHECK_MAX_AGE use the saved result, the others are checked again and saved
+func deadLinks(query string, articles []Article) map[string]bool {
+	urls := []string{}
+	for _, article := range articles {
+		if article.URL != "" {
+			urls = append(urls, article.URL)
+		}
+	}
+
+	// A database error only means every link is checked again
+	saved, err := store.LinkChecks(urls)
+	if err != nil {
+		recordFailure(&CacheError{Op: "read", Query: query, Err: err})
+	}
+
+	dead := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, linkCheckWorkers)
+	checked := []LinkCheck{}
+
+	for _, url := range urls {
+		if last, found := saved[url]; found && time.Since(last.CheckedAt) < linkCheckMaxAge {
+			mu.Lock()
+			dead[url] = last.Dead()
+			mu.Unlock()
+			continue
+		}
+
+		// Waits for a free slot before starting the check, so at most linkCheckWorkers links are checked at once
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			// A link that could not be reached is not saved, so it is checked again next time
+			status, err := linkStatus(url)
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			result := LinkCheck{URL: url, Status: status, CheckedAt: time.Now()}
+			dead[url] = result.Dead()
+			checked = append(checked, result)
+		})
+	}
+	wg.Wait()
+
+	if len(checked) > 0 {
+		if err := store.SaveLinkChecks(checked); err != nil {
+			recordFailure(&CacheError{Op: "write", Query: query, Err: err})
+		}
+	}
+	return dead
+}
+
+// Sends a HEAD request to the link, returning the status code of the response
+func linkStatus(url string) (int, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := linkCheckClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
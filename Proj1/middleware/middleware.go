@@ -0,0 +1,232 @@
+// Package middleware wraps outbound HTTP calls in a chain of http.RoundTrippers
+// (request logging, latency histograms, retries, and a circuit breaker).
+// It only depends on the standard library so it can be copied into the other projects.
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Returned when the circuit breaker is open and requests are not being sent
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// A Middleware wraps a RoundTripper with extra behavior
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// Allows a plain function to be used as a RoundTripper
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Wraps the base RoundTripper with every middleware
+// The first middleware is the outermost, so it sees each request first
+func Chain(base http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		base = middlewares[i](base)
+	}
+	return base
+}
+
+// Query parameters that are never written to the logs
+var secretParams = []string{"apikey", "api_key", "appid", "key", "token"}
+
+// Returns the URL with any secret query parameters hidden
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for name := range query {
+		for _, secret := range secretParams {
+			if strings.EqualFold(name, secret) {
+				query.Set(name, "REDACTED")
+			}
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// Logs every request with its status code and how long it took
+func Logging(logger *log.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			if err != nil {
+				logger.Printf("%s %s failed after %s: %s", req.Method, redactURL(req.URL), time.Since(start), err)
+			} else {
+				logger.Printf("%s %s -> %d in %s", req.Method, redactURL(req.URL), resp.StatusCode, time.Since(start))
+			}
+			return resp, err
+		})
+	}
+}
+
+// Histogram of request latencies, with a count per bucket upper bound
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []time.Duration
+	counts  []int64
+	count   int64
+	total   time.Duration
+}
+
+// Creates a histogram with the given bucket upper bounds (anything larger goes in a final overflow bucket)
+func NewHistogram(buckets ...time.Duration) *Histogram {
+	sorted := append([]time.Duration{}, buckets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return &Histogram{buckets: sorted, counts: make([]int64, len(sorted)+1)}
+}
+
+// Adds a latency to the histogram
+func (h *Histogram) Observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Find the first bucket this latency fits in (or the overflow bucket)
+	i := sort.Search(len(h.buckets), func(i int) bool { return d <= h.buckets[i] })
+	h.counts[i]++
+	h.count++
+	h.total += d
+}
+
+// Formats the histogram as a small table
+func (h *Histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var sb strings.Builder
+	if h.count == 0 {
+		return "No requests were recorded.\n"
+	}
+
+	fmt.Fprintf(&sb, "Requests: %d, Average Latency: %s\n", h.count, h.total/time.Duration(h.count))
+	for i, bound := range h.buckets {
+		fmt.Fprintf(&sb, "  <= %-8s %d\n", bound, h.counts[i])
+	}
+
+	// Without buckets, every request is in the overflow bucket, which the request count already shows
+	if len(h.buckets) > 0 {
+		fmt.Fprintf(&sb, "  >  %-8s %d\n", h.buckets[len(h.buckets)-1], h.counts[len(h.buckets)])
+	}
+	return sb.String()
+}
+
+// Records the latency of every request in the histogram
+func Metrics(h *Histogram) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			h.Observe(time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// Retries requests that fail or return a 5xx status, waiting longer after each attempt
+// Requests with a body are only retried if the body can be re-read (GetBody is set)
+func Retry(maxRetries int, backoff time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+
+			for attempt := 1; attempt <= maxRetries && shouldRetry(resp, err); attempt++ {
+				if req.Body != nil && req.GetBody == nil {
+					break
+				}
+
+				// Throw away the failed response before trying again
+				if resp != nil {
+					resp.Body.Close()
+				}
+
+				// Wait before retrying, unless the request was cancelled
+				select {
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				case <-time.After(backoff * time.Duration(1<<(attempt-1))):
+				}
+
+				retryReq := req.Clone(req.Context())
+				if req.GetBody != nil {
+					retryReq.Body, err = req.GetBody()
+					if err != nil {
+						return nil, err
+					}
+				}
+				resp, err = next.RoundTrip(retryReq)
+			}
+
+			return resp, err
+		})
+	}
+}
+
+// Returns whether the request should be tried again
+func shouldRetry(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= 500
+}
+
+// Stops sending requests for a cooldown period after too many failures in a row
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+// Creates a circuit breaker that opens after "threshold" failures in a row
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Returns the middleware that uses this circuit breaker
+func (cb *CircuitBreaker) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+
+			// Fail right away while the circuit is open
+			cb.mu.Lock()
+			if time.Now().Before(cb.openUntil) {
+				cb.mu.Unlock()
+				return nil, ErrCircuitOpen
+			}
+			cb.mu.Unlock()
+
+			resp, err := next.RoundTrip(req)
+
+			cb.mu.Lock()
+			defer cb.mu.Unlock()
+
+			// Any success closes the circuit again
+			if !shouldRetry(resp, err) {
+				cb.failures = 0
+				return resp, err
+			}
+
+			// Too many failures in a row opens the circuit
+			cb.failures++
+			if cb.failures >= cb.threshold {
+				cb.openUntil = time.Now().Add(cb.cooldown)
+				cb.failures = 0
+			}
+			return resp, err
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// URL that new articles for a query are POSTed to (Ex: a Slack or Discord incoming webhook), nothing is sent if empty
+	webhookURL = strings.Trim(os.Getenv("WEBHOOK_URL"), "'\"")
+
+	// Client used for the notifications (separate from the API client, so a slow webhook doesn't trip its circuit breaker)
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Body POSTed to WEBHOOK_URL when a query has new articles
+type NewArticlesNotification struct {
+	Query string `json:"query"`
+
+	// Short summary, so chat webhooks (Slack uses text, Discord uses content) show something readable
+	Text    string `json:"text"`
+	Content string `json:"content"`
+
+	// Publish time of the newest article that was cached before this call
+	PreviousNewest time.Time `json:"previous_newest"`
+	Articles       []Article `json:"articles"`
+}
+
+// Sends the articles of the response that are newer than anything cached for the query to WEBHOOK_URL, and adds them to the email digest
+// In watch mode (with a SCHEDULE), the new articles are the ones whose URL wasn't seen in an earlier fetch instead, and they are also printed
+// Queries that were never cached (or fetched) are skipped, since every article would count as new
+// Date ranges that end before today are skipped too, since they can't have new articles
+// Must be called before the response is saved, so the cache still has the previous results
+func notifyNewArticles(request SearchRequest, resp NewsAPIResponse) {
+	if (!watching && webhookURL == "" && len(digestTo) == 0) || request.To != "" {
+		return
+	}
+
+	previous, found := newestCachedArticle(request.Query)
+
+	var newArticles []Article
+	if watching {
+		newArticles = breakingArticles(request, resp)
+	} else if found {
+		for _, article := range resp.Articles {
+			published, err := time.Parse(time.RFC3339, article.PublishedAt)
+			if err == nil && published.After(previous) {
+				newArticles = append(newArticles, article)
+			}
+		}
+	}
+	if len(newArticles) == 0 {
+		return
+	}
+
+	// Collect them for the next digest email (if DIGEST_TO is set)
+	addToDigest(request.Query, newArticles)
+	if webhookURL == "" {
+		return
+	}
+
+	summary := fmt.Sprintf("%d new articles for '%s':", len(newArticles), request.Query)
+	for _, article := range newArticles {
+		summary += fmt.Sprintf("\n- %s (%s)", article.Title, article.URL)
+	}
+
+	body, _ := json.Marshal(NewArticlesNotification{
+		Query:          request.Query,
+		Text:           summary,
+		Content:        summary,
+		PreviousNewest: previous,
+		Articles:       newArticles,
+	})
+
+	webhookResp, err := webhookClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err == nil {
+		webhookResp.Body.Close()
+		if webhookResp.StatusCode < 200 || webhookResp.StatusCode > 299 {
+			err = fmt.Errorf("status %d", webhookResp.StatusCode)
+		}
+	}
+	if err != nil {
+		recordFailure(&SinkError{Sink: "notification webhook " + webhookURL, Query: request.Query, Err: err})
+		return
+	}
+	fmt.Printf("Sent %d new articles for '%s' to WEBHOOK_URL.\n", len(newArticles), request.Query)
+}
+
+// Returns the publish time of the newest article cached for the query (in memory or in the database)
+func newestCachedArticle(query string) (time.Time, bool) {
+	responses := []NewsAPIResponse{}
+
+	cacheMu.RLock()
+	if mem, inCache := cache[query]; inCache {
+		responses = append(responses, mem.resp)
+	}
+	cacheMu.RUnlock()
+
+	// Every date range that was saved for the query
+	stored, _ := store.QueryData(query)
+	for _, data := range stored {
+		var response NewsAPIResponse
+		if decodeStored(data, &response) == nil {
+			responses = append(responses, response)
+		}
+	}
+
+	var newest time.Time
+	found := false
+	for _, response := range responses {
+		for _, article := range response.Articles {
+			published, err := time.Parse(time.RFC3339, article.PublishedAt)
+			if err == nil && published.After(newest) {
+				newest = published
+				found = true
+			}
+		}
+	}
+	return newest, found
+}
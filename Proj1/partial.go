@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// How much of a request's date range was served from the cache, and how much had to be fetched
+type Coverage struct {
+	// Where the cached part came from (CACHE or DATABASE)
+	Source string `json:"source"`
+
+	CachedDays  int     `json:"cached_days"`
+	FetchedDays int     `json:"fetched_days"`
+	Percent     float64 `json:"cached_percent"`
+}
+
+// Finds cached results for the query that only cover the newest part of the request's date range
+// Only ranges up to today are split this way (a range with a "to" date is always fetched whole)
+// The in-memory cache is checked first, then the database (unless this is a refresh run)
+func loadPartial(request SearchRequest, refresh bool) (SearchRequest, NewsAPIResponse, string, bool) {
+	if request.To != "" {
+		return SearchRequest{}, NewsAPIResponse{}, "", false
+	}
+	requestDate, _ := time.Parse("2006-01-02", request.Days)
+
+	cacheMu.RLock()
+	mem, inCache := cache[request.Query]
+	cacheMu.RUnlock()
+	if inCache && mem.req.To == "" {
+		cacheDate, _ := time.Parse("2006-01-02", mem.req.Days)
+		if cacheDate.After(requestDate) {
+			return mem.req, mem.resp, "CACHE", true
+		}
+	}
+
+	if refresh {
+		return SearchRequest{}, NewsAPIResponse{}, "", false
+	}
+
+	// The row with the oldest date covers the most of the request
+	days, data, found, err := store.LookupNewer(request.Query, request.Days)
+	if err != nil {
+		recordFailure(&CacheError{Op: "read", Query: request.Query, Err: err})
+	}
+	if !found {
+		return SearchRequest{}, NewsAPIResponse{}, "", false
+	}
+
+	var response NewsAPIResponse
+	if err := decodeStored(data, &response); err != nil {
+		recordFailure(&CacheError{Op: "read", Query: request.Query, Err: err})
+		return SearchRequest{}, NewsAPIResponse{}, "", false
+	}
+	tagArticles(&response)
+
+	cachedReq := request
+	cachedReq.Days = days
+	return cachedReq, response, "DATABASE", true
+}
+
+// Answers the request from results that cover only part of its date range
+// Only the missing (older) days are fetched from the API, then both parts are merged, saved, and sent to the output sinks
+func processPartial(request, cachedReq SearchRequest, cached NewsAPIResponse, source, apiKey string) (int, error) {
+	cacheDate, _ := time.Parse("2006-01-02", cachedReq.Days)
+
+	// The missing window ends the day before the cached results start
+	missingTo := cacheDate.AddDate(0, 0, -1).Format("2006-01-02")
+	fetched, err := fetchOnce(fetchKey(request.Query, request.Days, missingTo), func() (NewsAPIResponse, error) {
+		fetched, err := callAPI(request, apiKey, missingTo)
+		if err != nil {
+			return NewsAPIResponse{}, err
+		}
+		tagArticles(&fetched)
+		return fetched, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Merge the cached (newer) articles with the fetched (older) ones
+	merged := cached
+	merged.Articles = mergeArticles(cached.Articles, fetched.Articles)
+	// Each total only counts its own part of the range, so the larger one is kept (at least as many as were merged)
+	merged.TotalResults = max(cached.TotalResults, fetched.TotalResults, len(merged.Articles))
+	enrichResponse(request, &merged)
+
+	// Save the merged results under the wider request, so the next request with this range is a full hit
+	writeChan <- reqNresp{req: request, resp: merged}
+	cacheMu.Lock()
+	cache[request.Query] = &reqNresp{req: request, resp: merged}
+	cacheMu.Unlock()
+
+	coverage := requestCoverage(request, cachedReq, source)
+	fmt.Printf("Query '%s' was %.0f%% cached (%d of %d days from %s), fetched the other %d days from the API.\n",
+		request.Query, coverage.Percent, coverage.CachedDays, coverage.CachedDays+coverage.FetchedDays, source, coverage.FetchedDays)
+
+	result := buildResult(request, merged, source+"+API")
+	result.Coverage = &coverage
+	writeResult(result)
+	return len(result.Articles), nil
+}
+
+// Returns how many days of the request were cached, and how many were fetched
+func requestCoverage(request, cachedReq SearchRequest, source string) Coverage {
+	today := userToday()
+	requestDate, _ := time.Parse("2006-01-02", request.Days)
+	cacheDate, _ := time.Parse("2006-01-02", cachedReq.Days)
+
+	total := int(today.Sub(requestDate).Hours()/24) + 1
+	cached := int(today.Sub(cacheDate).Hours()/24) + 1
+
+	return Coverage{
+		Source:      source,
+		CachedDays:  cached,
+		FetchedDays: total - cached,
+		Percent:     float64(cached) / float64(total) * 100,
+	}
+}
+
+// Returns the articles of both lists, without any article that appears twice (compared by URL), sorted the way the API sorts them
+// The first Limit articles are shown, so the merged list can't just keep the cached articles ahead of the fetched ones
+func mergeArticles(first, second []Article) []Article {
+	seen := make(map[string]bool)
+	merged := []Article{}
+
+	// Each article's rank within its own list (0 is the first article, 1 is the last)
+	rank := make(map[string]float64)
+
+	for _, list := range [][]Article{first, second} {
+		for i, article := range list {
+			if seen[article.URL] {
+				continue
+			}
+			seen[article.URL] = true
+			rank[article.URL] = float64(i) / float64(len(list))
+			merged = append(merged, article)
+		}
+	}
+
+	// Newest articles first (RFC3339 times in UTC sort as strings)
+	if sortBy == "publishedAt" {
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].PublishedAt > merged[j].PublishedAt
+		})
+		return merged
+	}
+
+	// Responses don't include the popularity (or relevancy) of their articles, so the lists are interleaved by rank instead
+	// (Ex: the 5th of 10 cached articles goes right alongside the 10th of 20 fetched ones)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return rank[merged[i].URL] < rank[merged[j].URL]
+	})
+	return merged
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields a line can have, in the order they are validated (q is the search term)
+//
+//	q="artificial intelligence" days=3 limit=5 sentiment=positive source=reuters
+//	q=golang from=2025-01-01 to=2025-01-31 limit=10
+var queryFields = []string{"q", "days", "from", "to", "limit", "sentiment", "source"}
+
+// Matches a line that uses named fields (it starts with one of them, Ex: q=... or days=...)
+var fieldLine = regexp.MustCompile(`^\s*[A-Za-z]+\s*=`)
+
+// Splits the line into its fields, returning an error if it can't be split
+// Lines with named fields can quote values that have spaces ("..." or '...'), and older lines are "query|days|limit|sentiment"
+func lineFields(text string) (map[string]string, error) {
+	if fieldLine.MatchString(text) {
+		return namedFields(text)
+	}
+	return pipeFields(text)
+}
+
+// Splits a line of named fields (key=value separated by spaces)
+func namedFields(text string) (map[string]string, error) {
+	fields := make(map[string]string)
+
+	rest := strings.TrimSpace(text)
+	for rest != "" {
+		key, value, found := strings.Cut(rest, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("expected key=value, found '%s'", strings.Fields(rest)[0])
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		// A quoted value runs until its closing quote, and anything else until the next space
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			end := strings.IndexByte(value[1:], value[0])
+			if end < 0 {
+				return nil, fmt.Errorf("the value of '%s' is missing its closing quote", key)
+			}
+			rest = value[end+2:]
+			value = value[1 : end+1]
+			if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+				return nil, fmt.Errorf("expected a space after the quoted value of '%s'", key)
+			}
+		} else {
+			end := strings.IndexAny(value, " \t")
+			if end < 0 {
+				end = len(value)
+			}
+			value, rest = value[:end], value[end:]
+		}
+		rest = strings.TrimSpace(rest)
+
+		// "query" is the longer name of q
+		if key == "query" {
+			key = "q"
+		}
+		if _, exists := fields[key]; exists {
+			return nil, fmt.Errorf("'%s' is given more than once", key)
+		}
+		fields[key] = value
+	}
+	return fields, nil
+}
+
+// Splits an older "query|days|limit|sentiment" line into the same fields (days can also be "from=YYYY-MM-DD,to=YYYY-MM-DD")
+func pipeFields(text string) (map[string]string, error) {
+	parameters := strings.Split(text, "|")
+
+	// Requests must be three parameters (with an optional fourth sentiment filter)
+	if len(parameters) != 3 && len(parameters) != 4 {
+		return nil, fmt.Errorf("only three or four parameters allowed per line (query, days, limit, and optional sentiment, separated by '|'), "+
+			"or named fields (Ex: q=\"golang\" days=3 limit=5), found %d", len(parameters))
+	}
+
+	fields := map[string]string{
+		"q":     strings.TrimSpace(parameters[0]),
+		"limit": strings.TrimSpace(parameters[2]),
+	}
+	if len(parameters) == 4 {
+		fields["sentiment"] = strings.TrimSpace(parameters[3])
+	}
+
+	// An explicit date range becomes its from and to fields
+	days := strings.TrimSpace(parameters[1])
+	if !strings.Contains(days, "=") {
+		fields["days"] = days
+		return fields, nil
+	}
+	for part := range strings.SplitSeq(days, ",") {
+		key, date, found := strings.Cut(part, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !found || (key != "from" && key != "to") {
+			return nil, fmt.Errorf("the date range is not valid ('%s' is not 'from=YYYY-MM-DD' or 'to=YYYY-MM-DD'), it is currently '%s'", part, days)
+		}
+		fields[key] = strings.TrimSpace(date)
+	}
+	return fields, nil
+}
+
+// Validates every field, returning the request or a ParseError for each invalid field
+func requestFromFields(fields map[string]string, fileName string, lineNum int) (SearchRequest, error) {
+	var problems []error
+	invalid := func(field, reason string, args ...any) {
+		problems = append(problems, &ParseError{File: fileName, Line: lineNum, Field: field, Reason: fmt.Sprintf(reason, args...)})
+	}
+
+	// Sorted so the same line always gives the same errors
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		if !slices.Contains(queryFields, key) {
+			invalid(key, "is not a field (the fields are %s)", strings.Join(queryFields, ", "))
+		}
+	}
+
+	request := SearchRequest{File: fileName, Line: lineNum}
+
+	request.Query = strings.TrimSpace(fields["q"])
+	if request.Query == "" {
+		invalid("q", "is required (it is the search term)")
+	}
+
+	// Either days ago, or an explicit date range (from, with an optional to)
+	days, hasDays := fields["days"]
+	from, hasFrom := fields["from"]
+	to, hasTo := fields["to"]
+	switch {
+	case hasDays && (hasFrom || hasTo):
+		invalid("days", "use either days or a from/to date range, not both")
+	case hasDays:
+		// Convert the day number to an actual date (Ex: if days was 1, date would be today, if it was 2, date would be yesterday, etc...)
+		// Today is the user's today (in TIMEZONE), not the server's
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			invalid("days", "must be a positive number, it is currently '%s'", days)
+		} else {
+			request.Days = daysToDate(n)
+		}
+	case hasFrom:
+		_, fromErr := time.Parse("2006-01-02", from)
+		_, toErr := time.Parse("2006-01-02", to)
+		if fromErr != nil {
+			invalid("from", "must be a date in the YYYY-MM-DD format, it is currently '%s'", from)
+		}
+		if hasTo && toErr != nil {
+			invalid("to", "must be a date in the YYYY-MM-DD format, it is currently '%s'", to)
+		}
+		if fromErr == nil && (!hasTo || toErr == nil) {
+			// A range that ends today or later shares the cache with "days ago" requests
+			value := "from=" + from
+			if hasTo {
+				value += ",to=" + to
+			}
+			var err error
+			request.Days, request.To, err = parseDateRange(value)
+			if err != nil {
+				invalid("to", "%s", err)
+			}
+		}
+	case hasTo:
+		invalid("from", "a date range needs a from date (to is %s)", to)
+	default:
+		invalid("days", "is required (or a from/to date range instead)")
+	}
+
+	// Limit must be a number (but still will be put into the request as a string since it is put into a URL for API calls)
+	request.Limit = strings.TrimSpace(fields["limit"])
+	if n, err := strconv.Atoi(request.Limit); err != nil || n <= 0 {
+		invalid("limit", "must be a positive number, it is currently '%s'", request.Limit)
+	}
+
+	// Sentiment must be positive, negative, or neutral (if given)
+	if sentiment, found := fields["sentiment"]; found {
+		request.Sentiment = strings.ToLower(strings.TrimSpace(sentiment))
+		if !isValidSentiment(request.Sentiment) {
+			invalid("sentiment", "must be positive, negative, or neutral, it is currently '%s'", sentiment)
+		}
+	}
+
+	// Source only keeps articles from that news source (matched against its ID or name)
+	if source, found := fields["source"]; found {
+		request.Source = strings.TrimSpace(source)
+		if request.Source == "" {
+			invalid("source", "cannot be empty")
+		}
+	}
+
+	if len(problems) > 0 {
+		return SearchRequest{}, errors.Join(problems...)
+	}
+	return request, nil
+}
+
+// Returns whether the article is from the source (Ex: "reuters" matches the ID "reuters" and the name "Reuters")
+func matchesSource(article Article, source string) bool {
+	source = strings.ToLower(source)
+	return strings.ToLower(article.Source.ID) == source || strings.Contains(strings.ToLower(article.Source.Name), source)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How complete the results of one query were this run (every request with the query is counted together)
+type QueryStats struct {
+	Query string
+
+	// Requests (input lines) that asked for the query
+	Requests int
+
+	// Most results the News API said it has for the query (it only sends the first page of them)
+	TotalResults int
+
+	// Articles written to the output across every request, and the sources they came from
+	Articles int
+	Sources  map[string]struct{}
+
+	// Oldest and newest publish dates of the articles written (zero if none were)
+	Oldest time.Time
+	Newest time.Time
+
+	// How many requests were answered by each location (CACHE, DATABASE, API, or a partial one like DATABASE+API)
+	Locations map[string]int
+
+	// API calls made for the query and how long they took in all
+	APICalls   int
+	APILatency time.Duration
+}
+
+var (
+	// Statistics of every query this run (reset at the start of each run)
+	queryStatsMu sync.Mutex
+	queryStats   = make(map[string]*QueryStats)
+)
+
+// Returns the statistics of the query, creating them the first time (the mutex must be held)
+func statsFor(query string) *QueryStats {
+	stats, found := queryStats[query]
+	if !found {
+		stats = &QueryStats{Query: query, Sources: make(map[string]struct{}), Locations: make(map[string]int)}
+		queryStats[query] = stats
+	}
+	return stats
+}
+
+// Adds a result that was written to the output to its query's statistics
+func recordQueryResult(result SearchResult) {
+	queryStatsMu.Lock()
+	defer queryStatsMu.Unlock()
+
+	stats := statsFor(result.Query)
+	stats.Requests++
+	stats.TotalResults = max(stats.TotalResults, result.TotalResults)
+	stats.Articles += len(result.Articles)
+	stats.Locations[result.Location]++
+
+	for _, article := range result.Articles {
+		if article.Source.Name != "" {
+			stats.Sources[article.Source.Name] = struct{}{}
+		}
+
+		published, err := time.Parse(time.RFC3339, article.PublishedAt)
+		if err != nil {
+			continue
+		}
+		if stats.Oldest.IsZero() || published.Before(stats.Oldest) {
+			stats.Oldest = published
+		}
+		if published.After(stats.Newest) {
+			stats.Newest = published
+		}
+	}
+}
+
+// Adds an API call for the query (and how long it took) to its statistics
+func recordQueryLatency(query string, elapsed time.Duration) {
+	queryStatsMu.Lock()
+	defer queryStatsMu.Unlock()
+
+	stats := statsFor(query)
+	stats.APICalls++
+	stats.APILatency += elapsed
+}
+
+// Prints a table of every query's statistics, so it is easy to see which queries had incomplete results
+// A query that shows far fewer articles than the API has, few sources, or a short date span may need a wider request
+func printQueryStats() {
+	queryStatsMu.Lock()
+	defer queryStatsMu.Unlock()
+	if len(queryStats) == 0 {
+		return
+	}
+
+	queries := make([]string, 0, len(queryStats))
+	for query := range queryStats {
+		queries = append(queries, query)
+	}
+	sort.Strings(queries)
+
+	fmt.Printf("\nQuery Coverage:\n")
+	fmt.Printf("  %-25s %8s %8s %8s %8s  %-25s %-20s %s\n", "QUERY", "REQUESTS", "TOTAL", "SHOWN", "SOURCES", "DATE SPAN", "FROM", "API LATENCY")
+	for _, query := range queries {
+		stats := queryStats[query]
+		fmt.Printf("  %-25s %8d %8d %8d %8d  %-25s %-20s %s\n",
+			truncateQuery(query), stats.Requests, stats.TotalResults, stats.Articles, len(stats.Sources), stats.dateSpan(), stats.locations(), stats.latency())
+	}
+}
+
+// Returns the dates of the oldest and newest articles in the user's time zone, and how many days they cover
+func (s *QueryStats) dateSpan() string {
+	if s.Oldest.IsZero() {
+		return "-"
+	}
+	oldest, newest := s.Oldest.In(userLocation), s.Newest.In(userLocation)
+	days := int(newest.Sub(oldest).Hours()/24) + 1
+	return fmt.Sprintf("%s to %s (%dd)", oldest.Format("01-02"), newest.Format("01-02"), days)
+}
+
+// Returns how many requests each location answered (Ex: API 1, CACHE 2)
+func (s *QueryStats) locations() string {
+	names := make([]string, 0, len(s.Locations))
+	for location := range s.Locations {
+		names = append(names, location)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, s.Locations[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Returns the average time of the query's API calls (- if it needed none)
+func (s *QueryStats) latency() string {
+	if s.APICalls == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s avg (%d calls)", (s.APILatency / time.Duration(s.APICalls)).Round(time.Millisecond), s.APICalls)
+}
+
+// Shortens a long query so the table stays aligned
+func truncateQuery(query string) string {
+	if len(query) <= 25 {
+		return query
+	}
+	return query[:22] + "..."
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Counters for where each request in this run got its results from
+var (
+	cacheHits atomic.Int64
+	dbHits    atomic.Int64
+	apiCalls  atomic.Int64
+)
+
+// Summary of a single run of the program (one row in the runs table)
+type RunSummary struct {
+	StartedAt string  `json:"startedAt"`
+	RuntimeMs int64   `json:"runtimeMs"`
+	Requests  int64   `json:"requests"`
+	CacheHits int64   `json:"cacheHits"`
+	DBHits    int64   `json:"dbHits"`
+	APICalls  int64   `json:"apiCalls"`
+	HitRate   float64 `json:"hitRate"`
+}
+
+// Saves the summary of this run to the database
+func saveRunSummary(start time.Time) {
+	err := store.SaveRun(RunSummary{
+		StartedAt: start.Format(time.RFC3339),
+		RuntimeMs: time.Since(start).Milliseconds(),
+		CacheHits: cacheHits.Load(),
+		DBHits:    dbHits.Load(),
+		APICalls:  apiCalls.Load(),
+	})
+	check(err)
+}
+
+// Loads the summaries of all previous runs (oldest first)
+func loadRunSummaries() []RunSummary {
+	summaries, err := store.Runs()
+	check(err)
+
+	for i := range summaries {
+		s := &summaries[i]
+
+		// Hit rate is the percentage of requests that did NOT need the API
+		s.Requests = s.CacheHits + s.DBHits + s.APICalls
+		if s.Requests > 0 {
+			s.HitRate = float64(s.CacheHits+s.DBHits) / float64(s.Requests) * 100
+		}
+	}
+
+	return summaries
+}
+
+// HTML page that draws the run history on canvases (no external libraries needed)
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>NewsAPI Cache Efficiency</title>
+<style>
+	body { font-family: sans-serif; margin: 2em; background: #fafafa; }
+	canvas { background: #fff; border: 1px solid #ddd; margin-bottom: 2em; }
+	table { border-collapse: collapse; }
+	td, th { border: 1px solid #ddd; padding: 4px 8px; text-align: right; }
+</style>
+</head>
+<body>
+<h1>NewsAPI Cache Efficiency ({{len .Runs}} runs)</h1>
+<h3>Cache Hit Rate (%)</h3>
+<canvas id="hitRate" width="900" height="250"></canvas>
+<h3>API Calls</h3>
+<canvas id="apiCalls" width="900" height="250"></canvas>
+<h3>Runtime (ms)</h3>
+<canvas id="runtime" width="900" height="250"></canvas>
+<table>
+<tr><th>Started</th><th>Requests</th><th>Cache</th><th>Database</th><th>API</th><th>Hit Rate</th><th>Runtime (ms)</th></tr>
+{{range .Runs}}<tr><td>{{.StartedAt}}</td><td>{{.Requests}}</td><td>{{.CacheHits}}</td><td>{{.DBHits}}</td><td>{{.APICalls}}</td><td>{{printf "%.1f" .HitRate}}%</td><td>{{.RuntimeMs}}</td></tr>
+{{end}}</table>
+<script>
+const runs = {{.JSON}};
+
+// Draws a simple line chart of one field across all runs
+function drawChart(id, field, color) {
+	const canvas = document.getElementById(id);
+	const ctx = canvas.getContext("2d");
+	const pad = 40;
+	const values = runs.map(r => r[field]);
+	const max = Math.max(1, ...values);
+	const step = runs.length > 1 ? (canvas.width - 2 * pad) / (runs.length - 1) : 0;
+
+	// Axes
+	ctx.strokeStyle = "#999";
+	ctx.beginPath();
+	ctx.moveTo(pad, pad / 2);
+	ctx.lineTo(pad, canvas.height - pad);
+	ctx.lineTo(canvas.width - pad, canvas.height - pad);
+	ctx.stroke();
+	ctx.fillStyle = "#333";
+	ctx.fillText(max.toFixed(0), 4, pad / 2 + 4);
+	ctx.fillText("0", 4, canvas.height - pad);
+
+	// Data line and points
+	ctx.strokeStyle = color;
+	ctx.fillStyle = color;
+	ctx.beginPath();
+	values.forEach((v, i) => {
+		const x = pad + i * step;
+		const y = canvas.height - pad - (v / max) * (canvas.height - 1.5 * pad);
+		i === 0 ? ctx.moveTo(x, y) : ctx.lineTo(x, y);
+		ctx.fillRect(x - 2, y - 2, 4, 4);
+	});
+	ctx.stroke();
+}
+
+drawChart("hitRate", "hitRate", "#2a9d8f");
+drawChart("apiCalls", "apiCalls", "#e76f51");
+drawChart("runtime", "runtimeMs", "#264653");
+</script>
+</body>
+</html>
+`))
+
+// Renders the HTML dashboard of all previous runs into the given file
+func renderDashboard(path string) {
+	runs := loadRunSummaries()
+
+	// The run history is also embedded as JSON so the charts can be drawn
+	runsJSON, err := json.Marshal(runs)
+	check(err)
+
+	file, err := os.Create(path)
+	check(err)
+	defer file.Close()
+
+	err = dashboardTemplate.Execute(file, map[string]any{
+		"Runs": runs,
+		"JSON": template.JS(runsJSON),
+	})
+	check(err)
+
+	fmt.Printf("Cache efficiency dashboard for %d runs written to %s\n", len(runs), path)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// When the input files are processed again (set with SCHEDULE)
+type Schedule interface {
+	// Returns the next run time after t
+	Next(t time.Time) time.Time
+}
+
+// Runs every fixed interval (Ex: SCHEDULE='30m')
+type intervalSchedule struct {
+	every time.Duration
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.every)
+}
+
+// Runs on a cron expression with five fields: minute, hour, day of month, month, and day of week (Ex: SCHEDULE='0 */6 * * *')
+// Each field can be '*', a number, a range (1-5), a list (1,15), or have a step (*/15)
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+
+	// Cron runs on a day if either day field matches, unless one of them is '*'
+	anyDay, anyWeekday bool
+}
+
+func (s cronSchedule) Next(t time.Time) time.Time {
+	// Start at the next whole minute, and check every minute for up to 5 years (enough for any valid expression)
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	for limit := next.AddDate(5, 0, 0); next.Before(limit); next = next.Add(time.Minute) {
+		if !s.months[int(next.Month())] || !s.hours[next.Hour()] || !s.minutes[next.Minute()] {
+			continue
+		}
+
+		dayMatch, weekdayMatch := s.days[next.Day()], s.weekdays[int(next.Weekday())]
+		switch {
+		case s.anyDay && s.anyWeekday, s.anyWeekday && dayMatch, s.anyDay && weekdayMatch:
+			return next
+		case !s.anyDay && !s.anyWeekday && (dayMatch || weekdayMatch):
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// Parses the SCHEDULE value, which is either a duration (Ex: '15m', '1h') or a five field cron expression
+// Returns nil if there is no schedule (the input files are processed once)
+func parseSchedule(value string) (Schedule, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	// A single field is an interval
+	fields := strings.Fields(value)
+	if len(fields) == 1 {
+		every, err := time.ParseDuration(value)
+		if err != nil || every < time.Minute {
+			return nil, fmt.Errorf("SCHEDULE interval must be a duration of at least 1m (Ex: '30m'), it is currently '%s'", value)
+		}
+		return intervalSchedule{every: every}, nil
+	}
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("SCHEDULE cron expression must have 5 fields (minute hour day month weekday), '%s' has %d", value, len(fields))
+	}
+
+	var s cronSchedule
+	var err error
+	ranges := []struct {
+		field    *map[int]bool
+		min, max int
+		name     string
+	}{
+		{&s.minutes, 0, 59, "minute"},
+		{&s.hours, 0, 23, "hour"},
+		{&s.days, 1, 31, "day of month"},
+		{&s.months, 1, 12, "month"},
+		{&s.weekdays, 0, 6, "day of week"},
+	}
+	for i, r := range ranges {
+		*r.field, err = parseCronField(fields[i], r.min, r.max)
+		if err != nil {
+			return nil, fmt.Errorf("SCHEDULE %s field: %w", r.name, err)
+		}
+	}
+	s.anyDay = fields[2] == "*"
+	s.anyWeekday = fields[4] == "*"
+
+	return s, nil
+}
+
+// Parses one cron field into the set of values it matches
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+
+	for _, part := range strings.Split(field, ",") {
+		// Optional step (Ex: */15 or 0-30/5)
+		step := 1
+		base, stepStr, hasStep := strings.Cut(part, "/")
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in '%s'", part)
+			}
+			part, step = base, n
+		}
+
+		// Range of values (Ex: * or 1-5 or 3)
+		low, high := min, max
+		if part != "*" {
+			lowStr, highStr, isRange := strings.Cut(part, "-")
+			var err error
+			low, err = strconv.Atoi(lowStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value '%s'", part)
+			}
+
+			// A single value with a step runs from that value to the end (Ex: 5/15 is 5,20,35,50)
+			high = low
+			if hasStep && !isRange {
+				high = max
+			}
+			if isRange {
+				high, err = strconv.Atoi(highStr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value '%s'", part)
+				}
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("'%s' is outside of %d-%d", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Possible sentiment tags for an article
+const (
+	SentimentPositive = "positive"
+	SentimentNegative = "negative"
+	SentimentNeutral  = "neutral"
+)
+
+var (
+	// Optional endpoint that classifies text (if empty, the lexicon is used)
+	sentimentURL = strings.Trim(os.Getenv("SENTIMENT_URL"), "'\"")
+
+	// Small lexicon of words that lean positive or negative
+	positiveWords = map[string]struct{}{
+		"good": {}, "great": {}, "best": {}, "win": {}, "wins": {}, "won": {}, "success": {}, "successful": {},
+		"growth": {}, "gain": {}, "gains": {}, "rise": {}, "rises": {}, "record": {}, "boost": {}, "improve": {},
+		"improves": {}, "improved": {}, "positive": {}, "happy": {}, "love": {}, "strong": {}, "breakthrough": {},
+		"celebrate": {}, "hope": {}, "recovery": {}, "safe": {}, "profit": {}, "surge": {}, "innovative": {},
+	}
+	negativeWords = map[string]struct{}{
+		"bad": {}, "worst": {}, "lose": {}, "loses": {}, "lost": {}, "loss": {}, "fail": {}, "fails": {},
+		"failure": {}, "crash": {}, "fall": {}, "falls": {}, "drop": {}, "drops": {}, "decline": {}, "crisis": {},
+		"war": {}, "death": {}, "dead": {}, "kill": {}, "killed": {}, "attack": {}, "fear": {}, "risk": {},
+		"scandal": {}, "fraud": {}, "lawsuit": {}, "negative": {}, "weak": {}, "threat": {}, "hack": {},
+	}
+)
+
+// Response expected back from the sentiment endpoint
+type sentimentResponse struct {
+	Label string `json:"label"`
+}
+
+// Returns whether the string is a supported sentiment tag
+func isValidSentiment(tag string) bool {
+	return tag == SentimentPositive || tag == SentimentNegative || tag == SentimentNeutral
+}
+
+// Tags every article that does not have a sentiment yet
+// Articles loaded from older database rows will be tagged here too
+func tagArticles(resp *NewsAPIResponse) {
+	for i := range resp.Articles {
+		if resp.Articles[i].Sentiment == "" {
+			resp.Articles[i].Sentiment = classifySentiment(resp.Articles[i].Title + " " + resp.Articles[i].Description)
+		}
+	}
+}
+
+// Classifies the text as positive, negative, or neutral
+// Uses the configured endpoint if there is one, falling back to the lexicon if it fails
+func classifySentiment(text string) string {
+	if sentimentURL != "" {
+		if tag, ok := classifyWithEndpoint(text); ok {
+			return tag
+		}
+	}
+	return classifyWithLexicon(text)
+}
+
+// Scores text by counting positive and negative words
+func classifyWithLexicon(text string) string {
+	score := 0
+
+	// Split on anything that isn't a letter so punctuation doesn't get in the way
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return r < 'a' || r > 'z'
+	})
+
+	for _, word := range words {
+		if _, ok := positiveWords[word]; ok {
+			score++
+		}
+		if _, ok := negativeWords[word]; ok {
+			score--
+		}
+	}
+
+	switch {
+	case score > 0:
+		return SentimentPositive
+	case score < 0:
+		return SentimentNegative
+	default:
+		return SentimentNeutral
+	}
+}
+
+// Sends the text to the sentiment endpoint, returning false if it could not be classified
+func classifyWithEndpoint(text string) (string, bool) {
+	payload, _ := json.Marshal(map[string]string{"text": text})
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(sentimentURL, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	var result sentimentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", false
+	}
+
+	// Only accept labels that this program understands
+	label := strings.ToLower(result.Label)
+	if !isValidSentiment(label) {
+		return "", false
+	}
+	return label, true
+}
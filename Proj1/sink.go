@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Where the results of a request are sent (selected with OUTPUT, Ex: OUTPUT='stdout,kafka')
+type OutputSink interface {
+	// Name of the sink, shown when a write fails
+	Name() string
+
+	// Sends the results of one request
+	Write(result SearchResult) error
+
+	// Flushes anything that is left and releases the sink
+	Close() error
+}
+
+// Results of one request, after the articles that don't match it were removed
+type SearchResult struct {
+	Query     string    `json:"query"`
+	Days      string    `json:"days"`
+	To        string    `json:"to,omitempty"`
+	Limit     int       `json:"limit"`
+	Sentiment string    `json:"sentiment,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	File      string    `json:"file"`
+	Line      int       `json:"line"`
+	Location  string    `json:"location"`
+	Timezone  string    `json:"timezone"`
+	Articles  []Article `json:"articles"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// How many results the News API said it has for the query (more than it sends for a single request)
+	TotalResults int `json:"total_results"`
+
+	// Request that had no results, if these are the results of a relaxed version of it
+	RelaxedFrom *SearchRequest `json:"relaxed_from,omitempty"`
+
+	// How much of the date range came from the cache, if only part of it was cached
+	Coverage *Coverage `json:"coverage,omitempty"`
+}
+
+// Every sink that results are written to (stdout unless OUTPUT says otherwise)
+var outputSinks []OutputSink
+
+// Opens every sink listed in OUTPUT (a comma-separated list of stdout, timeline, json, file, webhook, and kafka)
+//
+//	timeline: prints each request's results like stdout, grouped into Today, Yesterday, This Week, and Older (with a count for each)
+//	json:    prints each request's results to stdout as indented JSON (with the article metadata if ENRICH=true)
+//	file:    appends one JSON line per request to OUTPUT_FILE (default results.jsonl)
+//	webhook: POSTs each request's results as JSON to OUTPUT_WEBHOOK
+//	kafka:   writes each request's results to KAFKA_TOPIC (default news_results) on KAFKA_BROKERS
+func openSinks() error {
+	output := strings.Trim(os.Getenv("OUTPUT"), "'\"")
+	if output == "" {
+		output = "stdout"
+	}
+
+	for _, name := range strings.Split(output, ",") {
+		var sink OutputSink
+		var err error
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "stdout":
+			sink = stdoutSink{}
+		case "timeline":
+			sink = timelineSink{}
+		case "json":
+			sink = &jsonSink{}
+		case "file":
+			sink, err = newFileSink(strings.Trim(os.Getenv("OUTPUT_FILE"), "'\""))
+		case "webhook":
+			sink, err = newWebhookSink(strings.Trim(os.Getenv("OUTPUT_WEBHOOK"), "'\""))
+		case "kafka":
+			sink, err = newKafkaSink(strings.Trim(os.Getenv("KAFKA_BROKERS"), "'\""), strings.Trim(os.Getenv("KAFKA_TOPIC"), "'\""))
+		default:
+			err = fmt.Errorf("OUTPUT '%s' is not one of stdout, timeline, json, file, webhook, or kafka", name)
+		}
+		if err != nil {
+			return err
+		}
+
+		outputSinks = append(outputSinks, sink)
+	}
+	return nil
+}
+
+// Sends the result to every sink (after adding it to its query's statistics and the HTML report), recording a failure for each sink that could not be written to
+func writeResult(result SearchResult) {
+	// Add the Open Graph tags of shown articles that were not stored with them (if ENRICH=true)
+	enrichArticles(result.Articles)
+
+	recordQueryResult(result)
+	recordReportResult(result)
+	for _, sink := range outputSinks {
+		if err := sink.Write(result); err != nil {
+			recordFailure(&SinkError{Sink: sink.Name(), Query: result.Query, Err: err})
+		}
+	}
+}
+
+// Closes every sink (called once, before the program exits)
+func closeSinks() {
+	for _, sink := range outputSinks {
+		if err := sink.Close(); err != nil {
+			fmt.Printf("Could not close the %s output: %s\n", sink.Name(), err)
+		}
+	}
+}
+
+// Prints the results in the same format the program has always used
+type stdoutSink struct{}
+
+func (stdoutSink) Name() string {
+	return "stdout"
+}
+
+func (stdoutSink) Write(result SearchResult) error {
+	// In watch mode, only the articles that weren't seen in an earlier fetch are printed (as BREAKING news, when they are fetched)
+	if watching {
+		return nil
+	}
+
+	// Uses a string Builder to make sure all input prints out together at once
+	// This avoids concurrency issues
+	var sb strings.Builder
+	writeResultHeader(&sb, result)
+
+	// For each of the top results, print information (with the query's terms highlighted)
+	h := newHighlighter(result.Query)
+	for i, article := range result.Articles {
+		writeArticle(&sb, i+1, article, h)
+	}
+
+	// Print message if results were empty
+	if len(result.Articles) == 0 {
+		fmt.Fprintln(&sb, "\nNo articles matched the request...")
+	}
+
+	// Print the final built String
+	fmt.Print(sb.String())
+	return nil
+}
+
+func (stdoutSink) Close() error {
+	return nil
+}
+
+// Writes what the results are for (the request, its filters, and how much of it came from the cache)
+func writeResultHeader(sb *strings.Builder, result SearchResult) {
+	// Display that request was processed (and what it replaced if it was relaxed)
+	if orig := result.RelaxedFrom; orig != nil {
+		fmt.Fprintf(sb, "\n--- NO RESULTS FOR '%s' (Days=%s); SHOWING RESULTS FOR '%s' (Days=%s) INSTEAD ---", orig.Query, dateRangeText(orig.Days, orig.To), result.Query, dateRangeText(result.Days, result.To))
+	}
+	fmt.Fprintf(sb, "\n--- USING: %s, RESULTS FOR QUERY: %s (Days=%s %s, Limit=%d) FROM %s:%d ---\n", result.Location, result.Query, dateRangeText(result.Days, result.To), result.Timezone, result.Limit, result.File, result.Line)
+	if result.Sentiment != "" {
+		fmt.Fprintf(sb, "--- ONLY SHOWING %s ARTICLES ---\n", strings.ToUpper(result.Sentiment))
+	}
+	if result.Source != "" {
+		fmt.Fprintf(sb, "--- ONLY SHOWING ARTICLES FROM %s ---\n", strings.ToUpper(result.Source))
+	}
+	if c := result.Coverage; c != nil {
+		fmt.Fprintf(sb, "--- COVERAGE: %.0f%% FROM %s (%d DAYS), %.0f%% FROM API (%d DAYS) ---\n", c.Percent, c.Source, c.CachedDays, 100-c.Percent, c.FetchedDays)
+	}
+}
+
+// Writes the article's information, numbered by its place in the results
+// The query's terms are highlighted in the title and description, and the snippet around the first one is added if SNIPPET=true
+func writeArticle(sb *strings.Builder, number int, article Article, h *highlighter) {
+	fmt.Fprintf(sb, "ENTRY %d: %s\n", number, h.mark(article.Title))
+	fmt.Fprintf(sb, "PUBLISH DATE: %s\n", article.PublishedAt)
+	fmt.Fprintf(sb, "DESCRIPTION: %s\n", h.mark(article.Description))
+	if snippetEnabled {
+		if snippet, found := h.snippet(article.Content); found {
+			fmt.Fprintf(sb, "SNIPPET: %s\n", snippet)
+		}
+	}
+	fmt.Fprintf(sb, "SENTIMENT: %s\n", article.Sentiment)
+	fmt.Fprintf(sb, "URL: %s\n", article.URL)
+	if m := article.Metadata; m != nil && m.Image != "" {
+		fmt.Fprintf(sb, "IMAGE: %s\n", m.Image)
+	}
+	fmt.Fprintln(sb)
+}
+
+// Prints every result to stdout as indented JSON
+type jsonSink struct {
+	mu sync.Mutex
+}
+
+func (s *jsonSink) Name() string {
+	return "json"
+}
+
+func (s *jsonSink) Write(result SearchResult) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Workers print at the same time, so each result is printed whole
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Println(string(data))
+	return err
+}
+
+func (s *jsonSink) Close() error {
+	return nil
+}
+
+// Appends every result to a file as a line of JSON
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	if path == "" {
+		path = "results.jsonl"
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open OUTPUT_FILE: %w", err)
+	}
+	return &fileSink{path: path, file: file}, nil
+}
+
+func (s *fileSink) Name() string {
+	return "file " + s.path
+}
+
+func (s *fileSink) Write(result SearchResult) error {
+	line, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	// Workers write at the same time, so each line is written whole
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
+
+// POSTs every result as JSON to a URL
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSink(url string) (*webhookSink, error) {
+	if url == "" {
+		return nil, fmt.Errorf("OUTPUT includes webhook, but OUTPUT_WEBHOOK is not set")
+	}
+	return &webhookSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (s *webhookSink) Name() string {
+	return "webhook " + s.url
+}
+
+func (s *webhookSink) Write(result SearchResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
+
+// Writes every result to a Kafka topic, keyed by query (so results for the same query stay in order)
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSink(brokers, topic string) (*kafkaSink, error) {
+	if brokers == "" {
+		return nil, fmt.Errorf("OUTPUT includes kafka, but KAFKA_BROKERS is not set")
+	}
+	if topic == "" {
+		topic = "news_results"
+	}
+
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      strings.Split(brokers, ","),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 10 * time.Millisecond,
+		BatchSize:    1,
+	})
+	return &kafkaSink{writer: writer}, nil
+}
+
+func (s *kafkaSink) Name() string {
+	return "kafka " + s.writer.Topic
+}
+
+func (s *kafkaSink) Write(result SearchResult) error {
+	value, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return s.writer.WriteMessages(context.Background(), kafka.Message{Key: []byte(result.Query), Value: value})
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
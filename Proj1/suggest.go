@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Whether requests with no results are retried with relaxed parameters (turned off with SUGGEST=false)
+var suggestionsEnabled = strings.Trim(os.Getenv("SUGGEST"), "'\"") != "false"
+
+// Furthest back a relaxed request searches (the free News API plan only has about a month of articles)
+const maxRelaxedDays = 30
+
+// Tries relaxed versions of a request that had no results, printing the first one that has results
+func suggestRelaxed(req SearchRequest, apiKey string) {
+	for _, relaxed := range relaxedRequests(req) {
+		resp, location, err := lookupRelaxed(relaxed, apiKey)
+		if err != nil {
+			fmt.Printf("Could not look up suggestion '%s' for '%s': %s\n", relaxed.Query, req.Query, err)
+			return
+		}
+
+		for _, article := range resp.Articles {
+			if articleMatches(relaxed, article) {
+				printResponse(relaxed, resp, location)
+				return
+			}
+		}
+	}
+
+	fmt.Printf("No relaxed version of query '%s' had results either.\n", req.Query)
+}
+
+// Returns the relaxed versions of the request, from the smallest change to the largest
+// First the date range is made longer, then the rarest term is dropped from the query, then both
+func relaxedRequests(req SearchRequest) []SearchRequest {
+	relaxed := []SearchRequest{}
+	original := req
+
+	// Longer date range (at least a week, doubled, up to maxRelaxedDays)
+	requestDate, _ := time.Parse("2006-01-02", req.Days)
+	today := userToday()
+	days := int(today.Sub(requestDate).Hours()/24) + 1
+	longerDays := min(max(days*2, 7), maxRelaxedDays)
+
+	longer := ""
+	if longerDays > days {
+		longer = daysToDate(longerDays)
+		relaxed = append(relaxed, SearchRequest{Query: req.Query, Days: longer})
+	}
+
+	// Simplified query (only possible if there is more than one term)
+	if simplified, ok := dropRarestTerm(req.Query); ok {
+		relaxed = append(relaxed, SearchRequest{Query: simplified, Days: req.Days})
+		if longer != "" {
+			relaxed = append(relaxed, SearchRequest{Query: simplified, Days: longer})
+		}
+	}
+
+	// Everything else stays the same as the original request
+	for i := range relaxed {
+		relaxed[i].Limit = req.Limit
+		relaxed[i].Sentiment = req.Sentiment
+		relaxed[i].Source = req.Source
+		relaxed[i].To = req.To
+		relaxed[i].File = req.File
+		relaxed[i].Line = req.Line
+		relaxed[i].RelaxedFrom = &original
+	}
+	return relaxed
+}
+
+// Removes the rarest term from the query, returning false if there is only one term
+// Longer words tend to be rarer, so the longest term is treated as the rarest (the last one if there is a tie)
+func dropRarestTerm(query string) (string, bool) {
+	terms := strings.Fields(query)
+	if len(terms) < 2 {
+		return "", false
+	}
+
+	rarest := 0
+	for i, term := range terms {
+		if len(term) >= len(terms[rarest]) {
+			rarest = i
+		}
+	}
+
+	return strings.Join(append(terms[:rarest:rarest], terms[rarest+1:]...), " "), true
+}
+
+// Gets the results for a relaxed request from the in-memory cache, the database, or the API (in that order)
+// Returns where the results came from
+func lookupRelaxed(req SearchRequest, apiKey string) (NewsAPIResponse, string, error) {
+	if cached, inCache := loadFromCache(req); inCache {
+		return cached, "CACHE", nil
+	}
+	if fetched, wasFetched := waitForFetch(req); wasFetched {
+		return fetched, "CACHE", nil
+	}
+	if results, inDB := loadFromDatabase(req); inDB {
+		return *results, "DATABASE", nil
+	}
+
+	// Only requests with the same query (and a covered date range) are locked, like the main path
+	// A worker that waited here finds the results the other worker fetched in the cache
+	mu := getQueryMutex(req)
+	mu.Lock()
+	defer mu.Unlock()
+	if cached, inCache := loadFromCache(req); inCache {
+		return cached, "CACHE", nil
+	}
+
+	resp, err := fetchFromAPI(req, apiKey)
+	return resp, "API", err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Buckets of the timeline, from the newest articles to the oldest
+var timelineBuckets = []string{"TODAY", "YESTERDAY", "THIS WEEK", "OLDER"}
+
+// Prints the results like stdout, grouped by how long ago each article was published (in the user's time zone)
+// Multi-day requests are easier to read this way than as one flat list
+type timelineSink struct{}
+
+func (timelineSink) Name() string {
+	return "timeline"
+}
+
+func (timelineSink) Write(result SearchResult) error {
+	// Uses a string Builder to make sure all input prints out together at once
+	// This avoids concurrency issues
+	var sb strings.Builder
+	writeResultHeader(&sb, result)
+
+	// Articles keep their order (and their entry number) within each bucket
+	indexes := make(map[string][]int)
+	for i, article := range result.Articles {
+		bucket := ageBucket(article.PublishedAt)
+		indexes[bucket] = append(indexes[bucket], i)
+	}
+
+	// Count of every bucket, then the articles of each bucket that has any
+	counts := make([]string, len(timelineBuckets))
+	for i, bucket := range timelineBuckets {
+		counts[i] = fmt.Sprintf("%s: %d", bucket, len(indexes[bucket]))
+	}
+	fmt.Fprintf(&sb, "--- TIMELINE: %s ---\n", strings.Join(counts, ", "))
+
+	h := newHighlighter(result.Query)
+	for _, bucket := range timelineBuckets {
+		if len(indexes[bucket]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n=== %s (%d) ===\n", bucket, len(indexes[bucket]))
+		for _, i := range indexes[bucket] {
+			writeArticle(&sb, i+1, result.Articles[i], h)
+		}
+	}
+
+	// Print message if results were empty
+	if len(result.Articles) == 0 {
+		fmt.Fprintln(&sb, "\nNo articles matched the request...")
+	}
+
+	// Print the final built String
+	fmt.Print(sb.String())
+	return nil
+}
+
+func (timelineSink) Close() error {
+	return nil
+}
+
+// Returns the timeline bucket of an article published at the given time
+// Today and yesterday are the user's (in TIMEZONE), this week is the 5 days before yesterday, and anything unreadable is older
+func ageBucket(publishedAt string) string {
+	published, err := time.Parse(time.RFC3339, publishedAt)
+	if err != nil {
+		return "OLDER"
+	}
+
+	// Count whole days between the dates, not 24 hour periods
+	date, _ := time.Parse("2006-01-02", published.In(userLocation).Format("2006-01-02"))
+	days := int(userToday().Sub(date).Hours() / 24)
+
+	switch {
+	case days <= 0:
+		return "TODAY"
+	case days == 1:
+		return "YESTERDAY"
+	case days < 7:
+		return "THIS WEEK"
+	default:
+		return "OLDER"
+	}
+}
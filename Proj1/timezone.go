@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	// The runtime image has no time zone database, so it is built into the program
+	_ "time/tzdata"
+)
+
+// Time zone that "days" are counted in (set by TIMEZONE, Ex: TIMEZONE='America/New_York')
+// Containers usually run in UTC, so without it "1 day" can start hours before or after the user's today
+var userLocation = time.Local
+
+// Loads the time zone from TIMEZONE (the server's time zone is used if it is not set)
+func loadTimezone() error {
+	name := strings.Trim(os.Getenv("TIMEZONE"), "'\"")
+	if name == "" {
+		return nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("TIMEZONE '%s' is not a known time zone (Ex: 'America/New_York'): %w", name, err)
+	}
+	userLocation = location
+	return nil
+}
+
+// Returns the current time in the user's time zone
+func userNow() time.Time {
+	return time.Now().In(userLocation)
+}
+
+// Returns the start of the user's today (as a date with no time, so days between dates can be counted)
+func userToday() time.Time {
+	today, _ := time.Parse("2006-01-02", userNow().Format("2006-01-02"))
+	return today
+}
+
+// Returns the date of the request that covers the given number of days (1 day is the user's today, 2 days starts yesterday, ...)
+func daysToDate(days int) string {
+	return userNow().AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+}
+
+// Returns the name of the user's time zone, shown with the results
+func timezoneName() string {
+	return userLocation.String()
+}
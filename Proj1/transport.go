@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Creates the transport that API calls are sent over, sized for the worker pool
+// Every worker can keep its own connection open between calls, so large input files reuse a few connections
+// instead of opening a new one (and paying for a new TLS handshake) for every call
+func newAPITransport(numWorkers int) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+
+		// Use HTTP/2 when the server supports it, so every worker can share a single connection
+		ForceAttemptHTTP2: true,
+
+		// Keep one idle connection per worker (all calls go to the same host), plus a few for sentiment and retries
+		MaxIdleConns:        numWorkers + 4,
+		MaxIdleConnsPerHost: numWorkers + 4,
+
+		// Never have more open connections than workers to the same host, so ports are not used up
+		MaxConnsPerHost: numWorkers,
+
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+
+		// Ask for gzip responses (the transport decompresses them before they are read)
+		DisableCompression: false,
+	}
+}
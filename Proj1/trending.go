@@ -0,0 +1,164 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Defaults of the TRENDING mode (TRENDING_DAYS and TRENDING_TOP)
+const (
+	defaultTrendingDays = 7
+	defaultTrendingTop  = 20
+)
+
+// Common words that are never trending (the words of the cached queries are also left out, since every article of a query has them)
+// Words shorter than 3 letters are always left out, so they are not listed
+var stopWords = map[string]struct{}{
+	"about": {}, "above": {}, "after": {}, "again": {}, "against": {}, "all": {}, "also": {}, "and": {}, "any": {},
+	"are": {}, "because": {}, "been": {}, "before": {}, "being": {}, "below": {}, "between": {}, "both": {}, "but": {},
+	"can": {}, "could": {}, "did": {}, "does": {}, "doing": {}, "down": {}, "during": {}, "each": {}, "few": {},
+	"for": {}, "from": {}, "further": {}, "had": {}, "has": {}, "have": {}, "having": {}, "her": {}, "here": {},
+	"hers": {}, "him": {}, "his": {}, "how": {}, "into": {}, "its": {}, "itself": {}, "just": {}, "like": {}, "may": {},
+	"might": {}, "more": {}, "most": {}, "much": {}, "must": {}, "new": {}, "nor": {}, "not": {}, "now": {}, "off": {},
+	"once": {}, "only": {}, "other": {}, "our": {}, "ours": {}, "out": {}, "over": {}, "own": {}, "said": {}, "same": {},
+	"says": {}, "she": {}, "should": {}, "some": {}, "such": {}, "than": {}, "that": {}, "the": {}, "their": {},
+	"theirs": {}, "them": {}, "then": {}, "there": {}, "these": {}, "they": {}, "this": {}, "those": {}, "through": {},
+	"too": {}, "under": {}, "until": {}, "upon": {}, "very": {}, "was": {}, "were": {}, "what": {}, "when": {},
+	"where": {}, "which": {}, "while": {}, "who": {}, "whom": {}, "why": {}, "will": {}, "with": {}, "would": {},
+	"year": {}, "years": {}, "you": {}, "your": {}, "yours": {}, "amp": {}, "chars": {}, "get": {}, "gets": {}, "got": {},
+	"make": {}, "makes": {}, "one": {}, "two": {}, "three": {}, "first": {}, "last": {}, "week": {}, "today": {},
+	"yesterday": {},
+}
+
+// Term that shows up in the cached articles, and how many articles have it
+type TrendingTerm struct {
+	Term     string
+	Articles int
+}
+
+// Runs the TRENDING mode, which lists the most frequent keywords of every article cached from the last TRENDING_DAYS days
+// No API calls are made, so it only shows what earlier runs have saved
+func runTrendingMode() {
+	days := envPositiveInt("TRENDING_DAYS", defaultTrendingDays)
+	top := envPositiveInt("TRENDING_TOP", defaultTrendingTop)
+
+	rows, err := store.Rows()
+	check(err)
+
+	// Each article is counted once, even if several queries or date ranges cached it
+	since := userToday().AddDate(0, 0, -(days - 1))
+	seen := make(map[string]bool)
+	queryWords := make(map[string]bool)
+	articles := []Article{}
+	for _, row := range rows {
+		for _, word := range tokenize(row.Query) {
+			queryWords[word] = true
+		}
+
+		var resp NewsAPIResponse
+		if err := decodeStored(row.Data, &resp); err != nil {
+			fmt.Printf("Skipping cached results for '%s' (Days=%s), they could not be read: %s\n", row.Query, row.Days, err)
+			continue
+		}
+		for _, article := range resp.Articles {
+			if seen[article.URL] || !publishedSince(article, since) {
+				continue
+			}
+			seen[article.URL] = true
+			articles = append(articles, article)
+		}
+	}
+
+	terms := trendingTerms(articles, queryWords)
+	fmt.Printf("\n--- TRENDING IN %d CACHED ARTICLES FROM THE LAST %d DAYS (SINCE %s %s) ---\n", len(articles), days, since.Format("2006-01-02"), timezoneName())
+	if len(terms) == 0 {
+		fmt.Println("\nNo cached articles in this range... (run the program on some queries first)")
+		return
+	}
+	for i, term := range terms[:min(top, len(terms))] {
+		fmt.Printf("%2d. %-25s %d articles\n", i+1, term.Term, term.Articles)
+	}
+}
+
+// Returns the terms of the articles' titles and descriptions (mentioned by at least two articles), most articles first
+// The query words are left out, and ties are sorted alphabetically
+func trendingTerms(articles []Article, queryWords map[string]bool) []TrendingTerm {
+	counts := make(map[string]int)
+	for _, article := range articles {
+		// Count each term once per article, so a word repeated in one article doesn't trend
+		terms := make(map[string]bool)
+		for _, word := range tokenize(article.Title + " " + article.Description) {
+			if !queryWords[word] {
+				terms[word] = true
+			}
+		}
+		for term := range terms {
+			counts[term]++
+		}
+	}
+
+	trending := []TrendingTerm{}
+	for term, count := range counts {
+		if count >= 2 {
+			trending = append(trending, TrendingTerm{Term: term, Articles: count})
+		}
+	}
+	slices.SortFunc(trending, func(a, b TrendingTerm) int {
+		return cmp.Or(b.Articles-a.Articles, strings.Compare(a.Term, b.Term))
+	})
+	return trending
+}
+
+// Splits the text into lowercase words, leaving out stop words, numbers, and words shorter than 3 letters
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := []string{}
+	for _, word := range words {
+		if _, err := strconv.Atoi(word); err == nil || len([]rune(word)) < 3 || isStopWord(word) {
+			continue
+		}
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// Returns whether the word is too common to trend
+func isStopWord(word string) bool {
+	_, found := stopWords[word]
+	return found
+}
+
+// Returns whether the article was published on or after the date (in the user's time zone)
+// Articles without a readable publish date are left out
+func publishedSince(article Article, since time.Time) bool {
+	published, err := time.Parse(time.RFC3339, article.PublishedAt)
+	if err != nil {
+		return false
+	}
+	date, _ := time.Parse("2006-01-02", published.In(userLocation).Format("2006-01-02"))
+	return !date.Before(since)
+}
+
+// Returns the environment variable as a positive number, or the default if it is not set or not valid
+func envPositiveInt(name string, defaultValue int) int {
+	value := strings.Trim(os.Getenv(name), "'\"")
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		fmt.Printf("%s needs to be a positive number! It is currently %s. Defaulting to %d.\n", name, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Articles dropped this run because the News API sent them with missing or invalid fields (counted by reason)
+var (
+	droppedMu       sync.Mutex
+	droppedArticles = make(map[string]int)
+)
+
+// Removes the articles of the response that are missing required fields or have invalid ones, so they are never cached
+// Optional fields that are invalid (Ex: a broken image URL) are cleared instead of dropping the article
+func validateResponse(request SearchRequest, response *NewsAPIResponse) {
+	valid := response.Articles[:0]
+	for _, article := range response.Articles {
+		reason := invalidArticle(&article)
+		if reason == "" {
+			valid = append(valid, article)
+			continue
+		}
+
+		droppedMu.Lock()
+		droppedArticles[reason]++
+		droppedMu.Unlock()
+		fmt.Printf("Dropped an article for '%s': %s\n", request.Query, reason)
+	}
+	response.Articles = valid
+}
+
+// Returns why the article is malformed, or an empty string if it is valid
+func invalidArticle(article *Article) string {
+	// The News API keeps articles that were taken down, but replaces all of their fields with "[Removed]"
+	if article.Title == "[Removed]" {
+		return "article was removed"
+	}
+	if strings.TrimSpace(article.Title) == "" {
+		return "missing title"
+	}
+	if strings.TrimSpace(article.Source.Name) == "" {
+		return "missing source name"
+	}
+	if !validURL(article.URL) {
+		return "invalid url"
+	}
+	if _, err := time.Parse(time.RFC3339, article.PublishedAt); err != nil {
+		return "invalid publishedAt date"
+	}
+
+	if article.URLToImage != "" && !validURL(article.URLToImage) {
+		article.URLToImage = ""
+	}
+	return ""
+}
+
+// Returns whether the link is an absolute http or https URL
+func validURL(link string) bool {
+	parsed, err := url.Parse(link)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// Prints how many malformed articles were dropped this run, by reason (nothing if none were)
+func printDroppedArticles() {
+	droppedMu.Lock()
+	defer droppedMu.Unlock()
+	if len(droppedArticles) == 0 {
+		return
+	}
+
+	reasons := make([]string, 0, len(droppedArticles))
+	total := 0
+	for reason, count := range droppedArticles {
+		reasons = append(reasons, reason)
+		total += count
+	}
+	sort.Strings(reasons)
+
+	fmt.Printf("\nDropped %d malformed articles:\n", total)
+	for _, reason := range reasons {
+		fmt.Printf("  %s: %d\n", reason, droppedArticles[reason])
+	}
+}
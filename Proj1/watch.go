@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// Whether the program runs on a SCHEDULE, so each fetch of a query is compared with the earlier ones
+	watching bool
+
+	// How long a URL that was seen stays quiet (WATCH_QUIET_PERIOD, Ex: '72h')
+	// Articles that are republished (the same URL with a new publish time) within it are not pushed again
+	watchQuietPeriod = 72 * time.Hour
+)
+
+// Turns on watch mode if the program runs on a SCHEDULE, and checks WATCH_QUIET_PERIOD
+func loadWatch(scheduled bool) error {
+	watching = scheduled
+	if !watching {
+		return nil
+	}
+
+	if quiet := strings.Trim(os.Getenv("WATCH_QUIET_PERIOD"), "'\""); quiet != "" {
+		period, err := time.ParseDuration(quiet)
+		if err != nil || period < 0 {
+			return fmt.Errorf("WATCH_QUIET_PERIOD '%s' must be a duration (Ex: '72h')", quiet)
+		}
+		watchQuietPeriod = period
+	}
+
+	fmt.Printf("Watching for breaking news: articles are pushed once, unless they are missing for longer than %s.\n", watchQuietPeriod)
+	return nil
+}
+
+// Returns the articles of the response whose URL wasn't in any fetch of the query within the quiet period, then records every URL as seen
+// The first fetch of a query only records its URLs, since every article would count as new
+func breakingArticles(request SearchRequest, resp NewsAPIResponse) []Article {
+	lastSeen, err := store.SeenURLs(request.Query)
+	if err != nil {
+		recordFailure(&CacheError{Op: "read", Query: request.Query, Err: err})
+		return nil
+	}
+
+	// Nothing was recorded for the query yet
+	firstFetch := len(lastSeen) == 0
+
+	now := time.Now()
+	urls := []string{}
+	breaking := []Article{}
+	for _, article := range resp.Articles {
+		seen, wasSeen := lastSeen[article.URL]
+		if !firstFetch && (!wasSeen || now.Sub(seen) > watchQuietPeriod) {
+			breaking = append(breaking, article)
+		}
+
+		// A URL that is in the results twice is only pushed once
+		lastSeen[article.URL] = now
+		urls = append(urls, article.URL)
+	}
+
+	err = store.MarkSeen(request.Query, urls, now)
+	if err != nil {
+		recordFailure(&CacheError{Op: "write", Query: request.Query, Err: err})
+	}
+
+	if len(breaking) > 0 {
+		fmt.Printf("\nBREAKING: %d new articles for '%s' since the last fetch:\n", len(breaking), request.Query)
+		for _, article := range breaking {
+			fmt.Printf("- %s (%s)\n", article.Title, article.URL)
+		}
+	}
+	return breaking
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Kafka topics for the optional air quality and UV index metrics
+var (
+	airQualityTopic = "air_quality"
+	uvIndexTopic    = "uv_index"
+)
+
+// Response from the Air Pollution forecast API (one entry per hour)
+type AirPollutionResponse struct {
+	List []struct {
+		Time int `json:"dt"`
+		Main struct {
+			AQI int `json:"aqi"`
+		} `json:"main"`
+		Components struct {
+			PM25 float64 `json:"pm2_5"`
+		} `json:"components"`
+	} `json:"list"`
+}
+
+// One day of the UV Index forecast API
+type UVIndexEntry struct {
+	Time  int     `json:"date"`
+	Value float64 `json:"value"`
+}
+
+// Air Quality Payload (AQI is from 1 = Good to 5 = Very Poor, PM2.5 is in μg/m³)
+type AirQualityPayload struct {
+	Location string
+	Date     string
+	AQI      float64
+	PM25     float64
+}
+
+// UV Index Payload
+type UVIndexPayload struct {
+	Location string
+	Date     string
+	UVI      float64
+}
+
+// Air quality and UV index readings for a set of coordinates
+// Either one is nil if it is turned off or could not be fetched
+type ExtraReadings struct {
+	airQuality *AirPollutionResponse
+	uvIndex    []UVIndexEntry
+}
+
+// Returns the topics of the optional metrics that are turned on
+func extraTopics() []string {
+	topics := []string{}
+	if config.AirQuality {
+		topics = append(topics, airQualityTopic)
+	}
+	if config.UVIndex {
+		topics = append(topics, uvIndexTopic)
+	}
+	return topics
+}
+
+// Fetches the optional readings that are turned on for the coordinates
+// These are extras, so a failed call is reported and the forecast is still published without them
+func fetchExtraReadings(lat, lon float32, days int) ExtraReadings {
+	var readings ExtraReadings
+
+	if config.AirQuality {
+		var results AirPollutionResponse
+		err := getJSON("air_pollution", func(key string) string {
+			return fmt.Sprintf("https://api.openweathermap.org/data/2.5/air_pollution/forecast?lat=%f&lon=%f&appid=%s", lat, lon, key)
+		}, &results)
+		if err != nil {
+			pipelineErrors.WithLabelValues("air_quality").Inc()
+			fmt.Printf("Could not get air quality for %f,%f: %s\n", lat, lon, err)
+		} else {
+			readings.airQuality = &results
+		}
+	}
+
+	if config.UVIndex {
+		var results []UVIndexEntry
+		err := getJSON("uv_index", func(key string) string {
+			return fmt.Sprintf("https://api.openweathermap.org/data/2.5/uvi/forecast?lat=%f&lon=%f&cnt=%d&appid=%s", lat, lon, days, key)
+		}, &results)
+		if err != nil {
+			pipelineErrors.WithLabelValues("uv_index").Inc()
+			fmt.Printf("Could not get UV index for %f,%f: %s\n", lat, lon, err)
+		} else {
+			readings.uvIndex = results
+		}
+	}
+
+	return readings
+}
+
+// Calls the API with the next API key and decodes the JSON response into result (giving up after the forecast timeout)
+func getJSON(endpoint string, buildURL func(key string) string, result any) error {
+	ctx, cancel := stageContext(config.Timeouts.Forecast)
+	defer cancel()
+
+	resp, err := apiKeys.Get(ctx, endpoint, buildURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Returns the air quality reading closest to the sample time (false if there is none within 3 hours)
+func (r ExtraReadings) airQualityAt(t time.Time) (AirQualityPayload, bool) {
+	if r.airQuality == nil {
+		return AirQualityPayload{}, false
+	}
+
+	found := false
+	var best AirQualityPayload
+	bestDiff := 3 * time.Hour
+	for _, entry := range r.airQuality.List {
+		diff := t.Sub(time.Unix(int64(entry.Time), 0)).Abs()
+		if diff <= bestDiff {
+			best = AirQualityPayload{AQI: float64(entry.Main.AQI), PM25: entry.Components.PM25}
+			bestDiff = diff
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Returns the UV index for the day of the sample (false if the forecast doesn't include that day)
+// Days are compared in the sample's time zone, which is the location's
+func (r ExtraReadings) uvIndexAt(t time.Time) (UVIndexPayload, bool) {
+	day := t.Format("2006-01-02")
+	for _, entry := range r.uvIndex {
+		if time.Unix(int64(entry.Time), 0).In(t.Location()).Format("2006-01-02") == day {
+			return UVIndexPayload{UVI: entry.Value}, true
+		}
+	}
+	return UVIndexPayload{}, false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// Topic that every alert transition gets published to
+var alertsTopic = "alerts"
+
+// Message published to the alerts topic when an alert turns on or off
+type AlertMessage struct {
+	Zip       string
+	Date      string
+	Metric    string
+	Direction string
+	Value     float64
+	Threshold float64
+	Active    bool
+}
+
+var (
+	// Last known state of each alert (keyed by zip-date-metric-direction), used to detect transitions
+	alertStateMu sync.Mutex
+	alertState   = make(map[string]bool)
+)
+
+// Sets the alert gauge to 1 or 0, and publishes a message to the alerts topic if the alert changed state
+// Alerts start off inactive, so the first time an alert is active counts as a transition
+// An alert that turns on is also pushed to the notification webhooks (replayed metrics have no writer, so they never are)
+func setAlert(gauge *prometheus.GaugeVec, msg WeatherMessage, metric, direction string, value, threshold float64, active bool, writer *kafka.Writer) {
+
+	// Set alert gauge to 1 or 0
+	if active {
+		gauge.WithLabelValues(msg.labels()...).Set(1)
+	} else {
+		gauge.WithLabelValues(msg.labels()...).Set(0)
+	}
+
+	// Check if this alert is different from the last time it was set
+	stateKey := fmt.Sprintf("%s-%s-%s-%s", msg.Zip, msg.Date, metric, direction)
+
+	alertStateMu.Lock()
+	previous := alertState[stateKey]
+	alertState[stateKey] = active
+	alertStateMu.Unlock()
+
+	// Nothing to publish if there is no writer or the alert did not change
+	if writer == nil || previous == active {
+		return
+	}
+
+	alert := AlertMessage{
+		Zip:       msg.Zip,
+		Date:      msg.Date,
+		Metric:    metric,
+		Direction: direction,
+		Value:     value,
+		Threshold: threshold,
+		Active:    active,
+	}
+	if active {
+		notifyAlert(stateKey, alert)
+	}
+
+	// Key matches the other topics (zipcode-date) so alerts for the same location stay together
+	key := fmt.Sprintf("%s-%s", msg.Zip, msg.Date)
+	alertBytes, _ := json.Marshal(alert)
+
+	err := writeMessages(writer, kafka.Message{Key: []byte(key), Value: alertBytes})
+	recordProduce(alertsTopic, err)
+	if err != nil {
+		fmt.Println("Error publishing alert:", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// How long a key is skipped after OpenWeatherMap throttles it (429)
+var keyCooldown = time.Minute
+
+// Requests made with each API key, by response status (keys are labeled by position so they are never exposed)
+var apiKeyRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "pipeline_api_key_requests_total",
+		Help: "OpenWeatherMap API calls made with each key",
+	},
+	[]string{"key", "status"},
+)
+
+// Ran before main()
+func init() {
+	safeRegister(apiKeyRequests, "pipeline_api_key_requests_total")
+}
+
+// Set of API keys that requests are spread across (round-robin)
+// A key that is throttled (429) is skipped until its cooldown ends, and a key that is rejected (401) is never used again
+type KeyPool struct {
+	mu   sync.Mutex
+	keys []string
+	next int
+
+	// When each key can be used again (zero if it is available)
+	coolingUntil []time.Time
+	revoked      []bool
+}
+
+// Pool used for every OpenWeatherMap API call (set at the start of main)
+var apiKeys *KeyPool
+
+// Creates a pool with the given keys (duplicates and empty keys are removed)
+func NewKeyPool(keys []string) *KeyPool {
+	p := &KeyPool{}
+	seen := make(map[string]struct{})
+	for _, key := range keys {
+		if _, exists := seen[key]; key == "" || exists {
+			continue
+		}
+		seen[key] = struct{}{}
+		p.keys = append(p.keys, key)
+	}
+	p.coolingUntil = make([]time.Time, len(p.keys))
+	p.revoked = make([]bool, len(p.keys))
+	return p
+}
+
+// Returns the next usable key and its position, skipping the given positions
+// If every key is cooling down or revoked, the key that has been cooling down the longest is used anyway
+func (p *KeyPool) pick(skip map[int]bool) (int, string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	fallback := -1
+	for range p.keys {
+		i := p.next
+		p.next = (p.next + 1) % len(p.keys)
+
+		if skip[i] || p.revoked[i] {
+			continue
+		}
+		if now.Before(p.coolingUntil[i]) {
+			if fallback == -1 || p.coolingUntil[i].Before(p.coolingUntil[fallback]) {
+				fallback = i
+			}
+			continue
+		}
+		return i, p.keys[i], true
+	}
+
+	if fallback != -1 {
+		return fallback, p.keys[fallback], true
+	}
+	return -1, "", false
+}
+
+// Marks the key as throttled (429) or rejected (401)
+func (p *KeyPool) report(i, status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch status {
+	case http.StatusTooManyRequests:
+		p.coolingUntil[i] = time.Now().Add(keyCooldown)
+		fmt.Printf("API key %d was throttled, skipping it for %s.\n", i+1, keyCooldown)
+	case http.StatusUnauthorized:
+		p.revoked[i] = true
+		fmt.Printf("API key %d was rejected, it will not be used again.\n", i+1)
+	}
+}
+
+// Makes a GET request to the URL built with the next key, failing over to the other keys on a 429 or 401
+// The request is cancelled with the context (which has to stay alive until the body is read)
+// If every key fails, the last response is returned so the caller can report the error
+func (p *KeyPool) Get(ctx context.Context, endpoint string, buildURL func(key string) string) (*http.Response, error) {
+	tried := make(map[int]bool)
+
+	// Response of the last key that was throttled or rejected (its body is closed once another key is tried)
+	var last *http.Response
+
+	for {
+		i, key, ok := p.pick(tried)
+		if !ok {
+			// Once every usable key was tried, the last response is returned, so a 429 stays a temporary error
+			if last != nil {
+				return last, nil
+			}
+			return nil, fmt.Errorf("%w: no usable OpenWeatherMap API keys", errFatal)
+		}
+		tried[i] = true
+		if last != nil {
+			last.Body.Close()
+			last = nil
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", buildURL(key), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		apiStart := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		observeAPILatency(endpoint, apiStart)
+		if err != nil {
+			apiKeyRequests.WithLabelValues(fmt.Sprintf("key%d", i+1), "error").Inc()
+			return nil, err
+		}
+		apiKeyRequests.WithLabelValues(fmt.Sprintf("key%d", i+1), fmt.Sprint(resp.StatusCode)).Inc()
+
+		// Only throttled or rejected keys fail over, and only while there are other keys to try
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusUnauthorized {
+			return resp, nil
+		}
+		p.report(i, resp.StatusCode)
+		last = resp
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Scrape config read by Prometheus (only the fields this program sets)
+type prometheusConfig struct {
+	Global struct {
+		ScrapeInterval string `yaml:"scrape_interval"`
+	} `yaml:"global"`
+	ScrapeConfigs []scrapeConfig `yaml:"scrape_configs"`
+}
+
+type scrapeConfig struct {
+	JobName       string `yaml:"job_name"`
+	StaticConfigs []struct {
+		Targets []string `yaml:"targets"`
+	} `yaml:"static_configs"`
+}
+
+// Grafana data source provisioning file (https://grafana.com/docs/grafana/latest/administration/provisioning/#data-sources)
+type datasourceProvisioning struct {
+	APIVersion  int                 `yaml:"apiVersion"`
+	Datasources []datasourceOptions `yaml:"datasources"`
+}
+
+type datasourceOptions struct {
+	Name      string `yaml:"name"`
+	Type      string `yaml:"type"`
+	Access    string `yaml:"access"`
+	URL       string `yaml:"url"`
+	IsDefault bool   `yaml:"isDefault"`
+	Editable  bool   `yaml:"editable"`
+}
+
+// Writes the Prometheus scrape config and the Grafana data source into the shared bootstrap directory (bootstrap.dir)
+// The Prometheus and Grafana containers wait for these files before starting, so they always match the config of the run
+// If Prometheus is already running with an older scrape config, it is asked to reload it
+func writeBootstrap() error {
+	if config.Bootstrap.Dir == "" {
+		return nil
+	}
+
+	// Prometheus scrape config
+	var prom prometheusConfig
+	prom.Global.ScrapeInterval = config.Bootstrap.ScrapeInterval
+	job := scrapeConfig{JobName: config.Bootstrap.JobName}
+	job.StaticConfigs = append(job.StaticConfigs, struct {
+		Targets []string `yaml:"targets"`
+	}{config.Bootstrap.Targets})
+	prom.ScrapeConfigs = []scrapeConfig{job}
+
+	promPath := filepath.Join(config.Bootstrap.Dir, "prometheus", "prometheus.yml")
+	changed, err := writeBootstrapYAML(promPath, prom)
+	if err != nil {
+		return err
+	}
+
+	// Extra command line flags, added by the container's entrypoint (retention can't be set in prometheus.yml)
+	flags := []byte(fmt.Sprintf("--storage.tsdb.retention.time=%s\n", config.Bootstrap.Retention))
+	if _, err := writeBootstrapFile(filepath.Join(config.Bootstrap.Dir, "prometheus", "flags"), flags); err != nil {
+		return err
+	}
+
+	// Grafana data source, so dashboards work before this program has called the Grafana API
+	grafanaConfig := datasourceProvisioning{
+		APIVersion: 1,
+		Datasources: []datasourceOptions{{
+			Name:      "Prometheus",
+			Type:      "prometheus",
+			Access:    "proxy",
+			URL:       config.PrometheusURL,
+			IsDefault: true,
+			Editable:  true,
+		}},
+	}
+	if _, err := writeBootstrapYAML(filepath.Join(config.Bootstrap.Dir, "grafana", "provisioning", "datasources", "datasource.yml"), grafanaConfig); err != nil {
+		return err
+	}
+
+	fmt.Printf("Bootstrap files written to %s (job %s scraping %v every %s, keeping %s)\n",
+		config.Bootstrap.Dir, config.Bootstrap.JobName, config.Bootstrap.Targets, config.Bootstrap.ScrapeInterval, config.Bootstrap.Retention)
+
+	// A Prometheus that started with the last run's scrape config has to reload it (needs --web.enable-lifecycle)
+	// Failing is fine, since Prometheus may still be waiting for the file (it reads the new one when it starts)
+	if changed {
+		client := &http.Client{Timeout: 5 * time.Second}
+		if resp, err := client.Post(config.PrometheusURL+"/-/reload", "", nil); err == nil {
+			resp.Body.Close()
+		}
+	}
+	return nil
+}
+
+// Writes the value as YAML to the path, returning whether the file changed
+func writeBootstrapYAML(path string, value any) (bool, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	return writeBootstrapFile(path, data)
+}
+
+// Writes the file through a temporary file, so Prometheus and Grafana never read a half-written one
+// Returns whether the file changed (an unchanged file is not written again)
+func writeBootstrapFile(path string, data []byte) (bool, error) {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"proj2/grafana"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// Request sent through the stack by the canary (a ZIP code the GeoCoding API always knows, for a single day)
+	canaryZip  = "10001"
+	canaryDays = 1
+
+	// Location label, topic, and dashboard UID used by the canary, so it never touches a real ZIP code's data
+	canaryLocation = "canary"
+	canaryTopic    = "canary"
+	canaryUID      = "canary"
+)
+
+// One step of the canary, run in order (a failed stage skips the rest, since they need its result)
+type canaryStage struct {
+	Name string
+	Run  func() (string, error)
+}
+
+// Sends one request through every stage of the stack (geocode, forecast, Kafka, consume, gauge, dashboard), then exits
+// Each stage is timed and printed as PASS or FAIL, so the docker-compose stack can be checked before a big batch
+//
+//	proj2 canary
+//
+// With Docker: docker-compose run --rm proj2 ./proj2 canary
+//
+// Nothing is saved to the TSDB, and the canary's gauges and dashboard are removed once they were seen
+// Returns the exit code of the command
+func runCanary() int {
+	var (
+		location PostLocationRequest
+		forecast APIResponse
+		payload  TemperaturePayload
+		key      string
+		consumed WeatherMessage
+	)
+
+	stages := []canaryStage{
+		{"geocode", func() (string, error) {
+			var found bool
+			location, found = convertToCoordinates(PreCoordinateRequest{Days: canaryDays, ZIPCode: canaryZip})
+			if !found {
+				return "", canaryError(fmt.Errorf("cannot find results for ZIP code '%s'", canaryZip))
+			}
+			return fmt.Sprintf("ZIP %s is %s (%.2f, %.2f)", canaryZip, location.Name, location.Lat, location.Lon), nil
+		}},
+
+		{"forecast", func() (string, error) {
+			forecast = fetchForecast(location.Lat, location.Lon, canaryDays*8)
+			if forecast.Cod != "200" || len(forecast.DaysList) == 0 {
+				return "", fmt.Errorf("forecast request failed: %v", forecast.Message)
+			}
+			sample := forecast.DaysList[0]
+			date := time.Unix(int64(sample.Time), 0).In(forecast.timeZone()).Format("2006-01-02")
+			payload = TemperaturePayload{Location: location.Name, Date: date, Temp: float64(sample.Main.Temp), FeelsLike: float64(sample.Main.FeelsLike)}
+			return fmt.Sprintf("%d samples, %s is %.1f%s", len(forecast.DaysList), date, payload.Temp, tempUnit()), nil
+		}},
+
+		{"kafka", func() (string, error) {
+			// Make sure the broker answers within the Kafka timeout (instead of waiting for it like a normal run)
+			ctx, cancel := stageContext(config.Timeouts.Kafka)
+			defer cancel()
+			conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+			if err != nil {
+				return "", err
+			}
+			conn.Close()
+
+			// The canary topic only keeps messages for an hour, since each one is only read once
+			err = createKafkaTopic(tenantTopic(canaryTopic), 1, kafka.ConfigEntry{ConfigName: "retention.ms", ConfigValue: "3600000"})
+			if err != nil {
+				return "", err
+			}
+
+			writer := kafka.NewWriter(kafka.WriterConfig{
+				Brokers:      brokers,
+				Topic:        tenantTopic(canaryTopic),
+				BatchTimeout: 10 * time.Millisecond,
+				BatchSize:    1,
+			})
+			defer writer.Close()
+
+			// Every canary run has its own key, so this run's message can be told apart from older ones
+			key = fmt.Sprintf("%s-%s", canaryLocation, runID)
+			value, _ := json.Marshal(payload)
+			if err := writeMessages(writer, kafka.Message{Key: []byte(key), Value: value}); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("wrote %s to the %s topic", key, tenantTopic(canaryTopic)), nil
+		}},
+
+		{"consume", func() (string, error) {
+			reader := kafka.NewReader(kafka.ReaderConfig{
+				Brokers:     brokers,
+				Topic:       tenantTopic(canaryTopic),
+				StartOffset: kafka.FirstOffset,
+				MaxWait:     100 * time.Millisecond,
+			})
+			defer reader.Close()
+
+			ctx, cancel := stageContext(config.Timeouts.Kafka)
+			defer cancel()
+			for {
+				m, err := reader.ReadMessage(ctx)
+				if err != nil {
+					return "", err
+				}
+				if string(m.Key) != key {
+					continue
+				}
+
+				// Decoded the same way as the real consumers
+				msg, ok := decodePayload("temperature", m.Value)
+				if !ok {
+					return "", fmt.Errorf("the message could not be decoded")
+				}
+				msg.Topic = "temperature"
+				msg.Zip = canaryLocation
+				msg.Date = payload.Date
+				consumed = msg
+				return fmt.Sprintf("read %s back at offset %d", key, m.Offset), nil
+			}
+		}},
+
+		{"gauge", func() (string, error) {
+			// The gauges are set like any other message (without publishing alerts), then found in what Prometheus scrapes
+			setGauges(consumed, nil)
+			defer deleteGauges(prometheus.Labels{"location": canaryLocation})
+
+			families, err := prometheus.DefaultGatherer.Gather()
+			if err != nil {
+				return "", err
+			}
+			for _, family := range families {
+				if family.GetName() != "temperature" {
+					continue
+				}
+				for _, metric := range family.GetMetric() {
+					for _, label := range metric.GetLabel() {
+						if label.GetName() == "location" && label.GetValue() == canaryLocation {
+							return fmt.Sprintf("temperature{location=%q} = %.1f", canaryLocation, metric.GetGauge().GetValue()), nil
+						}
+					}
+				}
+			}
+			return "", fmt.Errorf("the temperature gauge was not exposed")
+		}},
+
+		{"dashboard", func() (string, error) {
+			// Grafana should already be up when the stack is checked, so it only gets a few seconds
+			if err := waitForGrafana(10 * time.Second); err != nil {
+				return "", err
+			}
+			if err := grafanaClient.EnsurePrometheusDataSource("Prometheus", config.PrometheusURL); err != nil {
+				return "", err
+			}
+			if err := grafanaClient.EnsureFolder(weatherFolderUID, weatherFolderTitle); err != nil {
+				return "", err
+			}
+
+			// Push the canary's dashboard, read it back, then remove it
+			metrics, alerts := dashboardPanels()
+			uid := tenantUID(canaryUID)
+			dashboard := grafana.NewLocationDashboard(uid, "Weather Dashboard - Canary", weatherFolderUID, canaryLocation, metrics, alerts)
+			if err := grafanaClient.PushDashboard(dashboard); err != nil {
+				return "", err
+			}
+			defer grafanaClient.DeleteDashboard(uid)
+			if _, err := grafanaClient.GetDashboard(uid); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("pushed and read back dashboard %s", uid), nil
+		}},
+	}
+
+	fmt.Printf("Canary: sending ZIP %s through the stack...\n\n", canaryZip)
+	start := time.Now()
+	failed := ""
+	for _, stage := range stages {
+		if failed != "" {
+			fmt.Printf("SKIP  %-10s\n", stage.Name)
+			continue
+		}
+
+		stageStart := time.Now()
+		detail, err := stage.Run()
+		elapsed := time.Since(stageStart).Round(time.Millisecond)
+		if err != nil {
+			failed = stage.Name
+			fmt.Printf("FAIL  %-10s %8s  %s\n", stage.Name, elapsed, err)
+			continue
+		}
+		fmt.Printf("PASS  %-10s %8s  %s\n", stage.Name, elapsed, detail)
+	}
+
+	if failed != "" {
+		fmt.Printf("\nCanary failed at the %s stage after %s.\n", failed, time.Since(start).Round(time.Millisecond))
+		return exitFatal
+	}
+	fmt.Printf("\nCanary passed in %s, the stack is ready.\n", time.Since(start).Round(time.Millisecond))
+	return exitOK
+}
+
+// Returns the error that cancelled the run (Ex: an invalid API key or a timeout), or the given error if the run wasn't cancelled
+func canaryError(err error) error {
+	if runFailed() {
+		return context.Cause(runCtx)
+	}
+	return err
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// A subcommand of the program (Ex: proj2 export --format csv), run as proj2 <name> [flags]
+type command struct {
+	Name        string
+	Description string
+
+	// Whether the command needs the TSDB (opened before it runs, which also needs Kafka for the kafka backend)
+	NeedsStore bool
+
+	// Runs the command with the arguments after its name, returning the exit code
+	Run func(args []string) int
+}
+
+// Every subcommand, in the order they are listed in the usage (run is used when no command is given)
+var commands = []command{
+	{"run", "fetch the forecasts in the input file and publish them (the default)", true, runPipeline},
+	{"replay", "set the Prometheus gauges from the TSDB and serve them, without any API calls", true, runReplay},
+	{"export", "write every metric in the TSDB to a CSV or JSON file", true, runExportMetrics},
+	{"purge", "remove the metrics of dates that have already passed from the TSDB", true, runPurge},
+	{"validate", "check the input file without calling any API", false, runValidate},
+	{"provision", "create the Grafana dashboards without fetching any forecasts", true, runProvision},
+	{"janitor", "remove the ZIP codes that none of the last runs asked for", true, runJanitor},
+	{"canary", "send one request through every stage to check the stack", true, func([]string) int { return runCanary() }},
+}
+
+// Returns the command with the name
+func findCommand(name string) (command, bool) {
+	i := slices.IndexFunc(commands, func(c command) bool { return c.Name == name })
+	if i == -1 {
+		return command{}, false
+	}
+	return commands[i], true
+}
+
+// Prints every command (Ex: when the command isn't known)
+func printUsage() {
+	fmt.Println("Usage: proj2 [command] [flags]   (docker-compose run --rm proj2 ./proj2 <command>)")
+	fmt.Println("\nCommands:")
+	for _, c := range commands {
+		fmt.Printf("  %-10s %s\n", c.Name, c.Description)
+	}
+	fmt.Println("\nRun 'proj2 <command> -h' for the flags of a command.")
+}
+
+// Sets the Prometheus gauges from every metric in the TSDB, then serves them until ENTER is pressed
+// Nothing is fetched or published, so Prometheus (and the dashboards) can be brought back after it lost its data
+//
+//	proj2 replay
+//
+// With Docker: docker-compose run --rm --service-ports proj2 ./proj2 replay
+//
+// Returns the exit code of the command
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return exitFatal
+	}
+
+	replayed := 0
+	err := metricStore.Each(func(msg WeatherMessage) bool {
+		setGauges(msg, nil)
+		replayed++
+		return true
+	})
+	if err != nil {
+		fmt.Println("Error reading the TSDB:", err)
+		return exitFatal
+	}
+
+	go startMetrics()
+	fmt.Printf("Replayed %d metrics from the TSDB.\n", replayed)
+	fmt.Println("\nPrometheus metrics available at http://localhost:8080/metrics")
+	fmt.Println("Press 'ENTER' to shut down server.")
+	bufio.NewReader(os.Stdin).ReadBytes('\n')
+	return exitOK
+}
+
+// Writes every metric in the TSDB to a file, then exits
+//
+//	proj2 export                            CSV file in export.path (one row per metric value)
+//	proj2 export --format json              JSON file in export.path (one object per stored message)
+//	proj2 export --out /data/metrics.csv    a different file
+//
+// With Docker: docker-compose run --rm proj2 ./proj2 export --format json
+//
+// Returns the exit code of the command
+func runExportMetrics(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "csv", "format of the file: csv or json")
+	out := flags.String("out", "", "file to write to (defaults to metrics-<time>.<format> in export.path)")
+	if err := flags.Parse(args); err != nil {
+		return exitFatal
+	}
+	if *format != "csv" && *format != "json" {
+		fmt.Printf("Unknown export format '%s', use csv or json\n", *format)
+		return exitFatal
+	}
+
+	path := *out
+	if path == "" {
+		path = filepath.Join(config.Export.Path, fmt.Sprintf("metrics-%s.%s", time.Now().Format("20060102-150405"), *format))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Println("Error creating export directory:", err)
+		return exitFatal
+	}
+
+	messages := []WeatherMessage{}
+	err := metricStore.Each(func(msg WeatherMessage) bool {
+		messages = append(messages, msg)
+		return true
+	})
+	if err != nil {
+		fmt.Println("Error reading the TSDB:", err)
+		return exitFatal
+	}
+
+	if *format == "json" {
+		err = writeMetricsJSON(path, messages)
+	} else {
+		err = writeMetricsCSV(path, messages)
+	}
+	if err != nil {
+		fmt.Println("Error writing the export:", err)
+		return exitFatal
+	}
+
+	fmt.Printf("Exported %d stored messages to %s\n", len(messages), path)
+	return exitOK
+}
+
+// Writes the messages as an indented JSON array
+func writeMetricsJSON(path string, messages []WeatherMessage) error {
+	data, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Writes one row for each metric value of the messages (metrics in sorted order, so the file is the same for the same TSDB)
+func writeMetricsCSV(path string, messages []WeatherMessage) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"zip", "date", "topic", "metric", "value", "group", "run_id", "produced_at"})
+	for _, msg := range messages {
+		values := messageValues(msg)
+		producedAt := ""
+		if !msg.ProducedAt.IsZero() {
+			producedAt = msg.ProducedAt.UTC().Format(time.RFC3339)
+		}
+		for _, metric := range slices.Sorted(maps.Keys(values)) {
+			w.Write([]string{msg.Zip, msg.Date, msg.Topic, metric, strconv.FormatFloat(values[metric], 'f', -1, 64), msg.Group, msg.RunID, producedAt})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Removes the metrics of dates that have already passed from the TSDB, then exits
+// Past forecasts are never used again by a run (the forecast API only goes forward), so they only take up space
+//
+//	proj2 purge                 removes the metrics of dates before today
+//	proj2 purge --days 7        keeps the last 7 days of past metrics
+//	proj2 purge --dry-run       only counts the metrics that would be removed
+//
+// With Docker: docker-compose run --rm proj2 ./proj2 purge --days 7 --dry-run
+//
+// Returns the exit code of the command
+func runPurge(args []string) int {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	days := flags.Int("days", 0, "keep the metrics of this many days before today")
+	dryRun := flags.Bool("dry-run", false, "only count the metrics that would be removed")
+	if err := flags.Parse(args); err != nil {
+		return exitFatal
+	}
+	if *days < 0 {
+		fmt.Println("--days can't be negative")
+		return exitFatal
+	}
+
+	// Count what is stale first, so a dry run (and the real one) can say how much goes
+	before := time.Now().AddDate(0, 0, -*days).Format("2006-01-02")
+	stale := 0
+	zips := make(map[string]struct{})
+	err := metricStore.Each(func(msg WeatherMessage) bool {
+		if msg.Date < before {
+			stale++
+			zips[msg.Zip] = struct{}{}
+		}
+		return true
+	})
+	if err != nil {
+		fmt.Println("Error reading the TSDB:", err)
+		return exitFatal
+	}
+
+	if *dryRun {
+		fmt.Printf("Would remove %d stored messages dated before %s (%d ZIP codes).\n", stale, before, len(zips))
+		return exitOK
+	}
+	if err := metricStore.DeleteBefore(before); err != nil {
+		fmt.Println("Error purging the TSDB:", err)
+		return exitFatal
+	}
+	fmt.Printf("Removed %d stored messages dated before %s (%d ZIP codes).\n", stale, before, len(zips))
+	return exitOK
+}
+
+// Checks every line of the input file with the same rules as a run, without calling any API or opening the TSDB, then exits
+// Lists every invalid line, then how many requests and API calls (at most, since the TSDB isn't checked) the file needs
+//
+//	proj2 validate                   checks the input file from the config (FILE)
+//	proj2 validate --file inputY.txt checks a different file
+//
+// With Docker: docker-compose run --rm proj2 ./proj2 validate --file inputY.txt
+//
+// Returns the exit code of the command (the same code as STRICT mode if any line is invalid)
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	filePath := flags.String("file", config.File, "input file to check")
+	if err := flags.Parse(args); err != nil {
+		return exitFatal
+	}
+	if *filePath == "" {
+		fmt.Println("No input file to check, set one with --file or file (FILE)")
+		return exitFatal
+	}
+
+	file, err := os.Open(*filePath)
+	if err != nil {
+		fmt.Println("Error opening the input file:", err)
+		return exitFatal
+	}
+	defer file.Close()
+
+	var lines, invalid, requests int
+	zips := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+
+		// parseLine prints why a line is invalid
+		lineRequests, valid := parseLine(scanner.Text(), lines)
+		if !valid {
+			invalid++
+			continue
+		}
+		requests += len(lineRequests)
+		for _, req := range lineRequests {
+			zips[req.ZIPCode] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Println("Error reading the input file:", err)
+		return exitFatal
+	}
+
+	// Every ZIP code is geocoded once and shares one forecast call, and every request gets the air quality and UV index if they are on
+	calls := 2 * len(zips)
+	if config.AirQuality {
+		calls += requests
+	}
+	if config.UVIndex {
+		calls += requests
+	}
+
+	fmt.Printf("\n%s: %d lines, %d invalid, %d requests for %d ZIP codes, at most %d API calls.\n",
+		*filePath, lines, invalid, requests, len(zips), calls)
+	if config.Quota > 0 && calls > config.Quota {
+		fmt.Printf("WARNING: that can be over the quota (QUOTA) of %d, a run will check the TSDB and ask before continuing.\n", config.Quota)
+	}
+	if invalid > 0 {
+		return exitStrict
+	}
+	return exitOK
+}
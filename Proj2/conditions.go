@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka topic for each sample's weather condition (from the forecast itself, so it needs no extra API call)
+var conditionsTopic = "conditions"
+
+// How severe a weather condition is, from 0 (clear or cloudy) to 3 (dangerous)
+const (
+	severityNone     = 0
+	severityMinor    = 1
+	severityModerate = 2
+	severitySevere   = 3
+)
+
+// Condition Payload (the OpenWeatherMap condition ID, Ex: 211 is a thunderstorm, and its severity class)
+type ConditionPayload struct {
+	Location    string
+	Date        string
+	ConditionID float64
+	Severity    float64
+}
+
+var (
+	conditionGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "weather_condition_id",
+			Help: "OpenWeatherMap condition ID of the most severe weather of the sample (Ex: 211 = thunderstorm, 602 = heavy snow, 741 = fog)",
+		},
+		dateLabels,
+	)
+	severityGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "weather_severity",
+			Help: "Severity of the weather condition (0 = none, 1 = minor, 2 = moderate, 3 = severe)",
+		},
+		dateLabels,
+	)
+
+	// ALERTS (for the severe conditions that are worth a warning on their own)
+	alertThunderstorm = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_thunderstorm",
+			Help: "1 if a thunderstorm is forecast (condition 2xx), else 0",
+		},
+		dateLabels,
+	)
+	alertHeavySnow = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_heavy_snow",
+			Help: "1 if heavy snow is forecast (condition 602 or 622), else 0",
+		},
+		dateLabels,
+	)
+	alertFog = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_fog",
+			Help: "1 if fog is forecast (condition 741), else 0",
+		},
+		dateLabels,
+	)
+)
+
+// Ran before main()
+func init() {
+	safeRegister(conditionGauge, "weather_condition_id")
+	safeRegister(severityGauge, "weather_severity")
+	safeRegister(alertThunderstorm, "alert_thunderstorm")
+	safeRegister(alertHeavySnow, "alert_heavy_snow")
+	safeRegister(alertFog, "alert_fog")
+}
+
+// Returns the severity class of the OpenWeatherMap condition ID (https://openweathermap.org/weather-conditions)
+func conditionSeverity(id int) int {
+	switch {
+	// Thunderstorms, heavy snow, sand, volcanic ash, squalls, and tornadoes
+	case id >= 200 && id < 300, id == 602, id == 622, id == 751, id == 762, id == 771, id == 781:
+		return severitySevere
+
+	// Heavy or freezing rain, rain showers, sleet, snow showers, and fog
+	case id >= 502 && id <= 531, id >= 611 && id <= 621, id == 741:
+		return severityModerate
+
+	// Drizzle, light rain, light snow, mist, smoke, haze, and dust
+	case id >= 300 && id < 800:
+		return severityMinor
+	}
+
+	// Clear sky (800) and clouds (801 to 804)
+	return severityNone
+}
+
+// Returns the most severe weather condition of the three hour entries (the first one if they are all as severe)
+// Entries without a condition are skipped, so the result is empty if none of them have one
+func worstCondition(entries []DailyResponse) WeatherResponse {
+	var worst WeatherResponse
+	worstSeverity := -1
+	for _, entry := range entries {
+		for _, condition := range entry.Weather {
+			if severity := conditionSeverity(condition.ID); severity > worstSeverity {
+				worst, worstSeverity = condition, severity
+			}
+		}
+	}
+	return worst
+}
+
+// Sets the condition gauges and the alert gauges of the severe conditions
+// Condition alerts have no threshold, so the condition ID is their value and the threshold is 0
+func setConditionGauges(msg WeatherMessage, alertWriter *kafka.Writer) {
+	conditionGauge.WithLabelValues(msg.labels()...).Set(msg.ConditionID)
+	severityGauge.WithLabelValues(msg.labels()...).Set(msg.Severity)
+
+	id := int(msg.ConditionID)
+	setAlert(alertThunderstorm, msg, "condition", "thunderstorm", msg.ConditionID, 0, id >= 200 && id < 300, alertWriter)
+	setAlert(alertHeavySnow, msg, "condition", "heavy snow", msg.ConditionID, 0, id == 602 || id == 622, alertWriter)
+	setAlert(alertFog, msg, "condition", "fog", msg.ConditionID, 0, id == 741, alertWriter)
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Configuration for this run (set at the start of main)
+var config Config
+
+// All settings for the program, loaded from config.yaml (environment variables override the file)
+type Config struct {
+	APIKey string `yaml:"api_key"`
+
+	// Extra API keys that requests are rotated across (round-robin, skipping keys that are throttled or rejected)
+	APIKeys []string `yaml:"api_keys"`
+
+	File    string `yaml:"file"`
+	Workers int    `yaml:"workers"`
+
+	// Units used by the forecast API (standard, metric, or imperial)
+	// Alert thresholds are compared against values in these units
+	Units string `yaml:"units"`
+
+	// Hours between forecast samples (a multiple of 3 that divides 24, since the API works in 3 hour increments)
+	Resolution int `yaml:"resolution"`
+
+	// How long a stored forecast stays fresh (Ex: 6h), after which it is fetched again instead of read from the TSDB
+	// Empty keeps stored forecasts forever
+	Freshness       string        `yaml:"freshness"`
+	FreshnessWindow time.Duration `yaml:"-"`
+
+	// Name that separates this deployment's data when several share one Kafka, Prometheus, and Grafana stack (empty if it isn't shared)
+	// It labels every metric, and prefixes every Kafka topic and dashboard UID
+	Tenant string `yaml:"tenant"`
+
+	// Identifies this run's data (Ex: a test run), replacing the generated run ID (empty generates one from the start time)
+	// When set, it is added to the tenant's prefix and label (Ex: classA-ci42), so the run's data is kept apart from every other run
+	RunID string `yaml:"run_id"`
+
+	// Most ZIP codes a state or range line (Ex: 3|state:NJ or 2|07001-07010) can expand to
+	MaxExpansion int `yaml:"max_expansion"`
+
+	Kafka struct {
+		Brokers []string `yaml:"brokers"`
+
+		// Partitions of each metric, alert, and quality topic (messages are split between them by ZIP code)
+		// Each consumed topic gets one reader per partition
+		Partitions int `yaml:"partitions"`
+	} `yaml:"kafka"`
+
+	Grafana struct {
+		URL      string `yaml:"url"`
+		User     string `yaml:"user"`
+		Password string `yaml:"password"`
+	} `yaml:"grafana"`
+
+	// Directory every generated dashboard is also written to as JSON (empty turns it off)
+	// Keys are sorted, so the files can be kept in git and changes reviewed as diffs
+	DashboardDir string `yaml:"dashboard_dir"`
+
+	// Prometheus server (used to export series)
+	PrometheusURL string `yaml:"prometheus_url"`
+
+	// Generates the Prometheus scrape config and the Grafana data source into a volume shared with both containers (empty Dir turns it off)
+	// Prometheus and Grafana wait for these files at startup, so the job name, targets, interval, and retention are set here instead of a pre-baked prometheus.yml
+	Bootstrap struct {
+		Dir            string   `yaml:"dir"`
+		JobName        string   `yaml:"job_name"`
+		Targets        []string `yaml:"targets"`
+		ScrapeInterval string   `yaml:"scrape_interval"`
+		Retention      string   `yaml:"retention"`
+	} `yaml:"bootstrap"`
+
+	// Exports dashboards and metrics into an archive at the end of the run
+	Export struct {
+		Enabled bool   `yaml:"enabled"`
+		Path    string `yaml:"path"`
+	} `yaml:"export"`
+
+	// Compares past forecasts to the observed weather, publishing each location's forecast error (one extra API call per location per run)
+	// Forecasts and observations are remembered in the file at Path between runs
+	Verification struct {
+		Enabled bool   `yaml:"enabled"`
+		Path    string `yaml:"path"`
+	} `yaml:"verification"`
+
+	// Where metrics are persisted between runs (jsonl or sqlite)
+	// The path defaults to /data/metrics.jsonl or /data/metrics.db depending on the backend
+	Storage struct {
+		Backend string `yaml:"backend"`
+		Path    string `yaml:"path"`
+	} `yaml:"storage"`
+
+	// Removes ZIP codes that none of the last Runs runs asked for (0 turns it off)
+	// Every run's ZIP codes are remembered in the history file, so it knows which ZIP codes are still in use
+	Janitor struct {
+		Runs        int    `yaml:"runs"`
+		HistoryPath string `yaml:"history_path"`
+	} `yaml:"janitor"`
+
+	// Also publishes air quality (AQI, PM2.5) and UV index metrics for each location (one extra API call each)
+	AirQuality bool `yaml:"air_quality"`
+	UVIndex    bool `yaml:"uv_index"`
+
+	// Hides the forecast summary that is printed for each request
+	Quiet bool `yaml:"quiet"`
+
+	// Keeps running and accepts forecast requests through the REST API (POST /requests) until ENTER is pressed
+	Serve bool `yaml:"serve"`
+
+	// Treats skipped lines, unknown ZIP codes, and reconciliation mismatches as failures (non-zero exit code)
+	Strict bool `yaml:"strict"`
+
+	// Most API calls the input file is allowed to need (0 turns the check off)
+	// The calls are estimated before processing, so a run that would get throttled halfway through can be stopped
+	Quota int `yaml:"quota"`
+
+	// Seconds each operation can take before it is given up on (a fatal error, except for the optional readings)
+	// Without them, a hung API or Kafka broker would stall the workers forever
+	Timeouts struct {
+		Geocode  int `yaml:"geocode"`
+		Forecast int `yaml:"forecast"`
+		Kafka    int `yaml:"kafka"`
+		Storage  int `yaml:"storage"`
+	} `yaml:"timeouts"`
+
+	// Pushes every alert that turns on to these destinations, at most once per alert per run
+	// Webhooks get the alert as JSON, Slack gets a line of text, and PagerDuty gets an Events API v2 trigger
+	Notifications struct {
+		Webhooks            []string `yaml:"webhooks"`
+		SlackWebhook        string   `yaml:"slack_webhook"`
+		PagerDutyRoutingKey string   `yaml:"pagerduty_routing_key"`
+	} `yaml:"notifications"`
+
+	// Where the machine-readable run report is written
+	ReportPath string `yaml:"report_path"`
+
+	// Report of every location's forecast highlights and active alerts, sent at the end of the run
+	// It goes by email when smtp.host is set, and to Slack when slack_webhook is set (both can be on)
+	// While serving, it is also sent every IntervalMinutes (0 only sends it at the end)
+	Summary struct {
+		SlackWebhook    string `yaml:"slack_webhook"`
+		IntervalMinutes int    `yaml:"interval_minutes"`
+
+		SMTP struct {
+			Host     string   `yaml:"host"`
+			Port     int      `yaml:"port"`
+			User     string   `yaml:"user"`
+			Password string   `yaml:"password"`
+			From     string   `yaml:"from"`
+			To       []string `yaml:"to"`
+		} `yaml:"smtp"`
+	} `yaml:"summary"`
+
+	Thresholds struct {
+		TempLow       float64 `yaml:"temp_low"`
+		TempHigh      float64 `yaml:"temp_high"`
+		HumidityLow   float64 `yaml:"humidity_low"`
+		HumidityHigh  float64 `yaml:"humidity_high"`
+		WindSpeedHigh float64 `yaml:"wind_speed_high"`
+		AQIHigh       float64 `yaml:"aqi_high"`
+		UVHigh        float64 `yaml:"uv_high"`
+	} `yaml:"thresholds"`
+}
+
+// Tenants are used in Kafka topic names and Grafana UIDs (which can be at most 40 characters), so they are kept short and simple
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,20}$`)
+
+// Durations Prometheus accepts in its config and flags (Ex: 5s, 1m30s, 15d), which time.ParseDuration can't read (no d, w, or y)
+var promDuration = regexp.MustCompile(`^([1-9][0-9]*(ms|s|m|h|d|w|y))+$`)
+
+// Returns the configuration with every default value filled in
+func defaultConfig() Config {
+	var cfg Config
+	cfg.Workers = 10
+	cfg.Units = "imperial"
+	cfg.Resolution = 24
+	cfg.MaxExpansion = 100
+	cfg.Kafka.Brokers = []string{"kafka:9092"}
+	cfg.Kafka.Partitions = 1
+	cfg.Grafana.URL = "http://grafana:3000"
+	cfg.Grafana.User = "admin"
+	cfg.Grafana.Password = "admin"
+	cfg.PrometheusURL = "http://prometheus:9090"
+	cfg.Bootstrap.JobName = "proj2"
+	cfg.Bootstrap.Targets = []string{"proj2:8080"}
+	cfg.Bootstrap.ScrapeInterval = "5s"
+	cfg.Bootstrap.Retention = "15d"
+	cfg.Export.Path = "/data/exports"
+	cfg.ReportPath = "/data/run-report.json"
+	cfg.Verification.Path = "/data/forecast-verification.json"
+	cfg.Storage.Backend = StorageKafka
+	cfg.Janitor.HistoryPath = "/data/run-history.json"
+	cfg.Timeouts.Geocode = 10
+	cfg.Timeouts.Forecast = 15
+	cfg.Timeouts.Kafka = 10
+	cfg.Timeouts.Storage = 10
+	cfg.Summary.IntervalMinutes = 1440
+	cfg.Summary.SMTP.Port = 587
+	cfg.Thresholds.TempLow = 32
+	cfg.Thresholds.TempHigh = 90
+	cfg.Thresholds.HumidityLow = 30
+	cfg.Thresholds.HumidityHigh = 70
+	cfg.Thresholds.WindSpeedHigh = 40
+	cfg.Thresholds.AQIHigh = 4
+	cfg.Thresholds.UVHigh = 8
+	return cfg
+}
+
+// Loads the configuration from the file at CONFIG (defaults to config.yaml), then applies environment variable overrides
+// Every invalid field is reported at once, instead of stopping at the first one
+func loadConfig() (Config, error) {
+	cfg := defaultConfig()
+	problems := []string{}
+
+	// Read the config file (it is fine if it doesn't exist)
+	path := strings.Trim(os.Getenv("CONFIG"), "'\"")
+	if path == "" {
+		path = "config.yaml"
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", path, err))
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		problems = append(problems, fmt.Sprintf("%s: %s", path, err))
+	}
+
+	// Environment variables override values from the file
+	overrideString(&cfg.APIKey, "API_KEY")
+	if keys := strings.Trim(os.Getenv("API_KEYS"), "'\""); keys != "" {
+		cfg.APIKeys = strings.Split(keys, ",")
+	}
+	overrideString(&cfg.File, "FILE")
+	overrideString(&cfg.Units, "UNITS")
+	overrideString(&cfg.Freshness, "FRESHNESS")
+	overrideString(&cfg.Tenant, "TENANT")
+	overrideString(&cfg.RunID, "RUN_ID")
+	overrideString(&cfg.Grafana.URL, "GRAFANA_URL")
+	overrideString(&cfg.Grafana.User, "GRAFANA_USER")
+	overrideString(&cfg.Grafana.Password, "GRAFANA_PASSWORD")
+	overrideString(&cfg.PrometheusURL, "PROMETHEUS_URL")
+	overrideString(&cfg.DashboardDir, "DASHBOARD_DIR")
+	overrideString(&cfg.Bootstrap.Dir, "BOOTSTRAP_DIR")
+	overrideString(&cfg.Bootstrap.JobName, "SCRAPE_JOB")
+	if targets := strings.Trim(os.Getenv("SCRAPE_TARGETS"), "'\""); targets != "" {
+		cfg.Bootstrap.Targets = strings.Split(targets, ",")
+	}
+	overrideString(&cfg.Bootstrap.ScrapeInterval, "SCRAPE_INTERVAL")
+	overrideString(&cfg.Bootstrap.Retention, "RETENTION")
+	overrideString(&cfg.Export.Path, "EXPORT_PATH")
+	overrideBool(&cfg.Export.Enabled, "EXPORT", &problems)
+	overrideString(&cfg.ReportPath, "REPORT_PATH")
+	overrideString(&cfg.Verification.Path, "VERIFY_PATH")
+	overrideBool(&cfg.Verification.Enabled, "VERIFY", &problems)
+	overrideString(&cfg.Storage.Backend, "STORAGE")
+	overrideString(&cfg.Storage.Path, "STORAGE_PATH")
+	overrideString(&cfg.Janitor.HistoryPath, "JANITOR_HISTORY")
+	overrideString(&cfg.Summary.SlackWebhook, "SUMMARY_SLACK_WEBHOOK")
+	overrideString(&cfg.Summary.SMTP.Host, "SMTP_HOST")
+	overrideString(&cfg.Summary.SMTP.User, "SMTP_USER")
+	overrideString(&cfg.Summary.SMTP.Password, "SMTP_PASSWORD")
+	overrideString(&cfg.Summary.SMTP.From, "SMTP_FROM")
+	if to := strings.Trim(os.Getenv("SUMMARY_TO"), "'\""); to != "" {
+		cfg.Summary.SMTP.To = strings.Split(to, ",")
+	}
+	if webhooks := strings.Trim(os.Getenv("NOTIFY_WEBHOOKS"), "'\""); webhooks != "" {
+		cfg.Notifications.Webhooks = strings.Split(webhooks, ",")
+	}
+	overrideString(&cfg.Notifications.SlackWebhook, "NOTIFY_SLACK_WEBHOOK")
+	overrideString(&cfg.Notifications.PagerDutyRoutingKey, "PAGERDUTY_ROUTING_KEY")
+	overrideBool(&cfg.Strict, "STRICT", &problems)
+	overrideBool(&cfg.Serve, "SERVE", &problems)
+	overrideBool(&cfg.Quiet, "QUIET", &problems)
+	overrideBool(&cfg.AirQuality, "AIR_QUALITY", &problems)
+	overrideBool(&cfg.UVIndex, "UV_INDEX", &problems)
+	if brokers := strings.Trim(os.Getenv("KAFKA_BROKERS"), "'\""); brokers != "" {
+		cfg.Kafka.Brokers = strings.Split(brokers, ",")
+	}
+
+	overrideInt(&cfg.Workers, "WORKERS", &problems)
+	overrideInt(&cfg.Resolution, "RESOLUTION", &problems)
+	overrideInt(&cfg.MaxExpansion, "MAX_EXPANSION", &problems)
+	overrideInt(&cfg.Kafka.Partitions, "KAFKA_PARTITIONS", &problems)
+	overrideInt(&cfg.Quota, "QUOTA", &problems)
+	overrideInt(&cfg.Janitor.Runs, "JANITOR_RUNS", &problems)
+	overrideInt(&cfg.Timeouts.Geocode, "TIMEOUT_GEOCODE", &problems)
+	overrideInt(&cfg.Timeouts.Forecast, "TIMEOUT_FORECAST", &problems)
+	overrideInt(&cfg.Timeouts.Kafka, "TIMEOUT_KAFKA", &problems)
+	overrideInt(&cfg.Timeouts.Storage, "TIMEOUT_STORAGE", &problems)
+	overrideInt(&cfg.Summary.IntervalMinutes, "SUMMARY_INTERVAL", &problems)
+	overrideInt(&cfg.Summary.SMTP.Port, "SMTP_PORT", &problems)
+
+	overrideFloat(&cfg.Thresholds.TempLow, "TEMP_LOW", &problems)
+	overrideFloat(&cfg.Thresholds.TempHigh, "TEMP_HIGH", &problems)
+	overrideFloat(&cfg.Thresholds.HumidityLow, "HUMIDITY_LOW", &problems)
+	overrideFloat(&cfg.Thresholds.HumidityHigh, "HUMIDITY_HIGH", &problems)
+	overrideFloat(&cfg.Thresholds.WindSpeedHigh, "WIND_SPEED_HIGH", &problems)
+	overrideFloat(&cfg.Thresholds.AQIHigh, "AQI_HIGH", &problems)
+	overrideFloat(&cfg.Thresholds.UVHigh, "UV_HIGH", &problems)
+
+	// Validate every field
+	for i := range cfg.APIKeys {
+		cfg.APIKeys[i] = strings.TrimSpace(cfg.APIKeys[i])
+	}
+	if cfg.APIKey == "" && strings.Join(cfg.APIKeys, "") == "" {
+		problems = append(problems, "api_key (API_KEY) or api_keys (API_KEYS) is required")
+	}
+	if cfg.File == "" && !cfg.Serve {
+		problems = append(problems, "file (FILE) is required (unless serve (SERVE) is on)")
+	}
+	if cfg.Workers <= 0 {
+		problems = append(problems, fmt.Sprintf("workers (WORKERS) must be a positive number, it is currently %d", cfg.Workers))
+	}
+	if cfg.Units != "standard" && cfg.Units != "metric" && cfg.Units != "imperial" {
+		problems = append(problems, fmt.Sprintf("units (UNITS) must be standard, metric, or imperial, it is currently '%s'", cfg.Units))
+	}
+	if cfg.Resolution < 3 || cfg.Resolution%3 != 0 || 24%cfg.Resolution != 0 {
+		problems = append(problems, fmt.Sprintf("resolution (RESOLUTION) must be 3, 6, 12, or 24 hours, it is currently %d", cfg.Resolution))
+	}
+	if cfg.Freshness != "" {
+		window, err := time.ParseDuration(cfg.Freshness)
+		if err != nil || window <= 0 {
+			problems = append(problems, fmt.Sprintf("freshness (FRESHNESS) must be a positive duration (Ex: 6h), it is currently '%s'", cfg.Freshness))
+		}
+		cfg.FreshnessWindow = window
+	}
+	if cfg.Tenant != "" && !tenantPattern.MatchString(cfg.Tenant) {
+		problems = append(problems, fmt.Sprintf("tenant (TENANT) can only have letters, numbers, dashes, and underscores (at most 20), it is currently '%s'", cfg.Tenant))
+	}
+	if cfg.RunID != "" && !tenantPattern.MatchString(cfg.RunID) {
+		problems = append(problems, fmt.Sprintf("run_id (RUN_ID) can only have letters, numbers, dashes, and underscores (at most 20), it is currently '%s'", cfg.RunID))
+	} else if cfg.Tenant != "" && cfg.RunID != "" && len(cfg.Tenant)+1+len(cfg.RunID) > 20 {
+		problems = append(problems, fmt.Sprintf("tenant and run_id (TENANT, RUN_ID) can be at most 20 characters together, they are currently %d", len(cfg.Tenant)+1+len(cfg.RunID)))
+	}
+	if cfg.MaxExpansion <= 0 {
+		problems = append(problems, fmt.Sprintf("max_expansion (MAX_EXPANSION) must be a positive number, it is currently %d", cfg.MaxExpansion))
+	}
+	if len(cfg.Kafka.Brokers) == 0 || cfg.Kafka.Brokers[0] == "" {
+		problems = append(problems, "kafka.brokers (KAFKA_BROKERS) needs at least one broker")
+	}
+	if cfg.Kafka.Partitions <= 0 {
+		problems = append(problems, fmt.Sprintf("kafka.partitions (KAFKA_PARTITIONS) must be a positive number, it is currently %d", cfg.Kafka.Partitions))
+	}
+	if cfg.Quota < 0 {
+		problems = append(problems, fmt.Sprintf("quota (QUOTA) cannot be negative, it is currently %d", cfg.Quota))
+	}
+	if cfg.Janitor.Runs < 0 {
+		problems = append(problems, fmt.Sprintf("janitor.runs (JANITOR_RUNS) cannot be negative, it is currently %d", cfg.Janitor.Runs))
+	}
+	if cfg.Timeouts.Geocode <= 0 || cfg.Timeouts.Forecast <= 0 || cfg.Timeouts.Kafka <= 0 || cfg.Timeouts.Storage <= 0 {
+		problems = append(problems, fmt.Sprintf("timeouts (TIMEOUT_GEOCODE, TIMEOUT_FORECAST, TIMEOUT_KAFKA, TIMEOUT_STORAGE) must be positive numbers of seconds, they are currently %d, %d, %d, and %d",
+			cfg.Timeouts.Geocode, cfg.Timeouts.Forecast, cfg.Timeouts.Kafka, cfg.Timeouts.Storage))
+	}
+	for i := range cfg.Notifications.Webhooks {
+		cfg.Notifications.Webhooks[i] = strings.TrimSpace(cfg.Notifications.Webhooks[i])
+		if !strings.HasPrefix(cfg.Notifications.Webhooks[i], "http://") && !strings.HasPrefix(cfg.Notifications.Webhooks[i], "https://") {
+			problems = append(problems, fmt.Sprintf("notifications.webhooks (NOTIFY_WEBHOOKS) must be http or https URLs, '%s' is not", cfg.Notifications.Webhooks[i]))
+		}
+	}
+	for i := range cfg.Summary.SMTP.To {
+		cfg.Summary.SMTP.To[i] = strings.TrimSpace(cfg.Summary.SMTP.To[i])
+	}
+	if cfg.Summary.SMTP.From == "" {
+		cfg.Summary.SMTP.From = cfg.Summary.SMTP.User
+	}
+	if cfg.Summary.SMTP.Host != "" && (len(cfg.Summary.SMTP.To) == 0 || cfg.Summary.SMTP.From == "") {
+		problems = append(problems, "summary.smtp.to (SUMMARY_TO) and summary.smtp.from (SMTP_FROM or SMTP_USER) are required when summary.smtp.host (SMTP_HOST) is set")
+	}
+	if cfg.Summary.SMTP.Port <= 0 {
+		problems = append(problems, fmt.Sprintf("summary.smtp.port (SMTP_PORT) must be a positive number, it is currently %d", cfg.Summary.SMTP.Port))
+	}
+	if cfg.Summary.IntervalMinutes < 0 {
+		problems = append(problems, fmt.Sprintf("summary.interval_minutes (SUMMARY_INTERVAL) cannot be negative, it is currently %d", cfg.Summary.IntervalMinutes))
+	}
+	if cfg.Grafana.URL == "" {
+		problems = append(problems, "grafana.url (GRAFANA_URL) is required")
+	}
+	for i := range cfg.Bootstrap.Targets {
+		cfg.Bootstrap.Targets[i] = strings.TrimSpace(cfg.Bootstrap.Targets[i])
+	}
+	if cfg.Bootstrap.Dir != "" {
+		if cfg.Bootstrap.JobName == "" {
+			problems = append(problems, "bootstrap.job_name (SCRAPE_JOB) is required when bootstrap.dir (BOOTSTRAP_DIR) is set")
+		}
+		if len(cfg.Bootstrap.Targets) == 0 || slices.Contains(cfg.Bootstrap.Targets, "") {
+			problems = append(problems, "bootstrap.targets (SCRAPE_TARGETS) needs at least one host:port, and none can be empty")
+		}
+		if !promDuration.MatchString(cfg.Bootstrap.ScrapeInterval) {
+			problems = append(problems, fmt.Sprintf("bootstrap.scrape_interval (SCRAPE_INTERVAL) must be a Prometheus duration (Ex: 5s, 1m), it is currently '%s'", cfg.Bootstrap.ScrapeInterval))
+		}
+		if !promDuration.MatchString(cfg.Bootstrap.Retention) {
+			problems = append(problems, fmt.Sprintf("bootstrap.retention (RETENTION) must be a Prometheus duration (Ex: 15d, 1y), it is currently '%s'", cfg.Bootstrap.Retention))
+		}
+	}
+	if cfg.Export.Enabled && cfg.Export.Path == "" {
+		problems = append(problems, "export.path (EXPORT_PATH) is required when export is enabled")
+	}
+	if cfg.Verification.Enabled && cfg.Verification.Path == "" {
+		problems = append(problems, "verification.path (VERIFY_PATH) is required when verification is enabled")
+	}
+	if cfg.Storage.Backend != StorageKafka && cfg.Storage.Backend != StorageJSONL && cfg.Storage.Backend != StorageSQLite {
+		problems = append(problems, fmt.Sprintf("storage.backend (STORAGE) must be kafka, jsonl, or sqlite, it is currently '%s'", cfg.Storage.Backend))
+	}
+	if cfg.Storage.Path == "" {
+		cfg.Storage.Path = defaultStoragePath(cfg.Storage.Backend)
+	}
+	if cfg.Thresholds.TempLow >= cfg.Thresholds.TempHigh {
+		problems = append(problems, "thresholds.temp_low (TEMP_LOW) must be below thresholds.temp_high (TEMP_HIGH)")
+	}
+	if cfg.Thresholds.HumidityLow >= cfg.Thresholds.HumidityHigh {
+		problems = append(problems, "thresholds.humidity_low (HUMIDITY_LOW) must be below thresholds.humidity_high (HUMIDITY_HIGH)")
+	}
+	if cfg.Thresholds.WindSpeedHigh < 0 {
+		problems = append(problems, "thresholds.wind_speed_high (WIND_SPEED_HIGH) cannot be negative")
+	}
+	if cfg.Thresholds.AQIHigh < 1 || cfg.Thresholds.AQIHigh > 5 {
+		problems = append(problems, fmt.Sprintf("thresholds.aqi_high (AQI_HIGH) must be between 1 and 5, it is currently %g", cfg.Thresholds.AQIHigh))
+	}
+	if cfg.Thresholds.UVHigh < 0 {
+		problems = append(problems, "thresholds.uv_high (UV_HIGH) cannot be negative")
+	}
+
+	if len(problems) > 0 {
+		return cfg, fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return cfg, nil
+}
+
+// Replaces the value with the environment variable (if it is set), removing quotes
+func overrideString(value *string, env string) {
+	if v := strings.Trim(os.Getenv(env), "'\""); v != "" {
+		*value = v
+	}
+}
+
+// Replaces the value with the environment variable (if it is set), recording a problem if it isn't a number
+func overrideInt(value *int, env string, problems *[]string) {
+	v := strings.Trim(os.Getenv(env), "'\"")
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		*problems = append(*problems, fmt.Sprintf("%s must be an integer, it is currently '%s'", env, v))
+		return
+	}
+	*value = n
+}
+
+// Replaces the value with the environment variable (if it is set), recording a problem if it isn't a number
+func overrideFloat(value *float64, env string, problems *[]string) {
+	v := strings.Trim(os.Getenv(env), "'\"")
+	if v == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		*problems = append(*problems, fmt.Sprintf("%s must be a number, it is currently '%s'", env, v))
+		return
+	}
+	*value = f
+}
+
+// Replaces the value with the environment variable (if it is set), recording a problem if it isn't true or false
+func overrideBool(value *bool, env string, problems *[]string) {
+	v := strings.Trim(os.Getenv(env), "'\"")
+	if v == "" {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		*problems = append(*problems, fmt.Sprintf("%s must be true or false, it is currently '%s'", env, v))
+		return
+	}
+	*value = b
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A field of a topic's payload
+type payloadField struct {
+	Name string
+
+	// Payloads without a required field are dropped, instead of showing a zero on the dashboards
+	Required bool
+
+	// Fills in an optional field that is missing (nil leaves it at zero)
+	Default func(payload map[string]json.RawMessage) json.RawMessage
+}
+
+// Fields each topic's payload is expected to have (the same fields the producer writes)
+// Anything else is an unknown field, which means the producer is newer (or older) than this consumer
+var payloadSchemas = map[string][]payloadField{
+	"temperature": {
+		{Name: "Location"}, {Name: "Date"},
+		{Name: "Temp", Required: true},
+		// Without a feels like temperature, the temperature itself is the closest value
+		{Name: "FeelsLike", Default: func(p map[string]json.RawMessage) json.RawMessage { return p["Temp"] }},
+		// Producers from before the low, high, and average were added only have the temperature itself
+		{Name: "MinTemp", Default: func(p map[string]json.RawMessage) json.RawMessage { return p["Temp"] }},
+		{Name: "MaxTemp", Default: func(p map[string]json.RawMessage) json.RawMessage { return p["Temp"] }},
+		{Name: "AvgTemp", Default: func(p map[string]json.RawMessage) json.RawMessage { return p["Temp"] }},
+	},
+	"humidity":      {{Name: "Location"}, {Name: "Date"}, {Name: "Humidity", Required: true}},
+	"wind":          {{Name: "Location"}, {Name: "Date"}, {Name: "Speed", Required: true}, {Name: "Degree", Required: true}},
+	"cloud":         {{Name: "Location"}, {Name: "Date"}, {Name: "CloudPercent", Required: true}},
+	airQualityTopic: {{Name: "Location"}, {Name: "Date"}, {Name: "AQI", Required: true}, {Name: "PM25", Required: true}},
+	uvIndexTopic:    {{Name: "Location"}, {Name: "Date"}, {Name: "UVI", Required: true}},
+	conditionsTopic: {{Name: "Location"}, {Name: "Date"}, {Name: "ConditionID", Required: true}, {Name: "Severity", Required: true}},
+}
+
+// Counts every payload problem found while consuming, by topic, field, and issue (missing, unknown, defaulted, or invalid)
+var payloadIssues = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "pipeline_payload_issues_total",
+		Help: "Problems with consumed Kafka payloads, by topic, field, and issue",
+	},
+	[]string{"topic", "field", "issue"},
+)
+
+var (
+	// Issues that were already printed (each one is only printed once, but always counted)
+	warnedPayloadsMu sync.Mutex
+	warnedPayloads   = make(map[string]bool)
+)
+
+// Ran before main()
+func init() {
+	safeRegister(payloadIssues, "pipeline_payload_issues_total")
+}
+
+// Decodes a payload from the topic into a WeatherMessage, checking it against the topic's schema
+// Returns false if the payload can't be used (it isn't JSON, or a required field is missing)
+// Unknown fields and defaulted fields are reported, but the payload is still used
+func decodePayload(topic string, value []byte) (WeatherMessage, bool) {
+	var msg WeatherMessage
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(value, &payload); err != nil {
+		reportPayloadIssue(topic, "", "invalid", err.Error())
+		return msg, false
+	}
+
+	schema, known := payloadSchemas[topic]
+	if !known {
+		reportPayloadIssue(topic, "", "unknown", "no schema for this topic")
+		return msg, false
+	}
+
+	// Required fields must be there, and optional fields get their default
+	expected := make(map[string]bool)
+	for _, field := range schema {
+		expected[field.Name] = true
+		if _, present := payload[field.Name]; present {
+			continue
+		}
+
+		switch {
+		case field.Required:
+			reportPayloadIssue(topic, field.Name, "missing", "required field is missing, dropping the payload")
+			return msg, false
+		case field.Default != nil:
+			if defaultValue := field.Default(payload); defaultValue != nil {
+				payload[field.Name] = defaultValue
+				reportPayloadIssue(topic, field.Name, "defaulted", "field is missing, using its default")
+			}
+		}
+	}
+
+	// Fields this consumer doesn't know about (sorted so the warnings are in the same order every time)
+	unknown := []string{}
+	for name := range payload {
+		if !expected[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		reportPayloadIssue(topic, name, "unknown", "field is not in this consumer's schema, ignoring it")
+	}
+
+	// Decode again with the defaults filled in
+	filled, _ := json.Marshal(payload)
+	if err := json.Unmarshal(filled, &msg); err != nil {
+		reportPayloadIssue(topic, "", "invalid", err.Error())
+		return msg, false
+	}
+	return msg, true
+}
+
+// Counts the issue, printing a warning the first time it is seen
+func reportPayloadIssue(topic, field, issue, detail string) {
+	payloadIssues.WithLabelValues(topic, field, issue).Inc()
+
+	key := fmt.Sprintf("%s-%s-%s", topic, field, issue)
+	warnedPayloadsMu.Lock()
+	warned := warnedPayloads[key]
+	warnedPayloads[key] = true
+	warnedPayloadsMu.Unlock()
+
+	if !warned {
+		fmt.Printf("WARNING: %s payload field '%s' %s: %s\n", topic, field, issue, detail)
+	}
+}
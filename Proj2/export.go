@@ -0,0 +1,216 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ZIP codes requested during this run (these are the ones that get exported)
+	requestedZipsMu sync.Mutex
+	requestedZips   = make(map[string]struct{})
+
+	// When a gauge was last set, so the export can wait for Prometheus to scrape it
+	lastGaugeUpdateMu sync.Mutex
+	lastGaugeUpdate   time.Time
+)
+
+// Longest the export waits for Prometheus to scrape the last gauge updates of the run
+const scrapeWait = 30 * time.Second
+
+// Remembers that the ZIP code was requested during this run
+func recordRequestedZip(zip string) {
+	requestedZipsMu.Lock()
+	defer requestedZipsMu.Unlock()
+	requestedZips[zip] = struct{}{}
+}
+
+// Remembers that a gauge was just set
+func recordGaugeUpdate() {
+	lastGaugeUpdateMu.Lock()
+	defer lastGaugeUpdateMu.Unlock()
+	lastGaugeUpdate = time.Now()
+}
+
+// Returns the requested ZIP codes in sorted order
+func getRequestedZips() []string {
+	requestedZipsMu.Lock()
+	defer requestedZipsMu.Unlock()
+
+	zips := make([]string, 0, len(requestedZips))
+	for zip := range requestedZips {
+		zips = append(zips, zip)
+	}
+	sort.Strings(zips)
+	return zips
+}
+
+// Exports the dashboards and metrics of every requested ZIP code into a single zip archive, so results can be shared offline
+// The archive holds a Grafana snapshot per dashboard, the Prometheus series per ZIP code, and a PNG per panel
+func exportRun() {
+	err := os.MkdirAll(config.Export.Path, 0755)
+	if err != nil {
+		fmt.Println("Error creating export directory:", err)
+		return
+	}
+
+	archivePath := filepath.Join(config.Export.Path, fmt.Sprintf("export-%s.zip", time.Now().Format("20060102-150405")))
+	file, err := os.Create(archivePath)
+	if err != nil {
+		fmt.Println("Error creating export archive:", err)
+		return
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	defer archive.Close()
+
+	// The series only have the last values of the run once Prometheus has scraped them
+	waitForScrape()
+	end := time.Now()
+
+	for _, zipCode := range getRequestedZips() {
+		uid := zipDashboardUID(zipCode)
+
+		// Prometheus series for this ZIP code, over the whole run
+		series, err := queryPrometheusRange(fmt.Sprintf(`{%s=%q, location="%s"}`, tenantLabel, namespace(), zipCode), runStart, end)
+		if err != nil {
+			fmt.Printf("Error exporting metrics for ZIP %s: %s\n", zipCode, err)
+		} else {
+			writeArchiveFile(archive, fmt.Sprintf("series/%s.json", zipCode), series)
+		}
+
+		// Dashboard snapshot (a copy of the dashboard with its data that can be viewed without Prometheus)
+		dashboard, err := grafanaClient.GetDashboard(uid)
+		if err != nil {
+			fmt.Printf("Error exporting dashboard for ZIP %s: %s\n", zipCode, err)
+			continue
+		}
+		snapshot, err := grafanaClient.CreateSnapshot(dashboard)
+		if err != nil {
+			fmt.Printf("Error creating snapshot for ZIP %s: %s\n", zipCode, err)
+		} else {
+			data, _ := json.MarshalIndent(map[string]any{"dashboard": dashboard, "snapshot": snapshot}, "", "  ")
+			writeArchiveFile(archive, fmt.Sprintf("snapshots/%s.json", uid), data)
+		}
+
+		// Rendered PNG of every panel (skipped if Grafana does not have the image renderer)
+		panels, _ := dashboard["panels"].([]any)
+		for _, p := range panels {
+			panel, _ := p.(map[string]any)
+			id, ok := panel["id"].(float64)
+			if !ok {
+				continue
+			}
+
+			png, err := grafanaClient.RenderPanel(uid, int(id), 1000, 500)
+			if err != nil {
+				fmt.Printf("Skipping PNG for ZIP %s: %s\n", zipCode, err)
+				break
+			}
+			writeArchiveFile(archive, fmt.Sprintf("panels/%s-%d.png", uid, int(id)), png)
+		}
+	}
+
+	fmt.Printf("Exported dashboards and metrics to %s\n", archivePath)
+}
+
+// Adds a file to the archive
+func writeArchiveFile(archive *zip.Writer, name string, data []byte) {
+	w, err := archive.Create(name)
+	if err != nil {
+		fmt.Printf("Error adding %s to export: %s\n", name, err)
+		return
+	}
+	w.Write(data)
+}
+
+// Waits until Prometheus has scraped this program's metrics since the last gauge was set (giving up after scrapeWait)
+// The scrape job is found by its name (bootstrap.job_name), using the last scrape time of its targets
+func waitForScrape() {
+	lastGaugeUpdateMu.Lock()
+	updated := lastGaugeUpdate
+	lastGaugeUpdateMu.Unlock()
+	if updated.IsZero() {
+		return
+	}
+
+	deadline := time.Now().Add(scrapeWait)
+	for time.Now().Before(deadline) {
+		if scraped, err := lastScrape(); err == nil && scraped.After(updated) {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+	fmt.Printf("Prometheus has not scraped the metrics within %s, so the export may miss the last values.\n", scrapeWait)
+}
+
+// Returns the newest scrape of any target of this program's scrape job
+func lastScrape() (time.Time, error) {
+	resp, err := http.Get(config.PrometheusURL + "/api/v1/targets?state=active")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	var targets struct {
+		Data struct {
+			ActiveTargets []struct {
+				Labels     map[string]string `json:"labels"`
+				LastScrape time.Time         `json:"lastScrape"`
+			} `json:"activeTargets"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
+		return time.Time{}, err
+	}
+
+	var newest time.Time
+	for _, target := range targets.Data.ActiveTargets {
+		if target.Labels["job"] == config.Bootstrap.JobName && target.LastScrape.After(newest) {
+			newest = target.LastScrape
+		}
+	}
+	return newest, nil
+}
+
+// Runs a range query against the Prometheus HTTP API from start to end, returning the raw JSON response
+// The step is the scrape interval, made wider for long runs so each series stays under Prometheus's 11,000 points
+func queryPrometheusRange(query string, start, end time.Time) ([]byte, error) {
+	step, err := time.ParseDuration(config.Bootstrap.ScrapeInterval)
+	if err != nil {
+		step = 15 * time.Second
+	}
+	step = max(step, end.Sub(start)/10000, time.Second).Round(time.Second)
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start.Unix(), 10))
+	params.Set("end", strconv.FormatInt(end.Unix(), 10))
+	params.Set("step", strconv.Itoa(int(step.Seconds())))
+
+	resp, err := http.Get(config.PrometheusURL + "/api/v1/query_range?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("prometheus query failed with status %d: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
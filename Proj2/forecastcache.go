@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How long a forecast response can be reused within a run
+var forecastCacheTTL = 10 * time.Minute
+
+// A cached (or in-flight) forecast response for a set of coordinates
+type forecastEntry struct {
+	// Closed once the response has been fetched
+	ready chan struct{}
+
+	cnt       int
+	results   APIResponse
+	fetchedAt time.Time
+}
+
+var (
+	// Forecast responses keyed by coordinates
+	forecastCacheMu sync.Mutex
+	forecastCache   = make(map[string]*forecastEntry)
+)
+
+// Returns the forecast for the coordinates, reusing a cached or in-flight response when possible
+// A response fetched with a larger count can serve any request with a smaller count
+func fetchForecast(lat, lon float32, cnt int) APIResponse {
+
+	// Coordinates are formatted the same way as the URL, so equal URLs share an entry
+	cacheKey := fmt.Sprintf("%f,%f", lat, lon)
+
+	forecastCacheMu.Lock()
+	entry, exists := forecastCache[cacheKey]
+
+	// Reuse the entry if it has (or will have) enough results and is still fresh
+	if exists && entry.cnt >= cnt && (entry.fetchedAt.IsZero() || time.Since(entry.fetchedAt) < forecastCacheTTL) {
+		forecastCacheMu.Unlock()
+		<-entry.ready
+
+		fmt.Printf("Reusing forecast response for %s (cnt=%d)\n", cacheKey, cnt)
+		return trimForecast(entry.results, cnt)
+	}
+
+	// Otherwise this request fetches the forecast, and anyone else asking for it waits
+	entry = &forecastEntry{ready: make(chan struct{}), cnt: cnt}
+	forecastCache[cacheKey] = entry
+	forecastCacheMu.Unlock()
+
+	// Make API request to get results (using the configured units and the next API key), giving up after the forecast timeout
+	ctx, cancel := stageContext(config.Timeouts.Forecast)
+	defer cancel()
+	resp, err := apiKeys.Get(ctx, "forecast", func(key string) string {
+		return fmt.Sprintf("https://api.openweathermap.org/data/2.5/forecast?lat=%f&lon=%f&cnt=%d&units=%s&appid=%s", lat, lon, cnt, config.Units, key)
+	})
+
+	// Uses HTTP response body to create a JSON Decoder
+	// Parses the JSON to fill the response structure
+	var results APIResponse
+	if err == nil {
+		err = json.NewDecoder(resp.Body).Decode(&results)
+
+		// Closes once response is decoded
+		resp.Body.Close()
+	}
+
+	// A failed call is returned as an error response (which is never reused)
+	if err != nil {
+		results = APIResponse{Cod: "error", Message: err.Error(), err: err}
+	}
+
+	forecastCacheMu.Lock()
+	entry.results = results
+	entry.fetchedAt = time.Now()
+
+	// Errors should not be reused, so remove the entry (anyone already waiting still gets the error)
+	if results.Cod != "200" && forecastCache[cacheKey] == entry {
+		delete(forecastCache, cacheKey)
+	}
+	forecastCacheMu.Unlock()
+
+	close(entry.ready)
+	return results
+}
+
+// Returns a copy of the response with only the first cnt entries
+func trimForecast(results APIResponse, cnt int) APIResponse {
+	if len(results.DaysList) > cnt {
+		results.DaysList = results.DaysList[:cnt]
+	}
+	return results
+}
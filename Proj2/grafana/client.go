@@ -0,0 +1,202 @@
+// Package grafana provisions Grafana folders, data sources, and dashboards over the Grafana HTTP API
+package grafana
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Client holds the Grafana connection details
+type Client struct {
+	URL  string
+	User string
+	Pass string
+
+	http *http.Client
+}
+
+// Creates a new client for the Grafana instance at the given URL
+func NewClient(url, user, pass string) *Client {
+	return &Client{URL: url, User: user, Pass: pass, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Sends an authenticated request to the Grafana API, returning the status code and body
+func (c *Client) do(method, path string, payload any) (int, []byte, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(method, c.URL+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.SetBasicAuth(c.User, c.Pass)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, respBody, err
+}
+
+// Waits until Grafana responds on /api/health
+func (c *Client) WaitForReady(timeout time.Duration) error {
+	start := time.Now()
+
+	for {
+		status, _, err := c.do("GET", "/api/health", nil)
+
+		// Grafana is up if status is 200 or 401 (login required)
+		if err == nil && (status == 200 || status == 401) {
+			fmt.Println("Grafana is up and ready!")
+			return nil
+		}
+
+		// Give up if it doesn't start in "timeout" duration
+		if time.Since(start) > timeout {
+			return fmt.Errorf("grafana did not become ready within %s", timeout)
+		}
+
+		// Retries every 2 seconds
+		fmt.Println("Waiting for Grafana to start...")
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// Ensures Grafana has a Prometheus data source with the given name and URL
+func (c *Client) EnsurePrometheusDataSource(name, url string) error {
+	dataSource := map[string]any{
+		"name":      name,
+		"type":      "prometheus",
+		"url":       url,
+		"access":    "proxy",
+		"isDefault": true,
+	}
+
+	status, body, err := c.do("POST", "/api/datasources", dataSource)
+	if err != nil {
+		return err
+	}
+
+	// 409 means the data source already exists, which is fine
+	if status == http.StatusConflict {
+		return nil
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("creating data source %s failed with status %d: %s", name, status, body)
+	}
+
+	fmt.Println("Prometheus data source configured successfully!")
+	return nil
+}
+
+// Ensures a folder with the given UID exists, so dashboards can be organized inside it
+func (c *Client) EnsureFolder(uid, title string) error {
+	status, body, err := c.do("POST", "/api/folders", map[string]string{"uid": uid, "title": title})
+	if err != nil {
+		return err
+	}
+
+	// 409 and 412 mean a folder with this UID or title already exists
+	if status == http.StatusConflict || status == http.StatusPreconditionFailed {
+		return nil
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("creating folder %s failed with status %d: %s", title, status, body)
+	}
+	return nil
+}
+
+// Renders the dashboard and posts it to Grafana
+// The /api/dashboards/db endpoint handles both creating new dashboards and updating existing dashboards
+func (c *Client) PushDashboard(d *Dashboard) error {
+	data, err := d.Render()
+	if err != nil {
+		return err
+	}
+
+	status, body, err := c.do("POST", "/api/dashboards/db", json.RawMessage(data))
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("pushing dashboard %s failed with status %d: %s", d.Title, status, body)
+	}
+	return nil
+}
+
+// Deletes the dashboard with the given UID (a dashboard that doesn't exist is not an error)
+func (c *Client) DeleteDashboard(uid string) error {
+	status, body, err := c.do("DELETE", "/api/dashboards/uid/"+uid, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return nil
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("deleting dashboard %s failed with status %d: %s", uid, status, body)
+	}
+	return nil
+}
+
+// Gets the dashboard model with the given UID
+func (c *Client) GetDashboard(uid string) (map[string]any, error) {
+	status, body, err := c.do("GET", "/api/dashboards/uid/"+uid, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("getting dashboard %s failed with status %d: %s", uid, status, body)
+	}
+
+	var result struct {
+		Dashboard map[string]any `json:"dashboard"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return result.Dashboard, nil
+}
+
+// Creates a snapshot of the dashboard (which never expires), returning Grafana's response (key, url, ...)
+func (c *Client) CreateSnapshot(dashboard map[string]any) (map[string]any, error) {
+	status, body, err := c.do("POST", "/api/snapshots", map[string]any{"dashboard": dashboard, "expires": 0})
+	if err != nil {
+		return nil, err
+	}
+	if status < 200 || status >= 300 {
+		return nil, fmt.Errorf("creating snapshot failed with status %d: %s", status, body)
+	}
+
+	var result map[string]any
+	err = json.Unmarshal(body, &result)
+	return result, err
+}
+
+// Renders a single panel of a dashboard as a PNG (requires the Grafana image renderer plugin)
+func (c *Client) RenderPanel(uid string, panelID, width, height int) ([]byte, error) {
+	path := fmt.Sprintf("/render/d-solo/%s/?panelId=%d&width=%d&height=%d&from=now-6h&to=now", uid, panelID, width, height)
+
+	status, body, err := c.do("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("rendering panel %d of %s failed with status %d", panelID, uid, status)
+	}
+	return body, nil
+}
@@ -0,0 +1,343 @@
+package grafana
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"text/template"
+)
+
+// Grafana dashboards are laid out on a grid that is 24 units wide
+const (
+	gridWidth         = 24
+	metricPanelHeight = 8
+	alertPanelHeight  = 4
+)
+
+// Gauge holding the start of each date as a Unix timestamp (with the same location, date, and epoch labels as the metrics)
+const DateTimestampGauge = "forecast_date_timestamp_seconds"
+
+// Info gauge (always 1) labeled with each location and the group it was requested as part of, joined on by the group dashboards
+const LocationGroupGauge = "location_group"
+
+// Matches the series of the dashboard's tenant (series without a tenant label match when no tenant is set)
+const TenantMatcher = `tenant="$tenant"`
+
+// Panel types supported by the templates
+const (
+	TypeTimeSeries = "timeseries"
+	TypeStat       = "stat"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// Dashboard templates (a "json" function is available so values are always escaped correctly)
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}).ParseFS(templateFiles, "templates/*.tmpl"))
+
+// A Prometheus metric that is displayed as a time series panel
+type Metric struct {
+	Name  string
+	Title string
+
+	// Grafana unit ID (Ex: "fahrenheit", "percent", "velocitymph")
+	Unit string
+
+	// Gauges of each date's low and high, drawn as a band around the metric's line (empty if it has no band)
+	Low, High string
+}
+
+// A Prometheus alert gauge (1 means active) that is displayed as a stat panel
+type Alert struct {
+	Name  string
+	Gauge string
+}
+
+// Position of a panel on the dashboard grid
+type GridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// A single panel on a dashboard
+// Expressions can use $location and $tenant, which are set to the dashboard's location and tenant
+type Panel struct {
+	Type   string
+	Title  string
+	Expr   string
+	Legend string
+	Unit   string
+
+	// Width of the panel (defaults to the whole row)
+	Width int
+
+	// Extra series drawn as a dashed band around the main one (Ex: each date's low and high)
+	Band []Target
+
+	// Set when the dashboard is laid out
+	ID      int
+	GridPos GridPos
+}
+
+// An extra query of a panel (RefID is its letter, the main query is A)
+type Target struct {
+	RefID  string
+	Expr   string
+	Legend string
+}
+
+// An annotation query that marks events (like alerts) on every time series panel
+type Annotation struct {
+	Name  string
+	Expr  string
+	Color string
+}
+
+// A full dashboard, ready to be rendered into Grafana JSON
+type Dashboard struct {
+	UID       string
+	Title     string
+	FolderUID string
+	Location  string
+	Tenant    string
+	Tags      []string
+	Refresh   string
+
+	Panels      []Panel
+	Annotations []Annotation
+}
+
+// Panels registered by other parts of the program, added to every location dashboard
+var (
+	customPanelsMu sync.Mutex
+	customPanels   []Panel
+)
+
+// Tenant that every new dashboard belongs to (empty if the stack isn't shared)
+var tenant string
+
+// Sets the tenant of every dashboard created after this, so their queries only match the tenant's series
+func SetTenant(t string) {
+	tenant = t
+}
+
+// Registers a custom panel that will be added to every location dashboard
+func RegisterPanel(p Panel) {
+	customPanelsMu.Lock()
+	defer customPanelsMu.Unlock()
+	customPanels = append(customPanels, p)
+}
+
+// Wraps the expression so its series are sorted by date (using the epoch label)
+// sort_by_label needs Prometheus to run with --enable-feature=promql-experimental-functions
+func Chronological(expr string) string {
+	return fmt.Sprintf(`sort_by_label(%s, "epoch")`, expr)
+}
+
+// Creates a time series panel for a metric, showing one line per date (in order)
+// A metric with a low and high gets each date's band too
+func MetricPanel(m Metric) Panel {
+	selector := `{` + TenantMatcher + `, location="$location"}`
+	p := Panel{
+		Type:   TypeTimeSeries,
+		Title:  m.Title,
+		Expr:   Chronological(m.Name + selector),
+		Legend: "{{date}}",
+		Unit:   m.Unit,
+	}
+	if m.Low != "" && m.High != "" {
+		p.Band = []Target{
+			{RefID: "B", Expr: Chronological(m.Low + selector), Legend: "{{date}} low"},
+			{RefID: "C", Expr: Chronological(m.High + selector), Legend: "{{date}} high"},
+		}
+	}
+	return p
+}
+
+// Creates a stat panel for an alert gauge, showing the date of every active alert (in order)
+func AlertPanel(a Alert) Panel {
+	return Panel{
+		Type:   TypeStat,
+		Title:  a.Name,
+		Expr:   Chronological(a.Gauge + `{` + TenantMatcher + `, location="$location"} == 1`),
+		Legend: "{{date}}",
+		Unit:   "none",
+	}
+}
+
+// Wraps the expression so each date is aggregated across every location of the group
+// The group's locations come from the location group gauge, and the aggregation keeps the date and epoch labels, so the series still sort by date
+func groupChronological(aggregation, expr, group string) string {
+	return Chronological(fmt.Sprintf(`%s by (date, epoch) ((%s) and on(location) %s{%s, group=%q})`, aggregation, expr, LocationGroupGauge, TenantMatcher, group))
+}
+
+// Builds the dashboard for a group of locations (a state or ZIP code range), using the location group gauge
+// Each metric is averaged across the group's locations, and each alert shows how many of them have it on
+func NewGroupDashboard(uid, title, folderUID, group string, metrics []Metric, alerts []Alert) *Dashboard {
+	d := &Dashboard{
+		UID:       uid,
+		Title:     title,
+		FolderUID: folderUID,
+		Tenant:    tenant,
+		Tags:      []string{"weather", "group"},
+		Refresh:   "5s",
+	}
+
+	selector := `{` + TenantMatcher + `}`
+	for _, m := range metrics {
+		p := Panel{
+			Type:   TypeTimeSeries,
+			Title:  m.Title + " - Average",
+			Expr:   groupChronological("avg", m.Name+selector, group),
+			Legend: "{{date}}",
+			Unit:   m.Unit,
+		}
+
+		// The band of a group goes from its lowest location's low to its highest location's high
+		if m.Low != "" && m.High != "" {
+			p.Band = []Target{
+				{RefID: "B", Expr: groupChronological("min", m.Low+selector, group), Legend: "{{date}} low"},
+				{RefID: "C", Expr: groupChronological("max", m.High+selector, group), Legend: "{{date}} high"},
+			}
+		}
+		d.Panels = append(d.Panels, p)
+	}
+
+	for _, a := range alerts {
+		d.Panels = append(d.Panels, Panel{
+			Type:   TypeStat,
+			Title:  a.Name + " - Locations",
+			Expr:   groupChronological("count", a.Gauge+selector+" == 1", group),
+			Legend: "{{date}}",
+			Unit:   "none",
+			Width:  gridWidth / max(len(alerts), 1),
+		})
+	}
+	return d
+}
+
+// Builds a dashboard from the given panels (not tied to a location)
+func NewDashboard(uid, title, folderUID string, tags []string, panels []Panel) *Dashboard {
+	return &Dashboard{
+		UID:       uid,
+		Title:     title,
+		FolderUID: folderUID,
+		Tenant:    tenant,
+		Tags:      tags,
+		Refresh:   "5s",
+		Panels:    panels,
+	}
+}
+
+// Builds the dashboard for a single location
+// Metric panels come first, then a row of alert panels, then any registered custom panels
+func NewLocationDashboard(uid, title, folderUID, location string, metrics []Metric, alerts []Alert) *Dashboard {
+	d := &Dashboard{
+		UID:       uid,
+		Title:     title,
+		FolderUID: folderUID,
+		Location:  location,
+		Tenant:    tenant,
+		Tags:      []string{"weather"},
+		Refresh:   "5s",
+	}
+
+	for _, m := range metrics {
+		d.Panels = append(d.Panels, MetricPanel(m))
+	}
+
+	// Alert panels share a single row, and each alert also marks its dates on the graphs
+	for _, a := range alerts {
+		panel := AlertPanel(a)
+		panel.Width = gridWidth / max(len(alerts), 1)
+		d.Panels = append(d.Panels, panel)
+
+		d.Annotations = append(d.Annotations, Annotation{
+			Name:  a.Name,
+			Expr:  a.Gauge + `{` + TenantMatcher + `, location="$location"} == 1`,
+			Color: "red",
+		})
+	}
+
+	customPanelsMu.Lock()
+	d.Panels = append(d.Panels, customPanels...)
+	customPanelsMu.Unlock()
+
+	return d
+}
+
+// Gives each panel an ID and a position, filling rows left to right
+func (d *Dashboard) layout() {
+	x, y, rowHeight := 0, 0, 0
+
+	for i := range d.Panels {
+		p := &d.Panels[i]
+		p.ID = i + 1
+
+		width := p.Width
+		if width <= 0 || width > gridWidth {
+			width = gridWidth
+		}
+		height := metricPanelHeight
+		if p.Type == TypeStat {
+			height = alertPanelHeight
+		}
+
+		// Move to the next row if this panel doesn't fit on the current one
+		if x+width > gridWidth {
+			x = 0
+			y += rowHeight
+			rowHeight = 0
+		}
+
+		p.GridPos = GridPos{X: x, Y: y, W: width, H: height}
+		x += width
+		rowHeight = max(rowHeight, height)
+	}
+}
+
+// Renders the dashboard into the JSON body expected by /api/dashboards/db
+func (d *Dashboard) Render() ([]byte, error) {
+	d.layout()
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "dashboard.json.tmpl", d); err != nil {
+		return nil, err
+	}
+
+	// Compact the output, which also makes sure the template produced valid JSON
+	var out bytes.Buffer
+	if err := json.Compact(&out, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Renders the dashboard as indented JSON with every key sorted, so the output of two runs can be compared as a diff
+func (d *Dashboard) RenderStable() ([]byte, error) {
+	data, err := d.Render()
+	if err != nil {
+		return nil, err
+	}
+
+	// Maps are written with sorted keys, so decoding and encoding again puts every key in a stable order
+	var model map[string]any
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(model, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
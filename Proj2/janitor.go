@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Most runs the history file remembers (older runs are dropped)
+const maxHistoryRuns = 100
+
+// ZIP codes that one run asked for
+type HistoryRun struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Zips []string  `json:"zips"`
+
+	// Offset from UTC (in seconds) of every location known by the end of the run, so later runs look up its dates on the right day
+	Offsets map[string]int `json:"offsets,omitempty"`
+}
+
+// Reads every run in the history file (a missing file has no runs)
+func loadRunHistory() ([]HistoryRun, error) {
+	data, err := os.ReadFile(config.Janitor.HistoryPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []HistoryRun{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []HistoryRun{}
+	err = json.Unmarshal(data, &runs)
+	return runs, err
+}
+
+// Adds this run's ZIP codes to the history file
+func recordRunHistory(zips []string) {
+	runs, err := loadRunHistory()
+	if err != nil {
+		fmt.Println("Error reading the run history:", err)
+		return
+	}
+
+	runs = append(runs, HistoryRun{ID: runID, Time: time.Now(), Zips: zips, Offsets: knownZipOffsets()})
+	if len(runs) > maxHistoryRuns {
+		runs = runs[len(runs)-maxHistoryRuns:]
+	}
+
+	data, _ := json.MarshalIndent(runs, "", "  ")
+	if err := os.WriteFile(config.Janitor.HistoryPath, data, 0644); err != nil {
+		fmt.Println("Error writing the run history:", err)
+	}
+}
+
+// Returns the ZIP codes in the TSDB that none of the last n runs asked for
+// Nothing is stale until there are at least n runs in the history, so a new deployment never removes anything
+func staleZips(n int) ([]string, error) {
+	runs, err := loadRunHistory()
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) < n {
+		fmt.Printf("Only %d runs are in the history, so no ZIP code is stale yet (needs %d).\n", len(runs), n)
+		return []string{}, nil
+	}
+
+	recent := make(map[string]struct{})
+	for _, run := range runs[len(runs)-n:] {
+		for _, zip := range run.Zips {
+			recent[zip] = struct{}{}
+		}
+	}
+
+	zips, err := metricStore.Zips()
+	if err != nil {
+		return nil, err
+	}
+	stale := []string{}
+	for _, zip := range zips {
+		if _, requested := recent[zip]; !requested {
+			stale = append(stale, zip)
+		}
+	}
+	return stale, nil
+}
+
+// Removes everything kept for the ZIP codes that none of the last n runs asked for:
+// their Grafana dashboard (and its JSON file), their gauge label sets, their metrics in the TSDB, and their Prometheus series
+// With dryRun, the stale ZIP codes are only listed
+// Returns the ZIP codes that were stale
+func cleanupStaleZips(n int, dryRun bool) []string {
+	stale, err := staleZips(n)
+	if err != nil {
+		fmt.Println("Error finding stale ZIP codes:", err)
+		return nil
+	}
+	if len(stale) == 0 {
+		fmt.Printf("No ZIP codes are stale (every ZIP code was asked for in the last %d runs).\n", n)
+		return stale
+	}
+
+	for _, zip := range stale {
+		if dryRun {
+			fmt.Printf("ZIP %s has not been asked for in the last %d runs, and would be removed\n", zip, n)
+			continue
+		}
+
+		if err := grafanaClient.DeleteDashboard(zipDashboardUID(zip)); err != nil {
+			fmt.Printf("Failed to delete the dashboard for ZIP %s: %s\n", zip, err)
+		}
+		if config.DashboardDir != "" {
+			os.Remove(filepath.Join(config.DashboardDir, zipDashboardUID(zip)+".json"))
+		}
+
+		gauges := deleteGauges(prometheus.Labels{"location": zip})
+
+		if err := metricStore.Delete(zip); err != nil {
+			fmt.Printf("Failed to delete the stored metrics for ZIP %s: %s\n", zip, err)
+		}
+
+		if err := deletePrometheusSeries(zip); err != nil {
+			fmt.Printf("Failed to delete the Prometheus series for ZIP %s (is --web.enable-admin-api set?): %s\n", zip, err)
+		}
+
+		fmt.Printf("Removed ZIP %s (not asked for in the last %d runs): dashboard, %d gauge label sets, and stored metrics\n", zip, n, gauges)
+	}
+	return stale
+}
+
+// Deletes every Prometheus series of the ZIP code (needs Prometheus to run with --web.enable-admin-api)
+func deletePrometheusSeries(zip string) error {
+	endpoint := config.PrometheusURL + "/api/v1/admin/tsdb/delete_series?" +
+		url.Values{"match[]": {fmt.Sprintf(`{%s=%q, location=%q}`, tenantLabel, namespace(), zip)}}.Encode()
+
+	resp, err := http.Post(endpoint, "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Removes the ZIP codes that none of the last runs asked for, then exits
+//
+//	proj2 janitor                   uses janitor.runs from the config
+//	proj2 janitor --runs 5          ZIP codes not asked for in the last 5 runs
+//	proj2 janitor --dry-run         only lists the ZIP codes that would be removed
+//
+// With Docker: docker-compose run --rm proj2 ./proj2 janitor --runs 5 --dry-run
+//
+// Returns the exit code of the command
+func runJanitor(args []string) int {
+	flags := flag.NewFlagSet("janitor", flag.ContinueOnError)
+	runs := flags.Int("runs", config.Janitor.Runs, "remove ZIP codes that none of the last N runs asked for")
+	dryRun := flags.Bool("dry-run", false, "only list the ZIP codes that would be removed")
+	if err := flags.Parse(args); err != nil {
+		return exitFatal
+	}
+	if *runs <= 0 {
+		fmt.Println("Set how many runs a ZIP code can go without being asked for, with --runs or janitor.runs (JANITOR_RUNS)")
+		return exitFatal
+	}
+
+	// Dashboards are removed too, so Grafana has to be up (max 60 seconds)
+	if !*dryRun {
+		if err := waitForGrafana(60 * time.Second); err != nil {
+			fmt.Println(err)
+			return exitFatal
+		}
+	}
+
+	cleanupStaleZips(*runs, *dryRun)
+	return exitOK
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -12,19 +11,28 @@ import (
 	"github.com/segmentio/kafka-go"
 )
 
-// KAFKA PORT USED
+// KAFKA BROKERS USED (set from the config)
 var (
-	brokerPort  string = "kafka:9092"
-	metricsChan        = make(chan WeatherMessage)
+	brokers = []string{"kafka:9092"}
+
+	// Messages read by the consumers, waiting to be written into Prometheus (buffered by the number of workers in main)
+	metricsChan chan WeatherMessage
 )
 
 // Structure that holds all writer instances for different topics
 // The writers handles all connections, partition selection, batching, and retries automatically
 type KafkaWriters struct {
-	TempWriter     *kafka.Writer
-	HumidityWriter *kafka.Writer
-	WindWriter     *kafka.Writer
-	CloudWriter    *kafka.Writer
+	TempWriter      *kafka.Writer
+	HumidityWriter  *kafka.Writer
+	WindWriter      *kafka.Writer
+	CloudWriter     *kafka.Writer
+	ConditionWriter *kafka.Writer
+	AlertWriter     *kafka.Writer
+	QualityWriter   *kafka.Writer
+
+	// Only created when the air quality or UV index metrics are turned on
+	AirQualityWriter *kafka.Writer
+	UVIndexWriter    *kafka.Writer
 }
 
 // Holds all metrics for a given ZIP-Date key
@@ -44,21 +52,41 @@ type WeatherMessage struct {
 	Date        string
 	Temperature float64 `json:"Temp"`
 	FeelsLike   float64 `json:"FeelsLike"`
+	MinTemp     float64 `json:"MinTemp"`
+	MaxTemp     float64 `json:"MaxTemp"`
+	AvgTemp     float64 `json:"AvgTemp"`
 	Humidity    float64 `json:"Humidity"`
 	WindSpeed   float64 `json:"Speed"`
 	WindDegree  float64 `json:"Degree"`
 	Cloud       float64 `json:"CloudPercent"`
+	AQI         float64 `json:"AQI"`
+	PM25        float64 `json:"PM25"`
+	UVI         float64 `json:"UVI"`
+	ConditionID float64 `json:"ConditionID"`
+	Severity    float64 `json:"Severity"`
+
+	// When the message was written to Kafka, and the run that stored it (used by the freshness window, and to tell apart
+	// the values of different runs when a forecast is fetched again)
+	ProducedAt time.Time `json:",omitzero"`
+	RunID      string    `json:",omitempty"`
+
+	// State or ZIP code range the location was requested as part of (empty if it was requested on its own)
+	Group string `json:",omitempty"`
 }
 
 // ALL PAYLOADS FOR EACH WRITER
 // The basis for each payload requires a location and a time
 
 // Temperature Payload
+// MinTemp, MaxTemp, and AvgTemp are the low, high, and average of every three hour entry until the next sample (the whole day at 24 hour resolution)
 type TemperaturePayload struct {
 	Location  string
 	Date      string
 	Temp      float64
 	FeelsLike float64
+	MinTemp   float64
+	MaxTemp   float64
+	AvgTemp   float64
 }
 
 // Humidity Payload
@@ -89,7 +117,7 @@ func waitForKafka() {
 
 	// Once Kafka is officially setup and this connection is successful, the function will finish
 	for {
-		conn, err := kafka.Dial("tcp", brokerPort)
+		conn, err := kafka.Dial("tcp", brokers[0])
 
 		if err == nil {
 			conn.Close()
@@ -100,21 +128,31 @@ func waitForKafka() {
 	}
 }
 
-// Ensures a Kafka topic exists
-// If doesn't, will be created
-func ensureKafkaTopic(topic string) {
+// Ensures a Kafka topic exists with at least the given number of partitions
+// If doesn't, will be created (with the given topic configs, Ex: cleanup.policy=compact)
+func ensureKafkaTopic(topic string, numPartitions int, configEntries ...kafka.ConfigEntry) {
+	check(createKafkaTopic(topic, numPartitions, configEntries...))
+}
+
+// Creates the Kafka topic if it doesn't exist yet (or adds partitions if it has too few), returning any error instead of ending the program
+func createKafkaTopic(topic string, numPartitions int, configEntries ...kafka.ConfigEntry) error {
 
 	// Connect to the Kafka broker
-	conn, err := kafka.Dial("tcp", brokerPort)
-	check(err)
+	conn, err := kafka.Dial("tcp", brokers[0])
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
 
 	// Check if the topic already exists by reading its partitions
 	partitions, err := conn.ReadPartitions(topic)
 
-	// If partitions are returned, that means the topic exists so the program can end
+	// If partitions are returned, that means the topic exists so the program can end (once it has enough partitions)
 	if err == nil && len(partitions) > 0 {
-		return
+		if len(partitions) < numPartitions {
+			return addKafkaPartitions(topic, len(partitions), numPartitions)
+		}
+		return nil
 	}
 
 	// If program reached here, that means the topic does not exist, so we need to create it
@@ -122,25 +160,29 @@ func ensureKafkaTopic(topic string) {
 	// First, find the Kafka controller (responsible for topic creation)
 	// In Kafka, only the controller broker can create topics
 	controller, err := conn.Controller()
-	check(err)
+	if err != nil {
+		return err
+	}
 
 	// Connect to the Kafka controller
 	controllerConn, err := kafka.Dial("tcp", fmt.Sprintf("%s:%d", controller.Host, controller.Port))
-	check(err)
+	if err != nil {
+		return err
+	}
 	defer controllerConn.Close()
 
-	// Define topic configuration: 1 partition, 1 replica
+	// Define topic configuration: the given number of partitions, 1 replica
 	topicConfigs := []kafka.TopicConfig{
 		{
 			Topic:             topic,
-			NumPartitions:     1,
+			NumPartitions:     numPartitions,
 			ReplicationFactor: 1,
+			ConfigEntries:     configEntries,
 		},
 	}
 
 	// Send request to Kafka controller to create the topic
-	err = controllerConn.CreateTopics(topicConfigs...)
-	check(err)
+	return controllerConn.CreateTopics(topicConfigs...)
 }
 
 // Initializes all of the Kafka Writers
@@ -151,51 +193,110 @@ func initKafkaWriters() *KafkaWriters {
 	// Writer for the temperature topic
 	tWriter := kafka.NewWriter(kafka.WriterConfig{
 		// Broker allows applications to communicate asynchronously by exchanging messages
-		Brokers:      []string{brokerPort},
-		Topic:        "temperature",
+		Brokers:      brokers,
+		Topic:        tenantTopic("temperature"),
 		BatchTimeout: 10 * time.Millisecond,
 		BatchSize:    1,
+		Balancer:     zipBalancer{},
 	})
 
 	// Writer for the humidity topic
 	hWriter := kafka.NewWriter(kafka.WriterConfig{
 		// Broker allows applications to communicate asynchronously by exchanging messages
-		Brokers:      []string{brokerPort},
-		Topic:        "humidity",
+		Brokers:      brokers,
+		Topic:        tenantTopic("humidity"),
 		BatchTimeout: 10 * time.Millisecond,
 		BatchSize:    1,
+		Balancer:     zipBalancer{},
 	})
 
 	// Writer for the wind topic
 	wWriter := kafka.NewWriter(kafka.WriterConfig{
 		// Broker allows applications to communicate asynchronously by exchanging messages
-		Brokers:      []string{brokerPort},
-		Topic:        "wind",
+		Brokers:      brokers,
+		Topic:        tenantTopic("wind"),
 		BatchTimeout: 10 * time.Millisecond,
 		BatchSize:    1,
+		Balancer:     zipBalancer{},
 	})
 
 	// Writer for the cloud topic
 	cWriter := kafka.NewWriter(kafka.WriterConfig{
 		// Broker allows applications to communicate asynchronously by exchanging messages
-		Brokers:      []string{brokerPort},
-		Topic:        "cloud",
+		Brokers:      brokers,
+		Topic:        tenantTopic("cloud"),
+		BatchTimeout: 10 * time.Millisecond,
+		BatchSize:    1,
+		Balancer:     zipBalancer{},
+	})
+
+	// Writer for the conditions topic
+	condWriter := kafka.NewWriter(kafka.WriterConfig{
+		// Broker allows applications to communicate asynchronously by exchanging messages
+		Brokers:      brokers,
+		Topic:        tenantTopic(conditionsTopic),
+		BatchTimeout: 10 * time.Millisecond,
+		BatchSize:    1,
+		Balancer:     zipBalancer{},
+	})
+
+	// Writer for the alerts topic
+	aWriter := kafka.NewWriter(kafka.WriterConfig{
+		// Broker allows applications to communicate asynchronously by exchanging messages
+		Brokers:      brokers,
+		Topic:        tenantTopic(alertsTopic),
+		BatchTimeout: 10 * time.Millisecond,
+		BatchSize:    1,
+		Balancer:     zipBalancer{},
+	})
+
+	// Writer for the quality issues topic
+	qWriter := kafka.NewWriter(kafka.WriterConfig{
+		// Broker allows applications to communicate asynchronously by exchanging messages
+		Brokers:      brokers,
+		Topic:        tenantTopic(qualityTopic),
 		BatchTimeout: 10 * time.Millisecond,
 		BatchSize:    1,
+		Balancer:     zipBalancer{},
 	})
 
-	return &KafkaWriters{TempWriter: tWriter, HumidityWriter: hWriter, WindWriter: wWriter, CloudWriter: cWriter}
+	writers := &KafkaWriters{TempWriter: tWriter, HumidityWriter: hWriter, WindWriter: wWriter, CloudWriter: cWriter, ConditionWriter: condWriter, AlertWriter: aWriter, QualityWriter: qWriter}
+
+	// Writers for the optional air quality and UV index topics
+	if config.AirQuality {
+		writers.AirQualityWriter = kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      brokers,
+			Topic:        tenantTopic(airQualityTopic),
+			BatchTimeout: 10 * time.Millisecond,
+			BatchSize:    1,
+			Balancer:     zipBalancer{},
+		})
+	}
+	if config.UVIndex {
+		writers.UVIndexWriter = kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      brokers,
+			Topic:        tenantTopic(uvIndexTopic),
+			BatchTimeout: 10 * time.Millisecond,
+			BatchSize:    1,
+			Balancer:     zipBalancer{},
+		})
+	}
+
+	return writers
 }
 
-// Reads messages that come through topics
+// Reads messages that come through topics (the topic's name without the tenant prefix, which is added here)
+// Each reader of a topic joins the same consumer group, so the topic's partitions are split between them
 func consumeKafkaTopic(ctx context.Context, topic string) {
 
 	// Creates a new Kafka reader to read data coming from this topic
 	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     []string{brokerPort},
-		Topic:       topic,
-		StartOffset: kafka.FirstOffset,
-		MaxWait:     100 * time.Millisecond,
+		Brokers:        brokers,
+		Topic:          tenantTopic(topic),
+		GroupID:        consumerGroup(topic),
+		StartOffset:    kafka.FirstOffset,
+		MaxWait:        100 * time.Millisecond,
+		CommitInterval: time.Second,
 	})
 	defer reader.Close()
 
@@ -209,18 +310,27 @@ func consumeKafkaTopic(ctx context.Context, topic string) {
 			return
 		}
 
-		// Unmarshal the JSON string into the WeatherMessage structure
-		var msg WeatherMessage
-		err = json.Unmarshal(m.Value, &msg)
-		check(err)
+		// Decode the JSON string into the WeatherMessage structure (checking it against the topic's schema)
+		// Payloads that can't be used are skipped, instead of showing up as zeros on the dashboards
+		kafkaConsumed.WithLabelValues(topic).Inc()
+		msg, ok := decodePayload(topic, m.Value)
+		if !ok {
+			continue
+		}
 
-		// Break up key into ZIP code and Date
+		// Break up key into ZIP code and Date (a key without both can't be put on a dashboard, so it is skipped)
 		keyParts := strings.SplitN(string(m.Key), "-", 2)
+		if len(keyParts) != 2 {
+			reportPayloadIssue(topic, "key", "invalid", "key is not ZIP-date, dropping the payload")
+			continue
+		}
 		msg.Zip = keyParts[0]
 		msg.Date = keyParts[1]
+		msg.Group = zipGroup(msg.Zip)
 
 		// Track which topic the message came from
 		msg.Topic = topic
+		msg.ProducedAt = m.Time
 
 		// Adds message to the metrics channel
 		metricsChan <- msg
@@ -230,7 +340,13 @@ func consumeKafkaTopic(ctx context.Context, topic string) {
 // Closes all of the Writers at the end of this program
 func (w *KafkaWriters) closeKafkaWriters() {
 	// Creates a slice of all writers for this program
-	writers := []*kafka.Writer{w.TempWriter, w.HumidityWriter, w.WindWriter, w.CloudWriter}
+	writers := []*kafka.Writer{w.TempWriter, w.HumidityWriter, w.WindWriter, w.CloudWriter, w.ConditionWriter, w.AlertWriter, w.QualityWriter}
+	if w.AirQualityWriter != nil {
+		writers = append(writers, w.AirQualityWriter)
+	}
+	if w.UVIndexWriter != nil {
+		writers = append(writers, w.UVIndexWriter)
+	}
 
 	// Waitgroup to close these channels concurrently
 	var wg sync.WaitGroup
@@ -239,8 +355,10 @@ func (w *KafkaWriters) closeKafkaWriters() {
 	for _, writer := range writers {
 		w := writer
 		wg.Go(func() {
-			err := w.Close()
-			check(err)
+			// Not check, since this runs while the program is already ending
+			if err := w.Close(); err != nil {
+				fmt.Println("Error closing Kafka writer:", err)
+			}
 		})
 	}
 
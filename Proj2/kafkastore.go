@@ -0,0 +1,355 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// ---- Kafka backend (a log-compacted topic keyed by zip-date-topic) ----
+
+// Kafka only keeps the newest message for each key in a compacted topic, so the topic holds the latest value of every
+// metric without growing forever, and no file has to be shared between runs
+// On start, the whole topic is replayed to rebuild the Prometheus gauges and the index used by Has and Zips
+// Deleted metrics are tombstones (a key with no value), which compaction eventually removes along with the old values
+// A value that is replaced by a newer run is first copied to zip-date-topic@runID, so the old forecast is kept for drift analysis
+// Every topic that can have stored metrics (deleting a ZIP code writes a tombstone for each of them)
+var storedTopics = []string{"temperature", "humidity", "wind", "cloud", conditionsTopic, airQualityTopic, uvIndexTopic}
+
+type kafkaStore struct {
+	writer *kafka.Writer
+
+	// Dates that have metrics (with when their newest metric was produced), by ZIP code
+	mu    sync.RWMutex
+	dates map[string]map[string]time.Time
+
+	// Newest value of every key (copied to an archive key when a new run replaces it), and the archive keys of each ZIP code
+	values   map[string][]byte
+	archived map[string][]string
+}
+
+// Creates the compacted topic (if needed), then replays it
+func openKafkaStore(topic string) (*kafkaStore, error) {
+	waitForKafka()
+	topic = tenantTopic(topic)
+
+	// One partition, since the whole topic is replayed by a single reader
+	ensureKafkaTopic(topic, 1, kafka.ConfigEntry{ConfigName: "cleanup.policy", ConfigValue: "compact"})
+
+	s := &kafkaStore{
+		writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      brokers,
+			Topic:        topic,
+			BatchTimeout: 10 * time.Millisecond,
+			BatchSize:    1,
+		}),
+		dates:    make(map[string]map[string]time.Time),
+		values:   make(map[string][]byte),
+		archived: make(map[string][]string),
+	}
+
+	replayed, err := s.replay(topic)
+	if err != nil {
+		s.writer.Close()
+		return nil, err
+	}
+	fmt.Printf("Replayed %d metrics from the %s topic\n", replayed, topic)
+	return s, nil
+}
+
+// Reads every message in the topic (up to the newest one when the program started), returning how many were read
+func (s *kafkaStore) replay(topic string) (int, error) {
+	conn, err := kafka.DialLeader(context.Background(), "tcp", brokers[0], topic, 0)
+	if err != nil {
+		return 0, err
+	}
+	first, last, err := conn.ReadOffsets()
+	conn.Close()
+	if err != nil || first >= last {
+		return 0, err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     topic,
+		Partition: 0,
+		MaxWait:   100 * time.Millisecond,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(first); err != nil {
+		return 0, err
+	}
+
+	// Compaction removes old offsets, so stop at the last offset instead of counting messages
+	replayed := 0
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		m, err := reader.ReadMessage(ctx)
+		cancel()
+		if err != nil {
+			return replayed, err
+		}
+
+		// Archived values are only kept for drift analysis, so they don't set the gauges
+		key := string(m.Key)
+		var msg WeatherMessage
+		if _, _, isArchive := strings.Cut(key, "@"); isArchive {
+			s.archive(key, len(m.Value) > 0)
+		} else if len(m.Value) == 0 {
+			// A tombstone removes everything read for its ZIP code and date so far
+			if zip, date, ok := splitStoreKey(key); ok {
+				s.unindex(zip, date)
+				deleteGauges(prometheus.Labels{"location": zip, "date": date})
+			}
+		} else if err := json.Unmarshal(m.Value, &msg); err == nil {
+			// Values stored before produced times were saved use the time they were written to the topic
+			if msg.ProducedAt.IsZero() {
+				msg.ProducedAt = m.Time
+			}
+			s.index(msg, key, m.Value)
+
+			// Same gauges as a new message, but nothing is published or stored again
+			setGauges(msg, nil)
+			replayed++
+		}
+
+		if m.Offset >= last-1 {
+			return replayed, nil
+		}
+	}
+}
+
+// Remembers that the ZIP code has metrics on the message's date (and when the newest one was produced), and the key's value
+func (s *kafkaStore) index(msg WeatherMessage, key string, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dates[msg.Zip] == nil {
+		s.dates[msg.Zip] = make(map[string]time.Time)
+	}
+	if msg.ProducedAt.After(s.dates[msg.Zip][msg.Date]) {
+		s.dates[msg.Zip][msg.Date] = msg.ProducedAt
+	}
+	s.values[key] = value
+}
+
+// Forgets that the ZIP code has metrics on the date
+func (s *kafkaStore) unindex(zip, date string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.dates[zip], date)
+	if len(s.dates[zip]) == 0 {
+		delete(s.dates, zip)
+	}
+	for _, topic := range storedTopics {
+		delete(s.values, storeKey(zip, date, topic))
+	}
+}
+
+// Remembers (or forgets, for a tombstone) an archive key, so deleting its ZIP code also deletes it
+func (s *kafkaStore) archive(key string, exists bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zip, _, _ := strings.Cut(key, "-")
+	kept := slices.DeleteFunc(s.archived[zip], func(k string) bool { return k == key })
+	if exists {
+		kept = append(kept, key)
+	}
+	s.archived[zip] = kept
+}
+
+// Returns the key of the message in the topic (zip-date-topic)
+func storeKey(zip, date, topic string) string {
+	return fmt.Sprintf("%s-%s-%s", zip, date, topic)
+}
+
+// Splits a key into its ZIP code and date (the date has dashes of its own, so the ZIP code is before the first dash and the topic after the last)
+func splitStoreKey(key string) (string, string, bool) {
+	first, last := strings.Index(key, "-"), strings.LastIndex(key, "-")
+	if first == -1 || first == last {
+		return "", "", false
+	}
+	return key[:first], key[first+1 : last], true
+}
+
+// Writes the message to the topic, replacing the last value for the same ZIP code, date, and topic
+// If the last value came from an earlier run, it is copied to an archive key under that run's ID first
+func (s *kafkaStore) Append(ctx context.Context, msg WeatherMessage) error {
+	if msg.ProducedAt.IsZero() {
+		msg.ProducedAt = time.Now()
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	key := storeKey(msg.Zip, msg.Date, msg.Topic)
+	messages := []kafka.Message{{Key: []byte(key), Value: data}}
+
+	s.mu.RLock()
+	previous := s.values[key]
+	s.mu.RUnlock()
+	var archiveKey string
+	if previous != nil {
+		var old WeatherMessage
+		if json.Unmarshal(previous, &old) == nil && old.RunID != msg.RunID {
+			// Values stored before run IDs were saved are archived under "unknown"
+			archiveKey = key + "@" + cmp.Or(old.RunID, "unknown")
+			messages = append([]kafka.Message{{Key: []byte(archiveKey), Value: previous}}, messages...)
+		}
+	}
+
+	if err := s.writer.WriteMessages(ctx, messages...); err != nil {
+		return err
+	}
+
+	s.index(msg, key, data)
+	if archiveKey != "" {
+		s.archive(archiveKey, true)
+	}
+	return nil
+}
+
+// Checks the index for a fresh enough metric of the ZIP code on the day
+func (s *kafkaStore) Has(zip, day string, since time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for date, producedAt := range s.dates[zip] {
+		if strings.HasPrefix(date, day) && !producedAt.Before(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns every ZIP code in the index
+func (s *kafkaStore) Zips() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	zips := make([]string, 0, len(s.dates))
+	for zip := range s.dates {
+		zips = append(zips, zip)
+	}
+	sort.Strings(zips)
+	return zips, nil
+}
+
+// Writes a tombstone for every topic on every date the ZIP code has metrics (and for its archived values)
+func (s *kafkaStore) Delete(zip string) error {
+	s.mu.RLock()
+	tombstones := []kafka.Message{}
+	for date := range s.dates[zip] {
+		for _, topic := range storedTopics {
+			tombstones = append(tombstones, kafka.Message{Key: []byte(storeKey(zip, date, topic))})
+		}
+	}
+	for _, key := range s.archived[zip] {
+		tombstones = append(tombstones, kafka.Message{Key: []byte(key)})
+	}
+	s.mu.RUnlock()
+
+	if len(tombstones) == 0 {
+		return nil
+	}
+	if err := writeMessages(s.writer, tombstones...); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for date := range s.dates[zip] {
+		for _, topic := range storedTopics {
+			delete(s.values, storeKey(zip, date, topic))
+		}
+	}
+	delete(s.dates, zip)
+	delete(s.archived, zip)
+	s.mu.Unlock()
+	return nil
+}
+
+// Writes a tombstone for every key dated before the day (and for the archived values of those dates)
+func (s *kafkaStore) DeleteBefore(day string) error {
+	type zipDate struct{ zip, date string }
+
+	s.mu.RLock()
+	stale := []zipDate{}
+	for zip, dates := range s.dates {
+		for date := range dates {
+			if date < day {
+				stale = append(stale, zipDate{zip, date})
+			}
+		}
+	}
+	tombstones := []kafka.Message{}
+	for _, d := range stale {
+		for _, topic := range storedTopics {
+			tombstones = append(tombstones, kafka.Message{Key: []byte(storeKey(d.zip, d.date, topic))})
+		}
+	}
+	archives := []string{}
+	for _, keys := range s.archived {
+		for _, key := range keys {
+			base, _, _ := strings.Cut(key, "@")
+			if _, date, ok := splitStoreKey(base); ok && date < day {
+				archives = append(archives, key)
+				tombstones = append(tombstones, kafka.Message{Key: []byte(key)})
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(tombstones) == 0 {
+		return nil
+	}
+	if err := writeMessages(s.writer, tombstones...); err != nil {
+		return err
+	}
+
+	for _, d := range stale {
+		s.unindex(d.zip, d.date)
+	}
+	for _, key := range archives {
+		s.archive(key, false)
+	}
+	return nil
+}
+
+// Calls fn with the newest value of every key, in order of key
+func (s *kafkaStore) Each(fn func(WeatherMessage) bool) error {
+	s.mu.RLock()
+	keys := slices.Sorted(maps.Keys(s.values))
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = s.values[key]
+	}
+	s.mu.RUnlock()
+
+	for _, value := range values {
+		var msg WeatherMessage
+		if json.Unmarshal(value, &msg) != nil {
+			continue
+		}
+		if !fn(msg) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *kafkaStore) Close() error {
+	return s.writer.Close()
+}
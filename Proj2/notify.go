@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PagerDuty Events API v2 endpoint that alert notifications are sent to (when a routing key is set)
+var pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Notification pushed to the webhooks, Slack, and PagerDuty when an alert gauge turns on
+type AlertNotification struct {
+	Zip       string    `json:"zip"`
+	Location  string    `json:"location,omitempty"`
+	Date      string    `json:"date"`
+	Metric    string    `json:"metric"`
+	Direction string    `json:"direction"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Units     string    `json:"units"`
+	Tenant    string    `json:"tenant,omitempty"`
+	FiredAt   time.Time `json:"fired_at"`
+}
+
+var (
+	// Alerts that were already notified this run (keyed like the alert state), so a flapping alert is only sent once
+	notifiedMu sync.Mutex
+	notified   = make(map[string]bool)
+
+	// Notifications that are still being delivered (waited for when the program shuts down)
+	notifyWG sync.WaitGroup
+)
+
+// Returns whether alert notifications are sent anywhere
+func notificationsEnabled() bool {
+	n := config.Notifications
+	return len(n.Webhooks) > 0 || n.SlackWebhook != "" || n.PagerDutyRoutingKey != ""
+}
+
+// Sends a notification that the alert turned on, unless it was already sent this run
+// Delivery happens in the background, so a slow webhook doesn't hold up the workers
+func notifyAlert(stateKey string, alert AlertMessage) {
+	if !notificationsEnabled() {
+		return
+	}
+
+	notifiedMu.Lock()
+	if notified[stateKey] {
+		notifiedMu.Unlock()
+		return
+	}
+	notified[stateKey] = true
+	notifiedMu.Unlock()
+
+	locationNamesMu.Lock()
+	name := locationNames[alert.Zip]
+	locationNamesMu.Unlock()
+
+	notification := AlertNotification{
+		Zip:       alert.Zip,
+		Location:  name,
+		Date:      alert.Date,
+		Metric:    alert.Metric,
+		Direction: alert.Direction,
+		Value:     alert.Value,
+		Threshold: alert.Threshold,
+		Units:     config.Units,
+		Tenant:    namespace(),
+		FiredAt:   time.Now(),
+	}
+	notifyWG.Go(func() {
+		deliverNotification(stateKey, notification)
+	})
+}
+
+// Sends the notification to every configured destination, counting each one that fails as a pipeline error
+func deliverNotification(stateKey string, n AlertNotification) {
+	deliver := func(destination, url string, payload any) {
+		if err := postNotification(url, payload); err != nil {
+			pipelineErrors.WithLabelValues("notify").Inc()
+			fmt.Printf("Error sending the %s alert for %s to %s: %s\n", n.Metric, n.Zip, destination, err)
+		}
+	}
+
+	for _, url := range config.Notifications.Webhooks {
+		deliver("webhook", url, n)
+	}
+	if config.Notifications.SlackWebhook != "" {
+		deliver("Slack", config.Notifications.SlackWebhook, map[string]string{"text": ":rotating_light: " + n.summary()})
+	}
+	if config.Notifications.PagerDutyRoutingKey != "" {
+		deliver("PagerDuty", pagerDutyURL, map[string]any{
+			"routing_key":  config.Notifications.PagerDutyRoutingKey,
+			"event_action": "trigger",
+			"dedup_key":    stateKey,
+			"payload": map[string]any{
+				"summary":        n.summary(),
+				"source":         "proj2",
+				"severity":       "warning",
+				"timestamp":      n.FiredAt.Format(time.RFC3339),
+				"custom_details": n,
+			},
+		})
+	}
+}
+
+// Returns a one line description of the alert (Ex: High temperature at 07001 (Newark) on 2025-10-20: 95.2, threshold 90)
+func (n AlertNotification) summary() string {
+	where := n.Zip
+	if n.Location != "" {
+		where += " (" + n.Location + ")"
+	}
+	if n.Metric == "condition" {
+		return fmt.Sprintf("%s%s at %s on %s (condition %g)", strings.ToUpper(n.Direction[:1]), n.Direction[1:], where, n.Date, n.Value)
+	}
+	return fmt.Sprintf("%s%s %s at %s on %s: %g, threshold %g", strings.ToUpper(n.Direction[:1]), n.Direction[1:], n.Metric, where, n.Date, n.Value, n.Threshold)
+}
+
+// Posts the payload as JSON, returning an error if it was not accepted
+func postNotification(url string, payload any) error {
+	body, _ := json.Marshal(payload)
+	resp, err := summaryClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Waits for the notifications that are still being delivered (a shutdown step)
+func waitForNotifications() {
+	notifyWG.Wait()
+}
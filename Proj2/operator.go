@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+
+	"proj2/grafana"
+)
+
+// Folder that the pipeline's own dashboard is organized into
+var (
+	pipelineFolderUID   = "pipeline"
+	pipelineFolderTitle = "Pipeline"
+)
+
+// Panels showing the pipeline's self-metrics (see pipeline.go), only matching this tenant's series
+var operatorPanels = []grafana.Panel{
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "API Latency p95 (s)",
+		Expr:   `histogram_quantile(0.95, sum by (le, endpoint) (rate(pipeline_api_request_duration_seconds_bucket{tenant="$tenant"}[1m])))`,
+		Legend: "{{endpoint}}",
+		Unit:   "s",
+		Width:  12,
+	},
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "API Calls per Second",
+		Expr:   `sum by (endpoint) (rate(pipeline_api_request_duration_seconds_count{tenant="$tenant"}[1m]))`,
+		Legend: "{{endpoint}}",
+		Unit:   "reqps",
+		Width:  12,
+	},
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "API Calls per Key",
+		Expr:   `sum by (key, status) (rate(pipeline_api_key_requests_total{tenant="$tenant"}[1m]))`,
+		Legend: "{{key}} ({{status}})",
+		Unit:   "reqps",
+	},
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "Kafka Produce Rate",
+		Expr:   `sum by (topic) (rate(pipeline_kafka_messages_produced_total{tenant="$tenant"}[1m]))`,
+		Legend: "{{topic}}",
+		Unit:   "wps",
+		Width:  12,
+	},
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "Kafka Consume Rate",
+		Expr:   `sum by (topic) (rate(pipeline_kafka_messages_consumed_total{tenant="$tenant"}[1m]))`,
+		Legend: "{{topic}}",
+		Unit:   "rps",
+		Width:  12,
+	},
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "Channel Depth",
+		Expr:   `pipeline_channel_depth{tenant="$tenant"}`,
+		Legend: "{{channel}}",
+		Unit:   "short",
+		Width:  12,
+	},
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "Worker Utilization",
+		Expr:   `pipeline_busy_workers{tenant="$tenant"} / pipeline_pool_size{tenant="$tenant"}`,
+		Legend: "{{pool}}",
+		Unit:   "percentunit",
+		Width:  12,
+	},
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "Errors per Minute",
+		Expr:   `sum by (stage) (increase(pipeline_errors_total{tenant="$tenant"}[1m]))`,
+		Legend: "{{stage}}",
+		Unit:   "short",
+	},
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "Rejected Values per Minute",
+		Expr:   `sum by (topic, field) (increase(pipeline_quality_issues_total{tenant="$tenant"}[1m]))`,
+		Legend: "{{topic}} {{field}}",
+		Unit:   "short",
+	},
+	{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "Payload Issues per Minute",
+		Expr:   `sum by (topic, field, issue) (increase(pipeline_payload_issues_total{tenant="$tenant"}[1m]))`,
+		Legend: "{{topic}} {{field}} ({{issue}})",
+		Unit:   "short",
+	},
+}
+
+// Creates (or updates) the operator dashboard showing how the pipeline itself is behaving
+func setupOperatorDashboard() {
+	err := grafanaClient.EnsureFolder(pipelineFolderUID, pipelineFolderTitle)
+	if err != nil {
+		fmt.Println("Error creating Grafana folder:", err)
+	}
+
+	dashboard := grafana.NewDashboard(tenantUID("proj2-pipeline"), "Pipeline Operator Dashboard", pipelineFolderUID, []string{"pipeline"}, operatorPanels)
+	saveDashboardJSON(dashboard)
+	if err := grafanaClient.PushDashboard(dashboard); err != nil {
+		fmt.Println("Failed to create/update operator dashboard:", err)
+		return
+	}
+	fmt.Println("Operator dashboard created/updated successfully")
+}
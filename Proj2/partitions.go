@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Partitioner for the metric, alert, and quality topics, which sends every message of a ZIP code to the same partition
+// Keys start with the ZIP code (Ex: 12601-2024-05-01), so a location's messages stay in order while different locations
+// are spread across the partitions (and the brokers leading them)
+type zipBalancer struct{}
+
+func (zipBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	zip, _, _ := strings.Cut(string(msg.Key), "-")
+
+	hash := fnv.New32a()
+	hash.Write([]byte(zip))
+	return partitions[hash.Sum32()%uint32(len(partitions))]
+}
+
+// Returns the consumer group the readers of a topic join, which splits the topic's partitions between them
+// Every run gets its own group, so it still reads each topic from the start (like the readers did before they were grouped)
+func consumerGroup(topic string) string {
+	return fmt.Sprintf("%s-consumers-%s", tenantTopic(topic), runID)
+}
+
+// How long the end of a run waits for the consumers to read the last messages before they are stopped anyway
+var consumerDrainWait = 30 * time.Second
+
+// Waits until this run's consumer group of every topic has no lag (it committed the end of every partition),
+// so the readers are not cancelled before the last produced messages reach Prometheus
+// Gives up after consumerDrainWait, saying how many messages were left unread
+func waitForConsumers(topics []string) {
+	deadline := time.Now().Add(consumerDrainWait)
+	for {
+		lag, err := consumerLag(topics)
+		if err == nil && lag == 0 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				fmt.Printf("Stopping the Kafka consumers without knowing if they are done: %s\n", err)
+			} else {
+				fmt.Printf("Stopping the Kafka consumers after %s with %d messages still unread.\n", consumerDrainWait, lag)
+			}
+			return
+		}
+
+		// Readers commit their offsets every second, so checking more often wouldn't end the wait sooner
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// Returns how many messages of the topics this run's consumer groups have not committed yet
+func consumerLag(topics []string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeouts.Kafka)*time.Second)
+	defer cancel()
+
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	var lag int64
+	for _, topic := range topics {
+		name := tenantTopic(topic)
+		metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{name}})
+		if err != nil {
+			return 0, err
+		}
+		if len(metadata.Topics) == 0 || metadata.Topics[0].Error != nil {
+			return 0, fmt.Errorf("no metadata for Kafka topic %s", name)
+		}
+
+		partitions := []int{}
+		requests := []kafka.OffsetRequest{}
+		for _, partition := range metadata.Topics[0].Partitions {
+			partitions = append(partitions, partition.ID)
+			requests = append(requests, kafka.FirstOffsetOf(partition.ID), kafka.LastOffsetOf(partition.ID))
+		}
+
+		offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{name: requests}})
+		if err != nil {
+			return 0, err
+		}
+		committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: consumerGroup(topic), Topics: map[string][]int{name: partitions}})
+		if err != nil {
+			return 0, err
+		}
+		if committed.Error != nil {
+			return 0, committed.Error
+		}
+
+		committedOffsets := make(map[int]int64)
+		for _, partition := range committed.Topics[name] {
+			committedOffsets[partition.Partition] = partition.CommittedOffset
+		}
+
+		// A partition the group never committed (-1) has to be read from its first offset
+		for _, partition := range offsets.Topics[name] {
+			if partition.Error != nil {
+				return 0, partition.Error
+			}
+			read := max(committedOffsets[partition.Partition], partition.FirstOffset)
+			lag += max(partition.LastOffset-read, 0)
+		}
+	}
+	return lag, nil
+}
+
+// Deletes this run's consumer group of every topic, so the groups of past runs don't pile up on the broker
+// Registered as a shutdown step, which runs once the readers have left their groups (a group with readers can't be deleted)
+func deleteConsumerGroups(topics []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeouts.Kafka)*time.Second)
+	defer cancel()
+
+	// Each group is deleted on its own, since groups can have different coordinators
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	for _, topic := range topics {
+		group := consumerGroup(topic)
+		resp, err := client.DeleteGroups(ctx, &kafka.DeleteGroupsRequest{GroupIDs: []string{group}})
+		if err == nil {
+			err = resp.Errors[group]
+		}
+
+		// Not check, since this runs while the program is already ending
+		if err != nil {
+			fmt.Printf("Error deleting Kafka consumer group %s: %s\n", group, err)
+		}
+	}
+}
+
+// Adds partitions to a topic that has fewer than it should (Ex: created before kafka.partitions was raised)
+// Kafka can't remove partitions, so a topic with more than it should keeps them (its readers just take more than one each)
+// New partitions change which partition a ZIP code's messages go to, so a location's older messages can be in a different one
+func addKafkaPartitions(topic string, current, wanted int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeouts.Kafka)*time.Second)
+	defer cancel()
+
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	resp, err := client.CreatePartitions(ctx, &kafka.CreatePartitionsRequest{
+		Topics: []kafka.TopicPartitionsConfig{{Name: topic, Count: int32(wanted)}},
+	})
+	if err != nil {
+		return err
+	}
+	if err := resp.Errors[topic]; err != nil {
+		return err
+	}
+
+	fmt.Printf("Kafka topic %s now has %d partitions (it had %d).\n", topic, wanted, current)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Self-metrics for the pipeline itself (shown on the operator dashboard)
+var (
+	apiLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pipeline_api_request_duration_seconds",
+			Help:    "Latency of OpenWeatherMap API calls in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"endpoint"},
+	)
+	kafkaProduced = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pipeline_kafka_messages_produced_total",
+			Help: "Messages written to each Kafka topic",
+		},
+		[]string{"topic"},
+	)
+	kafkaConsumed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pipeline_kafka_messages_consumed_total",
+			Help: "Messages read from each Kafka topic",
+		},
+		[]string{"topic"},
+	)
+	pipelineErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pipeline_errors_total",
+			Help: "Errors in each stage of the pipeline",
+		},
+		[]string{"stage"},
+	)
+	busyWorkers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pipeline_busy_workers",
+			Help: "Workers in each pool that are currently processing a message",
+		},
+		[]string{"pool"},
+	)
+	poolSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pipeline_pool_size",
+			Help: "Total workers in each pool",
+		},
+		[]string{"pool"},
+	)
+	channelDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pipeline_channel_depth",
+			Help: "Messages waiting in each pipeline channel",
+		},
+		[]string{"channel"},
+	)
+)
+
+// Ran before main()
+func init() {
+	safeRegister(apiLatency, "pipeline_api_request_duration_seconds")
+	safeRegister(kafkaProduced, "pipeline_kafka_messages_produced_total")
+	safeRegister(kafkaConsumed, "pipeline_kafka_messages_consumed_total")
+	safeRegister(pipelineErrors, "pipeline_errors_total")
+	safeRegister(busyWorkers, "pipeline_busy_workers")
+	safeRegister(poolSize, "pipeline_pool_size")
+	safeRegister(channelDepth, "pipeline_channel_depth")
+}
+
+// Records how long an API call to the endpoint took
+func observeAPILatency(endpoint string, start time.Time) {
+	apiLatency.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+}
+
+// Records the result of writing a message to a Kafka topic
+func recordProduce(topic string, err error) {
+	if err != nil {
+		pipelineErrors.WithLabelValues("kafka_produce").Inc()
+		return
+	}
+	kafkaProduced.WithLabelValues(topic).Inc()
+}
+
+// Marks a worker in the pool as busy until the returned function is called
+func trackWorker(pool string) func() {
+	busyWorkers.WithLabelValues(pool).Inc()
+	return func() { busyWorkers.WithLabelValues(pool).Dec() }
+}
+
+// Samples the depth of each channel once a second until stop is closed
+func watchChannelDepths(stop <-chan struct{}, depths map[string]func() int) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for name, depth := range depths {
+				channelDepth.WithLabelValues(name).Set(float64(depth()))
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Number of API calls a run is expected to make, by endpoint
+type CallEstimate struct {
+	Requests   int
+	TSDBHits   int
+	Geocode    int
+	Forecast   int
+	AirQuality int
+	UVIndex    int
+}
+
+// Total number of API calls in the estimate
+func (e CallEstimate) Total() int {
+	return e.Geocode + e.Forecast + e.AirQuality + e.UVIndex
+}
+
+// Estimates how many API calls the input file will need, then compares it to the quota (if one is set)
+// If the run would go over the quota, asks whether to continue (or stops the run if there is nobody to ask)
+func preflightCheck(filePath string) {
+	estimate, err := estimateCalls(filePath)
+	check(err)
+
+	fmt.Printf("Pre-flight estimate: %d requests (%d already in the TSDB) need about %d API calls "+
+		"(%d geocoding, %d forecast, %d air quality, %d UV index).\n",
+		estimate.Requests, estimate.TSDBHits, estimate.Total(),
+		estimate.Geocode, estimate.Forecast, estimate.AirQuality, estimate.UVIndex)
+
+	if config.Quota == 0 || estimate.Total() <= config.Quota {
+		return
+	}
+
+	reason := fmt.Sprintf("the run needs about %d API calls, which is over the quota (QUOTA) of %d", estimate.Total(), config.Quota)
+	fmt.Println("WARNING:", reason)
+
+	// Only ask when someone is at the terminal, otherwise stop before any key gets throttled
+	stat, err := os.Stdin.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		exitRun(exitFatal, reason)
+	}
+
+	fmt.Print("Continue anyway? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		exitRun(exitFatal, reason)
+	}
+}
+
+// Reads the input file and counts the API calls its requests will need
+// Requests already in the TSDB need no calls, and every ZIP code shares one forecast call (forecasts are reused within a run)
+func estimateCalls(filePath string) (CallEstimate, error) {
+	var estimate CallEstimate
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return estimate, err
+	}
+	defer file.Close()
+
+	zips := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Invalid lines are skipped (they are reported when the file is read for real)
+		days, lineZips, _, valid := peekLine(scanner.Text())
+		if !valid {
+			continue
+		}
+
+		for _, zip := range lineZips {
+			estimate.Requests++
+
+			if hasMetricInTSDB(PreCoordinateRequest{Days: days, ZIPCode: zip}) {
+				estimate.TSDBHits++
+				continue
+			}
+
+			// The air quality and UV index are fetched for every request
+			if config.AirQuality {
+				estimate.AirQuality++
+			}
+			if config.UVIndex {
+				estimate.UVIndex++
+			}
+
+			// Every ZIP code is geocoded once (geocodes are cached for the run) and shares one forecast call
+			if !zips[zip] {
+				zips[zip] = true
+				estimate.Geocode++
+				estimate.Forecast++
+			}
+		}
+	}
+
+	return estimate, scanner.Err()
+}
+
+// Returns the days, ZIP codes, and group of a line, without printing or reporting anything (the same rules as parseLine)
+func peekLine(text string) (int, []string, string, bool) {
+	parameters := strings.Split(text, "|")
+	if len(parameters) != 2 {
+		return 0, nil, "", false
+	}
+
+	days, err := strconv.Atoi(strings.TrimSpace(parameters[0]))
+	if err != nil || days <= 0 {
+		return 0, nil, "", false
+	}
+
+	zips, group, err := expandZips(strings.TrimSpace(parameters[1]))
+	if err != nil {
+		return 0, nil, "", false
+	}
+	return min(days, 5), zips, group, true
+}
@@ -4,8 +4,9 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"net/http"
+	"maps"
 	"os"
 	"strconv"
 	"strings"
@@ -13,6 +14,8 @@ import (
 	"time"
 
 	"github.com/segmentio/kafka-go"
+
+	"proj2/grafana"
 )
 
 // GeoCoding API (converts ZIP code to longitude and latitude coordinates)
@@ -88,6 +91,94 @@ type APIResponse struct {
 	Message any `json:"message"`
 
 	DaysList []DailyResponse `json:"list"`
+
+	// Location of the forecast, including its offset from UTC in seconds (Ex: -25200 for Pacific Daylight Time)
+	City struct {
+		Timezone int `json:"timezone"`
+	} `json:"city"`
+
+	// Error of a call that failed before the API answered (Ex: a timeout)
+	err error
+}
+
+// Returns the time zone of the forecast's location, so dates are the location's calendar days
+func (r APIResponse) timeZone() *time.Location {
+	return offsetZone(r.City.Timezone)
+}
+
+// Returns the time zone that is offset seconds from UTC (Ex: UTC-07:00)
+func offsetZone(offset int) *time.Location {
+	name := fmt.Sprintf("UTC%+03d:%02d", offset/3600, abs(offset%3600)/60)
+	return time.FixedZone(name, offset)
+}
+
+var (
+	// Offset from UTC (in seconds) of each ZIP code's location, from its forecasts in this run or an earlier one
+	zipOffsetsMu   sync.Mutex
+	zipOffsets     = make(map[string]int)
+	zipOffsetsOnce sync.Once
+)
+
+// Remembers the offset of the ZIP code's location (saved with the run history, so later runs know it before fetching)
+func recordZipOffset(zip string, offset int) {
+	zipOffsetsMu.Lock()
+	defer zipOffsetsMu.Unlock()
+	zipOffsets[zip] = offset
+}
+
+// Returns the time zone of the ZIP code's location, the same one its date labels use
+// A ZIP code that no run has fetched a forecast for yet has no metrics either, so the container's time zone is used
+func zipTimeZone(zip string) *time.Location {
+	zipOffsetsOnce.Do(loadZipOffsets)
+
+	zipOffsetsMu.Lock()
+	offset, known := zipOffsets[zip]
+	zipOffsetsMu.Unlock()
+	if !known {
+		return time.Local
+	}
+	return offsetZone(offset)
+}
+
+// Adds the offsets saved by earlier runs (a newer run's offset wins, and one recorded in this run is kept)
+func loadZipOffsets() {
+	runs, err := loadRunHistory()
+	if err != nil {
+		fmt.Println("Error reading the run history:", err)
+		return
+	}
+
+	saved := make(map[string]int)
+	for _, run := range runs {
+		for zip, offset := range run.Offsets {
+			saved[zip] = offset
+		}
+	}
+
+	zipOffsetsMu.Lock()
+	defer zipOffsetsMu.Unlock()
+	for zip, offset := range saved {
+		if _, known := zipOffsets[zip]; !known {
+			zipOffsets[zip] = offset
+		}
+	}
+}
+
+// Returns the offset of every ZIP code's location that is known so far
+func knownZipOffsets() map[string]int {
+	zipOffsetsOnce.Do(loadZipOffsets)
+
+	zipOffsetsMu.Lock()
+	defer zipOffsetsMu.Unlock()
+	return maps.Clone(zipOffsets)
+}
+
+// Returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
 }
 
 // A structure based off of the user input (BEFORE converting ZIP code to coordinates)
@@ -96,6 +187,12 @@ type PreCoordinateRequest struct {
 	ZIPCode string
 
 	LineNum int
+
+	// ID of a request submitted through the REST API (0 for requests from the input file)
+	ID int
+
+	// State or ZIP code range the request was expanded from (empty for a single ZIP code)
+	Group string
 }
 
 // A structure based off of the user input (AFTER converting ZIP code to coordinates)
@@ -107,18 +204,19 @@ type PostLocationRequest struct {
 	ZIPCode string
 
 	LineNum int
+	ID      int
 }
 
-// End program if there was an error
+// End program if there was an error (the run report is still written)
 func check(e error) {
 	if e != nil {
 		fmt.Println("ERROR", e)
-		os.Exit(1)
+		exitRun(exitFatal, e.Error())
 	}
 }
 
-// Parses each line of the file into a Request
-func parseLine(text string, lineNum int) (PreCoordinateRequest, bool) {
+// Parses each line of the file into its Requests (a state or ZIP code range becomes one request per ZIP code)
+func parseLine(text string, lineNum int) ([]PreCoordinateRequest, bool) {
 
 	// Split each line and make sure input is valid
 	parameters := strings.Split(text, "|")
@@ -126,7 +224,8 @@ func parseLine(text string, lineNum int) (PreCoordinateRequest, bool) {
 	// Requests must be two parameters (days and ZIP code)
 	if len(parameters) != 2 {
 		fmt.Printf("ERROR on Line %d: Only two parameters allowed (days and ZIP code, separated by '|'). Currently has %d parameters. Skipping Request.\n", lineNum, len(parameters))
-		return PreCoordinateRequest{}, false
+		reportSkippedLine(lineNum, fmt.Sprintf("expected 2 parameters, found %d", len(parameters)))
+		return nil, false
 	}
 
 	// The number of days to forecast is the first value (index 0)
@@ -140,7 +239,8 @@ func parseLine(text string, lineNum int) (PreCoordinateRequest, bool) {
 	days, err := strconv.Atoi(daysStr)
 	if err != nil || days <= 0 {
 		fmt.Printf("ERROR on Line %d: The number of days must be a positive number! It is currently '%s'. Skipping Request.\n", lineNum, parameters[0])
-		return PreCoordinateRequest{}, false
+		reportSkippedLine(lineNum, fmt.Sprintf("days must be a positive number, found '%s'", parameters[0]))
+		return nil, false
 	}
 
 	// Days must also be less than or equal to 5 due to API restrictions
@@ -149,13 +249,28 @@ func parseLine(text string, lineNum int) (PreCoordinateRequest, bool) {
 		days = 5
 	}
 
+	// States and ranges become every ZIP code they stand for (using the bundled ZIP database)
+	zips, group, err := expandZips(ZIPcode)
+	if err != nil {
+		fmt.Printf("ERROR on Line %d: %s. Skipping Request.\n", lineNum, err)
+		reportSkippedLine(lineNum, err.Error())
+		return nil, false
+	}
+	if group != "" {
+		fmt.Printf("Line %d: '%s' expands to %d ZIP codes (group %s)\n", lineNum, ZIPcode, len(zips), group)
+	}
+
 	// If request made it here, that means it is valid
-	// Create the pre request and return success
-	return PreCoordinateRequest{Days: days, ZIPCode: ZIPcode, LineNum: lineNum}, true
+	// Create the pre requests and return success
+	requests := make([]PreCoordinateRequest, len(zips))
+	for i, zip := range zips {
+		requests[i] = PreCoordinateRequest{Days: days, ZIPCode: zip, LineNum: lineNum, Group: group}
+	}
+	return requests, true
 }
 
 // Convert the ZIP code to latitude and longitude coordinates using GeoCoding API call
-func convertToCoordinates(req PreCoordinateRequest, key string) (PostLocationRequest, bool) {
+func convertToCoordinates(req PreCoordinateRequest) (PostLocationRequest, bool) {
 
 	// Retrieves values from pre coordinate request
 	days := req.Days
@@ -164,30 +279,37 @@ func convertToCoordinates(req PreCoordinateRequest, key string) (PostLocationReq
 
 	fmt.Println("API Call for Line", lineNum)
 
-	// Make API request to get coordinates (assuming UNITED STATES)
-	url := fmt.Sprintf("http://api.openweathermap.org/geo/1.0/zip?zip=%s,US&appid=%s", zipCode, key)
-
-	// Make a HTTP GET request to this URL, returning an HTTP response
-	resp, err := http.Get(url)
-	check(err)
-
-	// Uses HTTP response body to create a JSON Decoder
-	// Parses the JSON to fill the ZIPResponse structure
+	// Geocode the ZIP code, retrying while the supervisor says to (it aborts the run if the API key is not valid)
 	var response ZIPResponse
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	check(err)
-
-	// Closes once response is decoded
-	resp.Body.Close()
+	for attempt := 1; ; attempt++ {
+		var err error
+		response, err = geocode(zipCode)
+		if err == nil {
+			break
+		}
 
-	// If API key was not valid, end the program
-	if response.Cod == 401 {
-		fmt.Println(response.Message)
-		os.Exit(1)
+		switch superviseError(stageGeocode, lineNum, zipCode, attempt, err) {
+		case DecisionRetry:
+			waitToRetry(attempt)
+			continue
+		case DecisionSkip:
+			setRequestStatus(req.ID, StatusFailed, err.Error())
+		}
+		return PostLocationRequest{}, false
+	}
+	// ZIP codes from a state or range don't all exist (Ex: a prefix's xxx01 ZIP code), so a missing one is only noted
+	if response.Cod == "404" && req.Group != "" {
+		fmt.Printf("Line %d: ZIP code '%s' of group %s does not exist. Skipping it.\n", lineNum, zipCode, req.Group)
+		setRequestStatus(req.ID, StatusNotFound, fmt.Sprintf("cannot find results for ZIP code '%s'", zipCode))
+		return PostLocationRequest{}, false
 	}
+
 	// If GET request had an error finding results (BUT API KEY WAS VALID), skip this request
 	if response.Cod == "404" {
+		pipelineErrors.WithLabelValues("geocode").Inc()
 		fmt.Printf("ERROR on Line %d: Cannot find results for ZIP code '%s'. Skipping this request.\n", lineNum, zipCode)
+		reportNotFound(req)
+		setRequestStatus(req.ID, StatusNotFound, fmt.Sprintf("cannot find results for ZIP code '%s'", zipCode))
 		return PostLocationRequest{}, false
 	}
 
@@ -196,11 +318,68 @@ func convertToCoordinates(req PreCoordinateRequest, key string) (PostLocationReq
 	longitude := response.Longitude
 	name := response.Name
 
-	return PostLocationRequest{Days: days, Lat: latitude, Lon: longitude, Name: name, ZIPCode: zipCode, LineNum: lineNum}, true
+	return PostLocationRequest{Days: days, Lat: latitude, Lon: longitude, Name: name, ZIPCode: zipCode, LineNum: lineNum, ID: req.ID}, true
+}
+
+// Geocoded ZIP codes, so each one is only geocoded once per run (no matter how many lines ask for it)
+var (
+	geocodeCacheMu sync.Mutex
+	geocodeCache   = make(map[string]ZIPResponse)
+)
+
+// Returns the coordinates of the ZIP code, from the cache if it was already geocoded during this run
+// Only answers are cached (including ZIP codes that don't exist), so a failed call is tried again
+func geocode(zipCode string) (ZIPResponse, error) {
+	geocodeCacheMu.Lock()
+	response, cached := geocodeCache[zipCode]
+	geocodeCacheMu.Unlock()
+	if cached {
+		return response, nil
+	}
+
+	response, err := fetchGeocode(zipCode)
+	if err == nil {
+		geocodeCacheMu.Lock()
+		geocodeCache[zipCode] = response
+		geocodeCacheMu.Unlock()
+	}
+	return response, err
+}
+
+// Makes the GeoCoding API call for the ZIP code (assuming UNITED STATES) using the next API key, giving up after the geocode timeout
+// A ZIP code that doesn't exist is not an error (its response has a 404 code)
+func fetchGeocode(zipCode string) (ZIPResponse, error) {
+	ctx, cancel := stageContext(config.Timeouts.Geocode)
+	defer cancel()
+	resp, err := apiKeys.Get(ctx, "geocode", func(key string) string {
+		return fmt.Sprintf("http://api.openweathermap.org/geo/1.0/zip?zip=%s,US&appid=%s", zipCode, key)
+	})
+	if err != nil {
+		return ZIPResponse{}, err
+	}
+
+	// Uses HTTP response body to create a JSON Decoder
+	// Parses the JSON to fill the ZIPResponse structure
+	var response ZIPResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+
+	// Closes once response is decoded
+	resp.Body.Close()
+
+	if err != nil {
+		return ZIPResponse{}, err
+	}
+
+	// Successful responses have no code
+	if response.Cod == nil || response.Cod == "404" {
+		return response, nil
+	}
+	return response, statusError(response.Cod, response.Message)
 }
 
 // Do the API call to get results from the request
-func processRequest(req PostLocationRequest, key string, kWriters *KafkaWriters) {
+// Returns whether the forecast was published (false if the supervisor skipped it, or the run was aborted)
+func processRequest(req PostLocationRequest, kWriters *KafkaWriters) bool {
 
 	// Retrieves values from the post location request
 	days := req.Days
@@ -210,50 +389,75 @@ func processRequest(req PostLocationRequest, key string, kWriters *KafkaWriters)
 	zipCode := req.ZIPCode
 	lineNum := req.LineNum
 
+	// The summary report shows the location's name next to its ZIP code
+	recordLocationName(zipCode, location)
+
 	// Get correct count value, since API returns results for every three hours, we want 24 hours of results (24 / 3 = 8)
 	cnt := days * 8
 
-	// Make API request to get results (using imperial units)
-	url := fmt.Sprintf("https://api.openweathermap.org/data/2.5/forecast?lat=%f&lon=%f&cnt=%d&units=imperial&appid=%s", lat, lon, cnt, key)
+	// How many three hour entries are between each sample, and how many samples are in a day (from the configured resolution)
+	step := config.Resolution / 3
+	samplesPerDay := 24 / config.Resolution
 
-	// Make a HTTP GET request to this URL, returning an HTTP response
-	resp, err := http.Get(url)
-	check(err)
-
-	// Uses HTTP response body to create a JSON Decoder
-	// Parses the JSON to fill the response structure
+	// Get the forecast, retrying while the supervisor says to (duplicate coordinates within this run share a single API call)
 	var results APIResponse
-	err = json.NewDecoder(resp.Body).Decode(&results)
-	check(err)
-
-	// Closes once response is decoded
-	resp.Body.Close()
+	for attempt := 1; ; attempt++ {
+		results = fetchForecast(lat, lon, cnt)
+		if results.Cod == "200" {
+			break
+		}
 
-	// If GET request had an error, print the error message and end program
-	if results.Cod != "200" {
-		fmt.Printf("ERROR with request on Line %d: %s\n", lineNum, results.Message)
-		os.Exit(1)
+		err := results.err
+		if err == nil {
+			err = statusError(results.Cod, results.Message)
+		}
+		switch superviseError(stageForecast, lineNum, zipCode, attempt, err) {
+		case DecisionRetry:
+			waitToRetry(attempt)
+			continue
+		case DecisionSkip:
+			setRequestStatus(req.ID, StatusFailed, err.Error())
+		}
+		return false
 	}
 
+	// Get the air quality and UV index (only if they are turned on)
+	extras := fetchExtraReadings(lat, lon, days)
+
 	// Uses a string Builder to make sure all input prints out together at once
 	// This avoids concurrency issues
 	var sb strings.Builder
 
-	fmt.Fprintf(&sb, "\n")
+	// Dates are labeled in the location's own time zone (not the container's), so a sample lands on the location's calendar day
+	zone := results.timeZone()
+	recordZipOffset(zipCode, results.City.Timezone)
+
+	fmt.Fprintf(&sb, "\n--- FORECAST FOR %s (ZIP %s, %d days, %s) FROM LINE %d ---\n", location, zipCode, days, zone, lineNum)
 
-	// Get results for given amount of days (multiplied by 8 since API does three hour increments, and we want 24 hour increments)
-	for i := 0; i < days && i*8 < len(results.DaysList); i++ {
-		// Running every 8th entry
-		r := results.DaysList[i*8]
-		curTime := time.Unix(int64(r.Time), 0)
+	// Get results for given amount of days (every "step" entries, since API does three hour increments)
+	for i := 0; i < days*samplesPerDay && i*step < len(results.DaysList); i++ {
+		// Running every "step" entry
+		r := results.DaysList[i*step]
+		curTime := time.Unix(int64(r.Time), 0).In(zone)
 		date := curTime.Format("2006-01-02")
 
+		// Samples more often than once a day also need the hour in their date
+		if samplesPerDay > 1 {
+			date = curTime.Format("2006-01-02T15")
+		}
+
+		// Low, high, and average of every three hour entry until the next sample (the whole day at 24 hour resolution)
+		low, high, average := temperatureRange(results.DaysList[i*step : min((i+1)*step, len(results.DaysList))])
+
 		// Create metric-specific payloads to add to Kafka Writers
 		tempPayload := TemperaturePayload{
 			Location:  location,
 			Date:      date,
 			Temp:      float64(r.Main.Temp),
 			FeelsLike: float64(r.Main.FeelsLike),
+			MinTemp:   low,
+			MaxTemp:   high,
+			AvgTemp:   average,
 		}
 
 		humidityPayload := HumidityPayload{
@@ -275,90 +479,312 @@ func processRequest(req PostLocationRequest, key string, kWriters *KafkaWriters)
 			CloudPercent: float64(r.Clouds.All),
 		}
 
+		// Most severe weather condition until the next sample (Ex: a thunderstorm in any of the day's three hour entries)
+		condition := worstCondition(results.DaysList[i*step : min((i+1)*step, len(results.DaysList))])
+		conditionPayload := ConditionPayload{
+			Location:    location,
+			Date:        date,
+			ConditionID: float64(condition.ID),
+			Severity:    float64(conditionSeverity(condition.ID)),
+		}
+
 		// Key for each payload is the ZIP code and the date (zipcode-date)
 		key := fmt.Sprintf("%s-%s", zipCode, date)
 
-		// Publish payloads to their specific Kafka writer topics
-		tempBytes, _ := json.Marshal(tempPayload)
-		kWriters.TempWriter.WriteMessages(context.Background(), kafka.Message{Key: []byte(key), Value: tempBytes})
+		// Publish payloads to their specific Kafka writer topics (only if every value passes the quality gate)
+		qWriter := kWriters.QualityWriter
+		if passesQualityGate(qWriter, zipCode, location, date, "temperature",
+			qualityCheck{"Temp", tempPayload.Temp}, qualityCheck{"FeelsLike", tempPayload.FeelsLike},
+			qualityCheck{"MinTemp", tempPayload.MinTemp}, qualityCheck{"MaxTemp", tempPayload.MaxTemp}, qualityCheck{"AvgTemp", tempPayload.AvgTemp}) {
+			tempBytes, _ := json.Marshal(tempPayload)
+			publish(kWriters.TempWriter, "temperature", lineNum, zipCode, kafka.Message{Key: []byte(key), Value: tempBytes})
+		}
 
-		humidityBytes, _ := json.Marshal(humidityPayload)
-		kWriters.HumidityWriter.WriteMessages(context.Background(), kafka.Message{Key: []byte(key), Value: humidityBytes})
+		if passesQualityGate(qWriter, zipCode, location, date, "humidity", qualityCheck{"Humidity", humidityPayload.Humidity}) {
+			humidityBytes, _ := json.Marshal(humidityPayload)
+			publish(kWriters.HumidityWriter, "humidity", lineNum, zipCode, kafka.Message{Key: []byte(key), Value: humidityBytes})
+		}
 
-		windBytes, _ := json.Marshal(windPayload)
-		kWriters.WindWriter.WriteMessages(context.Background(), kafka.Message{Key: []byte(key), Value: windBytes})
+		if passesQualityGate(qWriter, zipCode, location, date, "wind",
+			qualityCheck{"Speed", windPayload.Speed}, qualityCheck{"Degree", windPayload.Degree}) {
+			windBytes, _ := json.Marshal(windPayload)
+			publish(kWriters.WindWriter, "wind", lineNum, zipCode, kafka.Message{Key: []byte(key), Value: windBytes})
+		}
 
-		cloudBytes, _ := json.Marshal(cloudPayload)
-		kWriters.CloudWriter.WriteMessages(context.Background(), kafka.Message{Key: []byte(key), Value: cloudBytes})
+		if passesQualityGate(qWriter, zipCode, location, date, "cloud", qualityCheck{"CloudPercent", cloudPayload.CloudPercent}) {
+			cloudBytes, _ := json.Marshal(cloudPayload)
+			publish(kWriters.CloudWriter, "cloud", lineNum, zipCode, kafka.Message{Key: []byte(key), Value: cloudBytes})
+		}
+
+		// Samples without a condition (an ID of 0) are not published, since that is not a real condition
+		if condition.ID != 0 && passesQualityGate(qWriter, zipCode, location, date, conditionsTopic,
+			qualityCheck{"ConditionID", conditionPayload.ConditionID}, qualityCheck{"Severity", conditionPayload.Severity}) {
+			conditionBytes, _ := json.Marshal(conditionPayload)
+			publish(kWriters.ConditionWriter, conditionsTopic, lineNum, zipCode, kafka.Message{Key: []byte(key), Value: conditionBytes})
+		}
+
+		// Remember the forecast, so it can be compared to the observed weather once the date has passed (if verification is on)
+		recordForecast(zipCode, lat, lon, results.City.Timezone, date, VerifiedValues{
+			Temperature: tempPayload.Temp,
+			Humidity:    humidityPayload.Humidity,
+			WindSpeed:   windPayload.Speed,
+			Cloud:       cloudPayload.CloudPercent,
+		})
+
+		// Summary of this sample for the console
+		fmt.Fprintf(&sb, "%s: %.1f%s (feels like %.1f%s, low %.1f%s, high %.1f%s), humidity %.0f%%, wind %.1f %s, clouds %.0f%%",
+			date, tempPayload.Temp, tempUnit(), tempPayload.FeelsLike, tempUnit(), tempPayload.MinTemp, tempUnit(), tempPayload.MaxTemp, tempUnit(), humidityPayload.Humidity,
+			windPayload.Speed, speedUnit(), cloudPayload.CloudPercent)
+		if condition.Desc != "" {
+			fmt.Fprintf(&sb, ", %s", condition.Desc)
+		}
+
+		// Publish the optional air quality and UV index readings for this sample (if they were found)
+		if airQualityPayload, found := extras.airQualityAt(curTime); found && passesQualityGate(qWriter, zipCode, location, date, airQualityTopic,
+			qualityCheck{"AQI", airQualityPayload.AQI}, qualityCheck{"PM25", airQualityPayload.PM25}) {
+			airQualityPayload.Location = location
+			airQualityPayload.Date = date
+
+			airQualityBytes, _ := json.Marshal(airQualityPayload)
+			publish(kWriters.AirQualityWriter, airQualityTopic, lineNum, zipCode, kafka.Message{Key: []byte(key), Value: airQualityBytes})
+
+			fmt.Fprintf(&sb, ", AQI %.0f (PM2.5 %.1f μg/m³)", airQualityPayload.AQI, airQualityPayload.PM25)
+		}
+		if uvPayload, found := extras.uvIndexAt(curTime); found && passesQualityGate(qWriter, zipCode, location, date, uvIndexTopic, qualityCheck{"UVI", uvPayload.UVI}) {
+			uvPayload.Location = location
+			uvPayload.Date = date
+
+			uvBytes, _ := json.Marshal(uvPayload)
+			publish(kWriters.UVIndexWriter, uvIndexTopic, lineNum, zipCode, kafka.Message{Key: []byte(key), Value: uvBytes})
+
+			fmt.Fprintf(&sb, ", UV %.1f", uvPayload.UVI)
+		}
+		fmt.Fprintln(&sb)
+	}
+
+	// Print the summary all at once (unless QUIET is on)
+	if !config.Quiet {
+		fmt.Print(sb.String())
 	}
+	return true
+}
+
+// Returns the lowest, highest, and average temperature of the three hour entries
+func temperatureRange(entries []DailyResponse) (float64, float64, float64) {
+	low, high, sum := float64(entries[0].Main.MinTemp), float64(entries[0].Main.MaxTemp), 0.0
+	for _, entry := range entries {
+		low = min(low, float64(entry.Main.MinTemp))
+		high = max(high, float64(entry.Main.MaxTemp))
+		sum += float64(entry.Main.Temp)
+	}
+	return low, high, sum / float64(len(entries))
+}
+
+// Returns the temperature unit for the configured units
+func tempUnit() string {
+	switch config.Units {
+	case "metric":
+		return "°C"
+	case "standard":
+		return "K"
+	}
+	return "°F"
+}
+
+// Returns the wind speed unit for the configured units
+func speedUnit() string {
+	if config.Units == "imperial" {
+		return "mph"
+	}
+	return "m/s"
+}
+
+// Reads every line of the input file concurrently, sending each valid request into the pipeline
+func readInputFile(filePath string) {
+	// Make sure file path for user input is correct
+	file, err := os.Open(filePath)
+	check(err)
+
+	// Close the file once it has been read
+	defer file.Close()
+
+	// A waitgroup used to wait for all the goroutines launched to finish when reading the lines from the file
+	var fileWG sync.WaitGroup
+
+	// Create scanner to read file
+	scanner := bufio.NewScanner(file)
+
+	// Store line number of request
+	lineNumber := 0
+
+	// Reads file line by line concurrently (using goroutines and waitgroups)
+	for scanner.Scan() {
+		// Get text on current line
+		text := scanner.Text()
+
+		// Make a copy of the line number after its incrementation for better error messages
+		lineNumber++
+		currentLine := lineNumber
+
+		// Each of these goroutines work concurrently
+		fileWG.Go(func() {
+
+			// Validate the current request
+			requests, _ := parseLine(text, currentLine)
+			reportLine(len(requests))
+
+			// If it is valid, send each of its requests to precoordinate channel for further processing
+			for _, req := range requests {
+				if req.Group != "" {
+					recordZipGroup(req.ZIPCode, req.Group)
+				}
+				submitRequest(req)
+			}
+		})
+	}
+
+	// Checks if there was an error reading the file
+	check(scanner.Err())
+
+	// SOME BUFFER TIME FOR EVERYTHING TO PROCESS CORRECTLY
+	// Really wanted to avoid doing this, but it seemed that there was no other option
+	time.Sleep(100 * time.Millisecond)
+
+	// Waits for all lines to be read
+	fileWG.Wait()
 }
 
 // MAIN ENTRY INTO THE PROGRAM
+// The first argument picks the command (run when there is none), Ex: proj2 validate --file inputY.txt
 func main() {
-	// Keep track of how long it takes to run this program
-	start := time.Now()
+	name, args := "run", []string{}
+	if len(os.Args) > 1 {
+		name, args = os.Args[1], os.Args[2:]
+	}
+	cmd, found := findCommand(name)
+	if !found {
+		if name != "help" && name != "-h" && name != "--help" {
+			fmt.Printf("Unknown command '%s'\n\n", name)
+		}
+		printUsage()
+		os.Exit(exitFatal)
+	}
 
-	// Gets API key from environmental variable
-	key := os.Getenv("API_KEY")
+	// Loads the config file (config.yaml), with environment variables overriding it
+	// All invalid fields are listed at once
+	var err error
+	config, err = loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println("Fix config.yaml (or the environment variables in docker-compose.yml) to run the program. \n" +
+			"docker-compose run --rm proj2")
+		exitRun(exitFatal, err.Error())
+	}
 
-	// Gets file path from environmental variable
-	filePath := os.Getenv("FILE")
+	// Gets the API keys from the config
+	// Requests are spread across every key, so a single free key does not get throttled
+	apiKeys = NewKeyPool(append([]string{config.APIKey}, config.APIKeys...))
+
+	// Apply the rest of the config
+	brokers = config.Kafka.Brokers
+	grafanaClient = grafana.NewClient(config.Grafana.URL, config.Grafana.User, config.Grafana.Password)
+	setThresholds(config)
+	applyTenant()
+	loadVerification()
+
+	// Write the Prometheus and Grafana config into the shared volume (their containers wait for it)
+	if err := writeBootstrap(); err != nil {
+		fmt.Println("Error writing bootstrap files:", err)
+		exitRun(exitFatal, err.Error())
+	}
 
-	// Gets the number of workers working in the worker pool from environmental variable
-	workers := os.Getenv("WORKERS")
+	// Alert notifications are delivered in the background, so wait for them before exiting
+	onShutdown(waitForNotifications)
 
-	// Makes sure user supplied their API Key
-	if key == "" {
-		fmt.Println("Please supply API Key to the docker-compose.yml file to run the program. \n" +
-			"docker-compose run --rm proj2")
-		return
+	// Open the TSDB that persists metrics between runs (validate never touches it)
+	// Everything that has to be flushed is closed by the shutdown steps, which also run when a fatal error ends the program
+	if cmd.NeedsStore {
+		metricStore, err = openMetricStore(config.Storage.Backend, config.Storage.Path)
+		check(err)
+		onShutdown(func() { metricStore.Close() })
 	}
+	defer runShutdown()
+
+	exitCode := cmd.Run(args)
+	runShutdown()
+	os.Exit(exitCode)
+}
 
-	// Remove quotes from (if it exists)
-	key = strings.Trim(key, "'\"")
-	filePath = strings.Trim(filePath, "'\"")
-	workers = strings.Trim(workers, "'\"")
+// Runs the whole pipeline (the run command): reads the input file, fetches every forecast, publishes it to Kafka,
+// sets the Prometheus gauges, and pushes the dashboards, then waits for ENTER
+//
+//	proj2 run                    uses the input file from the config (FILE)
+//	proj2 run --file inputY.txt  reads a different input file
+//
+// Returns the exit code of the run
+func runPipeline(args []string) int {
+	// Keep track of how long it takes to run this program
+	start := time.Now()
 
-	// Default number of worker if input wasn't valid
-	DEFAULT_NUM_WORKERS := 10
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	filePath := flags.String("file", config.File, "input file with one \"days|ZIP code\" request per line")
+	if err := flags.Parse(args); err != nil {
+		return exitFatal
+	}
+	numWorkers := config.Workers
 
-	// Makes sure number of workers input is valid
-	numWorkers, err := strconv.Atoi(workers)
-	if err != nil || numWorkers <= 0 {
-		fmt.Printf("Number of workers needs to be an integer! It is currently %s. Defaulting to %d Workers.\n", workers, DEFAULT_NUM_WORKERS)
-		numWorkers = DEFAULT_NUM_WORKERS
+	// Estimate the API calls the input file needs before anything is called (stopping if it is over the quota)
+	if *filePath != "" {
+		preflightCheck(*filePath)
 	}
 
-	// Creates HTTP server for Prometheus
+	// Creates HTTP server for Prometheus (and the REST API when serving)
+	if config.Serve {
+		registerRequestAPI()
+	}
 	go startMetrics()
 
 	// Initialize Kafka Writers (that will be closed at the end of this program)
 	kafkaWriters := initKafkaWriters()
-	defer kafkaWriters.closeKafkaWriters()
+	onShutdown(kafkaWriters.closeKafkaWriters)
 
 	// Launch consumers for all topics
-	topics := []string{"temperature", "humidity", "wind", "cloud"}
+	topics := append([]string{"temperature", "humidity", "wind", "cloud", conditionsTopic}, extraTopics()...)
 
-	// Make sure the topic exists and load cache for that topic
+	// Make sure the topic exists (with enough partitions) and load cache for that topic
 	for _, topic := range topics {
-		ensureKafkaTopic(topic)
+		ensureKafkaTopic(tenantTopic(topic), config.Kafka.Partitions)
 	}
 
+	// Alerts and quality issues have their own topics (which are not consumed by this program)
+	ensureKafkaTopic(tenantTopic(alertsTopic), config.Kafka.Partitions)
+	ensureKafkaTopic(tenantTopic(qualityTopic), config.Kafka.Partitions)
+
 	// Setup Grafana dashboard after Prometheus and Kafka are ready
 	// Wait for Grafana to start (max 60 seconds)
-	err = waitForGrafana(60 * time.Second)
+	err := waitForGrafana(60 * time.Second)
 	check(err)
 
-	// Cancellable context for the consumer (Prometheus)
-	ctx, cancel := context.WithCancel(context.Background())
+	// When serving, dashboards are pushed as requests finish, so the data source and folders are needed now
+	if config.Serve {
+		setupGrafana()
+	}
+
+	// Cancellable context for the consumer (Prometheus), which also ends if a fatal error cancels the run
+	ctx, cancel := context.WithCancel(runCtx)
+
+	// Buffered by the number of workers like the other channels, so its depth shows how far behind the metrics pool is
+	metricsChan = make(chan WeatherMessage, numWorkers)
 
 	// Goroutine that consumes Kafka data and writes it into the metric channel
+	// Each topic gets one reader per partition, which share the partitions as a consumer group
 	var kafkaWG sync.WaitGroup
-	for range numWorkers {
+	for range config.Kafka.Partitions {
 		for _, topic := range topics {
 			kafkaWG.Go(func() { consumeKafkaTopic(ctx, topic) })
 		}
 	}
+	onShutdown(func() { deleteConsumerGroups(topics) })
 
 	// Goroutine that collects data from metric channel and writes it into Prometheus
 	var promWG sync.WaitGroup
@@ -366,16 +792,32 @@ func main() {
 		promWG.Go(func() {
 			// Will wait until data gets put into the requests channel
 			for msg := range metricsChan {
-				updateMetrics(msg)
+				done := trackWorker("metrics")
+				updateMetrics(msg, kafkaWriters.AlertWriter)
+				done()
 			}
 		})
 	}
 
 	// Create a channel that stores requests BEFORE doing the GeoCoding API call
-	preCoordinateChan := make(chan PreCoordinateRequest)
+	// Channels are buffered by the number of workers so their depth shows how far behind each pool is
+	preCoordinateChan := make(chan PreCoordinateRequest, numWorkers)
+	openIntake(preCoordinateChan)
 
 	// Create channel of requests doing the actual API call after ZIP code was converted to coordinates
-	requestsChan := make(chan PostLocationRequest)
+	requestsChan := make(chan PostLocationRequest, numWorkers)
+
+	// Report the size of each worker pool and sample channel depths for the operator dashboard
+	for _, pool := range []string{"geocode", "forecast", "metrics"} {
+		poolSize.WithLabelValues(pool).Set(float64(numWorkers))
+	}
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	go watchChannelDepths(stopWatching, map[string]func() int{
+		"pre_coordinate": func() int { return len(preCoordinateChan) },
+		"requests":       func() int { return len(requestsChan) },
+		"metrics":        func() int { return len(metricsChan) },
+	})
 
 	// Waitgroup that waits for all ZIP codes to be processed before program ends
 	var zipCodeWG sync.WaitGroup
@@ -386,18 +828,36 @@ func main() {
 		zipCodeWG.Go(func() {
 			// Will wait until data gets put into the requests channel
 			for req := range preCoordinateChan {
+				// After a fatal error, the rest of the requests are drained without being processed
+				if runFailed() {
+					setRequestStatus(req.ID, StatusFailed, context.Cause(runCtx).Error())
+					continue
+				}
+				done := trackWorker("geocode")
 
 				// Will check if this request already has results
 				exists := isInTSDB(req)
+				if exists {
+					reportExpected(req, true)
+					setRequestStatus(req.ID, StatusDone, "results were already in the TSDB")
+				}
 
 				// If not in Prometheus TSDB, must create a new request and call API
 				if !exists {
 					// Convert ZIP code to coordinates, then add to request channel
-					newRequest, success := convertToCoordinates(req, key)
+					setRequestStatus(req.ID, StatusGeocoding, "")
+					newRequest, success := convertToCoordinates(req)
+					if !success && runFailed() {
+						setRequestStatus(req.ID, StatusFailed, context.Cause(runCtx).Error())
+					}
 					if success {
+						reportExpected(req, false)
+						setRequestStatus(req.ID, StatusFetching, "")
 						requestsChan <- newRequest
 					}
 				}
+
+				done()
 			}
 		})
 	}
@@ -411,61 +871,62 @@ func main() {
 		resultsWG.Go(func() {
 			// Will wait until data gets put into the requests channel
 			for req := range requestsChan {
-				processRequest(req, key, kafkaWriters)
-			}
-		})
-	}
-
-	// Make sure file path for user input is correct
-	file, err := os.Open(filePath)
-	check(err)
-
-	// Close the file once the program is complete
-	defer file.Close()
-
-	// A waitgroup used to wait for all the goroutines launched to finish when reading the lines from the file
-	var fileWG sync.WaitGroup
-
-	// Create scanner to read file
-	scanner := bufio.NewScanner(file)
-
-	// Store line number of request
-	lineNumber := 0
-
-	// Reads file line by line concurrently (using goroutines and waitgroups)
-	for scanner.Scan() {
-		// Get text on current line
-		text := scanner.Text()
-
-		// Make a copy of the line number after its incrementation for better error messages
-		lineNumber++
-		currentLine := lineNumber
-
-		// Each of these goroutines work concurrently
-		fileWG.Go(func() {
+				if runFailed() {
+					setRequestStatus(req.ID, StatusFailed, context.Cause(runCtx).Error())
+					continue
+				}
+				done := trackWorker("forecast")
+				published := processRequest(req, kafkaWriters)
+				done()
+				if runFailed() {
+					setRequestStatus(req.ID, StatusFailed, context.Cause(runCtx).Error())
+					continue
+				}
 
-			// Validate the current request
-			req, success := parseLine(text, currentLine)
+				// The supervisor skipped the request (its status already says why)
+				if !published {
+					continue
+				}
 
-			// If it is valid, send to precoordinate channel for further processing
-			if success {
-				preCoordinateChan <- req
+				// Requests from the REST API get their dashboard right away, since the service keeps running
+				if req.ID != 0 {
+					pushZipDashboard(req.ZIPCode)
+					setRequestStatus(req.ID, StatusDone, fmt.Sprintf("published to Kafka, dashboard at /d/%s", zipDashboardUID(req.ZIPCode)))
+				}
 			}
 		})
 	}
 
-	// Checks if there was an error reading the file
-	check(scanner.Err())
-
-	// SOME BUFFER TIME FOR EVERYTHING TO PROCESS CORRECTLY
-	// Really wanted to avoid doing this, but it seemed that there was no other option
-	time.Sleep(100 * time.Millisecond)
+	// Read the requests in the input file (optional when serving the REST API)
+	if *filePath != "" {
+		readInputFile(*filePath)
+	}
 
-	// Waits for all lines to be read
-	fileWG.Wait()
+	// Keep accepting requests through the REST API until ENTER is pressed
+	if config.Serve {
+		fmt.Printf("\nAccepting forecast requests at POST http://localhost:8080/requests (status at GET /requests/{id}).\n" +
+			"Press 'ENTER' to stop accepting requests and shut down.\n")
+
+		// Send the summary report every summary.interval_minutes while serving
+		stopSummaries := make(chan struct{})
+		go scheduleSummaryReports(stopSummaries)
+
+		// A fatal error also stops the service
+		pressed := make(chan struct{})
+		go func() {
+			bufio.NewReader(os.Stdin).ReadBytes('\n')
+			close(pressed)
+		}()
+		select {
+		case <-pressed:
+		case <-runCtx.Done():
+			fmt.Println("Shutting down, the run failed:", context.Cause(runCtx))
+		}
+		close(stopSummaries)
+	}
 
-	// If there were no errors, close the precoordinate channel
-	close(preCoordinateChan)
+	// Stop accepting requests, then close the precoordinate channel
+	closeIntake()
 
 	// Waits for all pre-coordinate requests to be converted to coordinates
 	zipCodeWG.Wait()
@@ -476,6 +937,11 @@ func main() {
 	// Waits for all API calls to be completed
 	resultsWG.Wait()
 
+	// Let the consumers read the last messages that were produced (unless the run already failed)
+	if !runFailed() {
+		waitForConsumers(topics)
+	}
+
 	// Tells prometheus to stop processing messages and kafka to stop reading them
 	cancel()
 
@@ -486,9 +952,38 @@ func main() {
 	close(metricsChan)
 	promWG.Wait()
 
+	// A fatal error cancelled the run, so now that every stage has stopped, end with the error (the report is still written)
+	if runFailed() {
+		exitRun(exitFatal, context.Cause(runCtx).Error())
+	}
+
+	// Make sure every request that was not skipped ended up with metrics
+	reconcile()
+
+	// Remember which ZIP codes this run asked for, then remove the ones no recent run asked for (if janitor.runs is set)
+	recordRunHistory(getRequestedZips())
+	if config.Janitor.Runs > 0 {
+		cleanupStaleZips(config.Janitor.Runs, false)
+	}
+
+	// Compare past forecasts to the observed weather (if verification is on)
+	verifyForecasts()
+
 	// Once ready, push dashboards
 	setupGrafana()
 
+	// Export dashboards and metrics for offline sharing (if enabled)
+	if config.Export.Enabled {
+		exportRun()
+	}
+
+	// Send the forecast highlights and alerts of every location by email or Slack (if either is set up)
+	sendSummaryReport()
+
+	// Always write the run report (STRICT mode turns skipped lines, unknown ZIP codes, and mismatches into failures)
+	exitCode, exitReason := finishedExitCode()
+	writeReport(exitCode, exitReason)
+
 	fmt.Println("\nPrometheus metrics available at http://localhost:8080/metrics")
 	fmt.Println("Set up Grafana dashboards at http://localhost:3000 (user: admin, pass: admin). Metrics may take ~10 seconds to show.")
 
@@ -497,4 +992,9 @@ func main() {
 
 	// Wait for user to press Enter to stop the server
 	bufio.NewReader(os.Stdin).ReadBytes('\n')
+
+	if exitCode != exitOK {
+		fmt.Println("Run failed:", exitReason)
+	}
+	return exitCode
 }
@@ -1,30 +1,27 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
-	"sync"
 	"time"
 
+	"proj2/grafana"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/segmentio/kafka-go"
 )
 
 // Define Prometheus metrics
 var (
-	// line-delimited JSON (used as TSDB)
-	metricsFilePath  = "/data/metrics.jsonl"
-	metricsFileMutex sync.Mutex
-
 	// Alerts
 	tempLow, tempHigh         float64
 	humidityLow, humidityHigh float64
 	windHigh                  float64
+	aqiHigh, uvHigh           float64
 
 	// Help description
 	tempHelp       = "Temperature in Fahrenheit"
@@ -32,6 +29,32 @@ var (
 	windSpeedHelp  = "Wind Speed in MPH"
 	windDegreeHelp = "Wind Direction in Degrees"
 	cloudHelp      = "Cloud cover percentage"
+	aqiHelp        = "Air Quality Index (1 = Good, 5 = Very Poor)"
+	pm25Help       = "PM2.5 concentration in μg/m³"
+	uviHelp        = "UV Index"
+
+	// Labels of every weather and alert gauge
+	// The date is readable, and the epoch (start of the date as a Unix timestamp) sorts chronologically in Grafana
+	dateLabels = []string{"location", "date", "epoch"}
+
+	// Start of each date as a Unix timestamp (Ex: for queries that only want the dates that haven't passed)
+	dateTimestampGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: grafana.DateTimestampGauge,
+			Help: "Start of the forecast date as a Unix timestamp",
+		},
+		dateLabels,
+	)
+
+	// Always 1, labeled with the state or ZIP code range each location was requested as part of (for the group dashboards)
+	// Kept apart from the weather gauges, so a location's series don't change when its group does
+	locationGroupGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: grafana.LocationGroupGauge,
+			Help: "1 for the group each location was requested as part of",
+		},
+		[]string{"location", "group"},
+	)
 
 	// PROMETHEUS GAUGES FOR EACH TOPIC
 	tempGauge = prometheus.NewGaugeVec(
@@ -39,42 +62,87 @@ var (
 			Name: "temperature",
 			Help: tempHelp,
 		},
-		[]string{"location", "date"},
+		dateLabels,
 	)
 	feelsLikeGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "feelslike",
 			Help: tempHelp,
 		},
-		[]string{"location", "date"},
+		dateLabels,
+	)
+
+	// Low, high, and average temperature of each date (of every three hour entry until the next sample)
+	tempMinGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "temperature_min",
+			Help: tempHelp,
+		},
+		dateLabels,
+	)
+	tempMaxGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "temperature_max",
+			Help: tempHelp,
+		},
+		dateLabels,
 	)
+	tempAvgGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "temperature_avg",
+			Help: tempHelp,
+		},
+		dateLabels,
+	)
+
 	humidityGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "humidity",
 			Help: humidityHelp,
 		},
-		[]string{"location", "date"},
+		dateLabels,
 	)
 	windSpeedGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "wind_speed",
 			Help: windSpeedHelp,
 		},
-		[]string{"location", "date"},
+		dateLabels,
 	)
 	windDegreeGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "wind_degree",
 			Help: windDegreeHelp,
 		},
-		[]string{"location", "date"},
+		dateLabels,
 	)
 	cloudGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "cloud_percent",
 			Help: cloudHelp,
 		},
-		[]string{"location", "date"},
+		dateLabels,
+	)
+	aqiGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aqi",
+			Help: aqiHelp,
+		},
+		dateLabels,
+	)
+	pm25Gauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pm2_5",
+			Help: pm25Help,
+		},
+		dateLabels,
+	)
+	uviGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "uvi",
+			Help: uviHelp,
+		},
+		dateLabels,
 	)
 
 	// ALERTS
@@ -83,38 +151,72 @@ var (
 			Name: "alert_temperature_high",
 			Help: "1 if temperature is above TEMP_HIGH, else 0",
 		},
-		[]string{"location", "date"},
+		dateLabels,
 	)
 	alertTempLow = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "alert_temperature_low",
 			Help: "1 if temperature is below TEMP_LOW, else 0",
 		},
-		[]string{"location", "date"},
+		dateLabels,
 	)
 	alertHumidityHigh = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "alert_humidity_high",
 			Help: "1 if humidity is above HUMIDITY_HIGH, else 0",
 		},
-		[]string{"location", "date"},
+		dateLabels,
 	)
 	alertHumidityLow = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "alert_humidity_low",
 			Help: "1 if humidity is below HUMIDITY_LOW, else 0",
 		},
-		[]string{"location", "date"},
+		dateLabels,
 	)
 	alertWindHigh = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "alert_wind_high",
 			Help: "1 if wind speed is above WIND_SPEED_HIGH, else 0",
 		},
-		[]string{"location", "date"},
+		dateLabels,
+	)
+	alertAQIHigh = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_aqi_high",
+			Help: "1 if the air quality index is at or above AQI_HIGH, else 0",
+		},
+		dateLabels,
+	)
+	alertUVHigh = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "alert_uv_high",
+			Help: "1 if the UV index is at or above UV_HIGH, else 0",
+		},
+		dateLabels,
 	)
 )
 
+// Every gauge labeled by location and date (used to remove a location's label sets)
+var dateGauges = []*prometheus.GaugeVec{
+	tempGauge, tempMinGauge, tempMaxGauge, tempAvgGauge, feelsLikeGauge, humidityGauge, windSpeedGauge, windDegreeGauge, cloudGauge, aqiGauge, pm25Gauge, uviGauge, dateTimestampGauge,
+	conditionGauge, severityGauge,
+	alertTempHigh, alertTempLow, alertHumidityHigh, alertHumidityLow, alertWindHigh, alertAQIHigh, alertUVHigh,
+	alertThunderstorm, alertHeavySnow, alertFog,
+}
+
+// Removes every label set of every date gauge that matches the labels (Ex: {"location": "12601"}), returning how many were removed
+func deleteGauges(labels prometheus.Labels) int {
+	deleted := 0
+	for _, gauge := range dateGauges {
+		deleted += gauge.DeletePartialMatch(labels)
+	}
+
+	// The location's group has no date label, so it is only removed along with the whole location
+	deleted += locationGroupGauge.DeletePartialMatch(labels)
+	return deleted
+}
+
 // Stores all registered metrics for this program
 var registeredMetrics = make(map[string]struct{})
 
@@ -131,45 +233,42 @@ func init() {
 	// Register metrics with the default registry safely
 	safeRegister(tempGauge, "temperature")
 	safeRegister(feelsLikeGauge, "feelslike")
+	safeRegister(tempMinGauge, "temperature_min")
+	safeRegister(tempMaxGauge, "temperature_max")
+	safeRegister(tempAvgGauge, "temperature_avg")
 	safeRegister(humidityGauge, "humidity")
 	safeRegister(windSpeedGauge, "wind_speed")
 	safeRegister(windDegreeGauge, "wind_degree")
 	safeRegister(cloudGauge, "cloud_percent")
+	safeRegister(aqiGauge, "aqi")
+	safeRegister(pm25Gauge, "pm2_5")
+	safeRegister(uviGauge, "uvi")
+	safeRegister(dateTimestampGauge, grafana.DateTimestampGauge)
+	safeRegister(locationGroupGauge, grafana.LocationGroupGauge)
 
 	safeRegister(alertTempHigh, "alert_temperature_high")
 	safeRegister(alertTempLow, "alert_temperature_low")
 	safeRegister(alertHumidityHigh, "alert_humidity_high")
 	safeRegister(alertHumidityLow, "alert_humidity_low")
 	safeRegister(alertWindHigh, "alert_wind_high")
+	safeRegister(alertAQIHigh, "alert_aqi_high")
+	safeRegister(alertUVHigh, "alert_uv_high")
+}
 
-	// Make sure alert values set up in docker-compose.yml are valid
-	// If they are not valid, use default values
-	var err error
-	tempLow, err = strconv.ParseFloat(os.Getenv("TEMP_LOW"), 64)
-	if err != nil {
-		tempLow = 32
-	}
-	tempHigh, err = strconv.ParseFloat(os.Getenv("TEMP_HIGH"), 64)
-	if err != nil {
-		tempHigh = 90
-	}
-	humidityLow, err = strconv.ParseFloat(os.Getenv("HUMIDITY_LOW"), 64)
-	if err != nil {
-		humidityLow = 30
-	}
-	humidityHigh, err = strconv.ParseFloat(os.Getenv("HUMIDITY_HIGH"), 64)
-	if err != nil {
-		humidityHigh = 70
-	}
-	windHigh, err = strconv.ParseFloat(os.Getenv("WIND_SPEED_HIGH"), 64)
-	if err != nil {
-		windHigh = 40
-	}
+// Sets the alert thresholds from the config
+func setThresholds(cfg Config) {
+	tempLow = cfg.Thresholds.TempLow
+	tempHigh = cfg.Thresholds.TempHigh
+	humidityLow = cfg.Thresholds.HumidityLow
+	humidityHigh = cfg.Thresholds.HumidityHigh
+	windHigh = cfg.Thresholds.WindSpeedHigh
+	aqiHigh = cfg.Thresholds.AQIHigh
+	uvHigh = cfg.Thresholds.UVHigh
 }
 
 // Starts the HTTP server for Prometheus (avaliable at localhost:8080/metrics)
 func startMetrics() {
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(tenantGatherer(), promhttp.HandlerOpts{})))
 	if err := http.ListenAndServe(":8080", nil); err != nil {
 		fmt.Println("Prometheus HTTP server failed:", err)
 		os.Exit(1)
@@ -178,114 +277,124 @@ func startMetrics() {
 
 // Updates metrics for Prometheus by reading Kafka log data
 // This function will be called when a metric is found in the metricChan
-func updateMetrics(msg WeatherMessage) {
+// Alert transitions are published using the alert writer (if it is not nil)
+func updateMetrics(msg WeatherMessage, alertWriter *kafka.Writer) {
+	setGauges(msg, alertWriter)
+	recordGaugeUpdate()
+
+	// Update the TSDB (persistence between programs), giving up after the storage timeout
+	msg.RunID = runID
+	ctx, cancel := stageContext(config.Timeouts.Storage)
+	defer cancel()
+	if err := metricStore.Append(ctx, msg); err != nil {
+		pipelineErrors.WithLabelValues("tsdb").Inc()
+		log.Println("Error saving metric:", err)
+	}
+}
+
+// Sets the gauges (and alert gauges) of the message's topic
+// Alert transitions are published using the alert writer (if it is not nil)
+func setGauges(msg WeatherMessage, alertWriter *kafka.Writer) {
+
+	// Every date the gauges have a value for also gets its timestamp
+	epoch, _ := strconv.ParseFloat(dateEpoch(msg.Date), 64)
+	dateTimestampGauge.WithLabelValues(msg.labels()...).Set(epoch)
 
 	// Update Gauges with metric data from Kafka for EACH topic
 	// Also sets alert gauges if necessary
 	switch msg.Topic {
 	case "temperature":
-		tempGauge.WithLabelValues(msg.Zip, msg.Date).Set(msg.Temperature)
-		feelsLikeGauge.WithLabelValues(msg.Zip, msg.Date).Set(msg.FeelsLike)
+		tempGauge.WithLabelValues(msg.labels()...).Set(msg.Temperature)
+		feelsLikeGauge.WithLabelValues(msg.labels()...).Set(msg.FeelsLike)
+		tempMinGauge.WithLabelValues(msg.labels()...).Set(msg.MinTemp)
+		tempMaxGauge.WithLabelValues(msg.labels()...).Set(msg.MaxTemp)
+		tempAvgGauge.WithLabelValues(msg.labels()...).Set(msg.AvgTemp)
 
 		// Set alert gauge to 1 or 0 depending on temperature
-		if msg.Temperature > tempHigh {
-			alertTempHigh.WithLabelValues(msg.Zip, msg.Date).Set(1)
-		} else {
-			alertTempHigh.WithLabelValues(msg.Zip, msg.Date).Set(0)
-		}
-
-		if msg.Temperature < tempLow {
-			alertTempLow.WithLabelValues(msg.Zip, msg.Date).Set(1)
-		} else {
-			alertTempLow.WithLabelValues(msg.Zip, msg.Date).Set(0)
-		}
+		setAlert(alertTempHigh, msg, "temperature", "high", msg.Temperature, tempHigh, msg.Temperature > tempHigh, alertWriter)
+		setAlert(alertTempLow, msg, "temperature", "low", msg.Temperature, tempLow, msg.Temperature < tempLow, alertWriter)
 	case "humidity":
-		humidityGauge.WithLabelValues(msg.Zip, msg.Date).Set(msg.Humidity)
+		humidityGauge.WithLabelValues(msg.labels()...).Set(msg.Humidity)
 
 		// Set alert gauge to 1 or 0 depending on humidity
-		if msg.Humidity > humidityHigh {
-			alertHumidityHigh.WithLabelValues(msg.Zip, msg.Date).Set(1)
-		} else {
-			alertHumidityHigh.WithLabelValues(msg.Zip, msg.Date).Set(0)
-		}
-
-		if msg.Humidity < humidityLow {
-			alertHumidityLow.WithLabelValues(msg.Zip, msg.Date).Set(1)
-		} else {
-			alertHumidityLow.WithLabelValues(msg.Zip, msg.Date).Set(0)
-		}
+		setAlert(alertHumidityHigh, msg, "humidity", "high", msg.Humidity, humidityHigh, msg.Humidity > humidityHigh, alertWriter)
+		setAlert(alertHumidityLow, msg, "humidity", "low", msg.Humidity, humidityLow, msg.Humidity < humidityLow, alertWriter)
 
 	case "wind":
-		windSpeedGauge.WithLabelValues(msg.Zip, msg.Date).Set(msg.WindSpeed)
-		windDegreeGauge.WithLabelValues(msg.Zip, msg.Date).Set(msg.WindDegree)
+		windSpeedGauge.WithLabelValues(msg.labels()...).Set(msg.WindSpeed)
+		windDegreeGauge.WithLabelValues(msg.labels()...).Set(msg.WindDegree)
 
 		// Set alert gauge to 1 or 0 depending on wind speed
-		if msg.WindSpeed > windHigh {
-			alertWindHigh.WithLabelValues(msg.Zip, msg.Date).Set(1)
-		} else {
-			alertWindHigh.WithLabelValues(msg.Zip, msg.Date).Set(0)
-		}
+		setAlert(alertWindHigh, msg, "wind", "high", msg.WindSpeed, windHigh, msg.WindSpeed > windHigh, alertWriter)
 
 	case "cloud":
-		cloudGauge.WithLabelValues(msg.Zip, msg.Date).Set(msg.Cloud)
+		cloudGauge.WithLabelValues(msg.labels()...).Set(msg.Cloud)
+
+	case conditionsTopic:
+		// Set the condition, its severity, and the alert gauges of the severe conditions (thunderstorm, heavy snow, fog)
+		setConditionGauges(msg, alertWriter)
+
+	case airQualityTopic:
+		aqiGauge.WithLabelValues(msg.labels()...).Set(msg.AQI)
+		pm25Gauge.WithLabelValues(msg.labels()...).Set(msg.PM25)
+
+		// Set alert gauge to 1 or 0 depending on the air quality index
+		setAlert(alertAQIHigh, msg, "aqi", "high", msg.AQI, aqiHigh, msg.AQI >= aqiHigh, alertWriter)
+
+	case uvIndexTopic:
+		uviGauge.WithLabelValues(msg.labels()...).Set(msg.UVI)
+
+		// Set alert gauge to 1 or 0 depending on the UV index
+		setAlert(alertUVHigh, msg, "uv", "high", msg.UVI, uvHigh, msg.UVI >= uvHigh, alertWriter)
 	}
+}
 
-	// Update the TSDB (persistence between programs)
-	// Append the message to the JSONL file
-	metricsFileMutex.Lock()
-	defer metricsFileMutex.Unlock()
+// Returns the values of the date labels (location, date, and epoch) for the message
+func (msg WeatherMessage) labels() []string {
+	return []string{msg.Zip, msg.Date, dateEpoch(msg.Date)}
+}
 
-	// Begins by opening the metric file in the volume
-	file, err := os.OpenFile(metricsFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		log.Println("Error opening metrics file:", err)
-		return
+// Returns the start of the date (YYYY-MM-DD, or YYYY-MM-DDTHH with an hour) as a Unix timestamp
+// Dates are already the location's calendar days, so they are read as UTC (every location's dates then sort the same way)
+func dateEpoch(date string) string {
+	layout := "2006-01-02"
+	if len(date) > len(layout) {
+		layout = "2006-01-02T15"
 	}
-	defer file.Close()
 
-	// Marshals the message so it becomes data stream of bytes
-	data, err := json.Marshal(msg)
+	t, err := time.Parse(layout, date)
 	if err != nil {
-		log.Println("Error marshaling metrics message:", err)
-		return
+		return "0"
 	}
-
-	// Write this data into the file
-	file.Write(data)
-	file.Write([]byte("\n"))
+	return strconv.FormatInt(t.Unix(), 10)
 }
 
 // Returns whether or not the given request was found in the Prometheus database
 func isInTSDB(req PreCoordinateRequest) bool {
+	date := time.Now().In(zipTimeZone(req.ZIPCode)).AddDate(0, 0, req.Days-1).Format("2006-01-02")
+	found := hasMetricInTSDB(req)
+	if found {
+		fmt.Printf("Found metric for %s-%s in file\n", req.ZIPCode, date)
+	} else if config.FreshnessWindow > 0 && metricStore.Has(req.ZIPCode, date, time.Time{}) {
+		fmt.Printf("Metric for %s-%s is older than the freshness window (%s), fetching it again\n", req.ZIPCode, date, config.FreshnessWindow)
+	}
+	return found
+}
 
-	// Gets ZIP code and the furthest date in YYYY-MM-DD format
-	zip := req.ZIPCode
-	date := time.Now().AddDate(0, 0, req.Days-1).Format("2006-01-02")
+// Returns whether the TSDB has a fresh metric for the request's ZIP code on its furthest date
+// Without a freshness window, any stored metric counts (forecasts are never fetched again)
+func hasMetricInTSDB(req PreCoordinateRequest) bool {
 
-	// Opens the metric volume file
-	file, err := os.Open(metricsFilePath)
-	if err != nil {
-		return false
-	}
-	defer file.Close()
-
-	// Reads this file
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		var msg WeatherMessage
-
-		// Each line will be converted to a msg structure
-		err := json.Unmarshal(scanner.Bytes(), &msg)
-		if err != nil {
-			continue
-		}
-
-		// If the same values are found as the request, then that means the API does NOT need to be called anymore
-		if msg.Zip == zip && msg.Date == date {
-			fmt.Printf("Found metric for %s-%s in file\n", zip, date)
-			return true
-		}
-	}
+	// Gets ZIP code and the furthest date in YYYY-MM-DD format, in the location's time zone like its date labels
+	// Dates can include the hour when the resolution is less than a day, so only the day is compared
+	date := time.Now().In(zipTimeZone(req.ZIPCode)).AddDate(0, 0, req.Days-1).Format("2006-01-02")
+	return metricStore.Has(req.ZIPCode, date, freshSince())
+}
 
-	return false
+// Returns when a stored metric must have been produced to still be fresh (the zero time if every metric is)
+func freshSince() time.Time {
+	if config.FreshnessWindow == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-config.FreshnessWindow)
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Creates (or updates) dashboards without fetching any forecasts, then exits
+//
+//	proj2 provision              dashboards for the ZIP codes in the input file
+//	proj2 provision --from-tsdb  dashboards for every ZIP code ever collected in the TSDB (Ex: restoring a fresh Grafana)
+//
+// With Docker: docker-compose run --rm proj2 ./proj2 provision --from-tsdb
+//
+// Returns the exit code of the command
+func runProvision(args []string) int {
+	flags := flag.NewFlagSet("provision", flag.ContinueOnError)
+	fromTSDB := flags.Bool("from-tsdb", false, "provision every ZIP code in the metrics store, not just the input file")
+	if err := flags.Parse(args); err != nil {
+		return exitFatal
+	}
+
+	// Find the ZIP codes to provision
+	var zips []string
+	var err error
+	if *fromTSDB {
+		zips, err = metricStore.Zips()
+	} else if config.File != "" {
+		zips, err = zipsInFile(config.File)
+	} else {
+		err = fmt.Errorf("no input file is set (FILE), use --from-tsdb to provision every ZIP code in the TSDB")
+	}
+	if err != nil {
+		fmt.Println("Error finding ZIP codes to provision:", err)
+		return exitFatal
+	}
+
+	// Wait for Grafana to start (max 60 seconds)
+	if err := waitForGrafana(60 * time.Second); err != nil {
+		fmt.Println(err)
+		return exitFatal
+	}
+
+	fmt.Printf("Provisioning dashboards for %d ZIP codes...\n", len(zips))
+	provisionGrafana(zips)
+	return exitOK
+}
+
+// Returns the unique ZIP codes of the valid lines in the input file, in sorted order
+func zipsInFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zipSet := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		_, lineZips, group, valid := peekLine(scanner.Text())
+		if !valid {
+			continue
+		}
+
+		// ZIP codes of a state or range line also get their group dashboard
+		for _, zip := range lineZips {
+			zipSet[zip] = struct{}{}
+			if group != "" {
+				recordZipGroup(zip, group)
+			}
+		}
+	}
+
+	zips := make([]string, 0, len(zipSet))
+	for zip := range zipSet {
+		zips = append(zips, zip)
+	}
+	sort.Strings(zips)
+	return zips, scanner.Err()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// Topic that every rejected value gets published to (which is not consumed by this program)
+var qualityTopic = "quality_issues"
+
+// Message published to the quality issues topic when a value is rejected
+type QualityIssue struct {
+	Zip      string
+	Location string
+	Date     string
+	Topic    string
+	Field    string
+	Value    float64
+	Min      float64
+	Max      float64
+}
+
+// A value to check before its payload is published
+type qualityCheck struct {
+	Field string
+	Value float64
+}
+
+// Counts every value that was rejected by the quality gate
+var qualityIssues = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "pipeline_quality_issues_total",
+		Help: "Values rejected before publishing because they are physically implausible, by topic and field",
+	},
+	[]string{"topic", "field"},
+)
+
+// Ran before main()
+func init() {
+	safeRegister(qualityIssues, "pipeline_quality_issues_total")
+}
+
+// Returns the range of values that are physically plausible for the field (in the configured units)
+func plausibleRange(field string) (float64, float64) {
+	switch field {
+	case "Temp", "FeelsLike", "MinTemp", "MaxTemp", "AvgTemp":
+		// -100°F to 150°F, converted to the configured units
+		switch config.Units {
+		case "metric":
+			return -73.3, 65.6
+		case "standard":
+			return 199.8, 338.7
+		}
+		return -100, 150
+	case "Humidity", "CloudPercent":
+		return 0, 100
+	case "Speed", "PM25", "UVI":
+		return 0, math.Inf(1)
+	case "Degree":
+		return 0, 360
+	case "AQI":
+		return 1, 5
+	case "ConditionID":
+		// OpenWeatherMap condition IDs go from 200 (thunderstorm) to 804 (overcast clouds)
+		return 200, 804
+	case "Severity":
+		return severityNone, severitySevere
+	}
+	return math.Inf(-1), math.Inf(1)
+}
+
+// Checks every value of a payload before it is published to the topic
+// If any value is implausible, each bad value is counted and published to the quality issues topic, and false is returned
+// so the payload is not published (bad API data should never reach the dashboards)
+func passesQualityGate(writer *kafka.Writer, zip, location, date, topic string, checks ...qualityCheck) bool {
+	passed := true
+
+	for _, c := range checks {
+		low, high := plausibleRange(c.Field)
+		if !math.IsNaN(c.Value) && c.Value >= low && c.Value <= high {
+			continue
+		}
+		passed = false
+
+		qualityIssues.WithLabelValues(topic, c.Field).Inc()
+		fmt.Printf("QUALITY: rejected %s %s of %g for ZIP %s on %s (expected %g to %g)\n", topic, c.Field, c.Value, zip, date, low, high)
+
+		issue := QualityIssue{Zip: zip, Location: location, Date: date, Topic: topic, Field: c.Field, Value: c.Value, Min: low, Max: high}
+		issueBytes, _ := json.Marshal(issue)
+
+		// Key matches the other topics (zipcode-date)
+		err := writeMessages(writer, kafka.Message{Key: []byte(fmt.Sprintf("%s-%s", zip, date)), Value: issueBytes})
+		recordProduce(qualityTopic, err)
+	}
+
+	return passed
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Exit codes of the program (also written to the run report)
+const (
+	exitOK = 0
+
+	// The program could not finish (Ex: invalid config, invalid API key, Kafka or Grafana not reachable)
+	exitFatal = 1
+
+	// The program finished, but STRICT mode found skipped lines, unknown ZIP codes, or reconciliation mismatches
+	exitStrict = 2
+)
+
+// Machine-readable summary of the run, always written at the end so automated checks can assert on the outcome
+type RunReport struct {
+	Strict bool `json:"strict"`
+
+	// Lines in the input file, and how many requests the valid ones had (a state or range line has one per ZIP code)
+	Lines    int `json:"lines"`
+	Requests int `json:"requests"`
+
+	// Lines that could not be parsed
+	SkippedLines []int `json:"skipped_lines"`
+
+	// ZIP codes that the GeoCoding API could not find
+	NotFoundZips []string `json:"not_found_zips"`
+
+	// Requests (or Kafka messages) the supervisor skipped after an error
+	FailedRequests []string `json:"failed_requests"`
+
+	// Requests that were already in the TSDB, and requests that had their forecast fetched
+	FromTSDB int `json:"from_tsdb"`
+	Fetched  int `json:"fetched"`
+
+	// Requests that should have metrics in the TSDB at the end of the run, but do not
+	Mismatches []string `json:"reconciliation_mismatches"`
+
+	// Every error message, in the order they happened
+	Errors []string `json:"errors"`
+
+	ExitCode   int    `json:"exit_code"`
+	ExitReason string `json:"exit_reason"`
+	Duration   string `json:"duration"`
+}
+
+var (
+	// Report for this run (filled in as the pipeline runs)
+	reportMu sync.Mutex
+	report   = RunReport{SkippedLines: []int{}, NotFoundZips: []string{}, FailedRequests: []string{}, Mismatches: []string{}, Errors: []string{}}
+
+	// Requests that should have metrics in the TSDB once the pipeline is done (checked by reconcile)
+	expectedRequests []PreCoordinateRequest
+
+	// When the run started (used for the report duration)
+	runStart = time.Now()
+)
+
+// Counts a line of the input file, and how many requests it had (0 if it was not valid)
+func reportLine(requests int) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	report.Lines++
+	report.Requests += requests
+}
+
+// Records a line that could not be parsed
+func reportSkippedLine(lineNum int, reason string) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	report.SkippedLines = append(report.SkippedLines, lineNum)
+	report.Errors = append(report.Errors, fmt.Sprintf("line %d: %s", lineNum, reason))
+}
+
+// Records a ZIP code that the GeoCoding API could not find
+func reportNotFound(req PreCoordinateRequest) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	report.NotFoundZips = append(report.NotFoundZips, req.ZIPCode)
+	report.Errors = append(report.Errors, fmt.Sprintf("line %d: ZIP code '%s' not found", req.LineNum, req.ZIPCode))
+}
+
+// Records a request (or Kafka message) that the supervisor skipped
+func reportFailedRequest(workerErr WorkerError) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	failure := fmt.Sprintf("line %d: %s for ZIP code '%s' failed: %s", workerErr.Line, workerErr.Stage, workerErr.Zip, workerErr.Err)
+	report.FailedRequests = append(report.FailedRequests, failure)
+	report.Errors = append(report.Errors, failure)
+}
+
+// Records a request that should have metrics at the end of the run
+// fromTSDB is whether its metrics were already in the TSDB (otherwise its forecast is fetched)
+func reportExpected(req PreCoordinateRequest, fromTSDB bool) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	if fromTSDB {
+		report.FromTSDB++
+	} else {
+		report.Fetched++
+	}
+	expectedRequests = append(expectedRequests, req)
+}
+
+// Checks that every expected request has its metrics in the TSDB, recording a mismatch for each one that doesn't
+func reconcile() {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	for _, req := range expectedRequests {
+		if !hasMetricInTSDB(req) {
+			mismatch := fmt.Sprintf("line %d: no metrics for ZIP code '%s' (%d days) in the TSDB", req.LineNum, req.ZIPCode, req.Days)
+			report.Mismatches = append(report.Mismatches, mismatch)
+			report.Errors = append(report.Errors, mismatch)
+		}
+	}
+
+	if len(report.Mismatches) > 0 {
+		fmt.Printf("Reconciliation found %d requests without metrics.\n", len(report.Mismatches))
+	}
+}
+
+// Returns the exit code and reason for a run that finished
+// In STRICT mode, skipped lines, unknown ZIP codes, failed requests, and reconciliation mismatches all fail the run
+func finishedExitCode() (int, string) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	if !config.Strict {
+		return exitOK, "completed"
+	}
+
+	failures := []string{}
+	if n := len(report.SkippedLines); n > 0 {
+		failures = append(failures, fmt.Sprintf("%d skipped lines", n))
+	}
+	if n := len(report.NotFoundZips); n > 0 {
+		failures = append(failures, fmt.Sprintf("%d ZIP codes not found", n))
+	}
+	if n := len(report.FailedRequests); n > 0 {
+		failures = append(failures, fmt.Sprintf("%d failed requests", n))
+	}
+	if n := len(report.Mismatches); n > 0 {
+		failures = append(failures, fmt.Sprintf("%d reconciliation mismatches", n))
+	}
+	if len(failures) > 0 {
+		return exitStrict, fmt.Sprintf("strict mode: %v", failures)
+	}
+	return exitOK, "completed"
+}
+
+// Writes the run report with the exit code and reason
+func writeReport(code int, reason string) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	report.Strict = config.Strict
+	report.ExitCode = code
+	report.ExitReason = reason
+	report.Duration = time.Since(runStart).String()
+	sort.Ints(report.SkippedLines)
+	sort.Strings(report.NotFoundZips)
+
+	path := config.ReportPath
+	if path == "" {
+		path = defaultConfig().ReportPath
+	}
+
+	data, _ := json.MarshalIndent(report, "", "  ")
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		fmt.Println("Error writing run report:", err)
+		return
+	}
+	fmt.Printf("Run report written to %s\n", path)
+}
+
+// Writes the run report and ends the program with the exit code
+// The shutdown steps run first, so the Kafka writers and the TSDB are always flushed
+func exitRun(code int, reason string) {
+	runShutdown()
+	writeReport(code, reason)
+	os.Exit(code)
+}
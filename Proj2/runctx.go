@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Context of the whole run, cancelled by the first fatal error
+// Every stage derives its own context (with its timeout) from it, so a fatal error anywhere stops every call that is waiting
+var runCtx, cancelRun = context.WithCancelCause(context.Background())
+
+// Ends the run because of a fatal error in one of the workers
+// Instead of exiting right away, the run is cancelled: waiting calls return, the workers drain their channels,
+// and main writes the report and exits once the pipeline has stopped (only the first error is kept)
+func failRun(err error) {
+	if runCtx.Err() == nil {
+		fmt.Println("ERROR", err)
+		pipelineErrors.WithLabelValues("fatal").Inc()
+	}
+	cancelRun(err)
+}
+
+// Returns whether a fatal error cancelled the run
+func runFailed() bool {
+	return runCtx.Err() != nil
+}
+
+// Returns a context for one operation of a stage, which ends after the stage's timeout (in seconds) or when the run is cancelled
+func stageContext(seconds int) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(runCtx, time.Duration(seconds)*time.Second)
+}
+
+// Writes the messages to the writer's topic, giving up after the Kafka timeout (so a hung broker doesn't stall the worker forever)
+func writeMessages(writer *kafka.Writer, msgs ...kafka.Message) error {
+	ctx, cancel := stageContext(config.Timeouts.Kafka)
+	defer cancel()
+	return writer.WriteMessages(ctx, msgs...)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status of a request submitted through the REST API
+const (
+	StatusQueued    = "queued"
+	StatusGeocoding = "geocoding"
+	StatusFetching  = "fetching"
+	StatusDone      = "done"
+	StatusNotFound  = "not_found"
+	StatusRejected  = "rejected"
+
+	// A fatal error cancelled the run before the request finished
+	StatusFailed = "failed"
+)
+
+// Progress of a request submitted through the REST API
+type RequestStatus struct {
+	ID        int       `json:"id"`
+	Days      int       `json:"days"`
+	Zip       string    `json:"zip"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Body of POST /requests
+type SubmitRequest struct {
+	Days int    `json:"days"`
+	Zip  string `json:"zip"`
+}
+
+var (
+	// Every request submitted through the REST API (requests from the input file have ID 0 and are not tracked)
+	requestStatusMu sync.Mutex
+	requestStatuses = make(map[int]*RequestStatus)
+	lastRequestID   int
+
+	// Channel new requests are sent to, which can be closed while handlers are still running
+	intakeMu     sync.RWMutex
+	intakeChan   chan<- PreCoordinateRequest
+	intakeClosed bool
+)
+
+// Sets the channel that requests are sent to
+func openIntake(ch chan<- PreCoordinateRequest) {
+	intakeMu.Lock()
+	defer intakeMu.Unlock()
+	intakeChan = ch
+	intakeClosed = false
+}
+
+// Closes the request channel, after which submitted requests are rejected
+func closeIntake() {
+	intakeMu.Lock()
+	defer intakeMu.Unlock()
+	intakeClosed = true
+	close(intakeChan)
+}
+
+// Sends the request into the pipeline, returning false if the pipeline is shutting down
+func submitRequest(req PreCoordinateRequest) bool {
+	intakeMu.RLock()
+	defer intakeMu.RUnlock()
+	if intakeClosed {
+		return false
+	}
+
+	recordRequestedZip(req.ZIPCode)
+	intakeChan <- req
+	return true
+}
+
+// Updates the status of a request submitted through the REST API (requests from the input file are ignored)
+func setRequestStatus(id int, status, message string) {
+	if id == 0 {
+		return
+	}
+
+	requestStatusMu.Lock()
+	defer requestStatusMu.Unlock()
+	if s, exists := requestStatuses[id]; exists {
+		s.Status = status
+		s.Message = message
+		s.UpdatedAt = time.Now()
+	}
+}
+
+// Returns a copy of the request's status
+func getRequestStatus(id int) (RequestStatus, bool) {
+	requestStatusMu.Lock()
+	defer requestStatusMu.Unlock()
+	s, exists := requestStatuses[id]
+	if !exists {
+		return RequestStatus{}, false
+	}
+	return *s, true
+}
+
+// Adds the REST API to the HTTP server (the same one that serves /metrics)
+//
+//	POST /requests       {"days": 3, "zip": "12601"} queues a forecast request, returning its ID
+//	GET  /requests/{id}  returns the status of the request
+//
+// When a tenant is set, every call needs the tenant in the X-Tenant header (or ?tenant=), so it can't reach another tenant's service by mistake
+func registerRequestAPI() {
+	http.HandleFunc("POST /requests", handleSubmitRequest)
+	http.HandleFunc("GET /requests/{id}", handleGetRequest)
+}
+
+// Handles POST /requests
+func handleSubmitRequest(w http.ResponseWriter, r *http.Request) {
+	if !tenantAllowed(r) {
+		writeTenantError(w)
+		return
+	}
+
+	var body SubmitRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be JSON like {\"days\": 3, \"zip\": \"12601\"}"})
+		return
+	}
+
+	// Same rules as a line of the input file
+	body.Zip = strings.TrimSpace(body.Zip)
+	if body.Zip == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "zip is required"})
+		return
+	}
+	if body.Days <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "days must be a positive number"})
+		return
+	}
+
+	// Days must also be less than or equal to 5 due to API restrictions
+	message := ""
+	if body.Days > 5 {
+		message = fmt.Sprintf("days changed from %d to 5 (due to free API)", body.Days)
+		body.Days = 5
+	}
+
+	requestStatusMu.Lock()
+	lastRequestID++
+	status := &RequestStatus{ID: lastRequestID, Days: body.Days, Zip: body.Zip, Tenant: config.Tenant, Status: StatusQueued, Message: message, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	requestStatuses[status.ID] = status
+	requestStatusMu.Unlock()
+
+	if !submitRequest(PreCoordinateRequest{Days: body.Days, ZIPCode: body.Zip, ID: status.ID}) {
+		setRequestStatus(status.ID, StatusRejected, "the pipeline is shutting down")
+		s, _ := getRequestStatus(status.ID)
+		writeJSON(w, http.StatusServiceUnavailable, s)
+		return
+	}
+
+	fmt.Printf("Request %d queued through the REST API (ZIP %s, %d days)\n", status.ID, body.Zip, body.Days)
+	s, _ := getRequestStatus(status.ID)
+	w.Header().Set("Location", fmt.Sprintf("/requests/%d", status.ID))
+	writeJSON(w, http.StatusAccepted, s)
+}
+
+// Handles GET /requests/{id}
+func handleGetRequest(w http.ResponseWriter, r *http.Request) {
+	if !tenantAllowed(r) {
+		writeTenantError(w)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id must be a number"})
+		return
+	}
+
+	s, exists := getRequestStatus(id)
+	if !exists {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("request %d not found", id)})
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// Writes the error for a call that isn't for this service's tenant
+func writeTenantError(w http.ResponseWriter) {
+	writeJSON(w, http.StatusForbidden, map[string]string{"error": fmt.Sprintf("this service belongs to tenant '%s', set it in the X-Tenant header", config.Tenant)})
+}
+
+// Writes the value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Storage backends for the time-series (the TSDB that persists metrics between runs)
+const (
+	StorageKafka  = "kafka"
+	StorageJSONL  = "jsonl"
+	StorageSQLite = "sqlite"
+)
+
+// Identifies the rows written during this run (SQLite backend)
+var runID = time.Now().Format("20060102-150405")
+
+// Where metrics are persisted between runs (set at the start of main)
+var metricStore MetricStore
+
+// Persists every WeatherMessage so later runs can skip API calls for results that already exist
+// A forecast that is fetched again (after the freshness window) doesn't erase the old values, they stay under their run ID
+type MetricStore interface {
+	// Saves the message (giving up if the context ends first)
+	Append(ctx context.Context, msg WeatherMessage) error
+
+	// Returns whether there is a metric for the ZIP code on the day (dates with an hour also match their day)
+	// Only metrics produced at or after since count (the zero time counts every metric)
+	Has(zip, day string, since time.Time) bool
+
+	// Returns every ZIP code that has metrics
+	Zips() ([]string, error)
+
+	// Removes every metric of the ZIP code
+	Delete(zip string) error
+
+	// Calls fn with every stored message until it returns false (values archived by a later run of the Kafka backend are left out)
+	Each(fn func(WeatherMessage) bool) error
+
+	// Removes every metric with a date before the day (YYYY-MM-DD)
+	DeleteBefore(day string) error
+
+	Close() error
+}
+
+// Opens the store for the configured backend
+func openMetricStore(backend, path string) (MetricStore, error) {
+	switch backend {
+	case StorageKafka:
+		return openKafkaStore(path)
+	case StorageSQLite:
+		return openSQLiteStore(path)
+	default:
+		return &jsonlStore{path: path}, nil
+	}
+}
+
+// ---- JSONL backend (one JSON message per line) ----
+
+type jsonlStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// Appends the message to the JSONL file
+// A single write can't be interrupted, so the context is only checked once the file is free
+func (s *jsonlStore) Append(ctx context.Context, msg WeatherMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Begins by opening the metric file in the volume
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Marshals the message so it becomes data stream of bytes
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// Write this data into the file
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Scans the whole file for a message with the ZIP code and day (lines written before produced times were stored never count as fresh)
+func (s *jsonlStore) Has(zip, day string, since time.Time) bool {
+	found := false
+	s.scan(func(msg WeatherMessage) bool {
+		found = msg.Zip == zip && strings.HasPrefix(msg.Date, day) && !msg.ProducedAt.Before(since)
+		return !found
+	})
+	return found
+}
+
+// Scans the whole file for unique ZIP codes
+func (s *jsonlStore) Zips() ([]string, error) {
+	// Use a map as a set to store unique ZIP codes
+	zipSet := make(map[string]struct{})
+	err := s.scan(func(msg WeatherMessage) bool {
+		zipSet[msg.Zip] = struct{}{}
+		return true
+	})
+
+	zips := make([]string, 0, len(zipSet))
+	for z := range zipSet {
+		zips = append(zips, z)
+	}
+	sort.Strings(zips)
+	return zips, err
+}
+
+// Rewrites the file without the ZIP code's messages
+func (s *jsonlStore) Delete(zip string) error {
+	return s.rewrite(func(msg WeatherMessage) bool { return msg.Zip == zip })
+}
+
+// Rewrites the file without the messages dated before the day (dates with an hour sort after their day, so they are kept on it)
+func (s *jsonlStore) DeleteBefore(day string) error {
+	return s.rewrite(func(msg WeatherMessage) bool { return msg.Date < day })
+}
+
+// Calls fn with every message in the file (a file that doesn't exist yet has none)
+func (s *jsonlStore) Each(fn func(WeatherMessage) bool) error {
+	err := s.scan(fn)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Rewrites the file without the messages that drop returns true for (written to a new file first, so a failure never loses the old one)
+func (s *jsonlStore) rewrite(drop func(WeatherMessage) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	kept, err := os.Create(s.path + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer kept.Close()
+
+	// Lines that aren't valid are kept as they are
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var msg WeatherMessage
+		if json.Unmarshal(scanner.Bytes(), &msg) == nil && drop(msg) {
+			continue
+		}
+		if _, err := kept.Write(append(scanner.Bytes(), '\n')); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := kept.Close(); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+func (s *jsonlStore) Close() error {
+	return nil
+}
+
+// Calls fn with every message in the file until it returns false
+func (s *jsonlStore) scan(fn func(WeatherMessage) bool) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Each line will be converted to a msg structure (lines that aren't valid are skipped)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var msg WeatherMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if !fn(msg) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// ---- SQLite backend (one row per metric value, indexed by ZIP code and date) ----
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// Opens (and creates if needed) the SQLite database
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Limit database connections to a single open and idle connection
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+
+	// Create the table and its indexes (if this is the first time the program is run)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS metrics (
+			zip TEXT NOT NULL,
+			date TEXT NOT NULL,
+			metric TEXT NOT NULL,
+			value REAL NOT NULL,
+			run_id TEXT NOT NULL,
+			produced_at TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS metrics_zip_date ON metrics (zip, date);
+		CREATE INDEX IF NOT EXISTS metrics_run_id ON metrics (run_id);
+	`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Allows concurrent reading and writing (has limited effect due to open/idle connection limit)
+	_, err = db.Exec("PRAGMA journal_mode=WAL;")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+// Writes one row for each metric in the message (all in one transaction)
+func (s *sqliteStore) Append(ctx context.Context, msg WeatherMessage) error {
+	producedAt := msg.ProducedAt
+	if producedAt.IsZero() {
+		producedAt = time.Now()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for metric, value := range messageValues(msg) {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO metrics (zip, date, metric, value, run_id, produced_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			msg.Zip, msg.Date, metric, value, runID, producedAt.UTC().Format(time.RFC3339),
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Looks up the ZIP code and day using the (zip, date) index
+// Dates with an hour (Ex: 2025-01-02T15) sort right after their day, so they are covered by the range
+// Produced times are all written as UTC RFC 3339, so they compare correctly as text
+func (s *sqliteStore) Has(zip, day string, since time.Time) bool {
+	fresh := ""
+	if !since.IsZero() {
+		fresh = since.UTC().Format(time.RFC3339)
+	}
+
+	// Every date of the day sorts before the next day
+	start, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return false
+	}
+	nextDay := start.AddDate(0, 0, 1).Format("2006-01-02")
+
+	var found int
+	err = s.db.QueryRow(`
+		SELECT 1 FROM metrics
+		WHERE zip = ? AND date >= ? AND date < ? AND produced_at >= ?
+		LIMIT 1`,
+		zip, day, nextDay, fresh,
+	).Scan(&found)
+	return err == nil
+}
+
+// Returns every unique ZIP code
+func (s *sqliteStore) Zips() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT zip FROM metrics ORDER BY zip")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zips := []string{}
+	for rows.Next() {
+		var zip string
+		if err := rows.Scan(&zip); err != nil {
+			return nil, err
+		}
+		zips = append(zips, zip)
+	}
+	return zips, rows.Err()
+}
+
+// Deletes every row of the ZIP code
+func (s *sqliteStore) Delete(zip string) error {
+	_, err := s.db.Exec("DELETE FROM metrics WHERE zip = ?", zip)
+	return err
+}
+
+// Deletes every row dated before the day
+func (s *sqliteStore) DeleteBefore(day string) error {
+	_, err := s.db.Exec("DELETE FROM metrics WHERE date < ?", day)
+	return err
+}
+
+// Turns the rows back into messages (one for each ZIP code, date, run, and topic) in order of ZIP code and date
+func (s *sqliteStore) Each(fn func(WeatherMessage) bool) error {
+	rows, err := s.db.Query("SELECT zip, date, metric, value, run_id, produced_at FROM metrics ORDER BY zip, date, run_id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// The metrics of one message can be spread out over the rows (they are only sorted by ZIP code, date, and run)
+	messages := make(map[string]*WeatherMessage)
+	order := []string{}
+	for rows.Next() {
+		var zip, date, metric, runID, producedAt string
+		var value float64
+		if err := rows.Scan(&zip, &date, &metric, &value, &runID, &producedAt); err != nil {
+			return err
+		}
+
+		var values WeatherMessage
+		if !setMessageValue(&values, metric, value) {
+			continue
+		}
+		key := strings.Join([]string{zip, date, runID, values.Topic}, "|")
+		msg, exists := messages[key]
+		if !exists {
+			msg = &WeatherMessage{Topic: values.Topic, Zip: zip, Date: date, RunID: runID}
+			msg.ProducedAt, _ = time.Parse(time.RFC3339, producedAt)
+			messages[key] = msg
+			order = append(order, key)
+		}
+		setMessageValue(msg, metric, value)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range order {
+		if !fn(*messages[key]) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// Returns the values in the message by metric name (only the values of the message's topic)
+func messageValues(msg WeatherMessage) map[string]float64 {
+	switch msg.Topic {
+	case "temperature":
+		return map[string]float64{"temperature": msg.Temperature, "feelslike": msg.FeelsLike,
+			"temperature_min": msg.MinTemp, "temperature_max": msg.MaxTemp, "temperature_avg": msg.AvgTemp}
+	case "humidity":
+		return map[string]float64{"humidity": msg.Humidity}
+	case "wind":
+		return map[string]float64{"wind_speed": msg.WindSpeed, "wind_degree": msg.WindDegree}
+	case "cloud":
+		return map[string]float64{"cloud_percent": msg.Cloud}
+	case airQualityTopic:
+		return map[string]float64{"aqi": msg.AQI, "pm2_5": msg.PM25}
+	case uvIndexTopic:
+		return map[string]float64{"uvi": msg.UVI}
+	case conditionsTopic:
+		return map[string]float64{"condition_id": msg.ConditionID, "severity": msg.Severity}
+	}
+	return nil
+}
+
+// Sets the metric's value (and the topic it belongs to) in the message, the opposite of messageValues
+// Returns false if the metric isn't one that is stored
+func setMessageValue(msg *WeatherMessage, metric string, value float64) bool {
+	switch metric {
+	case "temperature":
+		msg.Topic, msg.Temperature = "temperature", value
+	case "feelslike":
+		msg.Topic, msg.FeelsLike = "temperature", value
+	case "temperature_min":
+		msg.Topic, msg.MinTemp = "temperature", value
+	case "temperature_max":
+		msg.Topic, msg.MaxTemp = "temperature", value
+	case "temperature_avg":
+		msg.Topic, msg.AvgTemp = "temperature", value
+	case "humidity":
+		msg.Topic, msg.Humidity = "humidity", value
+	case "wind_speed":
+		msg.Topic, msg.WindSpeed = "wind", value
+	case "wind_degree":
+		msg.Topic, msg.WindDegree = "wind", value
+	// Stored as cloud before it was named after its gauge
+	case "cloud_percent", "cloud":
+		msg.Topic, msg.Cloud = "cloud", value
+	case "aqi":
+		msg.Topic, msg.AQI = airQualityTopic, value
+	case "pm2_5":
+		msg.Topic, msg.PM25 = airQualityTopic, value
+	case "uvi":
+		msg.Topic, msg.UVI = uvIndexTopic, value
+	case "condition_id":
+		msg.Topic, msg.ConditionID = conditionsTopic, value
+	case "severity":
+		msg.Topic, msg.Severity = conditionsTopic, value
+	default:
+		return false
+	}
+	return true
+}
+
+// Returns the default path of the store for the backend (the topic name for Kafka)
+func defaultStoragePath(backend string) string {
+	switch backend {
+	case StorageKafka:
+		return "metrics_store"
+	case StorageSQLite:
+		return "/data/metrics.db"
+	default:
+		return "/data/metrics.jsonl"
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Name of each ZIP code's location, from the GeoCoding API (the gauges are only labeled by ZIP code)
+	locationNamesMu sync.Mutex
+	locationNames   = make(map[string]string)
+
+	// Client used for the Slack webhook
+	summaryClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Forecast highlights and active alerts of one location, read from the gauges
+type LocationSummary struct {
+	Zip  string
+	Name string
+
+	// Whether the gauges have any forecast for the location (ZIP codes that were already in the TSDB may not)
+	HasForecast bool
+
+	High, Low                float64
+	MinHumidity, MaxHumidity float64
+	MaxWind                  float64
+
+	// Alerts that are on, as "date: alert name"
+	Alerts []string
+}
+
+// Remembers the location name of the ZIP code for the summary report
+func recordLocationName(zip, name string) {
+	locationNamesMu.Lock()
+	defer locationNamesMu.Unlock()
+	locationNames[zip] = name
+}
+
+// Returns whether the summary report is sent anywhere (by email or to Slack)
+func summaryEnabled() bool {
+	return config.Summary.SMTP.Host != "" || config.Summary.SlackWebhook != ""
+}
+
+// Reads the forecast highlights and active alerts of every requested ZIP code from the gauges
+func collectSummary() []LocationSummary {
+	summaries := make(map[string]*LocationSummary)
+	for _, zip := range getRequestedZips() {
+		locationNamesMu.Lock()
+		summaries[zip] = &LocationSummary{Zip: zip, Name: locationNames[zip], MinHumidity: 100, Alerts: []string{}}
+		locationNamesMu.Unlock()
+	}
+
+	// Names of the alert gauges, as shown on the dashboards
+	_, alerts := dashboardPanels()
+	alertNames := make(map[string]string)
+	for _, alert := range alerts {
+		alertNames[alert.Gauge] = alert.Name
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		fmt.Println("Error reading the gauges for the summary report:", err)
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			summary, requested := summaries[labels["location"]]
+			if !requested {
+				continue
+			}
+			value := metric.GetGauge().GetValue()
+
+			switch family.GetName() {
+			case "temperature":
+				if !summary.HasForecast {
+					summary.High, summary.Low = value, value
+				}
+				summary.HasForecast = true
+				summary.High = max(summary.High, value)
+				summary.Low = min(summary.Low, value)
+			case "humidity":
+				summary.MinHumidity = min(summary.MinHumidity, value)
+				summary.MaxHumidity = max(summary.MaxHumidity, value)
+			case "wind_speed":
+				summary.MaxWind = max(summary.MaxWind, value)
+			default:
+				if name, isAlert := alertNames[family.GetName()]; isAlert && value == 1 {
+					summary.Alerts = append(summary.Alerts, fmt.Sprintf("%s: %s", labels["date"], name))
+				}
+			}
+		}
+	}
+
+	result := make([]LocationSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		sort.Strings(summary.Alerts)
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Zip < result[j].Zip })
+	return result
+}
+
+// Builds the subject and plain text body of the summary report
+func formatSummary(summaries []LocationSummary) (string, string) {
+	alertCount := 0
+	for _, summary := range summaries {
+		alertCount += len(summary.Alerts)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Weather summary for %d locations (%d active alerts), %s\n", len(summaries), alertCount, time.Now().Format(time.RFC1123))
+	for _, summary := range summaries {
+		name := summary.Name
+		if name == "" {
+			name = "ZIP " + summary.Zip
+		} else {
+			name += " (ZIP " + summary.Zip + ")"
+		}
+
+		if !summary.HasForecast {
+			fmt.Fprintf(&sb, "\n%s: no new forecast this run (already in the TSDB)\n", name)
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s: high %.1f%s, low %.1f%s, humidity %.0f-%.0f%%, wind up to %.1f %s\n",
+			name, summary.High, tempUnit(), summary.Low, tempUnit(), summary.MinHumidity, summary.MaxHumidity, summary.MaxWind, speedUnit())
+		for _, alert := range summary.Alerts {
+			fmt.Fprintf(&sb, "  ALERT %s\n", alert)
+		}
+		fmt.Fprintf(&sb, "  Dashboard: http://localhost:3000/d/%s\n", zipDashboardUID(summary.Zip))
+	}
+
+	subject := fmt.Sprintf("Weather summary: %d locations, %d alerts", len(summaries), alertCount)
+	return subject, sb.String()
+}
+
+// Sends the summary report by email and to Slack (whichever are configured)
+// A delivery that fails is counted as a pipeline error, but doesn't fail the run
+func sendSummaryReport() {
+	if !summaryEnabled() {
+		return
+	}
+
+	subject, body := formatSummary(collectSummary())
+	if config.Summary.SMTP.Host != "" {
+		if err := sendSummaryEmail(subject, body); err != nil {
+			pipelineErrors.WithLabelValues("summary").Inc()
+			fmt.Println("Error emailing the summary report:", err)
+		} else {
+			fmt.Printf("Emailed the summary report to %s\n", strings.Join(config.Summary.SMTP.To, ", "))
+		}
+	}
+	if config.Summary.SlackWebhook != "" {
+		if err := sendSummarySlack(body); err != nil {
+			pipelineErrors.WithLabelValues("summary").Inc()
+			fmt.Println("Error sending the summary report to Slack:", err)
+		} else {
+			fmt.Println("Sent the summary report to Slack")
+		}
+	}
+}
+
+// Emails the report to every summary.smtp.to address (logging in if a user is set)
+func sendSummaryEmail(subject, body string) error {
+	smtpConfig := config.Summary.SMTP
+	headers := []string{
+		"From: " + smtpConfig.From,
+		"To: " + strings.Join(smtpConfig.To, ", "),
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+
+	// SMTP lines end with CRLF
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+
+	var auth smtp.Auth
+	if smtpConfig.User != "" {
+		auth = smtp.PlainAuth("", smtpConfig.User, smtpConfig.Password, smtpConfig.Host)
+	}
+	address := net.JoinHostPort(smtpConfig.Host, strconv.Itoa(smtpConfig.Port))
+	return smtp.SendMail(address, auth, smtpConfig.From, smtpConfig.To, []byte(message))
+}
+
+// Posts the report to the Slack incoming webhook (as a code block, so the columns line up)
+func sendSummarySlack(body string) error {
+	payload, _ := json.Marshal(map[string]string{"text": "```" + body + "```"})
+	resp, err := summaryClient.Post(config.Summary.SlackWebhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sends the summary report every summary.interval_minutes while serving, until stop is closed
+func scheduleSummaryReports(stop <-chan struct{}) {
+	if !summaryEnabled() || config.Summary.IntervalMinutes == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(config.Summary.IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sendSummaryReport()
+		case <-stop:
+			return
+		case <-runCtx.Done():
+			return
+		}
+	}
+}
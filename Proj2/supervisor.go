@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Stages of the pipeline that send their errors to the supervisor (also the labels of pipeline_errors_total)
+const (
+	stageGeocode  = "geocode"
+	stageForecast = "forecast"
+	stageKafka    = "kafka_produce"
+)
+
+// What the supervisor decides a worker does about its error
+type Decision int
+
+const (
+	// Give up on the request (or message), while the rest of the run goes on
+	DecisionSkip Decision = iota
+
+	// Make the same call again
+	DecisionRetry
+
+	// Cancel the whole run (every stage stops and drains, and the run report is still written)
+	DecisionAbort
+)
+
+// Error a worker hit, sent to the supervisor instead of ending the program from the worker
+type WorkerError struct {
+	Stage   string
+	Line    int
+	Zip     string
+	Attempt int
+	Err     error
+
+	// Where the supervisor sends its decision back to
+	decision chan Decision
+}
+
+var (
+	// Errors that retrying can't fix, so they always abort the run (Ex: an invalid API key)
+	errFatal = errors.New("fatal")
+
+	// Errors that may not happen again, so the call is retried (Ex: every key was throttled, or a server error)
+	errTemporary = errors.New("temporary")
+)
+
+// Most times a call with a temporary error is made before the run is aborted
+const maxAttempts = 3
+
+var (
+	// Channel every worker sends its errors to, and the supervisor that reads it (started by the first error)
+	workerErrors    = make(chan WorkerError)
+	startSupervisor sync.Once
+
+	// Steps that run when the program ends, however it ends (Ex: flushing the Kafka writers)
+	shutdownMu    sync.Mutex
+	shutdownSteps []func()
+)
+
+// Sends the worker's error to the supervisor, returning what the worker should do about it
+// attempt is how many times the call has been made (starting at 1)
+func superviseError(stage string, lineNum int, zipCode string, attempt int, err error) Decision {
+	startSupervisor.Do(func() { go superviseWorkers() })
+
+	workerErr := WorkerError{Stage: stage, Line: lineNum, Zip: zipCode, Attempt: attempt, Err: err, decision: make(chan Decision, 1)}
+	workerErrors <- workerErr
+	return <-workerErr.decision
+}
+
+// Decides what to do about every worker error, one at a time (so only one of them can abort the run)
+func superviseWorkers() {
+	for workerErr := range workerErrors {
+		pipelineErrors.WithLabelValues(workerErr.Stage).Inc()
+
+		decision := decide(workerErr)
+		switch decision {
+		case DecisionRetry:
+			fmt.Printf("WARNING on Line %d: %s for ZIP code '%s' failed (attempt %d of %d): %s. Retrying.\n",
+				workerErr.Line, workerErr.Stage, workerErr.Zip, workerErr.Attempt, maxAttempts, workerErr.Err)
+		case DecisionSkip:
+			// Errors after the run was cancelled are only part of stopping, so they are not reported
+			if !runFailed() {
+				fmt.Printf("ERROR on Line %d: %s for ZIP code '%s' failed: %s. Skipping it.\n", workerErr.Line, workerErr.Stage, workerErr.Zip, workerErr.Err)
+				reportFailedRequest(workerErr)
+			}
+		case DecisionAbort:
+			failRun(fmt.Errorf("%s on line %d: %w", workerErr.Stage, workerErr.Line, workerErr.Err))
+		}
+
+		workerErr.decision <- decision
+	}
+}
+
+// Returns what should be done about the error
+// Fatal errors abort the run, temporary ones are retried (aborting once they have had every attempt, since the stage is down),
+// and anything else only skips the request
+func decide(workerErr WorkerError) Decision {
+	switch {
+	case runFailed():
+		return DecisionSkip
+	case errors.Is(workerErr.Err, errFatal):
+		return DecisionAbort
+	case isTemporary(workerErr.Err) && workerErr.Attempt < maxAttempts:
+		return DecisionRetry
+	case isTemporary(workerErr.Err):
+		return DecisionAbort
+	default:
+		return DecisionSkip
+	}
+}
+
+// Returns whether the error may not happen again (a timeout, a network error, or a throttled or failing server)
+func isTemporary(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, errTemporary) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// Returns the error of an API response's status code (nil if the status isn't an error)
+func statusError(cod, message any) error {
+	status := fmt.Sprint(cod)
+	switch {
+	case status == "401":
+		return fmt.Errorf("%w: invalid API key: %v", errFatal, message)
+	case status == "429" || strings.HasPrefix(status, "5"):
+		return fmt.Errorf("%w: status %s: %v", errTemporary, status, message)
+	default:
+		return fmt.Errorf("status %s: %v", status, message)
+	}
+}
+
+// Waits before the next attempt (longer after each one), returning early if the run is cancelled
+func waitToRetry(attempt int) {
+	select {
+	case <-time.After(time.Duration(attempt) * time.Second):
+	case <-runCtx.Done():
+	}
+}
+
+// Writes the message to the topic, retrying while the supervisor says to (a skipped message is only counted)
+func publish(writer *kafka.Writer, topic string, lineNum int, zipCode string, msg kafka.Message) {
+	for attempt := 1; ; attempt++ {
+		err := writeMessages(writer, msg)
+		if err == nil {
+			recordProduce(topic, nil)
+			return
+		}
+		if superviseError(stageKafka, lineNum, zipCode, attempt, fmt.Errorf("writing to %s: %w", topic, err)) != DecisionRetry {
+			return
+		}
+		waitToRetry(attempt)
+	}
+}
+
+// Registers a step that runs when the program ends, however it ends (steps run newest first, like defers)
+func onShutdown(step func()) {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	shutdownSteps = append(shutdownSteps, step)
+}
+
+// Runs every shutdown step once (Ex: flushing the Kafka writers and closing the TSDB)
+func runShutdown() {
+	shutdownMu.Lock()
+	steps := shutdownSteps
+	shutdownSteps = nil
+	shutdownMu.Unlock()
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		steps[i]()
+	}
+}
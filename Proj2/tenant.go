@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+
+	"proj2/grafana"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Name of the label every metric gets when a tenant (or run ID) is set
+const tenantLabel = "tenant"
+
+// Separates the tenant's data from everyone else sharing the Kafka, Prometheus, and Grafana stack (if a tenant or run ID is set)
+// Dashboards only query the tenant's series, and get their own folders so their titles don't collide
+func applyTenant() {
+	if config.RunID != "" {
+		runID = config.RunID
+	}
+
+	grafana.SetTenant(namespace())
+	if namespace() == "" {
+		return
+	}
+
+	weatherFolderUID = tenantUID(weatherFolderUID)
+	weatherFolderTitle += " (" + namespace() + ")"
+	pipelineFolderUID = tenantUID(pipelineFolderUID)
+	pipelineFolderTitle += " (" + namespace() + ")"
+}
+
+// Returns what this run's data is namespaced by: the tenant, the run ID, or both (Ex: "classA-ci42"), empty if neither is set
+// The generated run ID doesn't count, since every run would otherwise get new topics and dashboards
+func namespace() string {
+	switch {
+	case config.Tenant != "" && config.RunID != "":
+		return config.Tenant + "-" + config.RunID
+	case config.RunID != "":
+		return config.RunID
+	default:
+		return config.Tenant
+	}
+}
+
+// Returns the Kafka topic for the name, prefixed with the tenant (Ex: "classA-temperature", or "classA-ci42-temperature" with a run ID)
+// Payloads are still decoded by the name without the prefix
+func tenantTopic(name string) string {
+	if namespace() == "" {
+		return name
+	}
+	return namespace() + "-" + name
+}
+
+// Returns the Grafana UID prefixed with the tenant (Ex: "classA-weather-12601")
+func tenantUID(uid string) string {
+	if namespace() == "" {
+		return uid
+	}
+	return namespace() + "-" + uid
+}
+
+// Returns the gatherer /metrics is served from, which adds the tenant label to every metric (if a tenant or run ID is set)
+// Metrics are registered before the config is loaded, so the label is added when they are scraped instead
+func tenantGatherer() prometheus.Gatherer {
+	if namespace() == "" {
+		return prometheus.DefaultGatherer
+	}
+
+	name, value := tenantLabel, namespace()
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := prometheus.DefaultGatherer.Gather()
+		for _, family := range families {
+			for _, metric := range family.Metric {
+				metric.Label = append(metric.Label, &dto.LabelPair{Name: &name, Value: &value})
+			}
+		}
+		return families, err
+	})
+}
+
+// Returns whether the REST API request is for this service's tenant (every request is if no tenant is set)
+// The tenant is given in the X-Tenant header, or the tenant query parameter (Ex: /requests/3?tenant=classA)
+func tenantAllowed(r *http.Request) bool {
+	if config.Tenant == "" {
+		return true
+	}
+	tenant := r.Header.Get("X-Tenant")
+	if tenant == "" {
+		tenant = r.URL.Query().Get("tenant")
+	}
+	return tenant == config.Tenant
+}
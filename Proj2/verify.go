@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"proj2/grafana"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Forecast values that are verified (in the configured units)
+type VerifiedValues struct {
+	Temperature float64 `json:"temperature"`
+	Humidity    float64 `json:"humidity"`
+	WindSpeed   float64 `json:"wind_speed"`
+	Cloud       float64 `json:"cloud"`
+}
+
+// Names of the verified values (used as the metric label of the accuracy gauges)
+var verifiedMetrics = []string{"temperature", "humidity", "wind_speed", "cloud_percent"}
+
+// Returns the values in the same order as verifiedMetrics
+func (v VerifiedValues) list() []float64 {
+	return []float64{v.Temperature, v.Humidity, v.WindSpeed, v.Cloud}
+}
+
+// Observed weather at a location at the given time (Unix seconds)
+type Observation struct {
+	Time   int64          `json:"time"`
+	Values VerifiedValues `json:"values"`
+}
+
+// Everything the verification remembers about a location between runs
+type VerifiedLocation struct {
+	Lat float32 `json:"lat"`
+	Lon float32 `json:"lon"`
+
+	// Offset of the location's time zone from UTC in seconds (forecast dates are the location's calendar days)
+	Zone int `json:"zone"`
+
+	// Newest forecast for every date that hasn't passed yet, observations taken since the oldest of them,
+	// and the absolute error of every date that was verified
+	Forecasts    map[string]VerifiedValues `json:"forecasts"`
+	Observations []Observation             `json:"observations"`
+	Errors       map[string]VerifiedValues `json:"errors"`
+}
+
+// Forecasts and observations of every location, saved to verification.path between runs
+type VerificationLedger struct {
+	Units     string                       `json:"units"`
+	Locations map[string]*VerifiedLocation `json:"locations"`
+}
+
+// Most verified dates kept for each location (the mean absolute error is over these)
+const maxVerifiedDates = 30
+
+// Response from the Current Weather API
+type CurrentWeatherResponse struct {
+	Cod     any           `json:"cod"`
+	Time    int64         `json:"dt"`
+	Main    MainResponse  `json:"main"`
+	Wind    WindResponse  `json:"wind"`
+	Clouds  CloudResponse `json:"clouds"`
+	Message any           `json:"message"`
+}
+
+var (
+	// Forecasts published during this run, added to the ledger once the run is over
+	verifyMu        sync.Mutex
+	pendingVerifies = make(map[string]*VerifiedLocation)
+
+	// Mean absolute error of each location's forecasts, by metric
+	forecastMAEGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_mae",
+			Help: "Mean absolute error of the location's verified forecasts, by metric (in the configured units)",
+		},
+		[]string{"location", "metric"},
+	)
+
+	// How many dates the mean absolute error is over
+	forecastVerifiedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "forecast_verified_dates",
+			Help: "Number of forecast dates that were compared to the observed weather",
+		},
+		[]string{"location"},
+	)
+)
+
+func init() {
+	safeRegister(forecastMAEGauge, "forecast_mae")
+	safeRegister(forecastVerifiedGauge, "forecast_verified_dates")
+}
+
+// Adds the accuracy panel to every location dashboard (if verification is on)
+func loadVerification() {
+	if !config.Verification.Enabled {
+		return
+	}
+	grafana.RegisterPanel(grafana.Panel{
+		Type:   grafana.TypeTimeSeries,
+		Title:  "Forecast Error (MAE)",
+		Expr:   `forecast_mae{` + grafana.TenantMatcher + `, location="$location"}`,
+		Legend: "{{metric}}",
+		Unit:   "none",
+	})
+}
+
+// Remembers a published forecast sample, so it can be compared to the observed weather once its date has passed
+func recordForecast(zip string, lat, lon float32, zone int, date string, values VerifiedValues) {
+	if !config.Verification.Enabled {
+		return
+	}
+
+	verifyMu.Lock()
+	defer verifyMu.Unlock()
+	location, exists := pendingVerifies[zip]
+	if !exists {
+		location = &VerifiedLocation{Forecasts: make(map[string]VerifiedValues)}
+		pendingVerifies[zip] = location
+	}
+	location.Lat, location.Lon, location.Zone = lat, lon, zone
+	location.Forecasts[date] = values
+}
+
+// Reads the ledger (a missing file is an empty ledger)
+func loadVerificationLedger() (*VerificationLedger, error) {
+	ledger := &VerificationLedger{Units: config.Units, Locations: make(map[string]*VerifiedLocation)}
+
+	data, err := os.ReadFile(config.Verification.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, ledger); err != nil {
+		return nil, err
+	}
+
+	// Errors in different units can't be averaged together, so the ledger starts over
+	if ledger.Units != config.Units {
+		fmt.Printf("Forecast verification was in %s units and is now in %s units, so its history is cleared\n", ledger.Units, config.Units)
+		ledger = &VerificationLedger{Units: config.Units, Locations: make(map[string]*VerifiedLocation)}
+	}
+	return ledger, nil
+}
+
+// Compares the forecasts of dates that have passed to the weather observed during them
+// The free API only has the current weather, so every run observes each location once, and dates are verified by later runs
+// A date that was never observed can't be verified, so it is dropped
+func verifyForecasts() {
+	if !config.Verification.Enabled {
+		return
+	}
+
+	ledger, err := loadVerificationLedger()
+	if err != nil {
+		fmt.Println("Error reading the forecast verification:", err)
+		return
+	}
+
+	// Add this run's forecasts (a newer forecast for a date replaces the older one)
+	verifyMu.Lock()
+	for zip, pending := range pendingVerifies {
+		location, exists := ledger.Locations[zip]
+		if !exists {
+			location = &VerifiedLocation{Forecasts: make(map[string]VerifiedValues), Errors: make(map[string]VerifiedValues)}
+			ledger.Locations[zip] = location
+		}
+		location.Lat, location.Lon, location.Zone = pending.Lat, pending.Lon, pending.Zone
+		for date, values := range pending.Forecasts {
+			location.Forecasts[date] = values
+		}
+	}
+	verifyMu.Unlock()
+
+	fmt.Println("\n--- FORECAST ACCURACY ---")
+	zips := make([]string, 0, len(ledger.Locations))
+	for zip := range ledger.Locations {
+		zips = append(zips, zip)
+	}
+	slices.Sort(zips)
+
+	now := time.Now()
+	for _, zip := range zips {
+		location := ledger.Locations[zip]
+		if location.Errors == nil {
+			location.Errors = make(map[string]VerifiedValues)
+		}
+
+		// Observe the weather now (only needed while the location still has forecasts to verify)
+		if len(location.Forecasts) > 0 {
+			observation, err := observeWeather(location.Lat, location.Lon)
+			if err != nil {
+				pipelineErrors.WithLabelValues("observation").Inc()
+				fmt.Printf("Could not observe the weather for ZIP %s: %s\n", zip, err)
+			} else {
+				location.Observations = append(location.Observations, observation)
+			}
+		}
+
+		verified, dropped := location.verify(now)
+		mae, dates := location.meanAbsoluteError()
+		for i, metric := range verifiedMetrics {
+			if dates > 0 {
+				forecastMAEGauge.WithLabelValues(zip, metric).Set(mae[i])
+			}
+		}
+		forecastVerifiedGauge.WithLabelValues(zip).Set(float64(dates))
+
+		if dates == 0 {
+			fmt.Printf("ZIP %s: no dates verified yet (%d forecasts waiting, %d dropped without an observation)\n", zip, len(location.Forecasts), dropped)
+			continue
+		}
+		fmt.Printf("ZIP %s: MAE over %d dates: temperature %.1f%s, humidity %.1f%%, wind %.1f %s, clouds %.1f%% (%d new, %d dropped without an observation)\n",
+			zip, dates, mae[0], tempUnit(), mae[1], mae[2], speedUnit(), mae[3], verified, dropped)
+	}
+
+	data, _ := json.MarshalIndent(ledger, "", "  ")
+	if err := os.WriteFile(config.Verification.Path, data, 0644); err != nil {
+		fmt.Println("Error writing the forecast verification:", err)
+	}
+}
+
+// Gets the current weather at the coordinates
+func observeWeather(lat, lon float32) (Observation, error) {
+	var results CurrentWeatherResponse
+	err := getJSON("observation", func(key string) string {
+		return fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?lat=%f&lon=%f&units=%s&appid=%s", lat, lon, config.Units, key)
+	}, &results)
+	if err != nil {
+		return Observation{}, err
+	}
+
+	return Observation{
+		Time: results.Time,
+		Values: VerifiedValues{
+			Temperature: float64(results.Main.Temp),
+			Humidity:    float64(results.Main.Humidity),
+			WindSpeed:   float64(results.Wind.Speed),
+			Cloud:       float64(results.Clouds.All),
+		},
+	}, nil
+}
+
+// Verifies every forecast whose date has passed against the average of the observations taken during it
+// Returns how many dates were verified, and how many were dropped since nothing was observed during them
+func (l *VerifiedLocation) verify(now time.Time) (verified, dropped int) {
+	zone := time.FixedZone("", l.Zone)
+	oldest := now
+
+	for date, forecast := range l.Forecasts {
+		start, end, ok := dateWindow(date, zone)
+		if !ok {
+			delete(l.Forecasts, date)
+			continue
+		}
+		if now.Before(end) {
+			if start.Before(oldest) {
+				oldest = start
+			}
+			continue
+		}
+
+		var sum VerifiedValues
+		count := 0
+		for _, o := range l.Observations {
+			t := time.Unix(o.Time, 0)
+			if !t.Before(start) && t.Before(end) {
+				sum.Temperature += o.Values.Temperature
+				sum.Humidity += o.Values.Humidity
+				sum.WindSpeed += o.Values.WindSpeed
+				sum.Cloud += o.Values.Cloud
+				count++
+			}
+		}
+		delete(l.Forecasts, date)
+		if count == 0 {
+			dropped++
+			continue
+		}
+
+		n := float64(count)
+		l.Errors[date] = VerifiedValues{
+			Temperature: math.Abs(forecast.Temperature - sum.Temperature/n),
+			Humidity:    math.Abs(forecast.Humidity - sum.Humidity/n),
+			WindSpeed:   math.Abs(forecast.WindSpeed - sum.WindSpeed/n),
+			Cloud:       math.Abs(forecast.Cloud - sum.Cloud/n),
+		}
+		verified++
+	}
+
+	// Observations from before every remaining forecast's date won't be needed again
+	l.Observations = slices.DeleteFunc(l.Observations, func(o Observation) bool {
+		return time.Unix(o.Time, 0).Before(oldest)
+	})
+
+	// Only the newest dates count toward the error (dates sort chronologically)
+	if len(l.Errors) > maxVerifiedDates {
+		dates := make([]string, 0, len(l.Errors))
+		for date := range l.Errors {
+			dates = append(dates, date)
+		}
+		slices.Sort(dates)
+		for _, date := range dates[:len(dates)-maxVerifiedDates] {
+			delete(l.Errors, date)
+		}
+	}
+	return verified, dropped
+}
+
+// Returns the mean absolute error of every verified metric (in the order of verifiedMetrics), and how many dates it is over
+func (l *VerifiedLocation) meanAbsoluteError() ([]float64, int) {
+	mae := make([]float64, len(verifiedMetrics))
+	for _, errs := range l.Errors {
+		for i, value := range errs.list() {
+			mae[i] += value
+		}
+	}
+	if len(l.Errors) == 0 {
+		return mae, 0
+	}
+	for i := range mae {
+		mae[i] /= float64(len(l.Errors))
+	}
+	return mae, len(l.Errors)
+}
+
+// Returns when the forecast date starts and ends in the location's time zone
+// A date with an hour (YYYY-MM-DDTHH) lasts one resolution, and a date without one lasts the whole day
+func dateWindow(date string, zone *time.Location) (time.Time, time.Time, bool) {
+	if start, err := time.ParseInLocation("2006-01-02T15", date, zone); err == nil {
+		return start, start.Add(time.Duration(config.Resolution) * time.Hour), true
+	}
+	start, err := time.ParseInLocation("2006-01-02", date, zone)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, start.AddDate(0, 0, 1), true
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Bundled ZIP code database (the 3-digit ZIP prefixes of every state)
+//
+//go:embed zipprefixes.txt
+var zipPrefixData string
+
+var (
+	// State of each 3-digit ZIP prefix, and the prefixes of each state (loaded from the bundled database)
+	prefixStates  = make(map[string]string)
+	statePrefixes = make(map[string][]string)
+
+	// Group label of each ZIP code that came from a state or range request (ZIP codes requested on their own have none)
+	zipGroupsMu sync.Mutex
+	zipGroups   = make(map[string]string)
+)
+
+// Ran before main()
+func init() {
+	for line := range strings.SplitSeq(zipPrefixData, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		state := fields[0]
+
+		// Prefixes are listed as single values or ranges (Ex: 850,852-853)
+		for part := range strings.SplitSeq(fields[1], ",") {
+			first, last, isRange := strings.Cut(part, "-")
+			if !isRange {
+				last = first
+			}
+			start, _ := strconv.Atoi(first)
+			end, _ := strconv.Atoi(last)
+			for p := start; p <= end; p++ {
+				prefix := fmt.Sprintf("%03d", p)
+				prefixStates[prefix] = state
+				statePrefixes[state] = append(statePrefixes[state], prefix)
+			}
+		}
+	}
+}
+
+// Expands the location of a line into the ZIP codes it stands for, and the group they share
+//   - "state:NJ" is one ZIP code per 3-digit prefix of the state (the xxx01 ZIP code of each sectional center, usually its main post office),
+//     so a state gets a spread of locations without thousands of API calls
+//   - "07001-07010" is every ZIP code in the range that has a known prefix
+//   - Anything else is a single ZIP code, with no group
+//
+// Returns an error if the state is unknown, the range is invalid, or it expands to more than max_expansion ZIP codes
+func expandZips(location string) ([]string, string, error) {
+	if state, isState := strings.CutPrefix(strings.ToLower(location), "state:"); isState {
+		state = strings.ToUpper(strings.TrimSpace(state))
+		prefixes, known := statePrefixes[state]
+		if !known {
+			return nil, "", fmt.Errorf("unknown state '%s' (use a two letter code, Ex: state:NJ)", state)
+		}
+
+		zips := make([]string, len(prefixes))
+		for i, prefix := range prefixes {
+			zips[i] = prefix + "01"
+		}
+		if len(zips) > config.MaxExpansion {
+			return nil, "", fmt.Errorf("state:%s expands to %d ZIP codes, more than max_expansion (MAX_EXPANSION) of %d", state, len(zips), config.MaxExpansion)
+		}
+		return zips, state, nil
+	}
+
+	first, last, isRange := strings.Cut(location, "-")
+	if !isRange {
+		return []string{location}, "", nil
+	}
+
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+	start, errStart := strconv.Atoi(first)
+	end, errEnd := strconv.Atoi(last)
+	if errStart != nil || errEnd != nil || len(first) != 5 || len(last) != 5 || start > end {
+		return nil, "", fmt.Errorf("ZIP code range '%s' must be two 5-digit ZIP codes, lowest first (Ex: 07001-07010)", location)
+	}
+	if end-start+1 > config.MaxExpansion {
+		return nil, "", fmt.Errorf("ZIP code range '%s' has %d ZIP codes, more than max_expansion (MAX_EXPANSION) of %d", location, end-start+1, config.MaxExpansion)
+	}
+
+	zips := []string{}
+	for z := start; z <= end; z++ {
+		zip := fmt.Sprintf("%05d", z)
+		if _, known := prefixStates[zip[:3]]; known {
+			zips = append(zips, zip)
+		}
+	}
+	if len(zips) == 0 {
+		return nil, "", fmt.Errorf("ZIP code range '%s' has no ZIP codes in the bundled ZIP database", location)
+	}
+	return zips, first + "-" + last, nil
+}
+
+// Remembers the group of the ZIP code, and publishes it on the location group gauge for the group dashboards
+// A ZIP code in several groups keeps the last one
+func recordZipGroup(zip, group string) {
+	zipGroupsMu.Lock()
+	defer zipGroupsMu.Unlock()
+	zipGroups[zip] = group
+
+	locationGroupGauge.DeletePartialMatch(prometheus.Labels{"location": zip})
+	locationGroupGauge.WithLabelValues(zip, group).Set(1)
+}
+
+// Returns the group of the ZIP code (empty if it was requested on its own)
+func zipGroup(zip string) string {
+	zipGroupsMu.Lock()
+	defer zipGroupsMu.Unlock()
+	return zipGroups[zip]
+}
+
+// Returns every group requested in this run (sorted)
+func requestedGroups() []string {
+	zipGroupsMu.Lock()
+	defer zipGroupsMu.Unlock()
+
+	seen := make(map[string]bool)
+	groups := []string{}
+	for _, group := range zipGroups {
+		if group != "" && !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
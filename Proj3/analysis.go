@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Whether each debater's style is measured and compared after the debate (on unless STYLE_REPORT=false)
+var styleReportEnabled = os.Getenv("STYLE_REPORT") != "false"
+
+// How one debater argued over the whole debate
+type StyleStats struct {
+	Speaker int    `json:"speaker"`
+	Persona string `json:"persona"`
+	Turns   int    `json:"turns"`
+
+	// Average number of words in each sentence
+	AvgSentenceWords float64 `json:"avg_sentence_words"`
+
+	// Distinct words divided by total words (closer to 1 is a richer vocabulary)
+	VocabularyRichness float64 `json:"vocabulary_richness"`
+
+	// Sentiment of each turn in order, from -1 (negative) to 1 (positive)
+	Sentiment []float64 `json:"sentiment"`
+
+	// Number of questions asked
+	Questions int `json:"questions"`
+}
+
+// Words that make a turn sound positive
+var positiveWords = map[string]struct{}{
+	"agree": {}, "benefit": {}, "best": {}, "better": {}, "compassion": {}, "correct": {}, "fair": {},
+	"faith": {}, "good": {}, "great": {}, "grace": {}, "healthy": {}, "helpful": {}, "hope": {},
+	"important": {}, "joy": {}, "kind": {}, "love": {}, "peace": {}, "respect": {}, "right": {},
+	"strong": {}, "support": {}, "true": {}, "trust": {}, "valid": {}, "valuable": {}, "wisdom": {},
+}
+
+// Words that make a turn sound negative
+var negativeWords = map[string]struct{}{
+	"absurd": {}, "bad": {}, "danger": {}, "dangerous": {}, "disagree": {}, "false": {}, "fear": {},
+	"flawed": {}, "harm": {}, "harmful": {}, "hate": {}, "ignorant": {}, "illogical": {}, "impure": {},
+	"misguided": {}, "mistake": {}, "nonsense": {}, "poor": {}, "reject": {}, "sin": {}, "unclean": {},
+	"unfair": {}, "unhealthy": {}, "weak": {}, "wrong": {},
+}
+
+// Measures the style of both debaters from their turns
+func analyzeStyles(turns []Turn) [2]StyleStats {
+	var stats [2]StyleStats
+	var sentences, words [2]int
+	var vocabulary [2]map[string]struct{}
+
+	for speaker := range stats {
+		stats[speaker].Speaker = speaker
+		vocabulary[speaker] = map[string]struct{}{}
+	}
+
+	for _, turn := range turns {
+		s := &stats[turn.Speaker]
+		s.Persona = turn.Persona
+		s.Turns++
+		s.Questions += strings.Count(turn.Content, "?")
+		sentences[turn.Speaker] += countSentences(turn.Content)
+
+		turnWords := styleWords(turn.Content)
+		words[turn.Speaker] += len(turnWords)
+		for _, word := range turnWords {
+			vocabulary[turn.Speaker][word] = struct{}{}
+		}
+		s.Sentiment = append(s.Sentiment, sentimentScore(turnWords))
+	}
+
+	for speaker := range stats {
+		if sentences[speaker] > 0 {
+			stats[speaker].AvgSentenceWords = float64(words[speaker]) / float64(sentences[speaker])
+		}
+		if words[speaker] > 0 {
+			stats[speaker].VocabularyRichness = float64(len(vocabulary[speaker])) / float64(words[speaker])
+		}
+	}
+	return stats
+}
+
+// Splits a turn into lowercase words, without punctuation
+func styleWords(content string) []string {
+	return strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+// Counts the sentences of a turn (text without an ending punctuation mark still counts as one)
+func countSentences(content string) int {
+	count := 0
+	for sentence := range strings.FieldsFuncSeq(content, func(r rune) bool { return r == '.' || r == '!' || r == '?' }) {
+		if strings.TrimSpace(sentence) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// Scores a turn from -1 (only negative words) to 1 (only positive words), 0 if it has neither
+func sentimentScore(words []string) float64 {
+	var positive, negative int
+	for _, word := range words {
+		if _, ok := positiveWords[word]; ok {
+			positive++
+		}
+		if _, ok := negativeWords[word]; ok {
+			negative++
+		}
+	}
+	if positive+negative == 0 {
+		return 0
+	}
+	return float64(positive-negative) / float64(positive+negative)
+}
+
+// Describes how a debater's sentiment changed from their first turn to their last
+func sentimentTrend(scores []float64) string {
+	if len(scores) < 2 {
+		return "steady"
+	}
+
+	// Compare the average of the first half of the turns to the second half, so one outlier turn doesn't decide it
+	half := len(scores) / 2
+	change := average(scores[len(scores)-half:]) - average(scores[:half])
+	switch {
+	case change > 0.2:
+		return "warmer"
+	case change < -0.2:
+		return "colder"
+	default:
+		return "steady"
+	}
+}
+
+// Returns the average of the values (0 if there are none)
+func average(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// Prints both debaters' styles side by side
+func printStyleReport(stats [2]StyleStats) {
+	header := func(s StyleStats) string { return fmt.Sprintf("LLM %d (%s)", s.Speaker, s.Persona) }
+	row := func(label, zero, one string) {
+		fmt.Fprintf(console, "\n%-22s %-24s %-24s", label, zero, one)
+	}
+
+	fmt.Fprintf(console, "\n\n--- DEBATER STYLE ---")
+	row("", header(stats[0]), header(stats[1]))
+	row("Turns", fmt.Sprint(stats[0].Turns), fmt.Sprint(stats[1].Turns))
+	row("Avg sentence (words)", fmt.Sprintf("%.1f", stats[0].AvgSentenceWords), fmt.Sprintf("%.1f", stats[1].AvgSentenceWords))
+	row("Vocabulary richness", fmt.Sprintf("%.2f", stats[0].VocabularyRichness), fmt.Sprintf("%.2f", stats[1].VocabularyRichness))
+	row("Sentiment (avg)", fmt.Sprintf("%+.2f", average(stats[0].Sentiment)), fmt.Sprintf("%+.2f", average(stats[1].Sentiment)))
+	row("Sentiment trend", sentimentTrend(stats[0].Sentiment), sentimentTrend(stats[1].Sentiment))
+	row("Questions asked", fmt.Sprint(stats[0].Questions), fmt.Sprint(stats[1].Questions))
+	fmt.Fprintln(console)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// How many candidate responses each debater generates per turn (1 means no branching)
+	branchFactor int
+
+	// Model that picks the strongest candidate (defaults to MODEL)
+	selectorModel = os.Getenv("SELECTOR_MODEL")
+
+	// Whether the candidates that were not picked are saved to the transcript
+	saveBranches = os.Getenv("SAVE_BRANCHES") == "true"
+)
+
+// Loads the branching settings from the environment variables
+func loadBranching() {
+	var err error
+
+	branchFactor, err = strconv.Atoi(os.Getenv("BRANCH_FACTOR"))
+	if err != nil || branchFactor < 1 {
+		branchFactor = 1
+	}
+
+	if selectorModel == "" {
+		selectorModel = model
+	}
+}
+
+// Generates the response for a turn
+// With branching, several candidates are generated and the selector model picks the strongest
+// Candidates are generated at the debater's temperature (shortening them uses the server's default)
+// Returns the chosen response, the candidates that were not chosen, and the completion tokens used for every candidate
+func generateTurn(modelName string, temperature float64, history []ChatMessage, words int) (string, []string, int) {
+
+	// Generate each candidate, making sure it respects the word/sentence limits
+	candidates := make([]string, branchFactor)
+	tokens := 0
+	for i := range candidates {
+		response, used := sendRequestTemperature(modelName, history, temperature)
+		var retryTokens int
+		candidates[i], retryTokens = enforceBudget(modelName, history, response, words)
+		tokens += used + retryTokens
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0], nil, tokens
+	}
+
+	chosen := selectCandidate(history, candidates)
+
+	// Everything that was not chosen is an alternative branch
+	alternatives := []string{}
+	for i, candidate := range candidates {
+		if i != chosen {
+			alternatives = append(alternatives, candidate)
+		}
+	}
+
+	return candidates[chosen], alternatives, tokens
+}
+
+// Asks the selector model which candidate is the strongest, returning its index
+// Falls back to the first candidate if the selector's answer can't be understood
+func selectCandidate(history []ChatMessage, candidates []string) int {
+
+	// Number every candidate so the selector can answer with just a number
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The debater was asked: \"%s\". Candidate responses:", history[len(history)-1].Content)
+	for i, candidate := range candidates {
+		fmt.Fprintf(&sb, " [%d] %s", i+1, candidate)
+	}
+	fmt.Fprintf(&sb, " Reply with only the number of the strongest, most persuasive candidate.")
+
+	selection := sendRequestTo(selectorModel, []ChatMessage{
+		{
+			Role:    "system",
+			Content: "You are an impartial debate coach who selects the strongest argument.",
+		},
+		{
+			Role:    "user",
+			Content: sb.String(),
+		},
+	})
+
+	// Use the first number found in the selector's answer
+	for _, field := range strings.FieldsFunc(selection, func(r rune) bool { return r < '0' || r > '9' }) {
+		choice, err := strconv.Atoi(field)
+		if err == nil && choice >= 1 && choice <= len(candidates) {
+			return choice - 1
+		}
+	}
+
+	return 0
+}
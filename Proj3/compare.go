@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Model comparison settings (loaded from environment variables in loadComparison)
+var (
+	// Two models that debate each other with the same persona (Ex: COMPARE_MODELS="ai/smollm2,ai/llama3.2")
+	compareModels  [2]string
+	compareEnabled bool
+
+	// Where the comparison gets saved at the end of the debate
+	comparisonFile = os.Getenv("COMPARISON_FILE")
+)
+
+// Finds each criteria's score in the judge's reply (Ex: "COHERENCE: 7 NOVELTY: 5")
+var (
+	coherencePattern = regexp.MustCompile(`(?i)coherence\s*[:=]?\s*(\d+)`)
+	noveltyPattern   = regexp.MustCompile(`(?i)novelty\s*[:=]?\s*(\d+)`)
+)
+
+// Scores of a single turn in a model comparison
+type TurnScore struct {
+	Round       int    `json:"round"`
+	Speaker     int    `json:"speaker"`
+	Model       string `json:"model"`
+	Coherence   int    `json:"coherence"`
+	Novelty     int    `json:"novelty"`
+	Words       int    `json:"words"`
+	WordLimit   int    `json:"word_limit"`
+	WithinLimit bool   `json:"within_limit"`
+}
+
+// Averages of every turn of one model (coherence and novelty are 1 to 10, adherence is the percent of turns within the word limit)
+type ModelSummary struct {
+	Model     string  `json:"model"`
+	Turns     int     `json:"turns"`
+	Coherence float64 `json:"coherence"`
+	Novelty   float64 `json:"novelty"`
+	Adherence float64 `json:"adherence_percent"`
+	AvgWords  float64 `json:"avg_words"`
+	Overall   float64 `json:"overall"`
+}
+
+// Result of a model comparison
+type Comparison struct {
+	Topic      string          `json:"topic"`
+	Persona    string          `json:"persona"`
+	JudgeModel string          `json:"judge_model"`
+	Models     [2]ModelSummary `json:"models"`
+	Winner     string          `json:"winner"`
+	Turns      []TurnScore     `json:"turns"`
+}
+
+// Loads the model comparison settings from the environment variables
+// Comparison mode is only turned on if two different models are given
+func loadComparison() {
+	models := strings.Split(os.Getenv("COMPARE_MODELS"), ",")
+	if len(models) == 2 && strings.TrimSpace(models[0]) != "" && strings.TrimSpace(models[1]) != "" &&
+		strings.TrimSpace(models[0]) != strings.TrimSpace(models[1]) {
+		compareModels = [2]string{strings.TrimSpace(models[0]), strings.TrimSpace(models[1])}
+		compareEnabled = true
+	}
+
+	if comparisonFile == "" {
+		comparisonFile = "comparison.json"
+	}
+}
+
+// Plugin that scores every turn on coherence, novelty, and adherence to the word limit (so it should be registered after moderation)
+type ModelComparison struct {
+	Scores []TurnScore
+
+	// Every earlier response of each debater, used to judge novelty
+	previous [2][]string
+}
+
+func (c *ModelComparison) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		coherence, novelty := c.judge(turn, c.previous[turn.Speaker])
+		c.previous[turn.Speaker] = append(c.previous[turn.Speaker], turn.Response)
+
+		words := countWords(turn.Response)
+		c.Scores = append(c.Scores, TurnScore{
+			Round:       turn.Round,
+			Speaker:     turn.Speaker,
+			Model:       turn.Model,
+			Coherence:   coherence,
+			Novelty:     novelty,
+			Words:       words,
+			WordLimit:   turn.Words,
+			WithinLimit: words <= turn.Words,
+		})
+	})
+}
+
+// Asks the judge model to score the turn's coherence and novelty (compared to the debater's earlier turns)
+// Either score defaults to 5 if the reply doesn't contain it
+func (c *ModelComparison) judge(turn *TurnContext, previous []string) (int, int) {
+	earlier := "none"
+	if len(previous) > 0 {
+		earlier = "\"" + strings.Join(previous, "\" \"") + "\""
+	}
+
+	reply := sendRequestTo(judgeModel, []ChatMessage{
+		{
+			Role: "system",
+			Content: "You are an impartial judge evaluating a debater. Score COHERENCE (clear, logical, and on-topic) and " +
+				"NOVELTY (makes points the debater has not made before) from 1 (worst) to 10 (best). " +
+				"Reply with only 'COHERENCE: N NOVELTY: N'.",
+		},
+		{
+			Role: "user",
+			Content: fmt.Sprintf("Topic: %s. The debater's earlier statements: %s. New statement (%s phase): \"%s\"",
+				topic, earlier, turn.Phase, turn.Response),
+		},
+	})
+
+	return parseCriteria(coherencePattern, reply), parseCriteria(noveltyPattern, reply)
+}
+
+// Returns the score matched by the pattern (from 1 to 10), or 5 if there is none
+func parseCriteria(pattern *regexp.Regexp, reply string) int {
+	match := pattern.FindStringSubmatch(reply)
+	if match == nil {
+		return 5
+	}
+	score, _ := strconv.Atoi(match[1])
+	return min(max(score, 1), 10)
+}
+
+// Builds the comparison of both models from every scored turn
+// The overall score is the average of coherence, novelty, and adherence (scaled to 10)
+func (c *ModelComparison) result(persona string) Comparison {
+	result := Comparison{Topic: topic, Persona: persona, JudgeModel: judgeModel, Turns: c.Scores}
+
+	for id := range 2 {
+		summary := ModelSummary{Model: compareModels[id]}
+		var coherence, novelty, within, words int
+		for _, s := range c.Scores {
+			if s.Speaker != id {
+				continue
+			}
+			summary.Turns++
+			coherence += s.Coherence
+			novelty += s.Novelty
+			words += s.Words
+			if s.WithinLimit {
+				within++
+			}
+		}
+
+		if summary.Turns > 0 {
+			turns := float64(summary.Turns)
+			summary.Coherence = float64(coherence) / turns
+			summary.Novelty = float64(novelty) / turns
+			summary.Adherence = float64(within) / turns * 100
+			summary.AvgWords = float64(words) / turns
+			summary.Overall = (summary.Coherence + summary.Novelty + summary.Adherence/10) / 3
+		}
+		result.Models[id] = summary
+	}
+
+	switch {
+	case result.Models[0].Overall > result.Models[1].Overall:
+		result.Winner = result.Models[0].Model
+	case result.Models[1].Overall > result.Models[0].Overall:
+		result.Winner = result.Models[1].Model
+	default:
+		result.Winner = "tie"
+	}
+	return result
+}
+
+// Prints the comparison as a table
+func (r Comparison) print() {
+	fmt.Fprintf(console, "\n\n--- MODEL COMPARISON (%s perspective, judged by %s) ---", r.Persona, r.JudgeModel)
+	fmt.Fprintf(console, "\n%-30s %9s %9s %10s %9s %9s", "MODEL", "COHERENCE", "NOVELTY", "ADHERENCE", "AVG WORDS", "OVERALL")
+	for _, m := range r.Models {
+		fmt.Fprintf(console, "\n%-30s %9.1f %9.1f %9.0f%% %9.1f %9.2f", m.Model, m.Coherence, m.Novelty, m.Adherence, m.AvgWords, m.Overall)
+	}
+	fmt.Fprintf(console, "\nWINNER: %s\n", r.Winner)
+}
+
+// Returns the verdict shown in the closing banner
+func (r Comparison) verdict() string {
+	if r.Winner == "tie" {
+		return fmt.Sprintf("%s and %s tied", r.Models[0].Model, r.Models[1].Model)
+	}
+	return fmt.Sprintf("%s argued better", r.Winner)
+}
+
+// Writes the comparison as JSON to the given file
+func (r Comparison) save(path string) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	check(err)
+
+	err = os.WriteFile(path, data, 0644)
+	check(err)
+
+	fmt.Fprintf(console, "\nModel comparison saved to %s\n", path)
+}
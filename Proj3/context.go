@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Size of the model's context window in tokens
+	contextLimit int
+
+	// Tokens kept free in the context window for the model's reply
+	responseReserve int
+
+	// Whether an over-long opponent statement is summarized by the model (instead of just truncated)
+	summarizeOverflow = os.Getenv("SUMMARIZE_OVERFLOW") == "true"
+)
+
+// Loads the context window settings from the environment variables
+// If they are not valid, use default values
+func loadContextLimits() {
+	var err error
+
+	contextLimit, err = strconv.Atoi(os.Getenv("CONTEXT_LIMIT"))
+	if err != nil || contextLimit <= 0 {
+		contextLimit = 4096
+	}
+
+	responseReserve, err = strconv.Atoi(os.Getenv("RESPONSE_TOKENS"))
+	if err != nil || responseReserve < 0 || responseReserve >= contextLimit {
+		responseReserve = min(256, contextLimit/4)
+	}
+}
+
+// Smallest excerpt of the opponent statement that is kept, even if it doesn't fit (without it, the debater has nothing to answer)
+const minOpponentTokens = 32
+
+// Roughly estimates the amount of tokens in the text (about 4 characters per token for English)
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Makes sure the prompt fits in the context window by shortening the quoted opponent statement
+// buildPrompt creates the user prompt from the opponent statement, so it can be rebuilt after shortening
+// Returns the opponent statement to use (unchanged if everything fits)
+func fitOpponentMessage(system, opponent string, buildPrompt func(string) string) string {
+	total := estimateTokens(system) + estimateTokens(buildPrompt(opponent)) + responseReserve
+	if total <= contextLimit {
+		return opponent
+	}
+
+	// How many tokens are left for the opponent statement once everything else is included
+	available := contextLimit - responseReserve - estimateTokens(system) - estimateTokens(buildPrompt(""))
+	if available < minOpponentTokens {
+		fmt.Fprintf(console, "\n(Prompt is about %d tokens, over the %d token limit, and only about %d tokens are left for the opponent statement. "+
+			"Keeping a %d token excerpt of it anyway, so the prompt is still over the limit.)",
+			total, contextLimit, max(available, 0), minOpponentTokens)
+		available = minOpponentTokens
+	} else {
+		fmt.Fprintf(console, "\n(Prompt is about %d tokens, over the %d token limit. Shortening opponent statement to %d tokens.)",
+			total, contextLimit, available)
+	}
+	if estimateTokens(opponent) <= available {
+		return opponent
+	}
+
+	// Ask the model for a summary that fits, falling back to truncation if the summary is still too long
+	if summarizeOverflow {
+		summary := sendRequest([]ChatMessage{
+			{
+				Role:    "system",
+				Content: "You summarize debate statements faithfully, keeping every main point.",
+			},
+			{
+				Role:    "user",
+				Content: fmt.Sprintf("Summarize this in at most %d words: %s", available*3/4, opponent),
+			},
+		})
+		if estimateTokens(summary) <= available {
+			return summary
+		}
+		opponent = summary
+	}
+
+	return truncateToTokens(opponent, available)
+}
+
+// Cuts the text at a word boundary so it fits in the given amount of tokens
+// Text that already fits is returned as it is, so the "..." only marks text that was actually cut
+func truncateToTokens(text string, tokens int) string {
+	if estimateTokens(text) <= tokens {
+		return text
+	}
+
+	var sb strings.Builder
+
+	for _, word := range strings.Fields(text) {
+		// Leave room for the "..." that marks the cut
+		if estimateTokens(sb.String()+" "+word+"...") > tokens {
+			break
+		}
+		if sb.Len() > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(word)
+	}
+
+	return sb.String() + "..."
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// Convergence check settings (loaded from environment variables in loadConvergence)
+var (
+	// Whether the debate skips to its closing once it stops producing new points (CONVERGENCE_CHECK=true)
+	convergenceEnabled = os.Getenv("CONVERGENCE_CHECK") == "true"
+
+	// Cosine similarity to one of the debater's earlier turns above which a turn has no new points (0 to 1)
+	convergenceThreshold float64
+
+	// Number of rounds in a row the judge's scores have to stay within a point of each other to count as a plateau (needs JUDGE=true)
+	convergenceRounds int
+)
+
+// Loads the convergence check settings from the environment variables
+// If they are not valid, use default values
+func loadConvergence() {
+	var err error
+
+	convergenceThreshold, err = strconv.ParseFloat(os.Getenv("CONVERGENCE_THRESHOLD"), 64)
+	if err != nil || convergenceThreshold <= 0 || convergenceThreshold > 1 {
+		convergenceThreshold = 0.92
+	}
+
+	convergenceRounds, err = strconv.Atoi(os.Getenv("CONVERGENCE_ROUNDS"))
+	if err != nil || convergenceRounds < 2 {
+		convergenceRounds = 3
+	}
+}
+
+// Plugin that ends the debate early once it has converged, skipping to the closing round
+// The debate has converged when both debaters' last two turns are highly similar to their own earlier turns (no new points),
+// or when the judge's scores of both debaters have plateaued
+type ConvergenceCheck struct {
+	// Why the debate ended early (empty if every round ran)
+	Reason string
+
+	// Judge whose scores are checked for a plateau (nil if there is no judge)
+	Judge *Judge
+
+	// Embedding of every turn, and the similarity of each turn to the most similar earlier turn, by debater
+	embeddings   [2][][]float64
+	similarities [2][]float64
+
+	// Set if the embeddings endpoint fails, so only the judge's scores are checked for the rest of the debate
+	disabled bool
+}
+
+// Compares every final response to the debater's earlier turns, then checks for convergence after each round
+// (so it should be registered after moderation)
+func (c *ConvergenceCheck) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		if c.disabled {
+			return
+		}
+
+		embedding, err := embed(turn.Response)
+		if err != nil {
+			fmt.Fprintf(console, "\n(Convergence check on similar turns turned off, the embeddings endpoint failed: %s)", err)
+			c.disabled = true
+			return
+		}
+
+		// The first turn of a debater has nothing of theirs to repeat
+		speaker := turn.Speaker
+		if len(c.embeddings[speaker]) > 0 {
+			best := 0.0
+			for _, earlier := range c.embeddings[speaker] {
+				best = max(best, cosineSimilarity(embedding, earlier))
+			}
+			c.similarities[speaker] = append(c.similarities[speaker], best)
+		}
+		c.embeddings[speaker] = append(c.embeddings[speaker], embedding)
+	})
+
+	e.AfterRound(func(e *DebateEngine, round int, phase Phase) {
+		// Nothing is skipped once the next round is the closing anyway
+		if c.Reason != "" || round >= e.Rounds-1 {
+			return
+		}
+
+		reason := c.repeating()
+		if reason == "" {
+			reason = c.plateau()
+		}
+		if reason == "" {
+			return
+		}
+
+		c.Reason = fmt.Sprintf("ended after round %d of %d: %s", round, e.Rounds, reason)
+		fmt.Fprintf(console, "\n(The debate has converged, %s. Skipping to the closing round.)", reason)
+		e.Stop(c.Reason)
+	})
+}
+
+// Returns why the debaters are repeating themselves (empty if either of them made a new point in their last two turns)
+func (c *ConvergenceCheck) repeating() string {
+	if c.disabled {
+		return ""
+	}
+
+	lowest := 1.0
+	for speaker := range 2 {
+		recent := c.similarities[speaker]
+		if len(recent) < 2 {
+			return ""
+		}
+		for _, similarity := range recent[len(recent)-2:] {
+			if similarity <= convergenceThreshold {
+				return ""
+			}
+			lowest = min(lowest, similarity)
+		}
+	}
+	return fmt.Sprintf("both debaters' last two turns repeat their earlier points (similarity of at least %.2f)", lowest)
+}
+
+// Returns why the judge's scores have plateaued (empty if there is no judge, or a debater's score still moved by more than a point)
+// The judge scores in the background, so only the rounds it has finished scoring for both debaters are compared
+func (c *ConvergenceCheck) plateau() string {
+	if c.Judge == nil {
+		return ""
+	}
+
+	// Score of each debater in every round (steelman turns are scored on a different rubric, so they are left out)
+	byRound := make(map[int]*[2]int)
+	scored := make(map[int]int)
+	for _, s := range c.Judge.scored() {
+		if s.Phase == PhaseSteelman {
+			continue
+		}
+		if byRound[s.Round] == nil {
+			byRound[s.Round] = &[2]int{}
+		}
+		byRound[s.Round][s.Speaker] = s.Score
+		scored[s.Round]++
+	}
+
+	rounds := []int{}
+	for round, count := range scored {
+		if count == 2 {
+			rounds = append(rounds, round)
+		}
+	}
+	slices.Sort(rounds)
+	if len(rounds) < convergenceRounds {
+		return ""
+	}
+	rounds = rounds[len(rounds)-convergenceRounds:]
+
+	for speaker := range 2 {
+		lowest, highest := 10, 1
+		for _, round := range rounds {
+			lowest = min(lowest, byRound[round][speaker])
+			highest = max(highest, byRound[round][speaker])
+		}
+		if highest-lowest > 1 {
+			return ""
+		}
+	}
+	return fmt.Sprintf("the judge's scores of both debaters stayed within a point for %d rounds", convergenceRounds)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ANSI escape codes used to color the output
+const (
+	colorReset   = "\033[0m"
+	colorBold    = "\033[1m"
+	colorDim     = "\033[2m"
+	colorYellow  = "\033[33m"
+	colorCyan    = "\033[36m"
+	colorMagenta = "\033[35m"
+)
+
+// Color of each debater
+var speakerColors = [2]string{colorCyan, colorMagenta}
+
+// Where everything meant for people is printed (stderr when the JSON output goes to stdout, set by loadOutput)
+var console io.Writer = os.Stdout
+
+// Whether output is colored (only when writing to a terminal, and NO_COLOR is not set)
+var colorEnabled = isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+
+// Returns whether the file is a terminal (instead of a pipe or a file)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Wraps the text in the color codes (if colors are enabled)
+func colorize(text string, codes ...string) string {
+	if !colorEnabled || len(codes) == 0 {
+		return text
+	}
+	return strings.Join(codes, "") + text + colorReset
+}
+
+// Prints the header at the start of each round
+func printRoundHeader(round, rounds int, phase Phase) {
+	header := fmt.Sprintf("=== ROUND %d of %d: %s ===", round, rounds, strings.ToUpper(string(phase)))
+	fmt.Fprintf(console, "\n\n%s", colorize(header, colorBold, colorYellow))
+}
+
+// Prints a debater's turn, with their persona and how long the turn took
+func printTurn(speaker int, persona, response string, elapsed time.Duration) {
+	name := colorize(fmt.Sprintf("LLM %d (%s):", speaker, persona), colorBold, speakerColors[speaker])
+	took := colorize(fmt.Sprintf("[%s]", elapsed.Round(100*time.Millisecond)), colorDim)
+	fmt.Fprintf(console, "\n%s %s %s", name, response, took)
+}
+
+// Prints the banner at the end of the debate
+// The verdict is shown if there is one, otherwise only how much each debater said (and why the debate ended early, if it did)
+func printVerdictBanner(personas [2]string, turns []Turn, verdict, stopReason string) {
+	words := [2]int{}
+	for _, turn := range turns {
+		words[turn.Speaker] += countWords(turn.Content)
+	}
+
+	line := strings.Repeat("=", 60)
+	fmt.Fprintf(console, "\n\n%s", colorize(line, colorBold, colorYellow))
+	fmt.Fprintf(console, "\n%s", colorize("DEBATE COMPLETE", colorBold, colorYellow))
+	for id := range 2 {
+		fmt.Fprintf(console, "\n%s %d words", colorize(fmt.Sprintf("LLM %d (%s):", id, personas[id]), colorBold, speakerColors[id]), words[id])
+	}
+	if verdict != "" {
+		fmt.Fprintf(console, "\n%s %s", colorize("VERDICT:", colorBold), verdict)
+	}
+	if stopReason != "" {
+		fmt.Fprintf(console, "\n%s %s", colorize("ENDED EARLY:", colorBold), stopReason)
+	}
+	fmt.Fprintf(console, "\n%s\n", colorize(line, colorBold, colorYellow))
+}
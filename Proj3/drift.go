@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Drift check settings (loaded from environment variables in loadDrift)
+var (
+	// Whether every response is checked for drifting off the topic (DRIFT_CHECK=true)
+	driftEnabled = os.Getenv("DRIFT_CHECK") == "true"
+
+	// Moderator model that checks the responses (defaults to MODEL)
+	driftModel = os.Getenv("DRIFT_MODEL")
+)
+
+// Loads the drift check settings from the environment variables
+func loadDrift() {
+	if driftModel == "" {
+		driftModel = model
+	}
+}
+
+// Response the moderator found to be off the topic
+type DriftEvent struct {
+	Round   int    `json:"round"`
+	Phase   Phase  `json:"phase"`
+	Speaker int    `json:"speaker"`
+	Reason  string `json:"reason"`
+}
+
+// Plugin that has a moderator model check every response for drifting off the topic
+// A drifting response is kept, but the next prompt redirects the debate back to the topic (and the debater that drifted is reminded on their next turn)
+type DriftCheck struct {
+	Events []DriftEvent
+
+	// Redirect added to each debater's next prompt (empty if they don't need one)
+	redirects [2]string
+}
+
+// Redirects debaters before their turn, and checks the final responses (so it should be registered after moderation)
+func (d *DriftCheck) Register(e *DebateEngine) {
+	e.BeforeTurn(func(e *DebateEngine, turn *TurnContext) {
+		if d.redirects[turn.Speaker] != "" {
+			turn.PromptExtras = append(turn.PromptExtras, d.redirects[turn.Speaker])
+			d.redirects[turn.Speaker] = ""
+		}
+	})
+
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		onTopic, reason := checkDrift(turn.Response)
+		if onTopic {
+			return
+		}
+
+		fmt.Fprintf(console, "\n(Moderator: LLM %d drifted off the topic: %s. Redirecting the debate.)", turn.Speaker, reason)
+		d.Events = append(d.Events, DriftEvent{Round: turn.Round, Phase: turn.Phase, Speaker: turn.Speaker, Reason: reason})
+
+		// The opponent speaks next, so they are asked not to follow the tangent
+		d.redirects[1-turn.Speaker] = fmt.Sprintf(" Moderator: your opponent's last statement drifted away from the topic (%s). "+
+			"Do not follow that tangent; bring the debate back to the topic: %s.", reason, topic)
+		d.redirects[turn.Speaker] = fmt.Sprintf(" Moderator: your last statement drifted away from the topic (%s). "+
+			"Stay on the topic: %s.", reason, topic)
+	})
+}
+
+// Asks the moderator model whether the statement is still about the topic
+// Returns whether it is, and the reason if it is not
+func checkDrift(response string) (bool, string) {
+	if response == "" {
+		return true, ""
+	}
+
+	verdict := sendRequestTo(driftModel, []ChatMessage{
+		{
+			Role: "system",
+			Content: "You moderate a debate and check whether each statement stays on the debate's topic. " +
+				"Arguments, examples, and rebuttals that relate back to the topic are fine. " +
+				"Reply RELEVANT if the statement is about the topic, otherwise reply DRIFT followed by a short reason.",
+		},
+		{
+			Role:    "user",
+			Content: fmt.Sprintf("Topic: %s. Statement: \"%s\"", topic, response),
+		},
+	})
+
+	// Whichever answer comes first is the verdict (the reason can mention the other word)
+	upper := strings.ToUpper(verdict)
+	drift, relevant := strings.Index(upper, "DRIFT"), strings.Index(upper, "RELEVANT")
+	if drift != -1 && (relevant == -1 || drift < relevant) {
+		reason := strings.TrimSpace(verdict[drift+len("DRIFT"):])
+		return false, strings.TrimLeft(reason, ":- ")
+	}
+	return true, ""
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Stage of the debate, each with its own instruction for the debaters
+type Phase string
+
+const (
+	PhaseOpening  Phase = "opening"
+	PhaseArgument Phase = "argument"
+	PhaseRebuttal Phase = "rebuttal"
+	PhaseSteelman Phase = "steelman"
+	PhaseClosing  Phase = "closing"
+)
+
+// Everything known about the turn that is currently being taken
+// Hooks can read and change these values (Ex: adding to the prompt, or replacing the response)
+type TurnContext struct {
+	Round   int
+	Phase   Phase
+	Speaker int
+	Persona string
+	Words   int
+
+	// Model that generates this debater's responses (and any rewrites of them)
+	Model string
+
+	// Temperature the response is generated at, set by the debater's tone (0 uses the server's default)
+	Temperature float64
+
+	// Extra text added to the end of the prompt (filled in by BeforeTurn hooks)
+	PromptExtras []string
+
+	// Messages sent to the model for this turn (set after the BeforeTurn hooks run)
+	History []ChatMessage
+
+	// Private reasoning the response was conditioned on (only if THINK=true), never shown to the opponent
+	Reasoning string
+
+	// Chosen response and the candidates that were not selected (set before the AfterTurn hooks run)
+	Response     string
+	Alternatives []string
+
+	// Completion tokens used for the response, including shortening and rewrites (hooks that rewrite the response add to it)
+	Tokens int
+
+	// When the turn started (used to measure how long it took)
+	Started time.Time
+}
+
+// Function that gets called before or after every turn
+type TurnHook func(e *DebateEngine, turn *TurnContext)
+
+// Function that gets called after both debaters have spoken in a round
+type RoundHook func(e *DebateEngine, round int, phase Phase)
+
+// Extension that registers its own hooks on the engine (Ex: fact ledger, moderation, transcript)
+type Plugin interface {
+	Register(e *DebateEngine)
+}
+
+// Runs the debate between the two personas, one phase at a time
+type DebateEngine struct {
+	Personas [2]string
+	Rounds   int
+
+	// Model of each debater (both use MODEL unless models are being compared)
+	Models [2]string
+
+	// Generation temperature of each debater (0 uses the server's default)
+	Temperatures [2]float64
+
+	// Adds a steelman round before the closing, where each debater presents the opponent's strongest argument
+	Steelman bool
+
+	// Conversation of each debater (the first message is always the system message)
+	Histories [2][]ChatMessage
+
+	// Why the debate skipped to its closing round (empty if every round ran), set by Stop
+	StopReason string
+
+	beforeTurn []TurnHook
+	afterTurn  []TurnHook
+	afterRound []RoundHook
+}
+
+// Creates an engine for the two personas with the given system messages
+func NewDebateEngine(personas, systemMessages [2]string, rounds int) *DebateEngine {
+	e := &DebateEngine{Personas: personas, Rounds: rounds, Models: [2]string{model, model}}
+	for id := range 2 {
+		e.Histories[id] = []ChatMessage{{Role: "system", Content: systemMessages[id]}}
+	}
+	return e
+}
+
+// Registers a hook that runs before the prompt for a turn is built
+func (e *DebateEngine) BeforeTurn(hook TurnHook) {
+	e.beforeTurn = append(e.beforeTurn, hook)
+}
+
+// Registers a hook that runs once a turn has a response, before it is saved to the debater's history
+func (e *DebateEngine) AfterTurn(hook TurnHook) {
+	e.afterTurn = append(e.afterTurn, hook)
+}
+
+// Registers a hook that runs after both debaters have spoken in a round
+func (e *DebateEngine) AfterRound(hook RoundHook) {
+	e.afterRound = append(e.afterRound, hook)
+}
+
+// Registers every hook of the plugins (hooks run in the order they were registered)
+func (e *DebateEngine) Use(plugins ...Plugin) {
+	for _, plugin := range plugins {
+		plugin.Register(e)
+	}
+}
+
+// Returns the phase of the round (rounds start at 0)
+// The first round is the opening and the last is the closing, the rounds in between alternate arguments and rebuttals
+// With a steelman round, the round before the closing is the steelman
+func (e *DebateEngine) phaseFor(round int) Phase {
+	switch {
+	case round == 0:
+		return PhaseOpening
+	case round == e.Rounds-1:
+		return PhaseClosing
+	case e.Steelman && round == e.Rounds-2:
+		return PhaseSteelman
+	case round%2 == 1:
+		return PhaseArgument
+	default:
+		return PhaseRebuttal
+	}
+}
+
+// Ends the debate early (Ex: once it stops producing new points)
+// The rounds that are left are skipped, except for the closing, so both debaters still close
+func (e *DebateEngine) Stop(reason string) {
+	e.StopReason = reason
+}
+
+// Runs every round of the debate (skipping to the closing round once the debate is stopped)
+func (e *DebateEngine) Run() {
+	for round := 0; round < e.Rounds; round++ {
+		phase := e.phaseFor(round)
+		printRoundHeader(round+1, e.Rounds, phase)
+
+		for id := range 2 {
+			e.takeTurn(round, phase, id)
+		}
+
+		for _, hook := range e.afterRound {
+			hook(e, round+1, phase)
+		}
+
+		if e.StopReason != "" {
+			round = max(round, e.Rounds-2)
+		}
+	}
+}
+
+// Has the debater respond to their opponent's last statement
+func (e *DebateEngine) takeTurn(round int, phase Phase, id int) {
+	turn := &TurnContext{
+		Started: time.Now(),
+		Round:   round + 1,
+		Phase:   phase,
+		Speaker: id,
+		Persona: e.Personas[id],
+		Model:   e.Models[id],
+
+		Temperature: e.Temperatures[id],
+
+		// How many words per turn (guideline), which can change each round
+		Words: wordsForRound(round),
+	}
+
+	for _, hook := range e.beforeTurn {
+		hook(e, turn)
+	}
+
+	// For ID 0, the other ID is 1
+	// For ID 1, the other ID is 0
+	opponentID := 1 - id
+
+	// Start fresh history for this LLM, with its system message (this LLM's personality)
+	system := e.Histories[id][0].Content
+
+	// Get the last message from the opponent (if it exists)
+	lastOpponentMessage := ""
+	if len(e.Histories[opponentID]) > 1 {
+		lastOpponentMessage = e.Histories[opponentID][len(e.Histories[opponentID])-1].Content
+	}
+
+	// Compress the opponent's statement into its main points, so it isn't parroted (if PARAPHRASE=true)
+	paraphraseTokens := 0
+	if paraphraseEnabled && lastOpponentMessage != "" {
+		lastOpponentMessage, paraphraseTokens = paraphraseOpponent(lastOpponentMessage)
+	}
+
+	// Builds the prompt around the opponent's statement (so it can be rebuilt if the statement gets shortened)
+	hasOpponent := lastOpponentMessage != ""
+	buildPrompt := func(opponentMessage string) string {
+		return phasePrompt(phase, hasOpponent, opponentMessage, turn.Words) + strings.Join(turn.PromptExtras, "")
+	}
+
+	// Shorten the opponent's statement if the prompt would not fit in the model's context window
+	lastOpponentMessage = fitOpponentMessage(system, lastOpponentMessage, buildPrompt)
+
+	turn.History = []ChatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: buildPrompt(lastOpponentMessage)},
+	}
+
+	// Let the LLM reason privately first, then answer with its reasoning in the prompt (if THINK=true)
+	thinkTokens := 0
+	if thinkEnabled {
+		turn.Reasoning, thinkTokens = think(turn)
+		turn.History[1].Content = promptWithReasoning(turn.History[1].Content, turn.Reasoning)
+	}
+
+	// Get LLM to respond to this request (choosing the strongest candidate if branching)
+	turn.Response, turn.Alternatives, turn.Tokens = generateTurn(turn.Model, turn.Temperature, turn.History, turn.Words)
+	turn.Tokens += thinkTokens + paraphraseTokens
+
+	for _, hook := range e.afterTurn {
+		hook(e, turn)
+	}
+
+	// Save this turn
+	e.Histories[id] = append(e.Histories[id], ChatMessage{
+		Role:    "assistant",
+		Content: turn.Response,
+	})
+
+	// Print message from this LLM
+	printTurn(id, turn.Persona, turn.Response, time.Since(turn.Started))
+	if logGeneration {
+		printGenerationParams(generationParams(turn))
+	}
+}
+
+// Builds the instruction for the phase
+// The first speaker of the debate has no opponent statement yet, so they just start the debate
+func phasePrompt(phase Phase, hasOpponent bool, opponentMessage string, words int) string {
+	if !hasOpponent {
+		return fmt.Sprintf("Start the debate from your perspective, <=%d words.", words)
+	}
+
+	switch phase {
+	case PhaseArgument:
+		return fmt.Sprintf(
+			"%s From your perspective, present a new argument for your position that has not been made yet. "+
+				"Do not quote your opponent verbatim; focus on your reasoning and beliefs. <=%d words.",
+			opponentStatement(opponentMessage), words)
+	case PhaseSteelman:
+		return fmt.Sprintf(
+			"%s Before your closing, present the strongest and most charitable version of your opponent's "+
+				"overall argument, as they would make it at their best. Do not rebut it or add your own view. <=%d words.",
+			opponentStatement(opponentMessage), words)
+	case PhaseClosing:
+		return fmt.Sprintf(
+			"%s This is your closing statement: briefly answer them, then summarize your strongest points. "+
+				"Do not quote your opponent verbatim; focus on your reasoning and beliefs. <=%d words.",
+			opponentStatement(opponentMessage), words)
+	default:
+		return fmt.Sprintf(
+			"%s From your perspective, respond with a counterargument. "+
+				"Do not quote your opponent verbatim; focus on your reasoning and beliefs. <=%d words.",
+			opponentStatement(opponentMessage), words)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// Reference documents of each debater (EVIDENCE_ZERO and EVIDENCE_ONE, comma-separated text files or URLs)
+	evidenceSources = [2]string{os.Getenv("EVIDENCE_ZERO"), os.Getenv("EVIDENCE_ONE")}
+
+	// Most words the summary of each document can have in the system message (EVIDENCE_WORDS)
+	evidenceWords int
+
+	// Summarized documents of each debater, loaded at startup
+	evidencePackets [2][]EvidenceDocument
+
+	// Client used to download the documents that are URLs
+	evidenceClient = &http.Client{Timeout: 30 * time.Second}
+
+	// Matches the parts of an HTML page that aren't text
+	htmlScripts = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	htmlTags    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// Reference document that a debater argues from
+type EvidenceDocument struct {
+	// Name the debater cites the document by (the file name, or the last part of the URL)
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Summary string `json:"summary"`
+}
+
+// Documents a response cited
+type EvidenceCitation struct {
+	Round     int      `json:"round"`
+	Speaker   int      `json:"speaker"`
+	Documents []string `json:"documents"`
+}
+
+// Loads and summarizes the reference documents of both debaters
+// The program ends if a document can't be read, so a debate never runs without the evidence it was meant to have
+func loadEvidence() {
+	var err error
+	evidenceWords, err = strconv.Atoi(os.Getenv("EVIDENCE_WORDS"))
+	if err != nil || evidenceWords <= 0 {
+		evidenceWords = 150
+	}
+
+	for id, sources := range evidenceSources {
+		for _, source := range strings.Split(sources, ",") {
+			source = strings.TrimSpace(source)
+			if source == "" {
+				continue
+			}
+
+			text, err := readEvidence(source)
+			check(err)
+
+			doc := EvidenceDocument{Name: evidenceName(source), Source: source}
+			doc.Summary = summarizeEvidence(doc.Name, text)
+			evidencePackets[id] = append(evidencePackets[id], doc)
+			fmt.Fprintf(console, "Loaded evidence for LLM %d: %s (%d words, summarized to %d)\n",
+				id, doc.Name, len(strings.Fields(text)), len(strings.Fields(doc.Summary)))
+		}
+	}
+}
+
+// Returns whether either debater has reference documents
+func evidenceEnabled() bool {
+	return len(evidencePackets[0]) > 0 || len(evidencePackets[1]) > 0
+}
+
+// Reads the text of a document from a file, or downloads it if it is a URL (HTML pages are reduced to their text)
+func readEvidence(source string) (string, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		data, err := os.ReadFile(source)
+		return string(data), err
+	}
+
+	resp, err := evidenceClient.Get(source)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading evidence %s: status %d", source, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	text := string(body)
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		text = htmlScripts.ReplaceAllString(text, " ")
+		text = htmlTags.ReplaceAllString(text, " ")
+	}
+	return text, nil
+}
+
+// Returns the name a document is cited by
+func evidenceName(source string) string {
+	if parsed, err := url.Parse(source); err == nil && parsed.Host != "" {
+		if name := path.Base(parsed.Path); name != "/" && name != "." {
+			return name
+		}
+		return parsed.Host
+	}
+	return filepath.Base(source)
+}
+
+// Summarizes the document in at most EVIDENCE_WORDS words
+// Documents too long for the context window are split into chunks that are summarized one at a time, then combined
+func summarizeEvidence(name, text string) string {
+	words := strings.Fields(text)
+	if len(words) <= evidenceWords {
+		return strings.Join(words, " ")
+	}
+
+	// Half of the context window is left for the chunk, so the instructions and the summary always fit
+	chunkWords := max(contextLimit/2*3/4, 100)
+
+	summaries := []string{}
+	for start := 0; start < len(words); start += chunkWords {
+		chunk := strings.Join(words[start:min(start+chunkWords, len(words))], " ")
+		summaries = append(summaries, summarizeExcerpt(name, chunk, evidenceWords))
+	}
+
+	// A single chunk is already summarized, otherwise the chunk summaries are summarized together
+	summary := strings.Join(summaries, " ")
+	if len(summaries) > 1 && len(strings.Fields(summary)) > evidenceWords {
+		summary = summarizeExcerpt(name, summary, evidenceWords)
+	}
+	return summary
+}
+
+// Asks the model to summarize part of a document, keeping the facts a debater could cite
+func summarizeExcerpt(name, excerpt string, words int) string {
+	return sendRequest([]ChatMessage{
+		{
+			Role:    "system",
+			Content: "You summarize reference documents faithfully, keeping the facts, figures, and arguments they contain.",
+		},
+		{
+			Role:    "user",
+			Content: fmt.Sprintf("Summarize this excerpt from the document \"%s\" in at most %d words: %s", name, words, excerpt),
+		},
+	})
+}
+
+// Returns the system message text with the debater's documents (empty if they have none)
+func evidenceInstructions(id int) string {
+	if len(evidencePackets[id]) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(" Argue from this evidence, citing the document name in brackets whenever you use it (Ex: [report.txt]):")
+	for _, doc := range evidencePackets[id] {
+		fmt.Fprintf(&sb, " [%s] %s", doc.Name, doc.Summary)
+	}
+	return sb.String()
+}
+
+// Returns the names of the debater's documents that the response cites
+func citedDocuments(id int, response string) []string {
+	lower := strings.ToLower(response)
+	cited := []string{}
+	for _, doc := range evidencePackets[id] {
+		if strings.Contains(lower, "["+strings.ToLower(doc.Name)+"]") {
+			cited = append(cited, doc.Name)
+		}
+	}
+	return cited
+}
+
+// Plugin that records which documents every final response cites (so it should be registered after moderation)
+type EvidenceTracker struct {
+	Citations []EvidenceCitation
+}
+
+func (t *EvidenceTracker) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		if len(evidencePackets[turn.Speaker]) == 0 {
+			return
+		}
+
+		cited := citedDocuments(turn.Speaker, turn.Response)
+		t.Citations = append(t.Citations, EvidenceCitation{Round: turn.Round, Speaker: turn.Speaker, Documents: cited})
+		if len(cited) == 0 {
+			fmt.Fprintf(console, "\n(LLM %d did not cite any of its evidence this turn.)", turn.Speaker)
+		}
+	})
+}
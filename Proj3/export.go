@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Training data export settings (loaded from environment variables in loadExport)
+var (
+	// File every turn is appended to as a training example (nothing is exported if empty)
+	// Examples are appended, so running many debates with the same file builds one dataset
+	exportFile = os.Getenv("EXPORT_FILE")
+
+	// Format of the examples: "openai" (fine-tuning JSONL) or "sharegpt"
+	exportFormat string
+
+	// Lowest judge score a turn needs to be exported (0 exports every turn, only used if JUDGE=true)
+	exportMinScore int
+)
+
+// Loads the export settings from the environment variables
+// If they are not valid, use default values
+func loadExport() {
+	exportFormat = strings.ToLower(strings.TrimSpace(os.Getenv("EXPORT_FORMAT")))
+	if exportFormat != "sharegpt" {
+		exportFormat = "openai"
+	}
+
+	var err error
+	exportMinScore, err = strconv.Atoi(os.Getenv("EXPORT_MIN_SCORE"))
+	if err != nil || exportMinScore < 0 || exportMinScore > 10 {
+		exportMinScore = 0
+	}
+	if exportMinScore > 0 && !judgeEnabled {
+		fmt.Fprintln(console, "EXPORT_MIN_SCORE is ignored since JUDGE is not true")
+		exportMinScore = 0
+	}
+}
+
+// Example in the OpenAI fine-tuning format (one per line)
+type openAIExample struct {
+	Messages []ChatMessage `json:"messages"`
+}
+
+// Message in the ShareGPT format ("system", "human", or "gpt")
+type shareGPTMessage struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+// Example in the ShareGPT format (one per line)
+type shareGPTExample struct {
+	Conversations []shareGPTMessage `json:"conversations"`
+}
+
+// A finished turn, kept until the debate is over (since the judge scores it in the background)
+type exportTurn struct {
+	Round   int
+	Speaker int
+	Prompt  []ChatMessage
+	Content string
+}
+
+// Plugin that turns every final response into a training example, with the exact messages that produced it
+// It should be registered after moderation, so a rewritten response is exported instead of the original
+type Exporter struct {
+	turns []exportTurn
+}
+
+func (x *Exporter) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		x.turns = append(x.turns, exportTurn{Round: turn.Round, Speaker: turn.Speaker, Prompt: turn.History, Content: turn.Response})
+	})
+}
+
+// Appends every turn that meets EXPORT_MIN_SCORE to the file (once the judge has scored every turn)
+func (x *Exporter) save(path string, scores []Score) {
+	// Score of each turn, by round and speaker
+	scored := make(map[[2]int]int, len(scores))
+	for _, s := range scores {
+		scored[[2]int{s.Round, s.Speaker}] = s.Score
+	}
+
+	// Personal details are removed from every example if SCRUB_PII=true (with the same placeholders across the whole debate)
+	s := NewScrubber()
+	clean := func(text string) string {
+		if scrubEnabled {
+			return s.scrub(text)
+		}
+		return text
+	}
+
+	var lines []string
+	skipped := 0
+	for _, turn := range x.turns {
+		if score, found := scored[[2]int{turn.Round, turn.Speaker}]; exportMinScore > 0 && (!found || score < exportMinScore) {
+			skipped++
+			continue
+		}
+
+		messages := make([]ChatMessage, 0, len(turn.Prompt)+1)
+		for _, message := range turn.Prompt {
+			messages = append(messages, ChatMessage{Role: message.Role, Content: clean(message.Content)})
+		}
+		messages = append(messages, ChatMessage{Role: "assistant", Content: clean(turn.Content)})
+
+		var example any = openAIExample{Messages: messages}
+		if exportFormat == "sharegpt" {
+			example = toShareGPT(messages)
+		}
+		data, err := json.Marshal(example)
+		check(err)
+		lines = append(lines, string(data))
+	}
+
+	if len(lines) == 0 {
+		fmt.Fprintf(console, "\nNo turns scored at least %d, so nothing was exported\n", exportMinScore)
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	check(err)
+	defer file.Close()
+
+	_, err = file.WriteString(strings.Join(lines, "\n") + "\n")
+	check(err)
+
+	fmt.Fprintf(console, "\nExported %d turns to %s (%s format", len(lines), path, exportFormat)
+	if skipped > 0 {
+		fmt.Fprintf(console, ", %d scored below %d", skipped, exportMinScore)
+	}
+	fmt.Fprintln(console, ")")
+}
+
+// Converts the messages to the ShareGPT format
+func toShareGPT(messages []ChatMessage) shareGPTExample {
+	roles := map[string]string{"system": "system", "user": "human", "assistant": "gpt"}
+
+	example := shareGPTExample{Conversations: make([]shareGPTMessage, len(messages))}
+	for i, message := range messages {
+		example.Conversations[i] = shareGPTMessage{From: roles[message.Role], Value: message.Content}
+	}
+	return example
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Whether the shared fact ledger is used (FACTS=true), which costs an extra call per turn
+var factsEnabled = os.Getenv("FACTS") == "true"
+
+// Bullet point or list number at the start of a claim (Ex: "- ", "2. ", "3) "), but not a number that is part of it (Ex: "1948 ...")
+// Splitting on sentences leaves a list number on its own (Ex: "1."), so a marker at the end is matched too
+var listMarker = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)])(?:\s+|$)`)
+
+// A single claim that was asserted during the debate
+type Fact struct {
+	ID      int
+	Speaker int
+	Round   int
+	Text    string
+}
+
+// Growing list of facts asserted so far, shared by both debaters
+type FactLedger struct {
+	Facts []Fact
+}
+
+// Asks the model to pull the factual claims out of a turn, and adds them to the ledger
+func (l *FactLedger) extract(speaker, round int, response string) {
+	history := []ChatMessage{
+		{
+			Role: "system",
+			Content: "You extract factual claims from debate statements. " +
+				"List each claim on its own line, at most 3 claims, with no numbering or extra text. " +
+				"If there are no factual claims, reply with NONE.",
+		},
+		{
+			Role:    "user",
+			Content: response,
+		},
+	}
+
+	// Response has its new lines replaced with spaces, so split claims on sentences instead
+	extracted := sendRequest(history)
+	// Only a reply of just NONE means there are no claims, since a claim can contain the word (Ex: "none of the prophets")
+	if strings.EqualFold(strings.TrimSpace(extracted), "NONE") {
+		return
+	}
+
+	for _, claim := range splitSentences(extracted) {
+		// Remove any bullet points the model added anyway
+		// A fragment without any words (Ex: "1." or "-") is only left over from the list, so it isn't a claim
+		claim = strings.TrimSpace(listMarker.ReplaceAllString(claim, ""))
+		if strings.IndexFunc(claim, unicode.IsLetter) == -1 {
+			continue
+		}
+
+		l.Facts = append(l.Facts, Fact{ID: len(l.Facts) + 1, Speaker: speaker, Round: round, Text: claim})
+	}
+}
+
+// Formats the ledger so it can be added to a prompt
+func (l *FactLedger) promptSection() string {
+	if len(l.Facts) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, " Facts asserted so far (you may reference or challenge them by number):")
+	for _, fact := range l.Facts {
+		fmt.Fprintf(&sb, " [%d] (LLM %d) %s", fact.ID, fact.Speaker, fact.Text)
+	}
+	return sb.String()
+}
+
+// Prints the full ledger at the end of the debate
+func (l *FactLedger) print() {
+	fmt.Fprintf(console, "\n\n--- FACT LEDGER (%d facts) ---", len(l.Facts))
+	for _, fact := range l.Facts {
+		fmt.Fprintf(console, "\n[%d] Round %d, LLM %d: %s", fact.ID, fact.Round, fact.Speaker, fact.Text)
+	}
+	fmt.Fprintln(console)
+}
+
+// Shows the ledger in every prompt, and adds the facts from every turn to it
+func (l *FactLedger) Register(e *DebateEngine) {
+	e.BeforeTurn(func(e *DebateEngine, turn *TurnContext) {
+		// Let the LLM see (and challenge) every fact asserted so far
+		turn.PromptExtras = append(turn.PromptExtras, l.promptSection())
+	})
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		l.extract(turn.Speaker, turn.Round, turn.Response)
+	})
+}
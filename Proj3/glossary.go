@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Whether a glossary of the debate's technical terms is added to the report (GLOSSARY=true)
+	glossaryEnabled = os.Getenv("GLOSSARY") == "true"
+
+	// Most terms the glossary can have (GLOSSARY_TERMS)
+	glossaryTerms int
+)
+
+// A term used in the debate, what it means, and who used it first
+type GlossaryEntry struct {
+	Term       string `json:"term"`
+	Definition string `json:"definition"`
+	Speaker    int    `json:"speaker"`
+	Persona    string `json:"persona"`
+	Round      int    `json:"round"`
+}
+
+// Loads the glossary settings from the environment variables
+// If they are not valid, use default values
+func loadGlossary() {
+	var err error
+
+	glossaryTerms, err = strconv.Atoi(os.Getenv("GLOSSARY_TERMS"))
+	if err != nil || glossaryTerms <= 0 {
+		glossaryTerms = 10
+	}
+}
+
+// Finds the domain-specific terms used in the debate, and defines all of them with a single call
+// Each term is credited to the first turn that used it, and terms that no turn actually used are left out
+func buildGlossary(turns []Turn) []GlossaryEntry {
+	var debate strings.Builder
+	for _, turn := range turns {
+		fmt.Fprintf(&debate, "LLM %d: %s\n", turn.Speaker, turn.Content)
+	}
+
+	// Responses have their new lines replaced with spaces, so the terms are separated by commas instead
+	reply := sendRequest([]ChatMessage{
+		{
+			Role: "system",
+			Content: fmt.Sprintf("You find the technical, religious, or domain-specific terms in a debate that a general reader might not know. "+
+				"Reply with at most %d terms exactly as they are written in the debate, separated by commas, with no other text. "+
+				"If there are no such terms, reply with NONE.", glossaryTerms),
+		},
+		{Role: "user", Content: fmt.Sprintf("Topic: %s.\n%s", topic, debate.String())},
+	})
+	// Only a reply of just NONE means there are no terms, since a term can contain the word (Ex: "nonetheless")
+	if strings.EqualFold(strings.TrimSpace(reply), "NONE") {
+		return nil
+	}
+
+	var entries []GlossaryEntry
+	seen := make(map[string]bool)
+	for term := range strings.SplitSeq(reply, ",") {
+		term = strings.Trim(strings.TrimSpace(term), "\"'.*-")
+		key := strings.ToLower(term)
+		if term == "" || seen[key] || len(entries) >= glossaryTerms {
+			continue
+		}
+		seen[key] = true
+
+		// Credit the term to the first turn that used it
+		for _, turn := range turns {
+			if strings.Contains(strings.ToLower(turn.Content), key) {
+				entries = append(entries, GlossaryEntry{Term: term, Speaker: turn.Speaker, Persona: turn.Persona, Round: turn.Round})
+				break
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	defineTerms(entries)
+	return entries
+}
+
+// Asks the model to define every term in one call ("TERM: definition" for each, in the same order)
+func defineTerms(entries []GlossaryEntry) {
+	terms := make([]string, len(entries))
+	for i, entry := range entries {
+		terms[i] = entry.Term
+	}
+
+	reply := sendRequest([]ChatMessage{
+		{
+			Role: "system",
+			Content: "You write glossaries for debates. For each term, write the term, a colon, and a one sentence definition " +
+				"that fits how it is used in a debate about the topic. Keep the terms in the given order, with no other text.",
+		},
+		{Role: "user", Content: fmt.Sprintf("Topic: %s. Terms: %s", topic, strings.Join(terms, "; "))},
+	})
+
+	// Each definition runs from its term until the next term in the reply
+	lower := strings.ToLower(reply)
+	for i := range entries {
+		start := strings.Index(lower, strings.ToLower(entries[i].Term)+":")
+		if start < 0 {
+			continue
+		}
+		start += len(entries[i].Term) + 1
+
+		end := len(reply)
+		if i+1 < len(entries) {
+			if next := strings.Index(lower[start:], strings.ToLower(entries[i+1].Term)+":"); next >= 0 {
+				end = start + next
+			}
+		}
+		entries[i].Definition = strings.TrimSpace(strings.TrimLeft(reply[start:end], " -"))
+	}
+}
+
+// Prints the glossary at the end of the debate
+func printGlossary(entries []GlossaryEntry) {
+	fmt.Fprintf(console, "\n\n--- GLOSSARY (%d terms) ---", len(entries))
+	for _, entry := range entries {
+		definition := entry.Definition
+		if definition == "" {
+			definition = "(no definition)"
+		}
+		fmt.Fprintf(console, "\n%s: %s %s", colorize(entry.Term, colorBold), definition,
+			colorize(fmt.Sprintf("[first used by LLM %d (%s), round %d]", entry.Speaker, entry.Persona, entry.Round), colorDim))
+	}
+	fmt.Fprintln(console)
+}
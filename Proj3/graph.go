@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Base path the argument graph is written to, as .dot and .json (GRAPH_FILE, nothing is written if empty)
+var graphFile = strings.TrimSuffix(strings.TrimSuffix(os.Getenv("GRAPH_FILE"), ".dot"), ".json")
+
+// Matches each "CLAIM: ... REBUTS: ..." pair in the extraction reply (the reply has its new lines replaced with spaces)
+var claimPattern = regexp.MustCompile(`(?i)CLAIM:\s*(.*?)\s*REBUTS:\s*((?:\d+[\s,]*)+|none)`)
+
+// One turn of the debate in the graph (the same record that is written in JSON output mode)
+type GraphTurn struct {
+	ID string `json:"id"`
+	TurnRecord
+
+	// Opponent turn this turn answered (empty for the first turn of the debate)
+	RespondsTo string `json:"responds_to,omitempty"`
+}
+
+// A claim made in a turn, and the opponent claims it rebuts
+type GraphClaim struct {
+	ID      int    `json:"id"`
+	Turn    string `json:"turn"`
+	Speaker int    `json:"speaker"`
+	Text    string `json:"text"`
+	Rebuts  []int  `json:"rebuts"`
+
+	// Whether any later opponent claim rebuts this one
+	Answered bool `json:"answered"`
+}
+
+// Connection between two nodes of the graph
+// Kinds: "responds_to" (turn to turn), "claims" (turn to claim), and "rebuts" (claim to claim)
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// Plugin that maps the argument structure of the debate: every turn, the claims made in it, and which claims they rebut
+// Claims are extracted once the turn is final (so it should be registered after moderation)
+type DebateGraph struct {
+	Turns  []GraphTurn  `json:"turns"`
+	Claims []GraphClaim `json:"claims"`
+	Edges  []GraphEdge  `json:"edges"`
+
+	// Last turn of each debater (what the opponent's next turn answers)
+	lastTurn [2]string
+}
+
+func (g *DebateGraph) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		id := fmt.Sprintf("r%d_llm%d", turn.Round, turn.Speaker)
+		node := GraphTurn{
+			ID: id,
+			TurnRecord: TurnRecord{
+				Round:     turn.Round,
+				Phase:     turn.Phase,
+				Speaker:   turn.Speaker,
+				Persona:   turn.Persona,
+				Model:     turn.Model,
+				Content:   turn.Response,
+				Tokens:    turn.Tokens,
+				LatencyMS: time.Since(turn.Started).Milliseconds(),
+			},
+			RespondsTo: g.lastTurn[1-turn.Speaker],
+		}
+		g.Turns = append(g.Turns, node)
+		g.lastTurn[turn.Speaker] = id
+		if node.RespondsTo != "" {
+			g.Edges = append(g.Edges, GraphEdge{From: id, To: node.RespondsTo, Kind: "responds_to"})
+		}
+
+		g.extract(id, turn.Speaker, turn.Response)
+	})
+}
+
+// Asks the model for the claims of the turn, and which of the opponent's claims each one rebuts
+func (g *DebateGraph) extract(turnID string, speaker int, response string) {
+	// Only the opponent's claims can be rebutted, so only they are numbered in the prompt
+	var opponentClaims strings.Builder
+	for _, claim := range g.Claims {
+		if claim.Speaker != speaker {
+			fmt.Fprintf(&opponentClaims, " [%d] %s", claim.ID, claim.Text)
+		}
+	}
+	if opponentClaims.Len() == 0 {
+		opponentClaims.WriteString(" none yet")
+	}
+
+	reply := sendRequest([]ChatMessage{
+		{
+			Role: "system",
+			Content: "You map the structure of debates. List each claim the statement makes, at most 3, as " +
+				"'CLAIM: <claim> REBUTS: <numbers>' where the numbers are the opponent claims it argues against, or 'REBUTS: none'.",
+		},
+		{
+			Role:    "user",
+			Content: fmt.Sprintf("Opponent claims:%s. Statement: \"%s\"", opponentClaims.String(), response),
+		},
+	})
+
+	for _, match := range claimPattern.FindAllStringSubmatch(reply, 3) {
+		claim := GraphClaim{ID: len(g.Claims) + 1, Turn: turnID, Speaker: speaker, Text: strings.Trim(match[1], " .-*"), Rebuts: []int{}}
+		if claim.Text == "" {
+			continue
+		}
+
+		for _, number := range strings.FieldsFunc(match[2], func(r rune) bool { return r == ',' || r == ' ' }) {
+			target, err := strconv.Atoi(number)
+
+			// Ignore numbers that aren't one of the opponent's claims
+			if err != nil || target < 1 || target > len(g.Claims) || g.Claims[target-1].Speaker == speaker {
+				continue
+			}
+			claim.Rebuts = append(claim.Rebuts, target)
+			g.Claims[target-1].Answered = true
+			g.Edges = append(g.Edges, GraphEdge{From: claimNode(claim.ID), To: claimNode(target), Kind: "rebuts"})
+		}
+
+		g.Claims = append(g.Claims, claim)
+		g.Edges = append(g.Edges, GraphEdge{From: turnID, To: claimNode(claim.ID), Kind: "claims"})
+	}
+}
+
+// Returns the node ID of a claim
+func claimNode(id int) string {
+	return fmt.Sprintf("c%d", id)
+}
+
+// Returns the claims that no opponent claim rebutted
+func (g *DebateGraph) unanswered() []GraphClaim {
+	claims := []GraphClaim{}
+	for _, claim := range g.Claims {
+		if !claim.Answered {
+			claims = append(claims, claim)
+		}
+	}
+	return claims
+}
+
+// Writes the graph as a GraphViz file (render with: dot -Tsvg debate_graph.dot -o debate_graph.svg)
+// Turns are boxes colored by debater, claims are ellipses, and claims nobody answered are red
+func (g *DebateGraph) dot() string {
+	colors := [2]string{"lightblue", "lightyellow"}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph debate {\n\tlabel=%s;\n\trankdir=TB;\n", strconv.Quote(topic))
+	for _, turn := range g.Turns {
+		fmt.Fprintf(&sb, "\t%s [shape=box, style=filled, fillcolor=%s, label=%s];\n",
+			turn.ID, colors[turn.Speaker], strconv.Quote(fmt.Sprintf("Round %d (%s)\nLLM %d: %s", turn.Round, turn.Phase, turn.Speaker, turn.Persona)))
+	}
+	for _, claim := range g.Claims {
+		color := "black"
+		if !claim.Answered {
+			color = "red"
+		}
+		fmt.Fprintf(&sb, "\t%s [shape=ellipse, color=%s, label=%s];\n", claimNode(claim.ID), color, strconv.Quote(wrapLabel(claim.Text, 40)))
+	}
+
+	styles := map[string]string{"responds_to": "dashed", "claims": "solid", "rebuts": "bold"}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&sb, "\t%s -> %s [style=%s, label=%s];\n", edge.From, edge.To, styles[edge.Kind], strconv.Quote(edge.Kind))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Breaks the text into lines of about the given width, so long claims don't make huge nodes
+func wrapLabel(text string, width int) string {
+	var sb strings.Builder
+	lineLength := 0
+	for _, word := range strings.Fields(text) {
+		if lineLength > 0 && lineLength+len(word) > width {
+			sb.WriteString("\n")
+			lineLength = 0
+		} else if lineLength > 0 {
+			sb.WriteString(" ")
+			lineLength++
+		}
+		sb.WriteString(word)
+		lineLength += len(word)
+	}
+	return sb.String()
+}
+
+// Writes the graph to GRAPH_FILE.dot and GRAPH_FILE.json, and prints how many claims went unanswered
+func (g *DebateGraph) save(path string) {
+	if scrubEnabled {
+		g = g.scrubbed()
+	}
+
+	err := os.WriteFile(path+".dot", []byte(g.dot()), 0644)
+	check(err)
+
+	data, err := json.MarshalIndent(g, "", "  ")
+	check(err)
+	err = os.WriteFile(path+".json", data, 0644)
+	check(err)
+
+	fmt.Fprintf(console, "\nArgument graph (%d turns, %d claims, %d unanswered) saved to %s.dot and %s.json\n",
+		len(g.Turns), len(g.Claims), len(g.unanswered()), path, path)
+}
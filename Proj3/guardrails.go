@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Guardrail settings (loaded from environment variables in loadGuardrails)
+var (
+	// Maximum amount of sentences per turn (0 means there is no sentence limit)
+	maxSentences int
+
+	// How many times a model gets re-prompted to shorten its reply before it gets truncated
+	maxRetries int
+
+	// Word budget for each round (Ex: "10,30,30,30,15"), the last value is used for any remaining rounds
+	wordSchedule []int
+)
+
+// Default amount of words per turn if there is no schedule
+const defaultWords = 10
+
+// Loads the guardrail settings from the environment variables
+// If they are not valid, use default values
+func loadGuardrails() {
+	var err error
+
+	maxSentences, err = strconv.Atoi(os.Getenv("MAX_SENTENCES"))
+	if err != nil || maxSentences < 0 {
+		maxSentences = 0
+	}
+
+	maxRetries, err = strconv.Atoi(os.Getenv("MAX_RETRIES"))
+	if err != nil || maxRetries < 0 {
+		maxRetries = 2
+	}
+
+	// Every value in the schedule must be a positive number, otherwise the default budget is used
+	wordSchedule = nil
+	if schedule := os.Getenv("WORD_SCHEDULE"); schedule != "" {
+		for _, value := range strings.Split(schedule, ",") {
+			words, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || words <= 0 {
+				fmt.Fprintf(console, "WORD_SCHEDULE values must be positive numbers, '%s' is not. Using %d words per turn.\n", value, defaultWords)
+				wordSchedule = nil
+				break
+			}
+			wordSchedule = append(wordSchedule, words)
+		}
+	}
+}
+
+// Returns the word budget for the round (rounds start at 0)
+func wordsForRound(round int) int {
+	if len(wordSchedule) == 0 {
+		return defaultWords
+	}
+	if round >= len(wordSchedule) {
+		return wordSchedule[len(wordSchedule)-1]
+	}
+	return wordSchedule[round]
+}
+
+// Counts the amount of words in the text (words are separated by whitespace)
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+// Splits text into sentences (a sentence ends with '.', '!' or '?')
+func splitSentences(text string) []string {
+	sentences := []string{}
+	var current strings.Builder
+
+	for _, r := range text {
+		current.WriteRune(r)
+
+		// End of a sentence, so save it
+		if r == '.' || r == '!' || r == '?' {
+			sentence := strings.TrimSpace(current.String())
+			if sentence != "" {
+				sentences = append(sentences, sentence)
+			}
+			current.Reset()
+		}
+	}
+
+	// Anything left over is an unfinished sentence
+	leftover := strings.TrimSpace(current.String())
+	if leftover != "" {
+		sentences = append(sentences, leftover)
+	}
+
+	return sentences
+}
+
+// Returns whether the text respects both the word and sentence budget
+func withinBudget(text string, words int) bool {
+	if countWords(text) > words {
+		return false
+	}
+	if maxSentences > 0 && len(splitSentences(text)) > maxSentences {
+		return false
+	}
+	return true
+}
+
+// Cuts the text down so it fits in the budget
+// Whole sentences are kept for as long as they fit, otherwise the first sentence gets cut at the word limit
+func truncateToBudget(text string, words int) string {
+	sentences := splitSentences(text)
+
+	kept := []string{}
+	wordCount := 0
+
+	for _, sentence := range sentences {
+		sentenceWords := countWords(sentence)
+
+		// Stop once the next sentence would go over the budget
+		if wordCount+sentenceWords > words || (maxSentences > 0 && len(kept) >= maxSentences) {
+			break
+		}
+
+		kept = append(kept, sentence)
+		wordCount += sentenceWords
+	}
+
+	// If not even the first sentence fits, cut it at the word limit instead
+	if len(kept) == 0 {
+		fields := strings.Fields(text)
+		if len(fields) > words {
+			fields = fields[:words]
+		}
+		return strings.Join(fields, " ")
+	}
+
+	return strings.Join(kept, " ")
+}
+
+// Makes sure the response respects the budget
+// Re-prompts the model to shorten its reply (up to maxRetries times), then truncates if it still doesn't fit
+func enforceBudget(modelName string, history []ChatMessage, response string, words int) (string, int) {
+	tokens := 0
+
+	for attempt := 1; attempt <= maxRetries && !withinBudget(response, words); attempt++ {
+		fmt.Fprintf(console, "\n(Response was %d words and %d sentences, asking model to shorten it. Attempt %d of %d)",
+			countWords(response), len(splitSentences(response)), attempt, maxRetries)
+
+		// Tell the model what it said and ask for a shorter version
+		instruction := fmt.Sprintf("Your reply was %d words. Rewrite it in %d words or fewer", countWords(response), words)
+		if maxSentences > 0 {
+			instruction += fmt.Sprintf(" and %d sentences or fewer", maxSentences)
+		}
+		instruction += ", keeping your main point."
+
+		retryHistory := append(history[:len(history):len(history)],
+			ChatMessage{Role: "assistant", Content: response},
+			ChatMessage{Role: "user", Content: instruction},
+		)
+
+		var used int
+		response, used = sendRequestUsage(modelName, retryHistory)
+		tokens += used
+	}
+
+	// Model still didn't listen, so cut the response at a sentence boundary
+	if !withinBudget(response, words) {
+		response = truncateToBudget(response, words)
+	}
+
+	return response, tokens
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Judge settings (loaded from environment variables in loadJudge)
+var (
+	// Whether every turn is scored by a judge model (JUDGE=true)
+	judgeEnabled = os.Getenv("JUDGE") == "true"
+
+	// Model that scores the turns (defaults to MODEL)
+	judgeModel = os.Getenv("JUDGE_MODEL")
+)
+
+// Finds the score in the judge's reply (Ex: "SCORE: 7")
+var scorePattern = regexp.MustCompile(`(?i)score\s*[:=]?\s*(\d+)`)
+
+// Score the judge gave to a single turn (from 1 to 10)
+type Score struct {
+	Round   int    `json:"round"`
+	Phase   Phase  `json:"phase"`
+	Speaker int    `json:"speaker"`
+	Score   int    `json:"score"`
+	Reason  string `json:"reason"`
+}
+
+// Loads the judge settings from the environment variables
+func loadJudge() {
+	if judgeModel == "" {
+		judgeModel = model
+	}
+}
+
+// Plugin that scores every turn once it is final (so it should be registered after moderation)
+// Steelman turns are scored on how fairly they present the opponent's side, and are totaled separately
+// Scoring doesn't change the debate, so turns are scored in the background while the next turns are generated
+type Judge struct {
+	Scores []Score
+
+	// Guards Scores while turns are still being scored (Ex: the convergence check reads them during the debate)
+	mu sync.Mutex
+
+	// Turns waiting to be scored, and closed once every one of them has been scored
+	pending chan judgeJob
+	done    chan struct{}
+}
+
+// A finished turn waiting to be scored
+type judgeJob struct {
+	turn     TurnContext
+	opponent string
+}
+
+func (j *Judge) Register(e *DebateEngine) {
+	// A few turns can wait, so the debate only slows down if the judge falls far behind
+	j.pending = make(chan judgeJob, 4)
+	j.done = make(chan struct{})
+
+	// Turns are scored one at a time, so the scores stay in the order of the debate
+	go func() {
+		for job := range j.pending {
+			score, reason := j.score(job.turn, job.opponent)
+			j.mu.Lock()
+			j.Scores = append(j.Scores, Score{Round: job.turn.Round, Phase: job.turn.Phase, Speaker: job.turn.Speaker, Score: score, Reason: reason})
+			j.mu.Unlock()
+		}
+		close(j.done)
+	}()
+
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		j.pending <- judgeJob{turn: *turn, opponent: e.Personas[1-turn.Speaker]}
+	})
+}
+
+// Returns a copy of the scores given so far (safe to call while turns are still being scored)
+func (j *Judge) scored() []Score {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return slices.Clone(j.Scores)
+}
+
+// Waits until every turn has been scored (called once the debate is over, before the scores are read)
+func (j *Judge) wait() {
+	if j.pending == nil {
+		return
+	}
+	close(j.pending)
+	<-j.done
+	j.pending = nil
+}
+
+// Asks the judge model to score the turn, returning the score and the judge's reason
+// Defaults to 5 if the reply doesn't contain a score
+func (j *Judge) score(turn TurnContext, opponent string) (int, string) {
+
+	rubric := "Score how persuasive, logical, and on-topic the statement is."
+	if turn.Phase == PhaseSteelman {
+		rubric = fmt.Sprintf("The speaker was asked to present the strongest version of the %s argument (their opponent's side). "+
+			"Score how fairly, charitably, and convincingly they presented it, not whether you agree with it.", opponent)
+	}
+
+	reply := sendRequestTo(judgeModel, []ChatMessage{
+		{
+			Role: "system",
+			Content: "You are an impartial debate judge. " + rubric +
+				" Reply with 'SCORE: N' where N is from 1 (worst) to 10 (best), followed by one sentence explaining the score.",
+		},
+		{
+			Role:    "user",
+			Content: fmt.Sprintf("Topic: %s. Speaker (%s perspective, %s phase): \"%s\"", topic, turn.Persona, turn.Phase, turn.Response),
+		},
+	})
+
+	match := scorePattern.FindStringSubmatch(reply)
+	if match == nil {
+		return 5, reply
+	}
+	score, _ := strconv.Atoi(match[1])
+	score = min(max(score, 1), 10)
+
+	reason := strings.TrimSpace(strings.TrimLeft(strings.Replace(reply, match[0], "", 1), ".:- "))
+	return score, reason
+}
+
+// Returns the total score of each debater, with steelman turns totaled separately
+func (j *Judge) totals() (debate [2]int, steelman [2]int) {
+	for _, s := range j.Scores {
+		if s.Phase == PhaseSteelman {
+			steelman[s.Speaker] += s.Score
+		} else {
+			debate[s.Speaker] += s.Score
+		}
+	}
+	return debate, steelman
+}
+
+// Returns the verdict shown in the closing banner (empty if nothing was scored)
+func (j *Judge) verdict(personas [2]string) string {
+	if len(j.Scores) == 0 {
+		return ""
+	}
+
+	debate, steelman := j.totals()
+
+	var verdict string
+	switch {
+	case debate[0] > debate[1]:
+		verdict = fmt.Sprintf("LLM 0 (%s) wins %d to %d", personas[0], debate[0], debate[1])
+	case debate[1] > debate[0]:
+		verdict = fmt.Sprintf("LLM 1 (%s) wins %d to %d", personas[1], debate[1], debate[0])
+	default:
+		verdict = fmt.Sprintf("Tie at %d", debate[0])
+	}
+
+	if steelman != [2]int{} {
+		verdict += fmt.Sprintf(" (steelman: LLM 0 %d, LLM 1 %d)", steelman[0], steelman[1])
+	}
+	return verdict
+}
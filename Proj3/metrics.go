@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus settings (loaded from environment variables in startMetrics)
+var (
+	// Whether metrics are served while the debate runs (METRICS=true)
+	metricsEnabled = os.Getenv("METRICS") == "true"
+
+	// Address the /metrics endpoint listens on (defaults to :8080, like Proj2)
+	metricsAddr = os.Getenv("METRICS_ADDR")
+)
+
+// Prometheus metrics for every chat request
+var (
+	requestLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "debate_request_duration_seconds",
+			Help:    "How long each chat request took, by model",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+		},
+		[]string{"model"},
+	)
+	tokensPerSecond = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "debate_tokens_per_second",
+			Help: "Completion tokens per second of the last chat request, by model",
+		},
+		[]string{"model"},
+	)
+	completionTokens = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "debate_completion_tokens_total",
+			Help: "Completion tokens generated, by model",
+		},
+		[]string{"model"},
+	)
+	requestErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "debate_request_errors_total",
+			Help: "Chat requests that failed, by model and reason (request, status, decode, empty)",
+		},
+		[]string{"model", "reason"},
+	)
+	requestWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "debate_request_wait_seconds",
+			Help:    "How long each request waited for the provider's rate limits (MAX_CONCURRENT_REQUESTS, REQUESTS_PER_MINUTE), by provider",
+			Buckets: []float64{0.01, 0.1, 0.5, 1, 2, 5, 10, 30, 60},
+		},
+		[]string{"provider"},
+	)
+)
+
+// Ran before main()
+func init() {
+	prometheus.MustRegister(requestLatency, tokensPerSecond, completionTokens, requestErrors, requestWait)
+}
+
+// Starts the HTTP server for Prometheus in the background (if METRICS=true)
+func startMetrics() {
+	if !metricsEnabled {
+		return
+	}
+	if metricsAddr == "" {
+		metricsAddr = ":8080"
+	}
+
+	http.Handle("/metrics", promhttp.Handler())
+	go func() {
+		if err := http.ListenAndServe(metricsAddr, nil); err != nil {
+			fmt.Fprintln(console, "Prometheus HTTP server failed:", err)
+		}
+	}()
+	fmt.Fprintf(console, "Prometheus metrics available at http://localhost%s/metrics\n", metricsAddr)
+}
+
+// Returns the completion tokens of a response
+// If the server doesn't report token usage, the tokens are estimated from the words in the response
+func tokenCount(reported int, response string) int {
+	if reported == 0 {
+		return len(strings.Fields(response)) * 4 / 3
+	}
+	return reported
+}
+
+// Records the latency and throughput of a successful chat request
+func recordRequest(modelName string, elapsed time.Duration, tokens int) {
+	requestLatency.WithLabelValues(modelName).Observe(elapsed.Seconds())
+	completionTokens.WithLabelValues(modelName).Add(float64(tokens))
+	if elapsed > 0 {
+		tokensPerSecond.WithLabelValues(modelName).Set(float64(tokens) / elapsed.Seconds())
+	}
+}
+
+// Records a chat request that failed
+func recordRequestError(modelName, reason string) {
+	requestErrors.WithLabelValues(modelName, reason).Inc()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Structured output settings (loaded from environment variables in loadOutput)
+var (
+	// Emits every turn as a line of JSON (OUTPUT=json), so other programs don't have to parse the printed debate
+	jsonOutputEnabled = strings.EqualFold(os.Getenv("OUTPUT"), "json")
+
+	// File the JSON lines are written to (stdout if empty)
+	outputFile = os.Getenv("OUTPUT_FILE")
+
+	// Where the JSON lines are written (set by loadOutput)
+	jsonOutput *JSONOutput
+)
+
+// One turn of the debate, as written in JSON output mode
+type TurnRecord struct {
+	Round     int    `json:"round"`
+	Phase     Phase  `json:"phase"`
+	Speaker   int    `json:"speaker"`
+	Persona   string `json:"persona"`
+	Model     string `json:"model"`
+	Content   string `json:"content"`
+	Tokens    int    `json:"tokens"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// Plugin that writes every turn as a line of JSON (JSON Lines)
+type JSONOutput struct {
+	file    *os.File
+	encoder *json.Encoder
+
+	// Removes personal details from each turn (only if SCRUB_PII=true)
+	scrubber *Scrubber
+}
+
+// Opens the JSON output (if OUTPUT=json)
+// When the JSON goes to stdout, everything else that is printed goes to the console on stderr instead, so stdout only has JSON
+func loadOutput() {
+	if !jsonOutputEnabled {
+		return
+	}
+
+	file := os.Stdout
+	if outputFile != "" {
+		var err error
+		file, err = os.Create(outputFile)
+		check(err)
+	} else {
+		console = os.Stderr
+		colorEnabled = isTerminal(os.Stderr) && os.Getenv("NO_COLOR") == ""
+	}
+
+	jsonOutput = &JSONOutput{file: file, encoder: json.NewEncoder(file)}
+	if scrubEnabled {
+		jsonOutput.scrubber = NewScrubber()
+	}
+}
+
+// Writes every turn once the other plugins are done with it (so it should be registered after moderation)
+func (o *JSONOutput) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		content := turn.Response
+		if o.scrubber != nil {
+			content = o.scrubber.scrub(content)
+		}
+
+		err := o.encoder.Encode(TurnRecord{
+			Round:     turn.Round,
+			Phase:     turn.Phase,
+			Speaker:   turn.Speaker,
+			Persona:   turn.Persona,
+			Model:     turn.Model,
+			Content:   content,
+			Tokens:    turn.Tokens,
+			LatencyMS: time.Since(turn.Started).Milliseconds(),
+		})
+		check(err)
+	})
+}
+
+// Closes the output file (stdout is left open)
+func (o *JSONOutput) close() {
+	if o.file == os.Stdout {
+		return
+	}
+	check(o.file.Close())
+	fmt.Fprintf(console, "\nJSON output saved to %s\n", outputFile)
+}
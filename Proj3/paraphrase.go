@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// Whether the opponent's last statement is paraphrased into bullet points before it goes in the prompt (PARAPHRASE=true)
+	// Models often parrot a statement that is quoted in full, and the bullet points are shorter (fewer prompt tokens)
+	paraphraseEnabled = os.Getenv("PARAPHRASE") == "true"
+
+	// Model that writes the paraphrase (defaults to MODEL)
+	paraphraseModel = os.Getenv("PARAPHRASE_MODEL")
+
+	// Most bullet points the paraphrase can have (PARAPHRASE_POINTS, 1 or 2)
+	paraphrasePoints int
+
+	// Words of every opponent statement before and after it was paraphrased (saved to the transcript metadata)
+	paraphraseMu       sync.Mutex
+	paraphraseWordsIn  int
+	paraphraseWordsOut int
+)
+
+// Loads the paraphrasing settings from the environment variables
+// If they are not valid, use default values
+func loadParaphrase() {
+	var err error
+
+	paraphrasePoints, err = strconv.Atoi(os.Getenv("PARAPHRASE_POINTS"))
+	if err != nil || paraphrasePoints < 1 || paraphrasePoints > 2 {
+		paraphrasePoints = 2
+	}
+
+	if paraphraseModel == "" {
+		paraphraseModel = model
+	}
+}
+
+// Compresses the opponent's statement into its main points, as bullet points on one line (Ex: "- Pork is unclean - The law is clear")
+// Returns the statement unchanged if the paraphrase failed or is not shorter, and the completion tokens used
+func paraphraseOpponent(statement string) (string, int) {
+	history := []ChatMessage{
+		{
+			Role:    "system",
+			Content: "You restate debate arguments faithfully and neutrally, in your own words, without adding anything.",
+		},
+		{
+			Role: "user",
+			Content: fmt.Sprintf("Restate the argument in this statement as at most %d short bullet points, each starting with \"- \". "+
+				"Only write the bullet points: \"%s\"", paraphrasePoints, statement),
+		},
+	}
+	paraphrase, tokens := sendRequestUsage(paraphraseModel, history)
+	paraphrase = strings.Join(strings.Fields(paraphrase), " ")
+
+	before, after := countWords(statement), countWords(paraphrase)
+	if paraphrase == "" || paraphrase == "(no response)" || after >= before {
+		return statement, tokens
+	}
+
+	paraphraseMu.Lock()
+	paraphraseWordsIn += before
+	paraphraseWordsOut += after
+	paraphraseMu.Unlock()
+
+	return paraphrase, tokens
+}
+
+// Introduces the opponent's last statement in the prompt
+// With PARAPHRASE=true it is not quoted, so the debater answers the points instead of repeating the wording
+func opponentStatement(message string) string {
+	if paraphraseEnabled {
+		return fmt.Sprintf("Your opponent's argument: %s.", strings.TrimRight(message, ". "))
+	}
+	return fmt.Sprintf("Your opponent stated: \"%s\".", message)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Persona check settings (loaded from environment variables in loadPersonaCheck)
+var (
+	// Whether every response is checked for breaking character (PERSONA_CHECK=true)
+	personaCheckEnabled = os.Getenv("PERSONA_CHECK") == "true"
+
+	// How responses are checked: model (a checker model reads the persona and the response) or embedding (PERSONA_CHECK_METHOD)
+	personaCheckMethod string
+
+	// Checker model for the model method (defaults to MODEL)
+	personaCheckModel = os.Getenv("PERSONA_CHECK_MODEL")
+
+	// Cosine similarity to the debater's system message below which a response breaks character, for the embedding method (0 to 1)
+	personaThreshold float64
+
+	// Whether a response that breaks character is regenerated once (PERSONA_REGENERATE=true), otherwise it is only recorded
+	personaRegenerate = os.Getenv("PERSONA_REGENERATE") == "true"
+)
+
+// Loads the persona check settings from the environment variables
+// If they are not valid, use default values
+func loadPersonaCheck() {
+	personaCheckMethod = strings.ToLower(strings.TrimSpace(os.Getenv("PERSONA_CHECK_METHOD")))
+	if personaCheckMethod != "embedding" {
+		personaCheckMethod = "model"
+	}
+
+	if personaCheckModel == "" {
+		personaCheckModel = model
+	}
+
+	var err error
+	personaThreshold, err = strconv.ParseFloat(os.Getenv("PERSONA_CHECK_THRESHOLD"), 64)
+	if err != nil || personaThreshold <= 0 || personaThreshold > 1 {
+		personaThreshold = 0.4
+	}
+}
+
+// Response that broke its debater's character
+type PersonaEvent struct {
+	Round   int    `json:"round"`
+	Phase   Phase  `json:"phase"`
+	Speaker int    `json:"speaker"`
+	Persona string `json:"persona"`
+	Reason  string `json:"reason"`
+
+	// Similarity to the system message (embedding method only)
+	Similarity float64 `json:"similarity,omitempty"`
+
+	// Whether the response was regenerated, and whether the new one stayed in character
+	Regenerated bool `json:"regenerated"`
+	Fixed       bool `json:"fixed"`
+}
+
+// Plugin that checks every response against its debater's persona (the system message), recording each one that breaks character
+// With PERSONA_REGENERATE=true, the response is regenerated once (so it should be registered after moderation, which can rewrite the response)
+type PersonaCheck struct {
+	Events []PersonaEvent
+
+	// Embedding of each debater's system message (embedding method only)
+	personas [2][]float64
+
+	// Set if the embeddings endpoint fails, so the check is skipped for the rest of the debate
+	disabled bool
+}
+
+func (p *PersonaCheck) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		// A steelman deliberately argues the other side, so it would always look out of character
+		if p.disabled || turn.Phase == PhaseSteelman {
+			return
+		}
+
+		system := e.Histories[turn.Speaker][0].Content
+		inCharacter, reason, similarity := p.check(turn.Speaker, system, turn.Response)
+		if inCharacter || p.disabled {
+			return
+		}
+
+		event := PersonaEvent{Round: turn.Round, Phase: turn.Phase, Speaker: turn.Speaker, Persona: turn.Persona, Reason: reason, Similarity: similarity}
+		if !personaRegenerate {
+			fmt.Fprintf(console, "\n(LLM %d broke character as %s: %s.)", turn.Speaker, turn.Persona, reason)
+			p.Events = append(p.Events, event)
+			return
+		}
+
+		fmt.Fprintf(console, "\n(LLM %d broke character as %s: %s. Asking for a new response.)", turn.Speaker, turn.Persona, reason)
+		retryHistory := append(turn.History[:len(turn.History):len(turn.History)],
+			ChatMessage{Role: "assistant", Content: turn.Response},
+			ChatMessage{Role: "user", Content: fmt.Sprintf(
+				"Your reply broke character (%s). Answer again as the %s you are, with your own beliefs and voice, keeping to the debate.", reason, turn.Persona)},
+		)
+		response, used := sendRequestTemperature(turn.Model, retryHistory, turn.Temperature)
+		var retryTokens int
+		turn.Response, retryTokens = enforceBudget(turn.Model, retryHistory, response, turn.Words)
+		turn.Tokens += used + retryTokens
+
+		event.Regenerated = true
+		event.Fixed, _, _ = p.check(turn.Speaker, system, turn.Response)
+		if !event.Fixed {
+			fmt.Fprintf(console, "\n(LLM %d is still out of character.)", turn.Speaker)
+		}
+		p.Events = append(p.Events, event)
+	})
+}
+
+// Checks whether the response stays in the character of the debater's system message
+// Returns whether it does, the reason if it doesn't, and the similarity to the system message (embedding method only)
+func (p *PersonaCheck) check(speaker int, system, response string) (bool, string, float64) {
+	if response == "" {
+		return true, "", 0
+	}
+
+	if personaCheckMethod == "model" {
+		inCharacter, reason := checkCharacter(system, response)
+		return inCharacter, reason, 0
+	}
+
+	// The system message is only embedded once per debater
+	var err error
+	if p.personas[speaker] == nil {
+		if p.personas[speaker], err = embed(system); err != nil {
+			p.turnOff(err)
+			return true, "", 0
+		}
+	}
+	embedding, err := embed(response)
+	if err != nil {
+		p.turnOff(err)
+		return true, "", 0
+	}
+
+	similarity := cosineSimilarity(p.personas[speaker], embedding)
+	if similarity >= personaThreshold {
+		return true, "", similarity
+	}
+	return false, fmt.Sprintf("similarity to the persona %.2f, below %.2f", similarity, personaThreshold), similarity
+}
+
+// Stops checking for the rest of the debate, since the embeddings endpoint failed
+func (p *PersonaCheck) turnOff(err error) {
+	fmt.Fprintf(console, "\n(Persona check turned off, the embeddings endpoint failed: %s)", err)
+	p.disabled = true
+}
+
+// Asks the checker model whether the statement is something the persona of the system message would say
+// Returns whether it is, and the reason if it is not
+func checkCharacter(system, response string) (bool, string) {
+	verdict := sendRequestTo(personaCheckModel, []ChatMessage{
+		{
+			Role: "system",
+			Content: "You check whether a debater stays in character. You are given the instructions that define the debater's persona, " +
+				"and one of their statements. Disagreeing, conceding a point, or asking questions is fine, as long as it is in the persona's voice and beliefs. " +
+				"Reply CONSISTENT if the statement fits the persona, otherwise reply BROKE followed by a short reason " +
+				"(Ex: speaking as an AI, arguing the opponent's beliefs as its own, or abandoning its own tradition).",
+		},
+		{
+			Role:    "user",
+			Content: fmt.Sprintf("Persona: \"%s\" Statement: \"%s\"", system, response),
+		},
+	})
+
+	// Whichever answer comes first is the verdict (the reason can mention the other word)
+	upper := strings.ToUpper(verdict)
+	broke, consistent := strings.Index(upper, "BROKE"), strings.Index(upper, "CONSISTENT")
+	if broke != -1 && (consistent == -1 || broke < consistent) {
+		reason := strings.TrimSpace(verdict[broke+len("BROKE"):])
+		return false, strings.TrimLeft(reason, ":- ")
+	}
+	return true, ""
+}
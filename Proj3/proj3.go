@@ -1,12 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -20,6 +17,9 @@ var (
 	religion0 string = os.Getenv("LLM_ZERO")
 	religion1 string = os.Getenv("LLM_ONE")
 	topic     string = os.Getenv("TOPIC")
+
+	// Adds a steelman round before the closing (STEELMAN=true)
+	steelmanEnabled bool = os.Getenv("STEELMAN") == "true"
 )
 
 // Message structure that both request and response use
@@ -32,6 +32,15 @@ type ChatMessage struct {
 type ChatRequest struct {
 	Model    string        `json:"model"`
 	Messages []ChatMessage `json:"messages"`
+
+	// Limits the length of the response (only used for warm-up pings, 0 means no limit)
+	MaxTokens int `json:"max_tokens,omitempty"`
+
+	// Generation temperature, set by the debater's tone (0 uses the server's default)
+	Temperature float64 `json:"temperature,omitempty"`
+
+	// Sampling seed (SEED), so servers that accept one give the same response to the same request
+	Seed *int `json:"seed,omitempty"`
 }
 
 // Response that is received from the AI
@@ -39,6 +48,11 @@ type ChatResponse struct {
 	Choices []struct {
 		Message ChatMessage `json:"message"`
 	} `json:"choices"`
+
+	// Token counts (not every server reports them)
+	Usage struct {
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
 }
 
 // Ends program if there was an error
@@ -48,44 +62,53 @@ func check(e error) {
 	}
 }
 
+// Sends the conversation history to the debate model, returning its response
 func sendRequest(history []ChatMessage) string {
+	return sendRequestTo(model, history)
+}
 
-	// Create the request
-	reqBody := ChatRequest{
-		Model:    model,
-		Messages: history,
-	}
-
-	// Marshal this data into bytes
-	reqBytes, err := json.Marshal(reqBody)
-	check(err)
+// Sends the conversation history to the given model, returning its response
+func sendRequestTo(modelName string, history []ChatMessage) string {
+	response, _ := sendRequestUsage(modelName, history)
+	return response
+}
 
-	// Create the HTTP POST Request
-	req, err := http.NewRequest("POST", BASE_URL+"chat/completions", bytes.NewBuffer(reqBytes))
-	check(err)
+// Sends the conversation history to the given model, returning its response and how many completion tokens it used
+func sendRequestUsage(modelName string, history []ChatMessage) (string, int) {
+	return sendRequestTemperature(modelName, history, 0)
+}
 
-	// Sets headers for this request
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer API")
+// Sends the conversation history to the given model at the given temperature (0 uses the server's default)
+// Returns the model's response and how many completion tokens it used
+func sendRequestTemperature(modelName string, history []ChatMessage, temperature float64) (string, int) {
 
-	// Client will do this request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	check(err)
-	defer resp.Body.Close()
+	// Create the request
+	reqBody := ChatRequest{
+		Model:       modelName,
+		Messages:    history,
+		Temperature: temperature,
+		Seed:        sampleSeed,
+	}
 
-	// Get information from request into bytes
-	body, _ := io.ReadAll(resp.Body)
+	// Send the request (retried on rate limits and server errors, and switched to SECONDARY_BASE_URL if it keeps failing)
+	body, elapsed := completeChat(reqBody)
 
 	// Unmarshal the bytes into JSON format
+	// A body that is cut off or not JSON has whatever content it has salvaged (instead of ending the debate)
 	var chatResp ChatResponse
-	err = json.Unmarshal(body, &chatResp)
-	check(err)
+	err := json.Unmarshal(body, &chatResp)
+	if err != nil {
+		recordRequestError(modelName, "decode")
+		return salvageResponse(reqBody, body, elapsed)
+	}
 
 	// Makes sure a response is returned
 	if len(chatResp.Choices) == 0 {
-		return "(no response)"
+		recordRequestError(modelName, "empty")
+		return "(no response)", 0
 	}
+	tokens := tokenCount(chatResp.Usage.CompletionTokens, chatResp.Choices[0].Message.Content)
+	recordRequest(modelName, elapsed, tokens)
 
 	// Print out and return the LLMs response
 	respText := chatResp.Choices[0].Message.Content
@@ -94,7 +117,7 @@ func sendRequest(history []ChatMessage) string {
 	respText = strings.ReplaceAll(respText, "\n", " ")
 
 	// Return this text
-	return respText
+	return respText, tokens
 }
 
 // MAIN ENTRY INTO THE PROGRAM
@@ -107,6 +130,42 @@ func main() {
 		log.Fatal("Missing BASE_URL or MODEL environmental variables.")
 	}
 
+	// Open the JSON output first (if OUTPUT=json), since it can move everything else that is printed to stderr
+	loadOutput()
+
+	// Serve Prometheus metrics while the debate runs (if METRICS=true)
+	startMetrics()
+
+	// Load word/sentence limit guardrails, branching, and context window settings
+	loadGuardrails()
+	loadBranching()
+	loadContextLimits()
+	loadRetries()
+	loadRateLimits()
+	loadReproducibility()
+	loadSalvage()
+	loadThinking()
+	loadParaphrase()
+	loadTTS()
+	loadScrubbing()
+	loadRepetition()
+	loadJudge()
+	loadConvergence()
+	loadDrift()
+	loadPersonaCheck()
+	loadComparison()
+	loadExport()
+	loadGlossary()
+	loadSeed()
+	loadTone()
+	loadPersonaStyles()
+
+	// Make sure every model answers before starting (switching to FALLBACK_MODEL if one doesn't)
+	latencies := warmUpModels()
+
+	// Summarize each debater's reference documents (after the warm-up, since summarizing uses the model)
+	loadEvidence()
+
 	// Make sure topic is valid
 	if topic == "" {
 		topic = "The War in Gaza"
@@ -119,99 +178,276 @@ func main() {
 		religion1 = "Jewish"
 	}
 
-	// How many words per turn (guideline)
-	words := 10
+	// When comparing models, both debaters share the first persona so only the model is different
+	if compareEnabled {
+		religion1 = religion0
+		fmt.Fprintf(console, "Comparing %s and %s, both speaking from a %s perspective\n", compareModels[0], compareModels[1], religion0)
+	}
 
-	// Set up initial system message for these LLMs
+	// Set up initial system message for these LLMs (each with the instruction for their tone)
 	llm0_message := fmt.Sprintf(
 		"You speak from a %s perspective on the topic: %s. "+
-			"Be calm, factual, concise, and logical. Present new points each turn, without repeating previous statements.",
-		religion0, topic)
+			"%s Present new points each turn, without repeating previous statements.",
+		religion0, topic, debaterTones[0].Instruction)
 
 	llm1_message := fmt.Sprintf(
 		"You speak from a %s perspective on the topic: %s. "+
-			"Be calm, factual, concise, and logical. Present new points each turn, without repeating previous statements.",
-		religion1, topic)
-
-	// Initialize conversation histories
-	histories := map[int][]ChatMessage{
-		0: {
-			{
-				Role:    "system",
-				Content: llm0_message,
-			},
-		},
-		1: {
-			{
-				Role:    "system",
-				Content: llm1_message,
-			},
-		},
+			"%s Present new points each turn, without repeating previous statements.",
+		religion1, topic, debaterTones[1].Instruction)
+	// Add each persona's stylistic constraints (from PERSONA_FILE)
+	if style, found := styleFor(religion0); found {
+		llm0_message += style.instructions()
+	}
+	if style, found := styleFor(religion1); found {
+		llm1_message += style.instructions()
+	}
+
+	// Give each debater their own evidence to argue from (EVIDENCE_ZERO, EVIDENCE_ONE)
+	llm0_message += evidenceInstructions(0)
+	llm1_message += evidenceInstructions(1)
+
+	// Tell each debater about the earlier debate they are following up on (SEED_TRANSCRIPT)
+	llm0_message += seedSection(0)
+	llm1_message += seedSection(1)
+
+	if toneEnabled {
+		fmt.Fprintf(console, "Tone: LLM 0 is %s, LLM 1 is %s\n", debaterTones[0].Name, debaterTones[1].Name)
+	}
+
+	// Classify how sensitive the topic is before starting
+	// High-sensitivity topics get stricter system prompts and have every response moderated
+	sensitivity := classifyTopic(topic)
+	fmt.Fprintf(console, "Topic sensitivity: %s\n", sensitivity)
+	if sensitivity == SensitivityHigh {
+		llm0_message += strictGuardrails
+		llm1_message += strictGuardrails
+		moderationEnabled = true
 	}
 
 	// Store how many turns each LLM has to speak
 	turns := 5
 
+	// The steelman round is an extra round before the closing
+	if steelmanEnabled {
+		turns++
+	}
+
+	religions := [2]string{religion0, religion1}
+	engine := NewDebateEngine(religions, [2]string{llm0_message, llm1_message}, turns)
+	engine.Steelman = steelmanEnabled
+	engine.Temperatures = [2]float64{debaterTones[0].Temperature, debaterTones[1].Temperature}
+	if compareEnabled {
+		engine.Models = compareModels
+	}
+	if seedTranscript != nil {
+		engine.Seed(seedTranscript.Turns)
+	}
+
+	// Record of every turn in the debate
+	transcript := &Transcript{Topic: topic, Personas: religions, Model: model}
+	if compareEnabled {
+		transcript.Model = compareModels[0] + " vs " + compareModels[1]
+	}
+	transcript.Metadata = map[string]any{"topic_sensitivity": sensitivity, "moderation": moderationEnabled, "model_latency": latencies}
+
+	// Register the optional features, in the order they should run each turn
+	// The repetition check and moderation run first so the transcript and fact ledger only see the final response
+	if repetitionEnabled {
+		engine.Use(&RepetitionGuard{})
+	}
+	moderator := &Moderator{Events: []ModerationEvent{}}
+	if moderationEnabled {
+		engine.Use(moderator)
+	}
+
+	// Check every response against its persona's constraints (after moderation, since a rewrite can break them again)
+	styleGuard := &StyleGuard{Violations: []StyleViolation{}}
+	if len(personaStyles) > 0 {
+		engine.Use(styleGuard)
+	}
+
+	// Check every response stays in its debater's character (before the transcript records it, since it can be regenerated)
+	personaCheck := &PersonaCheck{Events: []PersonaEvent{}}
+	if personaCheckEnabled {
+		engine.Use(personaCheck)
+	}
+	engine.Use(transcript)
+
+	// Record which documents each response cites
+	evidence := &EvidenceTracker{Citations: []EvidenceCitation{}}
+	if evidenceEnabled() {
+		engine.Use(evidence)
+	}
+
+	// Check every round for personal attacks (after moderation, so only the final responses are checked)
+	toneCheck := &ToneCheck{}
+	if toneCheckEnabled {
+		engine.Use(toneCheck)
+	}
+
+	// Check every response for drifting off the topic (after moderation, so only the final responses are checked)
+	driftCheck := &DriftCheck{Events: []DriftEvent{}}
+	if driftEnabled {
+		engine.Use(driftCheck)
+	}
+
+	// Map the claims of every turn and which claims they rebut (after moderation, so only the final responses are mapped)
+	graph := &DebateGraph{Turns: []GraphTurn{}, Claims: []GraphClaim{}, Edges: []GraphEdge{}}
+	if graphFile != "" {
+		engine.Use(graph)
+	}
+
+	// Write every turn as JSON (after moderation, so only the final response is written)
+	if jsonOutputEnabled {
+		engine.Use(jsonOutput)
+	}
+
+	// Read every turn aloud (after moderation, so only the final response is voiced)
+	narrator := &Narrator{}
+	if ttsEnabled {
+		engine.Use(narrator)
+	}
+
+	// Shared list of facts asserted by both LLMs
+	ledger := &FactLedger{}
+	if factsEnabled {
+		engine.Use(ledger)
+	}
+
+	// Score every turn (after moderation, so only the final response is judged)
+	judge := &Judge{}
+	if judgeEnabled {
+		engine.Use(judge)
+	}
+
+	// End the debate early once it stops producing new points (after the judge, since a plateau of its scores also counts)
+	convergence := &ConvergenceCheck{}
+	if judgeEnabled {
+		convergence.Judge = judge
+	}
+	if convergenceEnabled {
+		engine.Use(convergence)
+	}
+
+	// Turn every final response into a training example (after moderation, so only the final response is exported)
+	exporter := &Exporter{}
+	if exportFile != "" {
+		engine.Use(exporter)
+	}
+
+	// Score both models on coherence, novelty, and word limit adherence
+	comparison := &ModelComparison{}
+	if compareEnabled {
+		engine.Use(comparison)
+	}
+
 	// Start the debate
-	for range turns {
-		for id := range 2 {
-
-			// For ID 0, the other ID is 1
-			// For ID 1, the other ID is 0
-			opponentID := 1 - id
-
-			// Start fresh history for this LLM
-			history := []ChatMessage{
-				{
-					Role: "system",
-
-					// System message: this LLM's personality
-					Content: histories[id][0].Content,
-				},
-			}
-
-			// Get the last message from the opponent (if it exists)
-			lastOpponentMessage := ""
-			if len(histories[opponentID]) > 1 {
-				lastOpponentMessage = histories[opponentID][len(histories[opponentID])-1].Content
-			}
-
-			userPrompt := ""
-			if lastOpponentMessage != "" {
-				userPrompt = fmt.Sprintf(
-					"Your opponent stated: \"%s\". From your perspective, respond with a counterargument. "+
-						"Do not quote your opponent verbatim; focus on your reasoning and beliefs. <=%d words.",
-					lastOpponentMessage, words)
-			} else {
-				userPrompt = fmt.Sprintf("Start the debate from your perspective, <=%d words.", words)
-			}
-
-			// Add this prompt to the history
-			history = append(history, ChatMessage{
-				Role:    "user",
-				Content: userPrompt,
-			})
-
-			// LOOKING AT THE PROMPTS FOR THIS
-			//for i := range len(history) {
-			//	fmt.Println(history[i].Content)
-			//}
-			//fmt.Println()
-
-			// Get LLM to respond to this request
-			response := sendRequest(history)
-
-			// Save this turn
-			histories[id] = append(histories[id], ChatMessage{
-				Role:    "assistant",
-				Content: response,
-			})
-
-			// Print message from this LLM
-			fmt.Printf("\nLLM %d: %s", id, response)
+	engine.Run()
+
+	// The judge scores in the background, so wait for the last turns to be scored
+	judge.wait()
+
+	// Banner at the end of the debate (the comparison decides the verdict when models are compared)
+	verdict := judge.verdict(religions)
+	var result Comparison
+	if compareEnabled {
+		result = comparison.result(religion0)
+		verdict = result.verdict()
+	}
+	printVerdictBanner(religions, transcript.Turns, verdict, engine.StopReason)
+
+	// Structured comparison of both models
+	if compareEnabled {
+		result.print()
+		result.save(comparisonFile)
+		transcript.Metadata["model_comparison"] = result
+	}
+
+	// Final report of every fact asserted during the debate
+	if factsEnabled {
+		ledger.print()
+		transcript.Facts = ledger.Facts
+	}
+
+	// Define the technical terms used during the debate (after the fact ledger, at the end of the report)
+	if glossaryEnabled {
+		transcript.Glossary = buildGlossary(transcript.Turns)
+		printGlossary(transcript.Glossary)
+	}
+
+	// Compare how each debater argued (sentence length, vocabulary, sentiment, questions)
+	if styleReportEnabled {
+		styles := analyzeStyles(transcript.Turns)
+		printStyleReport(styles)
+		transcript.Styles = &styles
+	}
+
+	// Save the combined recording of the debate
+	if ttsEnabled {
+		narrator.save()
+	}
+
+	// Save the transcript if a file was given
+	transcript.Metadata["moderation_events"] = moderator.Events
+	if driftEnabled {
+		transcript.Metadata["drift_model"] = driftModel
+		transcript.Metadata["drift_events"] = driftCheck.Events
+	}
+	if personaCheckEnabled {
+		transcript.Metadata["persona_check_method"] = personaCheckMethod
+		if personaCheckMethod == "model" {
+			transcript.Metadata["persona_check_model"] = personaCheckModel
+		} else {
+			transcript.Metadata["persona_check_threshold"] = personaThreshold
 		}
+		transcript.Metadata["persona_events"] = personaCheck.Events
+	}
+	if len(personaStyles) > 0 {
+		transcript.Metadata["style_violations"] = styleGuard.Violations
+	}
+	if evidenceEnabled() {
+		transcript.Metadata["evidence"] = evidencePackets
+		transcript.Metadata["evidence_citations"] = evidence.Citations
+	}
+	if thinkEnabled {
+		transcript.Metadata["think_words"] = thinkWords
+	}
+	if paraphraseEnabled {
+		transcript.Metadata["paraphrase_model"] = paraphraseModel
+		transcript.Metadata["paraphrase_words"] = map[string]int{"before": paraphraseWordsIn, "after": paraphraseWordsOut}
+	}
+	if sampleSeed != nil {
+		transcript.Metadata["seed"] = *sampleSeed
+	}
+	if seedTranscript != nil {
+		transcript.Metadata["seed_transcript"] = seedFile
+		transcript.Metadata["seed_mode"] = seedMode
+		transcript.Metadata["seed_turns"] = len(seedTranscript.Turns)
+	}
+	if toneEnabled {
+		transcript.Metadata["tone"] = toneNames()
+		transcript.Metadata["tone_nudges"] = toneCheck.Nudges
+	}
+	if convergenceEnabled {
+		transcript.Metadata["early_termination"] = convergence.Reason
+	}
+	if judgeEnabled {
+		transcript.Metadata["judge_model"] = judgeModel
+		transcript.Metadata["judge_scores"] = judge.Scores
+	}
+	if transcriptFile != "" {
+		transcript.save(transcriptFile)
+	}
+	if graphFile != "" {
+		graph.save(graphFile)
+	}
+	if exportFile != "" {
+		exporter.save(exportFile, judge.Scores)
+	}
+	if jsonOutputEnabled {
+		jsonOutput.close()
 	}
 
 	// Once the conversation is complete and the results are processed, the program can end
-	fmt.Printf("\nProgram took %s to run.\n", time.Since(start))
+	fmt.Fprintf(console, "\nProgram took %s to run.\n", time.Since(start))
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rate limit settings (loaded from environment variables in loadRateLimits)
+var (
+	// Most requests sent to one provider at the same time (MAX_CONCURRENT_REQUESTS, 0 means no limit)
+	maxConcurrentRequests int
+
+	// Most requests started per minute on one provider (REQUESTS_PER_MINUTE, 0 means no limit)
+	requestsPerMinute int
+
+	// Limiter of every provider the debate has sent a request to, by base URL
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*providerLimiter)
+)
+
+// Loads the rate limit settings from the environment variables
+// If they are not valid, use default values
+func loadRateLimits() {
+	var err error
+
+	maxConcurrentRequests, err = strconv.Atoi(os.Getenv("MAX_CONCURRENT_REQUESTS"))
+	if err != nil || maxConcurrentRequests < 0 {
+		maxConcurrentRequests = 4
+	}
+
+	requestsPerMinute, err = strconv.Atoi(os.Getenv("REQUESTS_PER_MINUTE"))
+	if err != nil || requestsPerMinute < 0 {
+		requestsPerMinute = 0
+	}
+}
+
+// Keeps the requests to one provider under its limits
+// Every request (turns, judging, moderation, embeddings) waits here, so the judge working in the background
+// or several debates at once can't send more than the provider allows
+type providerLimiter struct {
+	// One slot for each request that can be sent at the same time (nil if there is no limit)
+	slots chan struct{}
+
+	// Time between the starts of two requests, and when the next request can start (0 if there is no limit)
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// Returns the limiter of the provider at the base URL (created the first time it is used)
+func limiterFor(baseURL string) *providerLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	limiter, exists := limiters[baseURL]
+	if !exists {
+		limiter = &providerLimiter{}
+		if maxConcurrentRequests > 0 {
+			limiter.slots = make(chan struct{}, maxConcurrentRequests)
+		}
+		if requestsPerMinute > 0 {
+			limiter.interval = time.Minute / time.Duration(requestsPerMinute)
+		}
+		limiters[baseURL] = limiter
+	}
+	return limiter
+}
+
+// Waits until a request can be sent to the provider at the base URL, returning the function that frees its slot
+// How long the request waited is recorded for the Prometheus metrics
+func acquireProvider(baseURL string) func() {
+	limiter := limiterFor(baseURL)
+	start := time.Now()
+
+	if limiter.slots != nil {
+		limiter.slots <- struct{}{}
+	}
+
+	// Each request reserves the next start time, so waiting requests are spread out evenly
+	if limiter.interval > 0 {
+		limiter.mu.Lock()
+		now := time.Now()
+		startAt := limiter.next
+		if startAt.Before(now) {
+			startAt = now
+		}
+		limiter.next = startAt.Add(limiter.interval)
+		limiter.mu.Unlock()
+
+		time.Sleep(time.Until(startAt))
+	}
+	requestWait.WithLabelValues(baseURL).Observe(time.Since(start).Seconds())
+
+	return func() {
+		if limiter.slots != nil {
+			<-limiter.slots
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Repetition check settings (loaded from environment variables in loadRepetition)
+var (
+	// Whether each response is compared to earlier turns (REPETITION_CHECK=true)
+	repetitionEnabled = os.Getenv("REPETITION_CHECK") == "true"
+
+	// Model used by the embeddings endpoint (defaults to MODEL)
+	embeddingModel = os.Getenv("EMBEDDING_MODEL")
+
+	// Cosine similarity above which a response counts as a repeat (0 to 1)
+	repetitionThreshold float64
+)
+
+// Request sent to the embeddings endpoint
+type EmbeddingRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+// Response from the embeddings endpoint
+type EmbeddingResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Loads the repetition check settings from the environment variables
+// If they are not valid, use default values
+func loadRepetition() {
+	if embeddingModel == "" {
+		embeddingModel = model
+	}
+
+	var err error
+	repetitionThreshold, err = strconv.ParseFloat(os.Getenv("REPETITION_THRESHOLD"), 64)
+	if err != nil || repetitionThreshold <= 0 || repetitionThreshold > 1 {
+		repetitionThreshold = 0.9
+	}
+}
+
+// Plugin that re-prompts a debater whose response is too similar to an earlier turn
+type RepetitionGuard struct {
+	// Embedding and text of every turn so far (from both debaters)
+	embeddings [][]float64
+	texts      []string
+
+	// Set if the embeddings endpoint fails, so the check is skipped for the rest of the debate
+	disabled bool
+}
+
+// Checks every response before the other plugins see it (so it should be registered before moderation)
+func (g *RepetitionGuard) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		if g.disabled {
+			return
+		}
+
+		embedding, err := embed(turn.Response)
+		if err != nil {
+			fmt.Fprintf(console, "\n(Repetition check turned off, the embeddings endpoint failed: %s)", err)
+			g.disabled = true
+			return
+		}
+
+		// Find the most similar earlier turn
+		best, bestIndex := 0.0, -1
+		for i, earlier := range g.embeddings {
+			if similarity := cosineSimilarity(embedding, earlier); similarity > best {
+				best, bestIndex = similarity, i
+			}
+		}
+
+		// Too similar, so ask for a new argument (once) and keep whatever comes back
+		if bestIndex != -1 && best > repetitionThreshold {
+			fmt.Fprintf(console, "\n(LLM %d repeated an earlier point, similarity %.2f. Asking for a new argument.)", turn.Speaker, best)
+
+			retryHistory := append(turn.History[:len(turn.History):len(turn.History)],
+				ChatMessage{Role: "assistant", Content: turn.Response},
+				ChatMessage{Role: "user", Content: fmt.Sprintf(
+					"Your reply repeats a point that was already made: \"%s\". Make a different argument that has not been made yet.",
+					g.texts[bestIndex])},
+			)
+			response, used := sendRequestUsage(turn.Model, retryHistory)
+			var retryTokens int
+			turn.Response, retryTokens = enforceBudget(turn.Model, retryHistory, response, turn.Words)
+			turn.Tokens += used + retryTokens
+
+			if embedding, err = embed(turn.Response); err != nil {
+				fmt.Fprintf(console, "\n(Repetition check turned off, the embeddings endpoint failed: %s)", err)
+				g.disabled = true
+				return
+			}
+		}
+
+		g.embeddings = append(g.embeddings, embedding)
+		g.texts = append(g.texts, turn.Response)
+	})
+}
+
+// Returns the embedding of the text from the provider's embeddings endpoint
+func embed(text string) ([]float64, error) {
+	reqBytes, err := json.Marshal(EmbeddingRequest{Model: embeddingModel, Input: text})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", BASE_URL+"embeddings", bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer API")
+
+	// Embeddings share the chat requests' rate limits, since they go to the same server
+	release := acquireProvider(BASE_URL)
+	defer release()
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+
+	var embResp EmbeddingResponse
+	if err := json.Unmarshal(body, &embResp); err != nil {
+		return nil, err
+	}
+	if len(embResp.Data) == 0 || len(embResp.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("no embedding returned")
+	}
+	return embResp.Data[0].Embedding, nil
+}
+
+// Returns the cosine similarity of two vectors (0 if they can't be compared)
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Sampling seed sent with every completion request (SEED), nil if none is set
+	// Servers that accept a seed (Ex: llama.cpp, OpenAI) give the same response to the same request, so two runs can be compared
+	// It is unrelated to SEED_TRANSCRIPT, which starts the debate from an earlier one
+	sampleSeed *int
+
+	// Whether the generation parameters of every turn are printed after it (LOG_GENERATION=true)
+	logGeneration = os.Getenv("LOG_GENERATION") == "true"
+)
+
+// Everything that decided how a turn's response was generated, saved with the turn
+// Two runs with the same inputs and parameters should have the same turns (if the server honors the seed)
+type GenerationParams struct {
+	Model string `json:"model"`
+
+	// 0 uses the server's default
+	Temperature float64 `json:"temperature"`
+	Seed        *int    `json:"seed,omitempty"`
+
+	// Word and sentence limits of the turn (0 sentences means no limit)
+	Words        int `json:"words"`
+	MaxSentences int `json:"max_sentences"`
+
+	// Candidates generated for the turn, and the model that picked one (if there was more than one)
+	Candidates    int    `json:"candidates"`
+	SelectorModel string `json:"selector_model,omitempty"`
+
+	// Most words of the private reasoning (0 if the debater did not reason first)
+	ThinkWords int `json:"think_words,omitempty"`
+}
+
+// Loads the seed from the environment variables
+// If it is not a number, no seed is sent
+func loadReproducibility() {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SEED")))
+	if err != nil {
+		return
+	}
+	sampleSeed = &value
+}
+
+// Returns the generation parameters of the turn
+func generationParams(turn *TurnContext) GenerationParams {
+	params := GenerationParams{
+		Model:        turn.Model,
+		Temperature:  turn.Temperature,
+		Seed:         sampleSeed,
+		Words:        turn.Words,
+		MaxSentences: maxSentences,
+		Candidates:   branchFactor,
+	}
+	if branchFactor > 1 {
+		params.SelectorModel = selectorModel
+	}
+	if thinkEnabled {
+		params.ThinkWords = thinkWords
+	}
+	return params
+}
+
+// Prints the generation parameters of the turn on one line (LOG_GENERATION=true)
+func printGenerationParams(params GenerationParams) {
+	seed := "none"
+	if params.Seed != nil {
+		seed = strconv.Itoa(*params.Seed)
+	}
+	temperature := "default"
+	if params.Temperature != 0 {
+		temperature = strconv.FormatFloat(params.Temperature, 'g', -1, 64)
+	}
+
+	line := fmt.Sprintf("(model=%s temperature=%s seed=%s words=%d max_sentences=%d candidates=%d",
+		params.Model, temperature, seed, params.Words, params.MaxSentences, params.Candidates)
+	if params.SelectorModel != "" {
+		line += " selector=" + params.SelectorModel
+	}
+	if params.ThinkWords > 0 {
+		line += fmt.Sprintf(" think_words=%d", params.ThinkWords)
+	}
+	fmt.Fprintf(console, "\n%s", colorize(line+")", colorDim))
+}
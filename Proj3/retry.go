@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Times a failed completion is retried before giving up (REQUEST_RETRIES)
+	requestRetries int
+
+	// Wait before the first retry, doubled after every failed attempt (RETRY_DELAY_MS)
+	retryDelay time.Duration
+
+	// Server (and model) used once BASE_URL keeps failing (SECONDARY_BASE_URL and SECONDARY_MODEL, nothing is switched if empty)
+	secondaryBaseURL = os.Getenv("SECONDARY_BASE_URL")
+	secondaryModel   = os.Getenv("SECONDARY_MODEL")
+
+	// Whether the requests were switched to the secondary server (for the rest of the debate, so every turn doesn't wait for the retries again)
+	failoverMu     sync.Mutex
+	usingSecondary bool
+)
+
+// Loads the retry settings from the environment variables
+// If they are not valid, use default values
+func loadRetries() {
+	var err error
+
+	requestRetries, err = strconv.Atoi(os.Getenv("REQUEST_RETRIES"))
+	if err != nil || requestRetries < 0 {
+		requestRetries = 3
+	}
+
+	delayMS, err := strconv.Atoi(os.Getenv("RETRY_DELAY_MS"))
+	if err != nil || delayMS <= 0 {
+		delayMS = 1000
+	}
+	retryDelay = time.Duration(delayMS) * time.Millisecond
+
+	// URLs are joined with the endpoint path, like BASE_URL (which ends with a slash)
+	if secondaryBaseURL != "" && !strings.HasSuffix(secondaryBaseURL, "/") {
+		secondaryBaseURL += "/"
+	}
+}
+
+// Error from a completion request, with the server's own message when it sent one
+type completionError struct {
+	StatusCode int
+	Message    string
+
+	// How long the server asked to wait before trying again (from the Retry-After header, 0 if it didn't say)
+	RetryAfter time.Duration
+}
+
+func (e *completionError) Error() string {
+	if e.StatusCode == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+// Returns whether trying again can help (connection problems, rate limits, and server errors)
+func (e *completionError) retryable() bool {
+	return e.StatusCode == 0 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Sends the chat request, retrying with exponential backoff and switching to the secondary server if BASE_URL keeps failing
+// Ends the program with the server's error message if the request can't be answered
+// Returns the response body, and how long the successful attempt took
+func completeChat(reqBody ChatRequest) ([]byte, time.Duration) {
+	body, elapsed, err := tryCompleteChat(reqBody)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return body, elapsed
+}
+
+// Sends the chat request like completeChat, but returns the error instead of ending the program (Ex: so warmup can try a fallback model)
+func tryCompleteChat(reqBody ChatRequest) ([]byte, time.Duration, error) {
+	failoverMu.Lock()
+	secondary := usingSecondary
+	failoverMu.Unlock()
+
+	if !secondary {
+		body, elapsed, err := completeWithRetries(BASE_URL, reqBody)
+		if err == nil {
+			return body, elapsed, nil
+		}
+		if secondaryBaseURL == "" || !err.retryable() {
+			return nil, 0, fmt.Errorf("Request to %s (model %s) failed: %s", BASE_URL, reqBody.Model, err)
+		}
+
+		failoverMu.Lock()
+		if !usingSecondary {
+			fmt.Fprintf(console, "\n(%s keeps failing: %s. Switching to SECONDARY_BASE_URL %s.)\n", BASE_URL, err, secondaryBaseURL)
+			usingSecondary = true
+		}
+		failoverMu.Unlock()
+	}
+
+	if secondaryModel != "" {
+		reqBody.Model = secondaryModel
+	}
+	body, elapsed, err := completeWithRetries(secondaryBaseURL, reqBody)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Request to SECONDARY_BASE_URL %s (model %s) failed: %s", secondaryBaseURL, reqBody.Model, err)
+	}
+	return body, elapsed, nil
+}
+
+// Sends the chat request to the server, trying again after rate limits and server errors
+// The wait doubles after every attempt (with some jitter), unless the server says how long to wait
+func completeWithRetries(baseURL string, reqBody ChatRequest) ([]byte, time.Duration, *completionError) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		body, elapsed, err := postCompletion(baseURL, reqBody)
+		if err == nil {
+			return body, elapsed, nil
+		}
+		if !err.retryable() || attempt >= requestRetries {
+			return nil, 0, err
+		}
+
+		wait := delay + rand.N(delay/2+1)
+		if err.RetryAfter > 0 {
+			wait = err.RetryAfter
+		}
+		fmt.Fprintf(console, "\n(Request to %s failed: %s. Retrying in %s, attempt %d of %d.)\n",
+			reqBody.Model, err, wait.Round(time.Millisecond), attempt+1, requestRetries)
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+// Sends the chat request to the server once (after waiting for the server's rate limits)
+func postCompletion(baseURL string, reqBody ChatRequest) ([]byte, time.Duration, *completionError) {
+	release := acquireProvider(baseURL)
+	defer release()
+
+	// Marshal this data into bytes
+	reqBytes, err := json.Marshal(reqBody)
+	check(err)
+
+	// Create the HTTP POST Request
+	req, err := http.NewRequest("POST", baseURL+"chat/completions", bytes.NewBuffer(reqBytes))
+	check(err)
+
+	// Sets headers for this request
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer API")
+
+	// Client will do this request (timed for the Prometheus metrics)
+	requestStart := time.Now()
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		recordRequestError(reqBody.Model, "request")
+		return nil, 0, &completionError{Message: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	// Get information from request into bytes
+	body, err := io.ReadAll(resp.Body)
+	elapsed := time.Since(requestStart)
+	if err != nil {
+		recordRequestError(reqBody.Model, "request")
+		return nil, 0, &completionError{Message: err.Error()}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		recordRequestError(reqBody.Model, "status")
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, 0, &completionError{
+			StatusCode: resp.StatusCode,
+			Message:    errorMessage(body),
+			RetryAfter: time.Duration(seconds) * time.Second,
+		}
+	}
+	return body, elapsed, nil
+}
+
+// Returns the message of an error response
+// OpenAI-compatible servers send {"error": {"message": ...}}, but some send {"error": "..."} or {"message": "..."}
+func errorMessage(body []byte) string {
+	var payload struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		var nested struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		}
+		var text string
+		switch {
+		case json.Unmarshal(payload.Error, &nested) == nil && nested.Message != "":
+			if nested.Type != "" {
+				return nested.Message + " (" + nested.Type + ")"
+			}
+			return nested.Message
+		case json.Unmarshal(payload.Error, &text) == nil && text != "":
+			return text
+		case payload.Message != "":
+			return payload.Message
+		}
+	}
+
+	// Not JSON (Ex: a proxy's HTML error page), so show the start of the body
+	text := strings.TrimSpace(string(body))
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	if text == "" {
+		return "empty response"
+	}
+	return text
+}
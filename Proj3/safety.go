@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Topic sensitivity levels
+const (
+	SensitivityLow    = "low"
+	SensitivityMedium = "medium"
+	SensitivityHigh   = "high"
+)
+
+// Whether every response is checked by the moderation pass (always on for high-sensitivity topics)
+var moderationEnabled = os.Getenv("MODERATION") == "true"
+
+// Extra system prompt instructions used for high-sensitivity topics
+var strictGuardrails = " This topic is sensitive. Never demean any religion, ethnicity, or group of people, " +
+	"avoid graphic content, acknowledge the human cost on every side, and keep a respectful tone at all times."
+
+// Something the moderation pass flagged during the debate
+type ModerationEvent struct {
+	Round   int    `json:"round"`
+	Speaker int    `json:"speaker"`
+	Reason  string `json:"reason"`
+}
+
+// Asks the model how sensitive the topic is (low, medium, or high)
+// Defaults to medium if the answer can't be understood
+func classifyTopic(topic string) string {
+	answer := sendRequest([]ChatMessage{
+		{
+			Role: "system",
+			Content: "You classify debate topics by how sensitive they are. " +
+				"Reply with exactly one word: low, medium, or high.",
+		},
+		{
+			Role:    "user",
+			Content: fmt.Sprintf("How sensitive is this topic for a debate between religious perspectives? Topic: %s", topic),
+		},
+	})
+
+	answer = strings.ToLower(answer)
+	for _, level := range []string{SensitivityHigh, SensitivityMedium, SensitivityLow} {
+		if strings.Contains(answer, level) {
+			return level
+		}
+	}
+	return SensitivityMedium
+}
+
+// Checks the response for disrespectful or harmful content
+// Returns whether the response is acceptable, and the reason if it is not
+func moderate(response string) (bool, string) {
+	verdict := sendRequest([]ChatMessage{
+		{
+			Role: "system",
+			Content: "You are a debate moderator. Check the statement for hate speech, insults toward any group, " +
+				"or graphic content. Reply SAFE if it is acceptable, otherwise reply UNSAFE followed by a short reason.",
+		},
+		{
+			Role:    "user",
+			Content: response,
+		},
+	})
+
+	if strings.Contains(strings.ToUpper(verdict), "UNSAFE") {
+		reason := strings.TrimSpace(verdict[strings.Index(strings.ToUpper(verdict), "UNSAFE")+len("UNSAFE"):])
+		return false, strings.TrimLeft(reason, ":- ")
+	}
+	return true, ""
+}
+
+// Runs the moderation pass on a response, asking the model for a respectful rewrite if it is flagged
+// Returns the (possibly rewritten) response, the completion tokens used for the rewrite, and the event if it was flagged
+func moderateTurn(modelName string, history []ChatMessage, response string, words, round, speaker int) (string, int, *ModerationEvent) {
+	ok, reason := moderate(response)
+	if ok {
+		return response, 0, nil
+	}
+
+	fmt.Fprintf(console, "\n(Moderator flagged LLM %d: %s. Asking for a respectful rewrite.)", speaker, reason)
+
+	retryHistory := append(history[:len(history):len(history)],
+		ChatMessage{Role: "assistant", Content: response},
+		ChatMessage{Role: "user", Content: "A moderator flagged your reply as disrespectful or harmful. " +
+			"Rewrite it respectfully, keeping your main point."},
+	)
+	rewritten, used := sendRequestUsage(modelName, retryHistory)
+	rewritten, retryTokens := enforceBudget(modelName, retryHistory, rewritten, words)
+
+	return rewritten, used + retryTokens, &ModerationEvent{Round: round, Speaker: speaker, Reason: reason}
+}
+
+// Plugin that runs the moderation pass on every turn, keeping track of every flagged response
+type Moderator struct {
+	Events []ModerationEvent
+}
+
+// Checks every response before it is saved (so a flagged response is replaced by its rewrite)
+func (m *Moderator) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		var event *ModerationEvent
+		var tokens int
+		turn.Response, tokens, event = moderateTurn(turn.Model, turn.History, turn.Response, turn.Words, turn.Round, turn.Speaker)
+		turn.Tokens += tokens
+		if event != nil {
+			m.Events = append(m.Events, *event)
+		}
+	})
+}
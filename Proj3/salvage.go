@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Salvage settings (loaded from environment variables in loadSalvage)
+var (
+	// max_tokens of the first retry when a malformed response had nothing to salvage, halved for the next (SALVAGE_MAX_TOKENS)
+	salvageMaxTokens int
+)
+
+// Times a malformed response with nothing to salvage is requested again (with a smaller max_tokens each time)
+const salvageRetries = 2
+
+// Finds the message content in a response that is not valid JSON, even if the body was cut off before the string ended
+// Streamed bodies have one "content" per chunk, which are joined
+var contentPattern = regexp.MustCompile(`"content"\s*:\s*"((?:[^"\\]|\\.)*)`)
+
+// Loads the salvage settings from the environment variables
+// If they are not valid, use default values
+func loadSalvage() {
+	var err error
+	salvageMaxTokens, err = strconv.Atoi(os.Getenv("SALVAGE_MAX_TOKENS"))
+	if err != nil || salvageMaxTokens <= 0 {
+		salvageMaxTokens = 512
+	}
+}
+
+// Returns the text of a response that could not be decoded (truncated or not JSON, common with local servers)
+// Whatever content is in the body is kept, otherwise the request is sent again with a smaller max_tokens
+// (so the server has less to cut off), instead of ending a long debate
+func salvageResponse(reqBody ChatRequest, body []byte, elapsed time.Duration) (string, int) {
+	for attempt := 0; ; attempt++ {
+		if text, found := salvageContent(body); found {
+			fmt.Fprintf(console, "\n(Response from %s was not valid JSON. Salvaged %d words of its content.)", reqBody.Model, len(strings.Fields(text)))
+			recordRequestError(reqBody.Model, "salvaged")
+			tokens := tokenCount(0, text)
+			recordRequest(reqBody.Model, elapsed, tokens)
+			return strings.ReplaceAll(text, "\n", " "), tokens
+		}
+		if attempt == salvageRetries {
+			break
+		}
+
+		// Nothing to salvage, so ask again for a shorter response
+		reqBody.MaxTokens = salvageMaxTokens >> attempt
+		fmt.Fprintf(console, "\n(Response from %s was not valid JSON and had no content to salvage. Retrying with max_tokens=%d.)", reqBody.Model, reqBody.MaxTokens)
+		body, elapsed = completeChat(reqBody)
+
+		var chatResp ChatResponse
+		if json.Unmarshal(body, &chatResp) == nil && len(chatResp.Choices) > 0 {
+			text := chatResp.Choices[0].Message.Content
+			tokens := tokenCount(chatResp.Usage.CompletionTokens, text)
+			recordRequest(reqBody.Model, elapsed, tokens)
+			return strings.ReplaceAll(text, "\n", " "), tokens
+		}
+		recordRequestError(reqBody.Model, "decode")
+	}
+
+	fmt.Fprintf(console, "\n(Response from %s could not be salvaged after %d retries. Continuing without it.)", reqBody.Model, salvageRetries)
+	recordRequestError(reqBody.Model, "empty")
+	return "(no response)", 0
+}
+
+// Returns the message content found in the body (joining the chunks of a streamed body), and whether there was any
+func salvageContent(body []byte) (string, bool) {
+	var sb strings.Builder
+	for _, match := range contentPattern.FindAllSubmatch(body, -1) {
+		sb.WriteString(unescapeContent(string(match[1])))
+	}
+
+	text := strings.TrimSpace(sb.String())
+	return text, text != ""
+}
+
+// Decodes the escapes of a JSON string's contents (Ex: \n or é)
+// A string that was cut off can end in the middle of an escape, which is dropped
+func unescapeContent(escaped string) string {
+	for trimmed := 0; trimmed <= 6 && trimmed <= len(escaped); trimmed++ {
+		var text string
+		if json.Unmarshal([]byte(`"`+escaped[:len(escaped)-trimmed]+`"`), &text) == nil {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// PII scrubbing settings (loaded from environment variables in loadScrubbing)
+var (
+	// Whether the saved transcript has personal details removed (SCRUB_PII=true)
+	// Models can make up names, emails, and phone numbers, so this should be on before sharing transcripts publicly
+	scrubEnabled = os.Getenv("SCRUB_PII") == "true"
+
+	// Extra names that are always replaced (Ex: "Jane Doe,John Smith")
+	scrubNames []string
+)
+
+// Patterns of personal details, replaced in order (so an email isn't also matched as a URL)
+var piiPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{"url", regexp.MustCompile(`https?://[^\s"]*[^\s".,;:!?)]`)},
+	{"ssn", regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{"card", regexp.MustCompile(`\b(?:\d[ -]?){13,16}\b`)},
+	{"phone", regexp.MustCompile(`(?:\+?1[ .-]?)?\(?\b\d{3}\)?[ .-]?\d{3}[ .-]?\d{4}\b`)},
+	{"ip", regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)},
+}
+
+// Titles followed by a name (Ex: "Dr. Jane Doe" or "Father O'Brien")
+var titledName = regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Dr|Prof|Professor|Rev|Father|Sister|Brother|Imam|Rabbi|Pastor|Sheikh)\.? ([A-Z][a-z'-]+(?: [A-Z][a-z'-]+)?)`)
+
+// Loads the PII scrubbing settings from the environment variables
+func loadScrubbing() {
+	for _, name := range strings.Split(os.Getenv("SCRUB_NAMES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			scrubNames = append(scrubNames, name)
+		}
+	}
+}
+
+// Replaces personal details in text, giving each different name its own placeholder
+type Scrubber struct {
+	// Placeholder of every name found so far (Ex: "Jane Doe" -> "[PERSON_1]")
+	people map[string]string
+
+	// How many details of each kind were replaced
+	Counts map[string]int
+}
+
+func NewScrubber() *Scrubber {
+	return &Scrubber{people: make(map[string]string), Counts: make(map[string]int)}
+}
+
+// Returns the text with every personal detail replaced by a placeholder
+func (s *Scrubber) scrub(text string) string {
+	for _, p := range piiPatterns {
+		text = p.pattern.ReplaceAllStringFunc(text, func(string) string {
+			s.Counts[p.kind]++
+			return "[" + strings.ToUpper(p.kind) + "]"
+		})
+	}
+
+	// Titled names keep their title, so the text still reads naturally
+	text = titledName.ReplaceAllStringFunc(text, func(match string) string {
+		name := titledName.FindStringSubmatch(match)[1]
+		return strings.TrimSuffix(match, name) + s.person(name)
+	})
+
+	for _, name := range scrubNames {
+		if strings.Contains(text, name) {
+			text = strings.ReplaceAll(text, name, s.person(name))
+		}
+	}
+
+	return text
+}
+
+// Returns a copy of any JSON value with every string in it scrubbed (structs come back as maps, which save the same way)
+func (s *Scrubber) scrubValue(value any) any {
+	data, err := json.Marshal(value)
+	check(err)
+
+	var decoded any
+	check(json.Unmarshal(data, &decoded))
+	return s.scrubDecoded(decoded)
+}
+
+// Scrubs every string inside a decoded JSON value (map keys are field names, so they are kept)
+func (s *Scrubber) scrubDecoded(value any) any {
+	switch v := value.(type) {
+	case string:
+		return s.scrub(v)
+	case []any:
+		for i, item := range v {
+			v[i] = s.scrubDecoded(item)
+		}
+	case map[string]any:
+		for key, item := range v {
+			v[key] = s.scrubDecoded(item)
+		}
+	}
+	return value
+}
+
+// Returns the placeholder for the name (the same name always gets the same placeholder)
+func (s *Scrubber) person(name string) string {
+	s.Counts["name"]++
+	if placeholder, exists := s.people[name]; exists {
+		return placeholder
+	}
+	placeholder := fmt.Sprintf("[PERSON_%d]", len(s.people)+1)
+	s.people[name] = placeholder
+	return placeholder
+}
+
+// Returns a copy of the transcript with personal details removed from every turn, alternative, fact, glossary entry, and metadata value
+// The topic and personas are kept, since they are chosen by whoever runs the debate
+func (t *Transcript) scrubbed() *Transcript {
+	s := NewScrubber()
+
+	clean := *t
+	clean.Turns = make([]Turn, len(t.Turns))
+	for i, turn := range t.Turns {
+		turn.Content = s.scrub(turn.Content)
+		turn.Reasoning = s.scrub(turn.Reasoning)
+
+		alternatives := make([]string, len(turn.Alternatives))
+		for j, alternative := range turn.Alternatives {
+			alternatives[j] = s.scrub(alternative)
+		}
+		if len(alternatives) > 0 {
+			turn.Alternatives = alternatives
+		}
+		clean.Turns[i] = turn
+	}
+
+	clean.Facts = make([]Fact, len(t.Facts))
+	for i, fact := range t.Facts {
+		fact.Text = s.scrub(fact.Text)
+		clean.Facts[i] = fact
+	}
+
+	clean.Glossary = make([]GlossaryEntry, len(t.Glossary))
+	for i, entry := range t.Glossary {
+		entry.Term = s.scrub(entry.Term)
+		entry.Definition = s.scrub(entry.Definition)
+		clean.Glossary[i] = entry
+	}
+
+	// Events and evidence in the metadata quote the turns, so they are scrubbed too
+	// Then record what was scrubbed (without the original values)
+	clean.Metadata = make(map[string]any, len(t.Metadata)+1)
+	for key, value := range t.Metadata {
+		clean.Metadata[key] = s.scrubValue(value)
+	}
+	clean.Metadata["pii_scrubbed"] = s.Counts
+
+	return &clean
+}
+
+// Returns a copy of the argument graph with the PII scrubbed from every turn and claim
+func (g *DebateGraph) scrubbed() *DebateGraph {
+	s := NewScrubber()
+
+	clean := *g
+	clean.Turns = make([]GraphTurn, len(g.Turns))
+	for i, turn := range g.Turns {
+		turn.Content = s.scrub(turn.Content)
+		clean.Turns[i] = turn
+	}
+
+	clean.Claims = make([]GraphClaim, len(g.Claims))
+	for i, claim := range g.Claims {
+		claim.Text = s.scrub(claim.Text)
+		clean.Claims[i] = claim
+	}
+
+	return &clean
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// Transcript of an earlier debate that both histories start from (SEED_TRANSCRIPT, nothing is seeded if empty)
+	seedFile = os.Getenv("SEED_TRANSCRIPT")
+
+	// What the new debate does with the earlier one: continue, rebut, or reframe (SEED_MODE)
+	seedMode string
+
+	// Earlier debate, loaded at startup
+	seedTranscript *Transcript
+)
+
+// Instruction added to both system messages for each seed mode
+var seedInstructions = map[string]string{
+	"continue": "Continue it from where it left off, building on what was already said without repeating it.",
+	"rebut":    "Focus on rebutting the strongest arguments your opponent made in it.",
+	"reframe":  "Reframe the question from a new angle instead of going over the same arguments again.",
+}
+
+// Most tokens of each debater's earlier statement that are repeated in their system message
+const seedStatementTokens = 150
+
+// Loads the earlier debate from SEED_TRANSCRIPT (if one is given)
+// If the mode is not valid, continue the debate
+func loadSeed() {
+	seedMode = strings.ToLower(strings.TrimSpace(os.Getenv("SEED_MODE")))
+	if _, valid := seedInstructions[seedMode]; !valid {
+		seedMode = "continue"
+	}
+	if seedFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(seedFile)
+	check(err)
+	seedTranscript = &Transcript{}
+	check(json.Unmarshal(data, seedTranscript))
+
+	// The topic and personas carry over, unless new ones were given
+	if topic == "" {
+		topic = seedTranscript.Topic
+	}
+	if religion0 == "" && religion1 == "" {
+		religion0, religion1 = seedTranscript.Personas[0], seedTranscript.Personas[1]
+	}
+	fmt.Fprintf(console, "Seeded from %s: %d earlier turns on '%s' (%s)\n", seedFile, len(seedTranscript.Turns), seedTranscript.Topic, seedMode)
+}
+
+// Returns the instruction about the earlier debate for the debater's system message (empty if nothing is seeded)
+// It includes the debater's own last statement, since the prompts only show the opponent's
+func seedSection(id int) string {
+	if seedTranscript == nil {
+		return ""
+	}
+
+	section := fmt.Sprintf(" This debate follows an earlier one on: %s. %s", seedTranscript.Topic, seedInstructions[seedMode])
+	for i := len(seedTranscript.Turns) - 1; i >= 0; i-- {
+		if turn := seedTranscript.Turns[i]; turn.Speaker == id {
+			section += fmt.Sprintf(" Your last statement in it was: \"%s\".", truncateToTokens(turn.Content, seedStatementTokens))
+			break
+		}
+	}
+	return section
+}
+
+// Adds every turn of the earlier debate to the speaker's history, so the first turn answers the last earlier statement
+// Debaters keep their speaker number, even if their persona or model changed
+func (e *DebateEngine) Seed(turns []Turn) {
+	for _, turn := range turns {
+		if turn.Speaker < 0 || turn.Speaker > 1 || turn.Content == "" {
+			continue
+		}
+		e.Histories[turn.Speaker] = append(e.Histories[turn.Speaker], ChatMessage{Role: "assistant", Content: turn.Content})
+	}
+
+	for id := range 2 {
+		if was := seedTranscript.Personas[id]; was != "" && was != e.Personas[id] {
+			fmt.Fprintf(console, "LLM %d speaks from a %s perspective (was %s in the earlier debate)\n", id, e.Personas[id], was)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// File with the stylistic constraints of each persona (PERSONA_FILE, nothing is constrained if empty)
+var personaFile = os.Getenv("PERSONA_FILE")
+
+// Stylistic constraints of a persona, loaded from PERSONA_FILE
+// Ex: {"Catholic": {"reading_level": 8, "banned_phrases": ["heretic"], "required_framing": "As a Catholic"}}
+type PersonaStyle struct {
+	// Highest Flesch-Kincaid grade level a response can have (0 means no limit)
+	ReadingLevel float64 `json:"reading_level"`
+
+	// Phrases the persona can never use (compared without case)
+	BannedPhrases []string `json:"banned_phrases"`
+
+	// Phrase every response has to include (Ex: "As a Catholic")
+	RequiredFraming string `json:"required_framing"`
+}
+
+// Constraints of each persona, keyed by the lowercase persona name
+var personaStyles = make(map[string]PersonaStyle)
+
+// Something a response broke that the style guard could not fix
+type StyleViolation struct {
+	Round      int      `json:"round"`
+	Speaker    int      `json:"speaker"`
+	Violations []string `json:"violations"`
+}
+
+// Loads the persona constraints from PERSONA_FILE
+// The program ends if the file was given but can't be read, so a debate never runs without the constraints it was meant to have
+func loadPersonaStyles() {
+	if personaFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(personaFile)
+	check(err)
+
+	styles := make(map[string]PersonaStyle)
+	err = json.Unmarshal(data, &styles)
+	check(err)
+
+	for persona, style := range styles {
+		personaStyles[strings.ToLower(strings.TrimSpace(persona))] = style
+	}
+}
+
+// Returns the constraints of the persona, and whether it has any
+func styleFor(persona string) (PersonaStyle, bool) {
+	style, found := personaStyles[strings.ToLower(strings.TrimSpace(persona))]
+	return style, found
+}
+
+// Returns the system prompt instructions for the constraints (added to the persona's system message)
+func (s PersonaStyle) instructions() string {
+	var sb strings.Builder
+	if s.ReadingLevel > 0 {
+		fmt.Fprintf(&sb, " Write at or below a grade %g reading level, using short sentences and simple words.", s.ReadingLevel)
+	}
+	if len(s.BannedPhrases) > 0 {
+		fmt.Fprintf(&sb, " Never use these phrases: \"%s\".", strings.Join(s.BannedPhrases, "\", \""))
+	}
+	if s.RequiredFraming != "" {
+		fmt.Fprintf(&sb, " Every statement must include the framing \"%s\".", s.RequiredFraming)
+	}
+	return sb.String()
+}
+
+// Returns every constraint the response breaks (empty if it follows all of them)
+func (s PersonaStyle) validate(response string) []string {
+	violations := []string{}
+	lower := strings.ToLower(response)
+
+	if s.ReadingLevel > 0 {
+		if grade := readingGrade(response); grade > s.ReadingLevel {
+			violations = append(violations, fmt.Sprintf("reading level is grade %.1f, above grade %g", grade, s.ReadingLevel))
+		}
+	}
+	for _, phrase := range s.BannedPhrases {
+		if phrase != "" && strings.Contains(lower, strings.ToLower(phrase)) {
+			violations = append(violations, fmt.Sprintf("uses the banned phrase \"%s\"", phrase))
+		}
+	}
+	if s.RequiredFraming != "" && !strings.Contains(lower, strings.ToLower(s.RequiredFraming)) {
+		violations = append(violations, fmt.Sprintf("is missing the framing \"%s\"", s.RequiredFraming))
+	}
+
+	return violations
+}
+
+// Returns the Flesch-Kincaid grade level of the text (0 if it has no words)
+func readingGrade(text string) float64 {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return 0
+	}
+
+	syllables := 0
+	for _, word := range words {
+		syllables += countSyllables(word)
+	}
+	sentences := max(len(splitSentences(text)), 1)
+
+	return 0.39*float64(len(words))/float64(sentences) + 11.8*float64(syllables)/float64(len(words)) - 15.59
+}
+
+// Estimates the syllables in a word by counting its groups of vowels (a silent 'e' at the end doesn't count)
+// Every word has at least one syllable
+func countSyllables(word string) int {
+	word = strings.TrimFunc(strings.ToLower(word), func(r rune) bool { return r < 'a' || r > 'z' })
+
+	count := 0
+	previousVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !previousVowel {
+			count++
+		}
+		previousVowel = vowel
+	}
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && count > 1 {
+		count--
+	}
+
+	return max(count, 1)
+}
+
+// Plugin that checks every response against its persona's constraints, re-prompting once if it breaks any of them
+// Anything still broken after the re-prompt is recorded (so it should be registered after moderation, which can rewrite the response)
+type StyleGuard struct {
+	Violations []StyleViolation
+}
+
+func (g *StyleGuard) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		style, found := styleFor(turn.Persona)
+		if !found {
+			return
+		}
+
+		violations := style.validate(turn.Response)
+		if len(violations) == 0 {
+			return
+		}
+
+		fmt.Fprintf(console, "\n(LLM %d broke its persona's style: %s. Asking for a rewrite.)", turn.Speaker, strings.Join(violations, "; "))
+
+		retryHistory := append(turn.History[:len(turn.History):len(turn.History)],
+			ChatMessage{Role: "assistant", Content: turn.Response},
+			ChatMessage{Role: "user", Content: fmt.Sprintf(
+				"Your reply %s. Rewrite it so it follows every style rule, keeping your main point.", strings.Join(violations, ", and "))},
+		)
+		response, used := sendRequestTemperature(turn.Model, retryHistory, turn.Temperature)
+		var retryTokens int
+		turn.Response, retryTokens = enforceBudget(turn.Model, retryHistory, response, turn.Words)
+		turn.Tokens += used + retryTokens
+
+		if violations = style.validate(turn.Response); len(violations) > 0 {
+			fmt.Fprintf(console, "\n(LLM %d still broke its persona's style: %s.)", turn.Speaker, strings.Join(violations, "; "))
+			g.Violations = append(g.Violations, StyleViolation{Round: turn.Round, Speaker: turn.Speaker, Violations: violations})
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Whether each debater reasons privately before every turn (THINK=true)
+	thinkEnabled = os.Getenv("THINK") == "true"
+
+	// Most words the private reasoning can have (THINK_WORDS)
+	thinkWords int
+)
+
+// Loads the thinking settings from the environment variables
+// If they are not valid, use default values
+func loadThinking() {
+	var err error
+
+	thinkWords, err = strconv.Atoi(os.Getenv("THINK_WORDS"))
+	if err != nil || thinkWords <= 0 {
+		thinkWords = 100
+	}
+}
+
+// Has the debater reason about the turn before answering, with the same system message and prompt as the public call
+// The reasoning is only added to this debater's prompt for the turn, so the opponent never sees it
+// Returns the reasoning and the completion tokens it used
+func think(turn *TurnContext) (string, int) {
+	prompt := turn.History[len(turn.History)-1].Content
+	history := []ChatMessage{
+		turn.History[0],
+		{
+			Role: "user",
+			Content: fmt.Sprintf("You are about to answer this: \"%s\" Before answering, think privately in at most %d words: "+
+				"what is your opponent's weakest point, what is your strongest reply, and what evidence supports it? "+
+				"Nobody else will read this, so only write your reasoning, not the statement itself.", prompt, thinkWords),
+		},
+	}
+	return sendRequestTemperature(turn.Model, history, turn.Temperature)
+}
+
+// Returns the public prompt conditioned on the debater's private reasoning
+func promptWithReasoning(prompt, reasoning string) string {
+	return prompt + fmt.Sprintf(" Your private reasoning for this turn (your opponent cannot see it, so do not mention it): \"%s\"",
+		strings.TrimSpace(reasoning))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Tone settings (loaded from environment variables in loadTone)
+var (
+	// Whether a tone was given (TONE), either one for both debaters or one per debater (Ex: "calm,heated")
+	toneEnabled = os.Getenv("TONE") != ""
+
+	// Whether every round is checked for personal attacks (on with TONE, unless TONE_CHECK=false)
+	toneCheckEnabled bool
+
+	// Tone of each debater (calm unless TONE is set)
+	debaterTones [2]Tone
+)
+
+// How a debater argues, and the temperature their turns are generated at
+type Tone struct {
+	Name        string
+	Instruction string
+
+	// Generation temperature (0 uses the server's default)
+	Temperature float64
+}
+
+// Every supported tone, from the calmest to the most heated
+var tones = map[string]Tone{
+	"calm": {
+		Name:        "calm",
+		Instruction: "Be calm, factual, concise, and logical.",
+		Temperature: 0.3,
+	},
+	"assertive": {
+		Name:        "assertive",
+		Instruction: "Be confident, direct, and concise. State your position firmly and press your strongest points, while staying factual and logical.",
+		Temperature: 0.7,
+	},
+	"heated": {
+		Name:        "heated",
+		Instruction: "Argue passionately and forcefully. Challenge your opponent's reasoning head-on and concede nothing, but attack their arguments, never the person.",
+		Temperature: 1.0,
+	},
+	"socratic": {
+		Name:        "socratic",
+		Instruction: "Argue mainly through pointed questions that expose the weaknesses in your opponent's reasoning and lead toward your position, while staying calm and logical.",
+		Temperature: 0.6,
+	},
+}
+
+// Loads the tone settings from the environment variables
+// An unknown tone is replaced by calm
+func loadTone() {
+	calm := tones["calm"]
+
+	// Without TONE, debaters keep the calm instruction at the server's default temperature
+	if !toneEnabled {
+		calm.Temperature = 0
+		debaterTones = [2]Tone{calm, calm}
+		return
+	}
+
+	names := strings.Split(os.Getenv("TONE"), ",")
+	for id := range 2 {
+		// A single tone is used by both debaters
+		name := strings.ToLower(strings.TrimSpace(names[min(id, len(names)-1)]))
+
+		tone, known := tones[name]
+		if !known {
+			fmt.Fprintf(console, "TONE must be calm, assertive, heated, or socratic, '%s' is not. Using calm for LLM %d.\n", name, id)
+			tone = calm
+		}
+		debaterTones[id] = tone
+	}
+
+	toneCheckEnabled = os.Getenv("TONE_CHECK") != "false"
+}
+
+// Returns the name of each debater's tone (saved to the transcript)
+func toneNames() [2]string {
+	return [2]string{debaterTones[0].Name, debaterTones[1].Name}
+}
+
+// Something the tone check flagged during the debate
+type ToneNudge struct {
+	Round   int    `json:"round"`
+	Speaker int    `json:"speaker"`
+	Reason  string `json:"reason"`
+}
+
+// Plugin that checks every round for personal attacks, nudging a debater that drifted into them back on their next turn
+// Unlike moderation, nothing is rewritten, the debater is only reminded in their next prompt
+type ToneCheck struct {
+	Nudges []ToneNudge
+
+	// Final responses of the current round, by speaker
+	responses [2]string
+
+	// Reminder added to each debater's next prompt (empty if they don't need one)
+	reminders [2]string
+}
+
+// Reminds debaters before their turn, and collects the final responses (so it should be registered after moderation)
+func (c *ToneCheck) Register(e *DebateEngine) {
+	e.BeforeTurn(func(e *DebateEngine, turn *TurnContext) {
+		if c.reminders[turn.Speaker] != "" {
+			turn.PromptExtras = append(turn.PromptExtras, c.reminders[turn.Speaker])
+			c.reminders[turn.Speaker] = ""
+		}
+	})
+
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		c.responses[turn.Speaker] = turn.Response
+	})
+
+	e.AfterRound(func(e *DebateEngine, round int, phase Phase) {
+		// Nobody speaks after the last round, so there is no one to nudge
+		if round == e.Rounds {
+			return
+		}
+
+		for id, response := range c.responses {
+			ok, reason := checkTone(response)
+			if ok {
+				continue
+			}
+
+			fmt.Fprintf(console, "\n(Tone check: LLM %d drifted into personal attacks: %s. Reminding them next round.)", id, reason)
+			c.Nudges = append(c.Nudges, ToneNudge{Round: round, Speaker: id, Reason: reason})
+			c.reminders[id] = fmt.Sprintf(" Your last statement attacked your opponent personally (%s). "+
+				"Respond to their arguments, not to them, and keep a %s tone.", reason, debaterTones[id].Name)
+		}
+		c.responses = [2]string{}
+	})
+}
+
+// Asks the model whether the statement attacks the opponent personally instead of their arguments
+// Returns whether the statement is civil, and the reason if it is not
+func checkTone(response string) (bool, string) {
+	if response == "" {
+		return true, ""
+	}
+
+	verdict := sendRequest([]ChatMessage{
+		{
+			Role: "system",
+			Content: "You check debate statements for personal attacks: insults, mocking, or questioning the opponent's character " +
+				"or intelligence instead of their arguments. Forceful disagreement is fine. " +
+				"Reply CIVIL if there are no personal attacks, otherwise reply ATTACK followed by a short reason.",
+		},
+		{
+			Role:    "user",
+			Content: response,
+		},
+	})
+
+	// Whichever answer comes first is the verdict (the reason can mention the other word)
+	upper := strings.ToUpper(verdict)
+	attack, civil := strings.Index(upper, "ATTACK"), strings.Index(upper, "CIVIL")
+	if attack != -1 && (civil == -1 || attack < civil) {
+		reason := strings.TrimSpace(verdict[attack+len("ATTACK"):])
+		return false, strings.TrimLeft(reason, ":- ")
+	}
+	return true, ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Where the transcript gets saved at the end of the debate (nothing is saved if empty)
+var transcriptFile = os.Getenv("TRANSCRIPT_FILE")
+
+// A single turn of the debate
+type Turn struct {
+	Round   int    `json:"round"`
+	Phase   Phase  `json:"phase"`
+	Speaker int    `json:"speaker"`
+	Persona string `json:"persona"`
+	Content string `json:"content"`
+
+	// Candidate responses that were generated but not selected
+	Alternatives []string `json:"alternatives,omitempty"`
+
+	// Private reasoning the debater wrote before the turn (THINK=true)
+	Reasoning string `json:"reasoning,omitempty"`
+
+	// Model, temperature, seed, and limits the response was generated with (for comparing runs)
+	Generation *GenerationParams `json:"generation,omitempty"`
+}
+
+// Full record of a debate
+type Transcript struct {
+	Topic    string         `json:"topic"`
+	Personas [2]string      `json:"personas"`
+	Model    string         `json:"model"`
+	Turns    []Turn         `json:"turns"`
+	Facts    []Fact         `json:"facts,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+
+	// Technical terms used in the debate, with their definitions (GLOSSARY=true)
+	Glossary []GlossaryEntry `json:"glossary,omitempty"`
+
+	// How each debater argued, compared side by side (on unless STYLE_REPORT=false)
+	Styles *[2]StyleStats `json:"styles,omitempty"`
+}
+
+// Adds a turn to the transcript
+func (t *Transcript) addTurn(turn Turn) {
+	t.Turns = append(t.Turns, turn)
+}
+
+// Writes the transcript as JSON to the given file (with personal details removed if SCRUB_PII=true)
+func (t *Transcript) save(path string) {
+	if scrubEnabled {
+		t = t.scrubbed()
+	}
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	check(err)
+
+	err = os.WriteFile(path, data, 0644)
+	check(err)
+
+	fmt.Fprintf(console, "\nTranscript saved to %s\n", path)
+}
+
+// Saves every turn (and its alternatives if requested) to the transcript
+func (t *Transcript) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		saved := Turn{Round: turn.Round, Phase: turn.Phase, Speaker: turn.Speaker, Persona: turn.Persona, Content: turn.Response, Reasoning: turn.Reasoning}
+		params := generationParams(turn)
+		saved.Generation = &params
+		if saveBranches {
+			saved.Alternatives = turn.Alternatives
+		}
+		t.addTurn(saved)
+	})
+}
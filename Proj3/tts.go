@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Text-to-speech settings (loaded from environment variables in loadTTS)
+var (
+	// Whether each turn is read aloud and saved as audio (TTS=true)
+	ttsEnabled = os.Getenv("TTS") == "true"
+
+	// OpenAI-compatible server with an /audio/speech endpoint (defaults to BASE_URL)
+	// Local engines (Ex: Kokoro, Piper, or LocalAI) can be used by pointing this at their OpenAI-compatible server
+	ttsURL = os.Getenv("TTS_URL")
+
+	// Speech model and the voice of each debater (Ex: "alloy,onyx")
+	ttsModel  = os.Getenv("TTS_MODEL")
+	ttsVoices [2]string
+
+	// Audio format (mp3 or wav) and the directory the audio gets written to
+	ttsFormat = os.Getenv("TTS_FORMAT")
+	ttsOutput = os.Getenv("TTS_OUTPUT")
+)
+
+// Request sent to the /audio/speech endpoint
+type SpeechRequest struct {
+	Model          string `json:"model"`
+	Input          string `json:"input"`
+	Voice          string `json:"voice"`
+	ResponseFormat string `json:"response_format"`
+}
+
+// Loads the text-to-speech settings from the environment variables
+// If they are not valid, use default values
+func loadTTS() {
+	if ttsURL == "" {
+		ttsURL = BASE_URL
+	}
+	if ttsModel == "" {
+		ttsModel = "tts-1"
+	}
+	if ttsFormat != "wav" {
+		ttsFormat = "mp3"
+	}
+	if ttsOutput == "" {
+		ttsOutput = "audio"
+	}
+
+	// Each debater needs its own voice, so a missing or repeated voice falls back to the defaults
+	ttsVoices = [2]string{"alloy", "onyx"}
+	voices := strings.Split(os.Getenv("TTS_VOICES"), ",")
+	if len(voices) == 2 && strings.TrimSpace(voices[0]) != "" && strings.TrimSpace(voices[1]) != "" &&
+		strings.TrimSpace(voices[0]) != strings.TrimSpace(voices[1]) {
+		ttsVoices = [2]string{strings.TrimSpace(voices[0]), strings.TrimSpace(voices[1])}
+	}
+}
+
+// Plugin that reads every turn aloud, saving each clip and a combined recording of the debate
+type Narrator struct {
+	clips [][]byte
+}
+
+// Synthesizes every response once it is final (so it should be registered after moderation)
+func (n *Narrator) Register(e *DebateEngine) {
+	e.AfterTurn(func(e *DebateEngine, turn *TurnContext) {
+		audio, err := synthesize(turn.Response, ttsVoices[turn.Speaker])
+		if err != nil {
+			fmt.Fprintf(console, "\n(Text-to-speech failed for LLM %d: %s)", turn.Speaker, err)
+			return
+		}
+
+		// Save the clip for this turn
+		err = os.MkdirAll(ttsOutput, 0755)
+		check(err)
+		err = os.WriteFile(filepath.Join(ttsOutput, fmt.Sprintf("round%d-llm%d.%s", turn.Round, turn.Speaker, ttsFormat)), audio, 0644)
+		check(err)
+
+		n.clips = append(n.clips, audio)
+	})
+}
+
+// Writes every clip, in order, into a single recording of the debate
+func (n *Narrator) save() {
+	if len(n.clips) == 0 {
+		return
+	}
+
+	var combined []byte
+	if ttsFormat == "wav" {
+		var err error
+		combined, err = joinWAV(n.clips)
+		if err != nil {
+			fmt.Fprintln(console, "\nCould not combine the audio clips:", err)
+			return
+		}
+	} else {
+		// MP3 files are a series of frames, so they can be joined back to back
+		combined = bytes.Join(n.clips, nil)
+	}
+
+	path := filepath.Join(ttsOutput, "debate."+ttsFormat)
+	err := os.WriteFile(path, combined, 0644)
+	check(err)
+
+	fmt.Fprintf(console, "\nDebate audio saved to %s\n", path)
+}
+
+// Sends the text to the speech endpoint, returning the audio
+func synthesize(text, voice string) ([]byte, error) {
+	reqBytes, err := json.Marshal(SpeechRequest{Model: ttsModel, Input: text, Voice: voice, ResponseFormat: ttsFormat})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", ttsURL+"audio/speech", bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer API")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, audio)
+	}
+	return audio, nil
+}
+
+// Joins WAV clips into one WAV file (every clip must use the same sample format, which is true for a single engine)
+// The format of the first clip is kept, and the audio data of every clip is placed back to back
+func joinWAV(clips [][]byte) ([]byte, error) {
+	var format, data []byte
+
+	for i, clip := range clips {
+		clipFormat, clipData, err := parseWAV(clip)
+		if err != nil {
+			return nil, fmt.Errorf("clip %d: %w", i+1, err)
+		}
+		if format == nil {
+			format = clipFormat
+		}
+		data = append(data, clipData...)
+	}
+
+	// RIFF header, then the "fmt " chunk, then the "data" chunk
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(4+8+len(format)+8+len(data)))
+	out.WriteString("WAVE")
+	out.WriteString("fmt ")
+	binary.Write(&out, binary.LittleEndian, uint32(len(format)))
+	out.Write(format)
+	out.WriteString("data")
+	binary.Write(&out, binary.LittleEndian, uint32(len(data)))
+	out.Write(data)
+
+	return out.Bytes(), nil
+}
+
+// Returns the contents of the "fmt " and "data" chunks of a WAV file
+func parseWAV(clip []byte) ([]byte, []byte, error) {
+	if len(clip) < 12 || string(clip[0:4]) != "RIFF" || string(clip[8:12]) != "WAVE" {
+		return nil, nil, fmt.Errorf("not a WAV file")
+	}
+
+	var format, data []byte
+	for pos := 12; pos+8 <= len(clip); {
+		id := string(clip[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(clip[pos+4 : pos+8]))
+		start := pos + 8
+
+		// Streamed WAV files can have a placeholder size, so the data chunk runs to the end of the file
+		end := min(start+size, len(clip))
+		if id == "data" && size == 0xFFFFFFFF {
+			end = len(clip)
+		}
+
+		switch id {
+		case "fmt ":
+			format = clip[start:end]
+		case "data":
+			data = clip[start:end]
+		}
+
+		// Chunks are padded to an even size
+		pos = end + size%2
+	}
+
+	if format == nil || data == nil {
+		return nil, nil, fmt.Errorf("missing fmt or data chunk")
+	}
+	return format, data, nil
+}
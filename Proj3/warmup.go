@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Model that is used instead if a configured model is not available (nothing is switched if empty)
+var fallbackModel = os.Getenv("FALLBACK_MODEL")
+
+// Sends a one token completion to the model, returning how long it took to answer
+// It goes through the same retries, failover, and rate limits as every other request,
+// but problems are returned instead of ending the program, so a fallback can be tried
+func pingModel(modelName string) (time.Duration, error) {
+
+	// Servers answer an unknown model with an error status (usually 404) and a message saying why
+	body, latency, err := tryCompleteChat(ChatRequest{
+		Model:     modelName,
+		Messages:  []ChatMessage{{Role: "user", Content: "Reply with OK."}},
+		MaxTokens: 1,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var chatResp ChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return 0, err
+	}
+	if len(chatResp.Choices) == 0 {
+		return 0, fmt.Errorf("no response")
+	}
+
+	return latency, nil
+}
+
+// Makes sure the model (set by the env variable) answers, switching to FALLBACK_MODEL if it doesn't
+// Ends the program with a clear message if neither model is available
+// Returns the model to use and its baseline latency
+func checkModel(env, modelName string) (string, time.Duration) {
+	latency, err := pingModel(modelName)
+	if err == nil {
+		fmt.Fprintf(console, "Model %s (%s) is available, baseline latency %s\n", modelName, env, latency.Round(time.Millisecond))
+		return modelName, latency
+	}
+	fmt.Fprintf(console, "Model %s (%s) is not available: %s\n", modelName, env, err)
+
+	if fallbackModel == "" || fallbackModel == modelName {
+		log.Fatalf("Check that %s is a model served at %s, or set FALLBACK_MODEL.", env, BASE_URL)
+	}
+
+	latency, err = pingModel(fallbackModel)
+	if err != nil {
+		log.Fatalf("FALLBACK_MODEL %s is not available either: %s", fallbackModel, err)
+	}
+	fmt.Fprintf(console, "Switching %s to FALLBACK_MODEL %s, baseline latency %s\n", env, fallbackModel, latency.Round(time.Millisecond))
+	return fallbackModel, latency
+}
+
+// Pings every configured model before the debate starts, so a bad model name is found now instead of on the first turn
+// Returns the baseline latency of each model
+func warmUpModels() map[string]string {
+	latencies := make(map[string]string)
+
+	debateModel := model
+	var latency time.Duration
+	model, latency = checkModel("MODEL", model)
+	latencies[model] = latency.String()
+
+	// Models that default to the debate model follow it if that one gets switched, and any other model is checked on its own
+	follow := func(env string, modelName *string) {
+		if *modelName == debateModel {
+			*modelName = model
+		} else if _, checked := latencies[*modelName]; !checked {
+			*modelName, latency = checkModel(env, *modelName)
+			latencies[*modelName] = latency.String()
+		}
+	}
+	follow("SELECTOR_MODEL", &selectorModel)
+
+	// Both compared models need to answer (they replace MODEL for the debaters)
+	if compareEnabled {
+		for i, compared := range compareModels {
+			if _, checked := latencies[compared]; !checked {
+				compareModels[i], latency = checkModel("COMPARE_MODELS", compared)
+				latencies[compareModels[i]] = latency.String()
+			}
+		}
+	}
+
+	// So do the judge, the drift check's moderator, the paraphraser, and the persona checker
+	if judgeEnabled || compareEnabled {
+		follow("JUDGE_MODEL", &judgeModel)
+	}
+	if driftEnabled {
+		follow("DRIFT_MODEL", &driftModel)
+	}
+	if paraphraseEnabled {
+		follow("PARAPHRASE_MODEL", &paraphraseModel)
+	}
+	if personaCheckEnabled && personaCheckMethod == "model" {
+		follow("PERSONA_CHECK_MODEL", &personaCheckModel)
+	}
+
+	// The embedding model also defaults to the debate model, but it can't answer a chat completion to be checked,
+	// so it only follows the switch (a failing embeddings endpoint already turns off the checks that use it)
+	if embeddingModel == debateModel {
+		embeddingModel = model
+	}
+
+	return latencies
+}